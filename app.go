@@ -125,9 +125,16 @@ func ProcessEvent(app *gopi.AppInstance, server gopi.RPCServer, discovery gopi.R
 	// Obtain discovery unit
 	switch evt.Type() {
 	case gopi.RPC_EVENT_SERVER_STARTED:
-		if service, subtype, name, err := app.Service(); err != nil {
+		service, subtype, name, err := app.Service()
+		if err != nil {
 			return err
-		} else if service_ := server.Service(service, subtype, name); service_ == nil {
+		}
+		// The name defaults to the hostname, and is set so that several
+		// servers can be registered on one machine
+		if name_, _ := app.AppFlags.GetString("rpc.name"); name_ != "" {
+			name = name_
+		}
+		if service_ := server.Service(service, subtype, name); service_ == nil {
 			return fmt.Errorf("Unable to create service record")
 		} else if discovery == nil {
 			return nil
@@ -0,0 +1,43 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func ListCrashReports(args []string, gaffer rpc.GafferClient, discovery rpc.DiscoveryClient) error {
+	if len(args) != 1 {
+		return gopi.ErrBadParameter
+	} else if reports, err := gaffer.ListCrashReports(list_filter.Service); err != nil {
+		return err
+	} else {
+		return OutputCrashReports(os.Stdout, reports)
+	}
+}
+
+func CrashReportCommands(args []string, gaffer rpc.GafferClient, discovery rpc.DiscoveryClient) error {
+	if len(args) != 1 {
+		return gopi.ErrBadParameter
+	} else if id, err := strconv.ParseUint(strings.TrimPrefix(args[0], "%"), 10, 64); err != nil {
+		return gopi.ErrBadParameter
+	} else if report, err := gaffer.GetCrashReport(id); err != nil {
+		return err
+	} else {
+		return OutputCrashReport(os.Stdout, report)
+	}
+}
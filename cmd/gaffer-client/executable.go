@@ -0,0 +1,63 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package main
+
+import (
+	"os"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func ExecutableCommands(args []string, gaffer rpc.GafferClient, discovery rpc.DiscoveryClient) error {
+	// Obtain the executable name
+	exec := reExecutable.FindStringSubmatch(args[0])
+	if len(exec) != 2 {
+		return gopi.ErrBadParameter
+	}
+
+	// Parse arguments
+	if len(args) < 2 {
+		return gopi.ErrBadParameter
+	}
+	switch args[1] {
+	case "add":
+		return AddService(args, gaffer, discovery)
+	case "upload":
+		if len(args) != 3 {
+			return gopi.ErrBadParameter
+		} else if fh, err := os.Open(args[2]); err != nil {
+			return err
+		} else {
+			defer fh.Close()
+			if executable, err := gaffer.UploadExecutable(exec[1], fh); err != nil {
+				return err
+			} else {
+				return OutputExecutables(os.Stdout, []rpc.GafferExecutable{executable})
+			}
+		}
+	case "rollback":
+		checksum := ""
+		if len(args) == 3 {
+			checksum = args[2]
+		} else if len(args) != 2 {
+			return gopi.ErrBadParameter
+		}
+		if executable, err := gaffer.RollbackExecutable(exec[1], checksum); err != nil {
+			return err
+		} else {
+			return OutputExecutables(os.Stdout, []rpc.GafferExecutable{executable})
+		}
+	default:
+		return gopi.ErrBadParameter
+	}
+}
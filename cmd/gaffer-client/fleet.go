@@ -0,0 +1,465 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Node is a gaffer service discovered on the network. Err is set when the
+// node could not be reached, or when a command failed on the node
+type Node struct {
+	Name      string
+	Labels    rpc.Tuples
+	Record    gopi.RPCServiceRecord
+	Gaffer    rpc.GafferClient
+	Discovery rpc.DiscoveryClient
+	Err       error
+}
+
+// nodeEvent is an event streamed from a node
+type nodeEvent struct {
+	node string
+	evt  rpc.GafferEvent
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+var (
+	// fleet_commands are called on every node at once, and the results are
+	// merged with a node column. Other commands are called on each node
+	// chosen with the -node and -nodeselector flags in turn
+	fleet_commands = map[string]func([]string, []*Node) error{
+		"":              FleetListInstances,
+		"/":             FleetListExecutables,
+		"@":             FleetListGroups,
+		"~ (<type>)...": FleetListEvents,
+		"%":             FleetListCrashReports,
+		"^ (<method>)":  FleetListAudit,
+	}
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Fleet returns the nodes discovered on the network which match the -node
+// and -nodeselector flags, and connects to each node at once. Nodes which
+// could not be reached are returned with an error
+func Fleet(app *gopi.AppInstance) ([]*Node, error) {
+	addr, _ := app.AppFlags.GetString("addr")
+	name, _ := app.AppFlags.GetString("node")
+	selector, _ := app.AppFlags.GetString("nodeselector")
+	timeout, exists := app.AppFlags.GetDuration("rpc.timeout")
+	if exists == false {
+		timeout = DISCOVERY_TIMEOUT
+	}
+
+	// Check the node name and selector
+	if _, err := path.Match(name, ""); err != nil {
+		return nil, fmt.Errorf("Invalid -node value: %v", strconv.Quote(name))
+	}
+	selector_, err := rpc.ParseLabelSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	// Discover the nodes
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	service, _, _, err := app.Service()
+	if err != nil {
+		return nil, err
+	}
+	pool := app.ModuleInstance("rpc/clientpool").(gopi.RPCClientPool)
+	records, err := pool.Lookup(ctx, fmt.Sprintf("_%v._tcp", service), addr, 0)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]*Node, 0, len(records))
+	for _, record := range records {
+		node := &Node{
+			Name:   record.Name(),
+			Labels: rpc.LabelsForText(record.Text()),
+			Record: record,
+		}
+		if name != "" {
+			if matched, _ := path.Match(name, node.Name); matched == false {
+				continue
+			}
+		}
+		if selector_.Matches(node.Labels) {
+			nodes = append(nodes, node)
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("No nodes match -node or -nodeselector")
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+
+	// Connect to the nodes
+	FanOut(nodes, func(i int, node *Node) error {
+		if gaffer, err := GafferStub(app, node.Record); err != nil {
+			return err
+		} else if discovery, err := DiscoveryStub(app, node.Record); err != nil {
+			return err
+		} else {
+			node.Gaffer, node.Discovery = gaffer, discovery
+			return nil
+		}
+	})
+
+	// Success
+	return nodes, nil
+}
+
+// FanOut calls a function for each node which can be reached at once, and
+// sets the error for a node when the function fails
+func FanOut(nodes []*Node, fn func(int, *Node) error) {
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		if node.Err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, node *Node) {
+			defer wg.Done()
+			if err := fn(i, node); err != nil {
+				node.Err = err
+			}
+		}(i, node)
+	}
+	wg.Wait()
+}
+
+// ReportNodes writes the error for each node which could not be reached or
+// where the command failed, and returns the number of nodes with errors
+func ReportNodes(fh io.Writer, nodes []*Node) int {
+	failed := 0
+	for _, node := range nodes {
+		if node.Err != nil {
+			fmt.Fprintf(fh, "%v: %v\n", node.Name, node.Err)
+			failed++
+		}
+	}
+	return failed
+}
+
+// ReportList reports the nodes which could not be listed, and returns an
+// error when no nodes could be listed
+func ReportList(nodes []*Node) error {
+	if ReportNodes(os.Stderr, nodes) == len(nodes) {
+		return fmt.Errorf("No nodes could be reached")
+	} else {
+		return nil
+	}
+}
+
+func RunFleet(app *gopi.AppInstance, nodes []*Node) error {
+	// Get command
+	args := app.AppFlags.Args()
+	command, err := CommandFromArgs(args)
+	if err != nil {
+		return err
+	}
+
+	// Set filter and queries
+	if err := SetQueriesFromFlags(app.AppFlags); err != nil {
+		return err
+	}
+
+	// Call command on every node and merge the results
+	go WaitForInterrupt(app)
+	if fn, exists := fleet_commands[command.Name]; exists {
+		return UsageError(app, command, fn(args, nodes))
+	}
+
+	// Other commands change nodes, which need to be chosen
+	name, _ := app.AppFlags.GetString("node")
+	selector, _ := app.AppFlags.GetString("nodeselector")
+	if name == "" && selector == "" {
+		return fmt.Errorf("Use -node or -nodeselector to choose the nodes for this command")
+	}
+	return UsageError(app, command, FleetCall(args, nodes, command.Callback))
+}
+
+// FleetCall calls a command on each node in turn, writing the node name
+// before the output of the command
+func FleetCall(args []string, nodes []*Node, callback func([]string, rpc.GafferClient, rpc.DiscoveryClient) error) error {
+	for _, node := range nodes {
+		if node.Err != nil {
+			continue
+		}
+		fmt.Fprintf(os.Stdout, "%v:\n", node.Name)
+		if err := callback(append([]string{}, args...), node.Gaffer, node.Discovery); err == gopi.ErrBadParameter {
+			return err
+		} else if err != nil {
+			node.Err = err
+		}
+	}
+	if failed := ReportNodes(os.Stderr, nodes); failed > 0 {
+		return fmt.Errorf("Failed on %v of %v nodes", failed, len(nodes))
+	}
+
+	// Success
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func FleetListInstances(args []string, nodes []*Node) error {
+	instances := make([][]rpc.GafferServiceInstance, len(nodes))
+	FanOut(nodes, func(i int, node *Node) (err error) {
+		instances[i], err = node.Gaffer.ListInstancesWithFilter(list_filter)
+		return
+	})
+	rows := make([][]string, 0)
+	for i, node := range nodes {
+		for _, instance := range instances[i] {
+			rows = append(rows, append([]string{node.Name}, InstanceRow(instance)...))
+		}
+	}
+	if len(rows) == 0 {
+		return FleetListServices(args, nodes)
+	} else if err := OutputFleet(os.Stdout, InstanceHeader, rows); err != nil {
+		return err
+	} else {
+		return ReportList(nodes)
+	}
+}
+
+func FleetListServices(args []string, nodes []*Node) error {
+	services := make([][]rpc.GafferService, len(nodes))
+	FanOut(nodes, func(i int, node *Node) (err error) {
+		services[i], err = node.Gaffer.ListServicesWithFilter(list_filter)
+		return
+	})
+	rows := make([][]string, 0)
+	for i, node := range nodes {
+		for _, service := range services[i] {
+			rows = append(rows, append([]string{node.Name}, ServiceRow(service)...))
+		}
+	}
+	if err := ReportList(nodes); err != nil {
+		return err
+	} else if len(rows) == 0 {
+		return fmt.Errorf("No services")
+	} else {
+		return OutputFleet(os.Stdout, ServiceHeader, rows)
+	}
+}
+
+func FleetListGroups(args []string, nodes []*Node) error {
+	groups := make([][]rpc.GafferServiceGroup, len(nodes))
+	FanOut(nodes, func(i int, node *Node) (err error) {
+		groups[i], err = node.Gaffer.ListGroupsWithFilter(list_filter)
+		return
+	})
+	rows := make([][]string, 0)
+	for i, node := range nodes {
+		for _, group := range groups[i] {
+			rows = append(rows, append([]string{node.Name}, GroupRow(group)...))
+		}
+	}
+	if len(rows) > 0 {
+		if err := OutputFleet(os.Stdout, GroupHeader, rows); err != nil {
+			return err
+		}
+	}
+	return ReportList(nodes)
+}
+
+func FleetListExecutables(args []string, nodes []*Node) error {
+	executables := make([][]rpc.GafferExecutable, len(nodes))
+	FanOut(nodes, func(i int, node *Node) (err error) {
+		executables[i], err = node.Gaffer.ListExecutables()
+		return
+	})
+	rows := make([][]string, 0)
+	for i, node := range nodes {
+		for _, executable := range executables[i] {
+			rows = append(rows, append([]string{node.Name}, ExecutableRow(executable)...))
+		}
+	}
+	if err := OutputFleet(os.Stdout, ExecutableHeader, rows); err != nil {
+		return err
+	} else {
+		return ReportList(nodes)
+	}
+}
+
+// FleetListEvents lists events from every node in time order, or streams
+// events from every node with the "tail" argument
+func FleetListEvents(args []string, nodes []*Node) error {
+	if len(args) > 1 && args[1] == "tail" {
+		if filter, err := StreamFilterFromArgs(args[2:]); err != nil {
+			return err
+		} else {
+			return FleetStreamEvents(nodes, filter)
+		}
+	}
+
+	// Filter by event types
+	query := event_query
+	if types, err := EventTypesFromArgs(args[1:]); err != nil {
+		return err
+	} else {
+		query.Types = types
+	}
+
+	// Merge events in time order
+	events := make([][]rpc.GafferEvent, len(nodes))
+	FanOut(nodes, func(i int, node *Node) (err error) {
+		events[i], err = node.Gaffer.QueryEvents(query)
+		return
+	})
+	merged := make([]nodeEvent, 0)
+	for i, node := range nodes {
+		for _, evt := range events[i] {
+			merged = append(merged, nodeEvent{node.Name, evt})
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].evt.Timestamp().Before(merged[j].evt.Timestamp())
+	})
+	rows := make([][]string, len(merged))
+	for i, evt := range merged {
+		rows[i] = append([]string{evt.node}, EventRow(evt.evt)...)
+	}
+	if err := OutputFleet(os.Stdout, EventHeader, rows); err != nil {
+		return err
+	} else {
+		return ReportList(nodes)
+	}
+}
+
+// FleetStreamEvents writes events from every node as they are received,
+// until the streams end or CTRL+C is pressed
+func FleetStreamEvents(nodes []*Node, filter rpc.GafferFilter) error {
+	// Report nodes which could not be reached
+	if ReportNodes(os.Stderr, nodes) == len(nodes) {
+		return fmt.Errorf("No nodes could be reached")
+	}
+
+	// Stream events from the other nodes
+	events := make(chan nodeEvent)
+	done := make(chan *Node)
+	streams := 0
+	for _, node := range nodes {
+		if node.Err != nil {
+			continue
+		}
+		streams++
+		go func(node *Node) {
+			evts := make(chan rpc.GafferEvent)
+			go func() {
+				for evt := range evts {
+					events <- nodeEvent{node.Name, evt}
+				}
+			}()
+			err := node.Gaffer.StreamEventsWithFilter(filter, evts)
+			close(evts)
+			node.Err = err
+			done <- node
+		}(node)
+	}
+
+	for streams > 0 {
+		select {
+		case evt := <-events:
+			OutputStreamEvent(os.Stdout, evt.node, evt.evt)
+		case node := <-done:
+			if node.Err != nil {
+				fmt.Fprintf(os.Stderr, "%v: %v\n", node.Name, node.Err)
+			}
+			streams--
+		case <-interrupt:
+			return nil
+		}
+	}
+
+	// Success
+	return nil
+}
+
+func FleetListCrashReports(args []string, nodes []*Node) error {
+	if len(args) != 1 {
+		return gopi.ErrBadParameter
+	}
+	reports := make([][]rpc.GafferCrashReport, len(nodes))
+	FanOut(nodes, func(i int, node *Node) (err error) {
+		reports[i], err = node.Gaffer.ListCrashReports(list_filter.Service)
+		return
+	})
+	rows := make([][]string, 0)
+	for i, node := range nodes {
+		for _, report := range reports[i] {
+			rows = append(rows, append([]string{node.Name}, CrashReportRow(report)...))
+		}
+	}
+	if err := OutputFleet(os.Stdout, CrashReportHeader, rows); err != nil {
+		return err
+	} else {
+		return ReportList(nodes)
+	}
+}
+
+// FleetListAudit lists calls from the audit log of every node in time
+// order
+func FleetListAudit(args []string, nodes []*Node) error {
+	// Filter by method name
+	query := audit_query
+	if len(args) > 2 {
+		return gopi.ErrBadParameter
+	} else if len(args) == 2 {
+		query.Method = args[1]
+	}
+
+	// Merge records in time order
+	records := make([][]rpc.GafferAuditRecord, len(nodes))
+	FanOut(nodes, func(i int, node *Node) (err error) {
+		records[i], err = node.Gaffer.QueryAudit(query)
+		return
+	})
+	type nodeRecord struct {
+		node   string
+		record rpc.GafferAuditRecord
+	}
+	merged := make([]nodeRecord, 0)
+	for i, node := range nodes {
+		for _, record := range records[i] {
+			merged = append(merged, nodeRecord{node.Name, record})
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].record.Timestamp().Before(merged[j].record.Timestamp())
+	})
+	rows := make([][]string, len(merged))
+	for i, record := range merged {
+		rows[i] = append([]string{record.node}, AuditRow(record.record)...)
+	}
+	if err := OutputFleet(os.Stdout, AuditHeader, rows); err != nil {
+		return err
+	} else {
+		return ReportList(nodes)
+	}
+}
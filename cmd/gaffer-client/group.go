@@ -11,6 +11,8 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	// Frameworks
 	gopi "github.com/djthorpe/gopi"
@@ -19,6 +21,23 @@ import (
 
 ////////////////////////////////////////////////////////////////////////////////
 
+// DecodeGroupList returns group names from a comma-separated list of
+// @<group> arguments, or an empty list
+func DecodeGroupList(arg string) ([]string, error) {
+	groups := make([]string, 0)
+	if arg == "" {
+		return groups, nil
+	}
+	for _, group := range strings.Split(arg, ",") {
+		if group_ := reGroup.FindStringSubmatch(group); len(group_) != 2 {
+			return nil, gopi.ErrBadParameter
+		} else {
+			groups = append(groups, group_[1])
+		}
+	}
+	return groups, nil
+}
+
 func GroupCommands(args []string, gaffer rpc.GafferClient, discovery rpc.DiscoveryClient) error {
 	// Obtain the group name
 	group := reGroup.FindStringSubmatch(args[0])
@@ -26,6 +45,82 @@ func GroupCommands(args []string, gaffer rpc.GafferClient, discovery rpc.Discove
 		return gopi.ErrBadParameter
 	}
 
+	// Set flags and environment
+	if len(args) > 2 && (args[1] == "flags" || args[1] == "env") {
+		if patch, err := DecodePatch(args[2:]); err != nil {
+			return err
+		} else if args[1] == "flags" {
+			if group_, err := gaffer.PatchFlagsForGroup(group[1], patch_version, patch); err != nil {
+				return err
+			} else {
+				return OutputGroups(os.Stdout, []rpc.GafferServiceGroup{group_})
+			}
+		} else if group_, err := gaffer.PatchEnvForGroup(group[1], patch_version, patch); err != nil {
+			return err
+		} else {
+			return OutputGroups(os.Stdout, []rpc.GafferServiceGroup{group_})
+		}
+	}
+
+	// Mark flags and environment as secret
+	if len(args) > 1 && args[1] == "secrets" {
+		if group_, err := gaffer.SetSecretsForGroup(group[1], DecodeKeys(args[2:])); err != nil {
+			return err
+		} else {
+			return OutputGroups(os.Stdout, []rpc.GafferServiceGroup{group_})
+		}
+	}
+
+	// Set inherited environment and env files
+	if len(args) > 2 && args[1] == "envpolicy" {
+		if policy, err := rpc.EnvPolicyForName(args[2]); err != nil {
+			return err
+		} else if group_, err := gaffer.SetGroupEnvPolicy(group[1], policy, args[3:]); err != nil {
+			return err
+		} else {
+			return OutputGroups(os.Stdout, []rpc.GafferServiceGroup{group_})
+		}
+	} else if len(args) > 1 && args[1] == "envfiles" {
+		if group_, err := gaffer.SetGroupEnvFiles(group[1], args[2:]); err != nil {
+			return err
+		} else {
+			return OutputGroups(os.Stdout, []rpc.GafferServiceGroup{group_})
+		}
+	}
+
+	// Return or set lifecycle hooks
+	if len(args) == 2 && args[1] == "hooks" {
+		if group_, err := gaffer.GetGroup(group[1]); err != nil {
+			return err
+		} else {
+			return OutputHooks(os.Stdout, group_.Hooks())
+		}
+	} else if len(args) > 2 && args[1] == "hooks" {
+		if hooks, err := DecodeHooks(args[2:]); err != nil {
+			return err
+		} else if group_, err := gaffer.SetGroupHooks(group[1], hooks); err != nil {
+			return err
+		} else {
+			return OutputHooks(os.Stdout, group_.Hooks())
+		}
+	}
+
+	// Set included groups
+	if len(args) == 3 && args[1] == "set" && strings.HasPrefix(args[2], "groups=") {
+		if groups, err := DecodeGroupList(strings.TrimPrefix(args[2], "groups=")); err != nil {
+			return err
+		} else if group_, err := gaffer.SetGroupGroups(group[1], groups); err != nil {
+			return err
+		} else {
+			return OutputGroups(os.Stdout, []rpc.GafferServiceGroup{group_})
+		}
+	}
+
+	// Start, stop and restart services in the group
+	if len(args) > 1 && (args[1] == "start" || args[1] == "stop" || args[1] == "restart") {
+		return GroupOperation(group[1], args[1], args[2:], gaffer)
+	}
+
 	// Parse arguments
 	switch len(args) {
 	case 1:
@@ -51,16 +146,68 @@ func GroupCommands(args []string, gaffer rpc.GafferClient, discovery rpc.Discove
 			} else {
 				return ListAllGroups(args, gaffer, discovery)
 			}
-		case "start":
-			return gopi.ErrNotImplemented
-		case "stop":
-			return gopi.ErrNotImplemented
+		default:
+			return gopi.ErrHelp
+		}
+	case 3, 4:
+		switch args[1] {
+		case "signal":
+			if signal, process_group, err := SignalArguments(args[1:]); err != nil {
+				return err
+			} else if instances, err := gaffer.SignalGroup(group[1], signal, process_group); err != nil {
+				return err
+			} else if len(instances) == 0 {
+				return fmt.Errorf("No running instances")
+			} else {
+				return OutputInstances(os.Stdout, instances)
+			}
 		default:
 			return gopi.ErrHelp
 		}
 	default:
 		return gopi.ErrHelp
 	}
+}
+
+// GroupOperation starts, stops or restarts the services in a group, with
+// the arguments "(all)" for start and "(<settle-time>) (all)" for restart
+func GroupOperation(group, operation string, args []string, gaffer rpc.GafferClient) error {
+	all := false
+	if len(args) > 0 && args[len(args)-1] == "all" && operation != "stop" {
+		all, args = true, args[:len(args)-1]
+	}
+	settle := time.Duration(0)
+	if len(args) == 1 && operation == "restart" {
+		if duration, err := time.ParseDuration(args[0]); err != nil || duration < 0 {
+			return gopi.ErrBadParameter
+		} else {
+			settle, args = duration, args[1:]
+		}
+	}
+	if len(args) != 0 {
+		return gopi.ErrBadParameter
+	}
+
+	var results []rpc.GafferServiceResult
+	var err error
+	switch operation {
+	case "start":
+		results, err = gaffer.StartGroup(group, all)
+	case "stop":
+		results, err = gaffer.StopGroup(group)
+	case "restart":
+		results, err = gaffer.RestartGroup(group, settle, all)
+	}
+	if err != nil {
+		return err
+	} else if err := OutputServiceResults(os.Stdout, results); err != nil {
+		return err
+	}
+	for _, result := range results {
+		if result.Error() != nil {
+			return fmt.Errorf("One or more services in @%v failed to %v", group, operation)
+		}
+	}
 
 	// Success
 	return nil
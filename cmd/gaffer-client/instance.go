@@ -0,0 +1,53 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package main
+
+import (
+	"os"
+	"strconv"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func InstanceCommands(args []string, gaffer rpc.GafferClient, discovery rpc.DiscoveryClient) error {
+	// Obtain the instance identifier
+	id, err := strconv.ParseUint(args[0], 10, 32)
+	if err != nil {
+		return gopi.ErrBadParameter
+	}
+
+	// Parse arguments
+	if len(args) < 2 {
+		return gopi.ErrBadParameter
+	}
+	switch args[1] {
+	case "signal":
+		if signal, group, err := SignalArguments(args[1:]); err != nil {
+			return err
+		} else if instance, err := gaffer.SignalInstance(uint32(id), signal, group); err != nil {
+			return err
+		} else {
+			return OutputInstances(os.Stdout, []rpc.GafferServiceInstance{instance})
+		}
+	case "labels":
+		if tuples, err := DecodeTuples(args[2:]); err != nil {
+			return err
+		} else if instance, err := gaffer.SetLabelsForInstance(uint32(id), tuples); err != nil {
+			return err
+		} else {
+			return OutputInstances(os.Stdout, []rpc.GafferServiceInstance{instance})
+		}
+	default:
+		return gopi.ErrBadParameter
+	}
+}
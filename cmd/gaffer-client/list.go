@@ -14,23 +14,31 @@ import (
 	"time"
 
 	// Frameworks
+	gopi "github.com/djthorpe/gopi"
 	rpc "github.com/djthorpe/gopi-rpc"
 	tablewriter "github.com/olekukonko/tablewriter"
 )
 
 ////////////////////////////////////////////////////////////////////////////////
 
+var (
+	// list_filter is set from the command line flags
+	list_filter rpc.GafferFilter
+
+	// event_query is set from the command line flags
+	event_query rpc.GafferEventQuery
+
+	// audit_query is set from the command line flags
+	audit_query rpc.GafferAuditQuery
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
 func ListAllExecutables(args []string, gaffer rpc.GafferClient, discovery rpc.DiscoveryClient) error {
-	if list, err := gaffer.ListExecutables(); err != nil {
+	if executables, err := gaffer.ListExecutables(); err != nil {
+		return err
+	} else if err := OutputExecutables(os.Stdout, executables); err != nil {
 		return err
-	} else {
-		output := tablewriter.NewWriter(os.Stdout)
-		for _, cell := range list {
-			output.Append([]string{
-				"/" + cell,
-			})
-		}
-		output.Render()
 	}
 
 	// Return success
@@ -38,7 +46,7 @@ func ListAllExecutables(args []string, gaffer rpc.GafferClient, discovery rpc.Di
 }
 
 func ListAllGroups(args []string, gaffer rpc.GafferClient, discovery rpc.DiscoveryClient) error {
-	if groups, err := gaffer.ListGroups(); err != nil {
+	if groups, err := gaffer.ListGroupsWithFilter(list_filter); err != nil {
 		return err
 	} else if len(groups) == 0 {
 
@@ -50,6 +58,71 @@ func ListAllGroups(args []string, gaffer rpc.GafferClient, discovery rpc.Discove
 	return nil
 }
 
+func ListEvents(args []string, gaffer rpc.GafferClient, discovery rpc.DiscoveryClient) error {
+	// Stream events
+	if len(args) > 1 && args[1] == "tail" {
+		if filter, err := StreamFilterFromArgs(args[2:]); err != nil {
+			return err
+		} else {
+			return StreamEvents(gaffer, filter)
+		}
+	}
+
+	// Filter by event types
+	query := event_query
+	if types, err := EventTypesFromArgs(args[1:]); err != nil {
+		return err
+	} else {
+		query.Types = types
+	}
+	if events, err := gaffer.QueryEvents(query); err != nil {
+		return err
+	} else if err := OutputEvents(os.Stdout, events); err != nil {
+		return err
+	}
+
+	// Return success
+	return nil
+}
+
+// StreamEvents writes events as they are received until the stream ends
+// or CTRL+C is pressed
+func StreamEvents(gaffer rpc.GafferClient, filter rpc.GafferFilter) error {
+	events := make(chan rpc.GafferEvent)
+	errs := make(chan error)
+	go func() {
+		errs <- gaffer.StreamEventsWithFilter(filter, events)
+	}()
+	for {
+		select {
+		case evt := <-events:
+			OutputStreamEvent(os.Stdout, "", evt)
+		case err := <-errs:
+			return err
+		case <-interrupt:
+			return nil
+		}
+	}
+}
+
+func ListAudit(args []string, gaffer rpc.GafferClient, discovery rpc.DiscoveryClient) error {
+	// Filter by method name
+	query := audit_query
+	if len(args) > 2 {
+		return gopi.ErrBadParameter
+	} else if len(args) == 2 {
+		query.Method = args[1]
+	}
+	if records, err := gaffer.QueryAudit(query); err != nil {
+		return err
+	} else if err := OutputAudit(os.Stdout, records); err != nil {
+		return err
+	}
+
+	// Return success
+	return nil
+}
+
 func ListAllServiceRecords(args []string, gaffer rpc.GafferClient, discovery rpc.DiscoveryClient) error {
 	if list, err := discovery.Enumerate(rpc.DISCOVERY_TYPE_DB, time.Second); err != nil {
 		return err
@@ -68,7 +141,7 @@ func ListAllServiceRecords(args []string, gaffer rpc.GafferClient, discovery rpc
 }
 
 func ListAllInstances(args []string, gaffer rpc.GafferClient, discovery rpc.DiscoveryClient) error {
-	if instances, err := gaffer.ListInstances(); err != nil {
+	if instances, err := gaffer.ListInstancesWithFilter(list_filter); err != nil {
 		return err
 	} else if len(instances) == 0 {
 		return ListAllServices(args, gaffer, discovery)
@@ -78,7 +151,7 @@ func ListAllInstances(args []string, gaffer rpc.GafferClient, discovery rpc.Disc
 }
 
 func ListAllServices(args []string, gaffer rpc.GafferClient, discovery rpc.DiscoveryClient) error {
-	if services, err := gaffer.ListServices(); err != nil {
+	if services, err := gaffer.ListServicesWithFilter(list_filter); err != nil {
 		return err
 	} else if len(services) == 0 {
 		return fmt.Errorf("No services")
@@ -59,7 +59,7 @@ func Conn(app *gopi.AppInstance) (gopi.RPCServiceRecord, error) {
 			for _, service := range services {
 				names = append(names, strconv.Quote(service.Name()))
 			}
-			return nil, fmt.Errorf("More than one service returned, use -addr to choose between %v", strings.Join(names, ","))
+			return nil, fmt.Errorf("More than one service returned, use -addr to choose between %v or -fleet to call all of them", strings.Join(names, ","))
 		} else {
 			return services[0], nil
 		}
@@ -101,7 +101,13 @@ func DiscoveryStub(app *gopi.AppInstance, sr gopi.RPCServiceRecord) (rpc.Discove
 }
 
 func Main(app *gopi.AppInstance, done chan<- struct{}) error {
-	if record, err := Conn(app); err != nil {
+	if fleet, _ := app.AppFlags.GetBool("fleet"); fleet {
+		if nodes, err := Fleet(app); err != nil {
+			return err
+		} else if err := RunFleet(app, nodes); err != nil {
+			return err
+		}
+	} else if record, err := Conn(app); err != nil {
 		return err
 	} else if gaffer_client, err := GafferStub(app, record); err != nil {
 		return err
@@ -143,6 +149,21 @@ func main() {
 	// Set flags
 	config.AppFlags.FlagString("addr", "", "Service name or gateway address")
 	config.AppFlags.FlagBool("dns", false, "Use DNS for service discovery")
+	config.AppFlags.FlagBool("fleet", false, "Call every gaffer service discovered on the network")
+	config.AppFlags.FlagString("node", "", "Choose fleet nodes by name, which can include wildcards")
+	config.AppFlags.FlagString("nodeselector", "", "Choose fleet nodes by labels, for example zone=garage")
+	config.AppFlags.FlagString("service", "", "Filter by service name, which can include wildcards")
+	config.AppFlags.FlagString("group", "", "Filter by group name, which can include wildcards")
+	config.AppFlags.FlagString("selector", "", "Filter by labels, for example env=prod,tier!=edge")
+	config.AppFlags.FlagString("state", "", "Filter instances by state (running|stopped|failed)")
+	config.AppFlags.FlagString("sort", "", "Sort by name, id or start, with - prefix to reverse")
+	config.AppFlags.FlagUint("offset", 0, "Skip the first results")
+	config.AppFlags.FlagUint("limit", 0, "Maximum number of results, or zero for all")
+	config.AppFlags.FlagUint("instance", 0, "Filter events by instance")
+	config.AppFlags.FlagString("identity", "", "Filter the audit log by caller identity, which can include wildcards")
+	config.AppFlags.FlagDuration("since", 0, "List events more recent than a duration ago")
+	config.AppFlags.FlagDuration("until", 0, "List events older than a duration ago")
+	config.AppFlags.FlagUint("expect", 0, "Expected version when changing flags or environment, or zero for any version")
 
 	// Run the command line tool
 	os.Exit(gopi.CommandLineTool2(config, Main))
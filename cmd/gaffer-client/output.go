@@ -11,6 +11,8 @@ package main
 import (
 	"fmt"
 	"io"
+	"strings"
+	"time"
 
 	// Frameworks
 	gopi "github.com/djthorpe/gopi"
@@ -20,54 +22,281 @@ import (
 
 ////////////////////////////////////////////////////////////////////////////////
 
+var (
+	// Table headers, which are prefixed with a NODE column in fleet mode
+	ServiceHeader     = []string{"SERVICE", "GROUPS", "LABELS", "FLAGS", "ARGS", "MODE", "RUN TIME", "IDLE TIME", "UPGRADE", "VERSION"}
+	GroupHeader       = []string{"GROUP", "INCLUDES", "FLAGS", "ENV", "VERSION"}
+	InstanceHeader    = []string{"INSTANCE", "SERVICE", "LABELS", "FLAGS", "ENV", "STATUS"}
+	ExecutableHeader  = []string{"EXECUTABLE", "SIZE", "MODIFIED", "ARCH", "SERVICES", "SHA-256"}
+	EventHeader       = []string{"SEQ", "TIME", "TYPE", "SERVICE", "GROUP", "INSTANCE", "DATA"}
+	AuditHeader       = []string{"SEQ", "TIME", "PEER", "IDENTITY", "METHOD", "PARAMS", "ERROR"}
+	CrashReportHeader = []string{"REPORT", "SERVICE", "INSTANCE", "TIME", "STATUS", "UPTIME"}
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func ServiceRow(service rpc.GafferService) []string {
+	return []string{
+		service.Name(),
+		RenderGroupList(service.Groups()),
+		RenderLabels(service.Labels()),
+		RenderFlags(service.Flags()),
+		RenderArgs(service),
+		RenderMode(service),
+		RenderDuration(service.RunTime()),
+		RenderDuration(service.IdleTime()),
+		RenderUpgradePolicy(service),
+		fmt.Sprint(service.Version()),
+	}
+}
+
 func OutputServices(fh io.Writer, services []rpc.GafferService) error {
 	output := tablewriter.NewWriter(fh)
-	output.SetHeader([]string{"SERVICE", "GROUPS", "FLAGS", "MODE", "RUN TIME", "IDLE TIME"})
+	output.SetHeader(ServiceHeader)
 	for _, service := range services {
-		output.Append([]string{
-			service.Name(),
-			RenderGroupList(service.Groups()),
-			RenderFlags(service.Flags()),
-			RenderMode(service),
-			RenderDuration(service.RunTime()),
-			RenderDuration(service.IdleTime()),
-		})
+		output.Append(ServiceRow(service))
 	}
 	output.Render()
 	return nil
 }
 
+func GroupRow(group rpc.GafferServiceGroup) []string {
+	return []string{
+		"@" + group.Name(),
+		RenderIncludes(group.Groups()),
+		RenderFlags(group.Flags()),
+		RenderEnv(group.Env()),
+		fmt.Sprint(group.Version()),
+	}
+}
+
 func OutputGroups(fh io.Writer, groups []rpc.GafferServiceGroup) error {
 	output := tablewriter.NewWriter(fh)
-	output.SetHeader([]string{"GROUP", "FLAGS", "ENV"})
+	output.SetHeader(GroupHeader)
 	for _, group := range groups {
-		output.Append([]string{
-			"@" + group.Name(),
-			RenderFlags(group.Flags()),
-			RenderEnv(group.Env()),
-		})
+		output.Append(GroupRow(group))
 	}
 	output.Render()
 	return nil
+}
 
+func InstanceRow(instance rpc.GafferServiceInstance) []string {
+	return []string{
+		fmt.Sprint(instance.Id()),
+		fmt.Sprint(instance.Service().Name()),
+		RenderLabels(instance.Labels()),
+		RenderFlags(instance.Flags()),
+		RenderEnv(instance.Env()),
+		RenderInstanceStatus(instance),
+	}
 }
 
 func OutputInstances(fh io.Writer, instances []rpc.GafferServiceInstance) error {
 	output := tablewriter.NewWriter(fh)
-	output.SetHeader([]string{"INSTANCE", "SERVICE", "FLAGS", "ENV", "STATUS"})
+	output.SetHeader(InstanceHeader)
 	for _, instance := range instances {
+		output.Append(InstanceRow(instance))
+	}
+	output.Render()
+	return nil
+}
+
+func OutputServiceResults(fh io.Writer, results []rpc.GafferServiceResult) error {
+	output := tablewriter.NewWriter(fh)
+	output.SetHeader([]string{"SERVICE", "INSTANCES", "RESULT"})
+	for _, result := range results {
 		output.Append([]string{
-			fmt.Sprint(instance.Id()),
-			fmt.Sprint(instance.Service().Name()),
-			RenderFlags(instance.Flags()),
-			RenderEnv(instance.Env()),
-			RenderInstanceStatus(instance),
+			result.Service().Name(),
+			RenderInstanceList(result.Instances()),
+			RenderResult(result.Error()),
 		})
 	}
 	output.Render()
 	return nil
 }
 
+func ExecutableRow(executable rpc.GafferExecutable) []string {
+	return []string{
+		RenderExecutable(executable),
+		RenderSize(executable.Size()),
+		executable.ModTime().Format(time.RFC3339),
+		RenderArch(executable),
+		RenderServiceList(executable.Services()),
+		executable.Checksum(),
+	}
+}
+
+func OutputExecutables(fh io.Writer, executables []rpc.GafferExecutable) error {
+	output := tablewriter.NewWriter(fh)
+	output.SetHeader(ExecutableHeader)
+	for _, executable := range executables {
+		output.Append(ExecutableRow(executable))
+	}
+	output.Render()
+	return nil
+}
+
+func OutputServiceData(fh io.Writer, data rpc.GafferServiceData) error {
+	output := tablewriter.NewWriter(fh)
+	output.SetHeader([]string{"SERVICE", "DATA", "FILES", "SIZE", "MODIFIED"})
+	output.Append([]string{
+		data.Service(),
+		data.Path(),
+		fmt.Sprint(data.Files()),
+		RenderSize(data.Size()),
+		data.ModTime().Format(time.RFC3339),
+	})
+	output.Render()
+	return nil
+}
+
+func EventRow(evt rpc.GafferEvent) []string {
+	return []string{
+		fmt.Sprint(evt.Seq()),
+		evt.Timestamp().Local().Format(time.RFC3339),
+		RenderEventType(evt.Type()),
+		RenderEventService(evt),
+		RenderEventGroup(evt),
+		RenderEventInstance(evt),
+		strings.TrimSpace(string(evt.Data())),
+	}
+}
+
+func OutputEvents(fh io.Writer, events []rpc.GafferEvent) error {
+	output := tablewriter.NewWriter(fh)
+	output.SetHeader(EventHeader)
+	for _, evt := range events {
+		output.Append(EventRow(evt))
+	}
+	output.Render()
+	return nil
+}
+
+func AuditRow(record rpc.GafferAuditRecord) []string {
+	return []string{
+		fmt.Sprint(record.Seq()),
+		record.Timestamp().Local().Format(time.RFC3339),
+		RenderString(record.Peer()),
+		RenderString(record.Identity()),
+		record.Method(),
+		RenderEnv(record.Params()),
+		RenderString(record.Error()),
+	}
+}
+
+func OutputAudit(fh io.Writer, records []rpc.GafferAuditRecord) error {
+	output := tablewriter.NewWriter(fh)
+	output.SetHeader(AuditHeader)
+	for _, record := range records {
+		output.Append(AuditRow(record))
+	}
+	output.Render()
+	return nil
+}
+
+func CrashReportRow(report rpc.GafferCrashReport) []string {
+	return []string{
+		fmt.Sprint("%", report.Id()),
+		report.Service(),
+		fmt.Sprint(report.Instance()),
+		report.Timestamp().Local().Format(time.RFC3339),
+		RenderCrashStatus(report),
+		RenderDuration(report.Uptime()),
+	}
+}
+
+func OutputCrashReports(fh io.Writer, reports []rpc.GafferCrashReport) error {
+	output := tablewriter.NewWriter(fh)
+	output.SetHeader(CrashReportHeader)
+	for _, report := range reports {
+		output.Append(CrashReportRow(report))
+	}
+	output.Render()
+	return nil
+}
+
+func OutputCrashReport(fh io.Writer, report rpc.GafferCrashReport) error {
+	output := tablewriter.NewWriter(fh)
+	output.SetAutoWrapText(false)
+	output.Append([]string{"Report", fmt.Sprint("%", report.Id())})
+	output.Append([]string{"Service", report.Service()})
+	output.Append([]string{"Instance", fmt.Sprint(report.Instance())})
+	output.Append([]string{"Time", report.Timestamp().Local().Format(time.RFC3339)})
+	output.Append([]string{"Status", RenderCrashStatus(report)})
+	output.Append([]string{"Uptime", RenderDuration(report.Uptime())})
+	output.Append([]string{"Resources", RenderCrashUsage(report)})
+	output.Append([]string{"Flags", RenderFlags(report.Flags())})
+	output.Append([]string{"Args", strings.Join(report.Args(), " ")})
+	output.Append([]string{"Env", RenderEnv(report.Env())})
+	output.Append([]string{"Stdout", strings.Join(report.Stdout(), "\n")})
+	output.Append([]string{"Stderr", strings.Join(report.Stderr(), "\n")})
+	output.Render()
+	return nil
+}
+
+func OutputHooks(fh io.Writer, hooks []rpc.GafferHook) error {
+	output := tablewriter.NewWriter(fh)
+	output.SetHeader([]string{"STAGE", "TIMEOUT", "COMMAND"})
+	for _, hook := range hooks {
+		output.Append([]string{
+			hook.Stage.Name(),
+			RenderDuration(hook.Timeout),
+			hook.Command,
+		})
+	}
+	output.Render()
+	return nil
+}
+
+func OutputFlags(fh io.Writer, flags []rpc.GafferFlag, values rpc.Tuples) error {
+	output := tablewriter.NewWriter(fh)
+	output.SetHeader([]string{"FLAG", "TYPE", "DEFAULT", "VALUE", "USAGE"})
+	for _, flag := range flags {
+		output.Append([]string{
+			"-" + flag.Name(),
+			flag.Type(),
+			flag.Default(),
+			RenderFlagValue(flag, values),
+			flag.Usage(),
+		})
+	}
+	output.Render()
+	return nil
+}
+
+func OutputResolvedTuples(fh io.Writer, flags, env []rpc.GafferResolvedTuple) error {
+	output := tablewriter.NewWriter(fh)
+	output.SetHeader([]string{"KEY", "VALUE", "ORIGIN", "EXPLANATION"})
+	for _, flag := range flags {
+		output.Append([]string{
+			"-" + flag.Key(),
+			flag.Value(),
+			flag.Origin(),
+			RenderExplanation(flag),
+		})
+	}
+	for _, e := range env {
+		output.Append([]string{
+			e.Key(),
+			e.Value(),
+			e.Origin(),
+			RenderExplanation(e),
+		})
+	}
+	output.Render()
+	return nil
+}
+
+func OutputProgress(fh io.Writer, progress <-chan rpc.GafferEvent) {
+	for evt := range progress {
+		if service := evt.Service(); service != nil {
+			fmt.Fprintf(fh, "%v: %s\n", service.Name(), evt.Data())
+		} else {
+			fmt.Fprintf(fh, "%s\n", evt.Data())
+		}
+	}
+}
+
 func OutputRecords(fh io.Writer, records []gopi.RPCServiceRecord) error {
 	output := tablewriter.NewWriter(fh)
 	output.SetHeader([]string{"SERVICE", "NAME", "HOST", "ADDR", "TXT"})
@@ -83,3 +312,23 @@ func OutputRecords(fh io.Writer, records []gopi.RPCServiceRecord) error {
 	output.Render()
 	return nil
 }
+
+// OutputFleet writes a table of results from several nodes, where the
+// first column of each row is the node name
+func OutputFleet(fh io.Writer, header []string, rows [][]string) error {
+	output := tablewriter.NewWriter(fh)
+	output.SetHeader(append([]string{"NODE"}, header...))
+	output.AppendBulk(rows)
+	output.Render()
+	return nil
+}
+
+// OutputStreamEvent writes an event received from a stream on a single line,
+// prefixed by the node name in fleet mode
+func OutputStreamEvent(fh io.Writer, node string, evt rpc.GafferEvent) {
+	line := strings.Join(EventRow(evt)[1:], " ")
+	if node != "" {
+		line = node + ": " + line
+	}
+	fmt.Fprintln(fh, line)
+}
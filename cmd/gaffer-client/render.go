@@ -10,6 +10,7 @@ package main
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -31,6 +32,14 @@ func RenderGroupList(groups []string) string {
 	return groups_
 }
 
+func RenderIncludes(groups []string) string {
+	if len(groups) == 0 {
+		return "-"
+	} else {
+		return RenderGroupList(groups)
+	}
+}
+
 func RenderFlags(flags rpc.Tuples) string {
 	flags_ := flags.Flags()
 	if len(flags_) == 0 {
@@ -47,6 +56,92 @@ func RenderFlags(flags rpc.Tuples) string {
 	}
 }
 
+func RenderFlagValue(flag rpc.GafferFlag, values rpc.Tuples) string {
+	if values.ExistsForKey(flag.Name()) == false {
+		return "-"
+	} else if value := values.StringForKey(flag.Name()); value == "" && flag.Type() == "bool" {
+		return "true"
+	} else {
+		return value
+	}
+}
+
+func RenderExplanation(tuple rpc.GafferResolvedTuple) string {
+	lines := make([]string, 0)
+	if tuple.Raw() != tuple.Value() {
+		lines = append(lines, "expanded from "+strconv.Quote(tuple.Raw()))
+	}
+	for _, variable := range tuple.Variables() {
+		if variable.Origin() == "unresolved" {
+			lines = append(lines, "${"+variable.Key()+"} is unresolved")
+		} else {
+			lines = append(lines, "${"+variable.Key()+"} from "+variable.Origin())
+		}
+	}
+	for _, override := range tuple.Overrides() {
+		lines = append(lines, "overrides "+override.Origin()+" value "+strconv.Quote(override.Value()))
+	}
+	if len(lines) == 0 {
+		return "-"
+	} else {
+		return strings.Join(lines, "\n")
+	}
+}
+
+func RenderInstanceList(instances []rpc.GafferServiceInstance) string {
+	if len(instances) == 0 {
+		return "-"
+	}
+	ids := make([]string, len(instances))
+	for i, instance := range instances {
+		ids[i] = fmt.Sprint(instance.Id())
+	}
+	return strings.Join(ids, ",")
+}
+
+func RenderResult(err error) string {
+	if err == nil {
+		return "OK"
+	} else {
+		return err.Error()
+	}
+}
+
+// RenderArgs returns the positional arguments for a service, and the
+// flag style when it is not the default
+func RenderArgs(service rpc.GafferService) string {
+	args := make([]string, 0, len(service.Args())+1)
+	switch service.FlagStyle() {
+	case rpc.GAFFER_FLAG_STYLE_DOUBLE_DASH:
+		args = append(args, "(--key=value)")
+	case rpc.GAFFER_FLAG_STYLE_SEPARATE:
+		args = append(args, "(--key value)")
+	}
+	for _, arg := range service.Args() {
+		args = append(args, strconv.Quote(arg))
+	}
+	if len(args) == 0 {
+		return "-"
+	} else {
+		return strings.Join(args, "\n")
+	}
+}
+
+func RenderLabels(labels rpc.Tuples) string {
+	if labels.Len() == 0 {
+		return "-"
+	} else {
+		labels_ := ""
+		for i, key := range labels.Keys() {
+			if i > 0 {
+				labels_ += "\n"
+			}
+			labels_ += key + "=" + labels.StringForKey(key)
+		}
+		return labels_
+	}
+}
+
 func RenderEnv(env rpc.Tuples) string {
 	env_ := env.Env()
 	if len(env_) == 0 {
@@ -74,6 +169,53 @@ func RenderMode(service rpc.GafferService) string {
 	}
 }
 
+func RenderUpgradePolicy(service rpc.GafferService) string {
+	policy := fmt.Sprint(service.UpgradePolicy())
+	if strings.HasPrefix(policy, "GAFFER_UPGRADE_") {
+		policy = strings.ToLower(strings.TrimPrefix(policy, "GAFFER_UPGRADE_"))
+	}
+	if service.IsStale() {
+		return policy + " (stale)"
+	} else {
+		return policy
+	}
+}
+
+func RenderExecutable(executable rpc.GafferExecutable) string {
+	if executable.IsGopi() {
+		return "/" + executable.Path() + " (gopi)"
+	} else {
+		return "/" + executable.Path()
+	}
+}
+
+func RenderArch(executable rpc.GafferExecutable) string {
+	if arch := executable.Arch(); arch == "" {
+		return "-"
+	} else {
+		return arch
+	}
+}
+
+func RenderServiceList(services []string) string {
+	if len(services) == 0 {
+		return "unused"
+	} else {
+		return strings.Join(services, "\n")
+	}
+}
+
+func RenderSize(size int64) string {
+	switch {
+	case size >= 1024*1024:
+		return fmt.Sprintf("%.1fM", float64(size)/(1024*1024))
+	case size >= 1024:
+		return fmt.Sprintf("%.1fK", float64(size)/1024)
+	default:
+		return fmt.Sprint(size)
+	}
+}
+
 func RenderInstanceStatus(instance rpc.GafferServiceInstance) string {
 	if instance.Start().IsZero() && instance.Stop().IsZero() {
 		return "Starting"
@@ -89,6 +231,56 @@ func RenderInstanceStatus(instance rpc.GafferServiceInstance) string {
 	return "??"
 }
 
+func RenderEventType(t rpc.GafferEventType) string {
+	return strings.ToLower(strings.TrimPrefix(fmt.Sprint(t), "GAFFER_EVENT_"))
+}
+
+func RenderEventService(evt rpc.GafferEvent) string {
+	if service := evt.Service(); service == nil {
+		return "-"
+	} else {
+		return service.Name()
+	}
+}
+
+func RenderEventGroup(evt rpc.GafferEvent) string {
+	if group := evt.Group(); group == nil {
+		return "-"
+	} else {
+		return "@" + group.Name()
+	}
+}
+
+func RenderEventInstance(evt rpc.GafferEvent) string {
+	if instance := evt.Instance(); instance == nil {
+		return "-"
+	} else {
+		return fmt.Sprint(instance.Id())
+	}
+}
+
+func RenderCrashStatus(report rpc.GafferCrashReport) string {
+	if report.Signal() == "" {
+		return fmt.Sprintf("Exit code %v", report.ExitCode())
+	} else if report.CoreDumped() {
+		return fmt.Sprintf("Signal %v (core dumped)", report.Signal())
+	} else {
+		return fmt.Sprintf("Signal %v", report.Signal())
+	}
+}
+
+func RenderCrashUsage(report rpc.GafferCrashReport) string {
+	return fmt.Sprintf("user %v system %v max rss %v", report.UserTime(), report.SystemTime(), RenderSize(report.MaxRSS()*1024))
+}
+
+func RenderString(value string) string {
+	if value == "" {
+		return "-"
+	} else {
+		return value
+	}
+}
+
 func RenderDuration(duration time.Duration) string {
 	if duration == 0 {
 		return "-"
@@ -11,6 +11,8 @@ package main
 import (
 	"fmt"
 	"regexp"
+	"strings"
+	"time"
 
 	gopi "github.com/djthorpe/gopi"
 	rpc "github.com/djthorpe/gopi-rpc"
@@ -36,6 +38,18 @@ var (
 	reServiceFlags     = regexp.MustCompile("^([A-Za-z][A-Za-z0-9\\.\\-_]*) flags$")
 	reInstance         = regexp.MustCompile("^[1-9][0-9]*$")
 	reRecord           = regexp.MustCompile("^_[A-Za-z][A-Za-z0-9\\.\\-_]*$")
+	reEvents           = regexp.MustCompile("^~$")
+	reCrashReport      = regexp.MustCompile("^%[1-9][0-9]*$")
+	reAudit            = regexp.MustCompile("^\\^$")
+)
+
+var (
+	// patch_version is the expected version when changing flags or
+	// environment, set from the -expect command line flag
+	patch_version uint64
+
+	// interrupt is closed on CTRL+C, which ends streaming commands
+	interrupt = make(chan struct{})
 )
 
 var (
@@ -45,19 +59,50 @@ var (
 		&Command{"/", nil, "List all executables", ListAllExecutables},
 		&Command{"@", nil, "List all groups", ListAllGroups},
 		&Command{"_", nil, "List all service records", ListAllServiceRecords},
+		&Command{"~ (<type>)...", reEvents, "List events from the journal", ListEvents},
+		&Command{"~ tail (<type>)...", reEvents, "Stream events as they happen (press CTRL+C to end)", ListEvents},
+		&Command{"%", nil, "List crash reports", ListCrashReports},
+		&Command{"%<id>", reCrashReport, "Show a crash report", CrashReportCommands},
+		&Command{"^ (<method>)", reAudit, "List calls which changed services, groups or instances", ListAudit},
 		&Command{"_<service-type>._tcp", reRecord, "List service records", RecordCommands},
-		&Command{"/<executable> add name=<service> groups=@<group-list> mode=(manual|auto)", reExecutable, "Add service", AddService},
+		&Command{"/<executable> add name=<service> groups=@<group-list> mode=(manual|auto)", reExecutable, "Add service", ExecutableCommands},
+		&Command{"/<executable> upload <file>", reExecutable, "Upload an executable", ExecutableCommands},
+		&Command{"/<executable> rollback (<checksum>)", reExecutable, "Restore a previous version of an executable", ExecutableCommands},
 		&Command{"<service> rm", reServiceRemove, "Remove Service", ServiceCommands},
 		&Command{"<service> (start|stop)", reServiceStartStop, "Start or stop service instances", ServiceCommands},
-		&Command{"<service> flags (<key>=<value> | <key>)...", reServiceFlags, "Set service flags", ServiceCommands},
+		&Command{"<service> flags", reServiceFlags, "List flags accepted by the service executable", ServiceCommands},
+		&Command{"<service> flags (<key>=<value> | <key>+=<value> | <key> | <key>- | *-)...", reServiceFlags, "Set, add or remove service flags", ServiceCommands},
 		&Command{"<service> set name=<service> groups=@<group-list>", reServiceFlags, "Set service parameters", ServiceCommands},
 		&Command{"<service> disable", reServiceFlags, "Disable service", ServiceCommands},
 		&Command{"<service> (manual|auto) instance_count=<uint> run_time=<duration> idle_time=<duration>", reServiceFlags, "Enable service", ServiceCommands},
+		&Command{"<service> signal <signal> (group)", reService, "Send a signal to running service instances", ServiceCommands},
+		&Command{"<service> upgrade (none|stale|restart)", reService, "Set policy when the service executable changes", ServiceCommands},
+		&Command{"<service> scale <count>", reService, "Start or stop instances until <count> are running", ServiceCommands},
+		&Command{"<service> restart (<settle-time>)", reService, "Rolling restart of running service instances", ServiceCommands},
+		&Command{"<service> explain", reService, "Explain where service flags and environment come from", ServiceCommands},
+		&Command{"<service> data (wipe)", reService, "Show or wipe the data directory for a service", ServiceCommands},
+		&Command{"<service> labels (<key>=<value> | <key>)...", reService, "Set service labels", ServiceCommands},
+		&Command{"<service> secrets (<key>)...", reService, "Mark service flags as secret, so their values are not shown", ServiceCommands},
+		&Command{"<service> envpolicy (default|clean|inherit|allow) (<var>)...", reService, "Set which variables are inherited from the gaffer environment", ServiceCommands},
+		&Command{"<service> hooks (<stage>(:<timeout>)=<command>)... | *-", reService, "Show or set commands run at each stage of the instance lifecycle", ServiceCommands},
+		&Command{"<service> args (<arg>)...", reService, "Set positional arguments which follow the flags", ServiceCommands},
+		&Command{"<service> style (single|double|separate)", reService, "Set how flags are passed to the executable", ServiceCommands},
+		&Command{"<instance> signal <signal> (group)", reInstance, "Send a signal to a running instance", InstanceCommands},
+		&Command{"<instance> labels (<key>=<value> | <key>)...", reInstance, "Set instance labels", InstanceCommands},
 		&Command{"@<group> add", reGroup, "Add a group", GroupCommands},
 		&Command{"@<group> rm", reGroup, "Remove a group", GroupCommands},
-		&Command{"@<group> flags (<key>=<value> | <key>)...", reGroup, "Set group flags", GroupCommands},
-		&Command{"@<group> env (<key>=<value> | <key>)...", reGroup, "Set group environment", GroupCommands},
+		&Command{"@<group> flags (<key>=<value> | <key>+=<value> | <key> | <key>- | *-)...", reGroup, "Set, add or remove group flags", GroupCommands},
+		&Command{"@<group> env (<key>=<value> | <key>+=<value> | <key> | <key>- | *-)...", reGroup, "Set, add or remove group environment", GroupCommands},
+		&Command{"@<group> secrets (<key>)...", reGroup, "Mark group flags and environment as secret, so their values are not shown", GroupCommands},
+		&Command{"@<group> envpolicy (default|clean|inherit|allow) (<var>)...", reGroup, "Set which variables are inherited from the gaffer environment", GroupCommands},
+		&Command{"@<group> envfiles (<path>)...", reGroup, "Set .env files read into the group environment", GroupCommands},
+		&Command{"@<group> hooks (<stage>(:<timeout>)=<command>)... | *-", reGroup, "Show or set commands run at each stage of the instance lifecycle", GroupCommands},
 		&Command{"@<group> set name=@<group>", reGroup, "Set group parameters", GroupCommands},
+		&Command{"@<group> set groups=@<group-list>", reGroup, "Set the groups included by a group", GroupCommands},
+		&Command{"@<group> signal <signal> (group)", reGroup, "Send a signal to running instances in a group", GroupCommands},
+		&Command{"@<group> start (all)", reGroup, "Start instances of every service in a group, stopping them again on failure with 'all'", GroupCommands},
+		&Command{"@<group> stop", reGroup, "Stop instances of every service in a group", GroupCommands},
+		&Command{"@<group> restart (<settle-time>) (all)", reGroup, "Rolling restart of every service in a group, ending on failure with 'all'", GroupCommands},
 	}
 )
 
@@ -80,21 +125,185 @@ func GetCommandForArgument(commands []*Command, arg string) *Command {
 	return nil
 }
 
-func Run(app *gopi.AppInstance, gaffer rpc.GafferClient, discovery rpc.DiscoveryClient) error {
-	// Get command
-	args := app.AppFlags.Args()
+// SignalArguments returns the signal name and whether the signal should be
+// delivered to the process group from "signal <signal> (group)" arguments
+func SignalArguments(args []string) (string, bool, error) {
+	if len(args) == 2 && args[0] == "signal" {
+		return args[1], false, nil
+	} else if len(args) == 3 && args[0] == "signal" && args[2] == "group" {
+		return args[1], true, nil
+	} else {
+		return "", false, gopi.ErrBadParameter
+	}
+}
+
+// FilterFromFlags returns a filter from the -service, -group, -selector,
+// -state, -sort, -offset and -limit command line flags
+func FilterFromFlags(flags *gopi.Flags) (rpc.GafferFilter, error) {
+	var filter rpc.GafferFilter
+	filter.Service, _ = flags.GetString("service")
+	filter.Group, _ = flags.GetString("group")
+	filter.Selector, _ = flags.GetString("selector")
+	filter.Sort, _ = flags.GetString("sort")
+	filter.Offset, _ = flags.GetUint("offset")
+	filter.Limit, _ = flags.GetUint("limit")
+	filter.Group = strings.TrimPrefix(filter.Group, "@")
+	if _, err := rpc.ParseLabelSelector(filter.Selector); err != nil {
+		return filter, err
+	} else if state, _ := flags.GetString("state"); state != "" {
+		if state_, err := rpc.InstanceStateForName(state); err != nil {
+			return filter, err
+		} else {
+			filter.State = state_
+		}
+	}
+	return filter, nil
+}
+
+// QueryFromFlags returns an event query from the -service, -group,
+// -instance, -since, -until and -limit command line flags
+func QueryFromFlags(flags *gopi.Flags) (rpc.GafferEventQuery, error) {
+	var query rpc.GafferEventQuery
+	query.Service, _ = flags.GetString("service")
+	query.Group, _ = flags.GetString("group")
+	query.Limit, _ = flags.GetUint("limit")
+	query.Group = strings.TrimPrefix(query.Group, "@")
+	if instance, _ := flags.GetUint("instance"); instance > 0 {
+		query.Instance = uint32(instance)
+	}
+	if since, _ := flags.GetDuration("since"); since < 0 {
+		return query, fmt.Errorf("Invalid -since value: %v", since)
+	} else if since > 0 {
+		query.Start = time.Now().Add(-since)
+	}
+	if until, _ := flags.GetDuration("until"); until < 0 {
+		return query, fmt.Errorf("Invalid -until value: %v", until)
+	} else if until > 0 {
+		query.End = time.Now().Add(-until)
+	}
+	return query, nil
+}
+
+// AuditQueryFromFlags returns an audit query from the -service, -group,
+// -identity, -since, -until and -limit command line flags, where the
+// service or group name is matched against the request parameters
+func AuditQueryFromFlags(flags *gopi.Flags, events rpc.GafferEventQuery) rpc.GafferAuditQuery {
+	query := rpc.GafferAuditQuery{
+		Start: events.Start,
+		End:   events.End,
+		Name:  events.Service,
+		Limit: events.Limit,
+	}
+	if query.Name == "" {
+		query.Name = events.Group
+	}
+	query.Identity, _ = flags.GetString("identity")
+	return query
+}
+
+// EventTypesFromArgs returns event types from command line arguments
+func EventTypesFromArgs(args []string) ([]rpc.GafferEventType, error) {
+	types := make([]rpc.GafferEventType, 0, len(args))
+	for _, arg := range args {
+		if type_, err := rpc.EventTypeForName(arg); err != nil {
+			return nil, err
+		} else {
+			types = append(types, type_)
+		}
+	}
+	return types, nil
+}
+
+// StreamFilterFromArgs returns a filter for streaming events from the
+// command line flags and event types in the arguments
+func StreamFilterFromArgs(args []string) (rpc.GafferFilter, error) {
+	filter := rpc.GafferFilter{
+		Service:  list_filter.Service,
+		Group:    list_filter.Group,
+		Selector: list_filter.Selector,
+		State:    list_filter.State,
+		Instance: event_query.Instance,
+	}
+	if types, err := EventTypesFromArgs(args); err != nil {
+		return filter, err
+	} else {
+		filter.Types = types
+	}
+	return filter, nil
+}
+
+// CommandFromArgs returns the command for the command line arguments
+func CommandFromArgs(args []string) (*Command, error) {
 	command := GetCommandForArgument(root_commands, "")
 	if len(args) > 0 {
 		command = GetCommandForArgument(root_commands, args[0])
 	}
 	if command == nil {
-		return gopi.ErrHelp
+		return nil, gopi.ErrHelp
+	} else {
+		return command, nil
 	}
+}
 
-	// Call command
-	if err := command.Callback(args, gaffer, discovery); err == gopi.ErrBadParameter {
+// SetQueriesFromFlags sets the filter and queries used by commands from
+// the command line flags
+func SetQueriesFromFlags(flags *gopi.Flags) error {
+	// Set the filter for listing services, groups and instances
+	if filter, err := FilterFromFlags(flags); err != nil {
+		return err
+	} else {
+		list_filter = filter
+	}
+
+	// Set the query for listing events
+	if query, err := QueryFromFlags(flags); err != nil {
+		return err
+	} else {
+		event_query = query
+	}
+
+	// Set the query for listing the audit log
+	audit_query = AuditQueryFromFlags(flags, event_query)
+
+	// Set the expected version for changing flags and environment
+	if version, _ := flags.GetUint("expect"); version > 0 {
+		patch_version = uint64(version)
+	}
+
+	// Success
+	return nil
+}
+
+// UsageError returns the usage for a command when it was called with bad
+// parameters, or else the error
+func UsageError(app *gopi.AppInstance, command *Command, err error) error {
+	if err == gopi.ErrBadParameter {
 		return fmt.Errorf("Usage: %v %v", app.AppFlags.Name(), command.Name)
 	} else {
 		return err
 	}
 }
+
+// WaitForInterrupt closes the interrupt channel on CTRL+C
+func WaitForInterrupt(app *gopi.AppInstance) {
+	app.WaitForSignal()
+	close(interrupt)
+}
+
+func Run(app *gopi.AppInstance, gaffer rpc.GafferClient, discovery rpc.DiscoveryClient) error {
+	// Get command
+	args := app.AppFlags.Args()
+	command, err := CommandFromArgs(args)
+	if err != nil {
+		return err
+	}
+
+	// Set filter and queries
+	if err := SetQueriesFromFlags(app.AppFlags); err != nil {
+		return err
+	}
+
+	// Call command
+	go WaitForInterrupt(app)
+	return UsageError(app, command, command.Callback(args, gaffer, discovery))
+}
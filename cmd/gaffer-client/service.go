@@ -11,6 +11,9 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	// Frameworks
 	gopi "github.com/djthorpe/gopi"
@@ -26,11 +29,269 @@ func ServiceCommands(args []string, gaffer rpc.GafferClient, discovery rpc.Disco
 		return gopi.ErrBadParameter
 	}
 
-	fmt.Println(service[1])
-	return gopi.ErrNotImplemented
+	// Parse arguments
+	if len(args) < 2 {
+		fmt.Println(service[1])
+		return gopi.ErrNotImplemented
+	}
+	switch args[1] {
+	case "signal":
+		if signal, group, err := SignalArguments(args[1:]); err != nil {
+			return err
+		} else if instances, err := gaffer.SignalService(service[1], signal, group); err != nil {
+			return err
+		} else if len(instances) == 0 {
+			return fmt.Errorf("No running instances")
+		} else {
+			return OutputInstances(os.Stdout, instances)
+		}
+	case "upgrade":
+		if len(args) != 3 {
+			return gopi.ErrBadParameter
+		} else if policy, err := rpc.UpgradePolicyForName(args[2]); err != nil {
+			return err
+		} else if service, err := gaffer.SetServiceUpgradePolicy(service[1], policy); err != nil {
+			return err
+		} else {
+			return OutputServices(os.Stdout, []rpc.GafferService{service})
+		}
+	case "explain":
+		if len(args) != 2 {
+			return gopi.ErrBadParameter
+		} else if flags, env, err := gaffer.ResolveService(service[1]); err != nil {
+			return err
+		} else if len(flags) == 0 && len(env) == 0 {
+			return fmt.Errorf("No flags or environment")
+		} else {
+			return OutputResolvedTuples(os.Stdout, flags, env)
+		}
+	case "data":
+		if len(args) == 2 {
+			if data, err := gaffer.GetServiceData(service[1]); err != nil {
+				return err
+			} else {
+				return OutputServiceData(os.Stdout, data)
+			}
+		} else if len(args) == 3 && args[2] == "wipe" {
+			if data, err := gaffer.WipeServiceData(service[1]); err != nil {
+				return err
+			} else {
+				return OutputServiceData(os.Stdout, data)
+			}
+		} else {
+			return gopi.ErrBadParameter
+		}
+	case "secrets":
+		if service_, err := gaffer.SetSecretsForService(service[1], DecodeKeys(args[2:])); err != nil {
+			return err
+		} else {
+			return OutputServices(os.Stdout, []rpc.GafferService{service_})
+		}
+	case "envpolicy":
+		if len(args) < 3 {
+			return gopi.ErrBadParameter
+		} else if policy, err := rpc.EnvPolicyForName(args[2]); err != nil {
+			return err
+		} else if service_, err := gaffer.SetServiceEnvPolicy(service[1], policy, args[3:]); err != nil {
+			return err
+		} else {
+			return OutputServices(os.Stdout, []rpc.GafferService{service_})
+		}
+	case "hooks":
+		if len(args) == 2 {
+			if service_, err := gaffer.GetService(service[1]); err != nil {
+				return err
+			} else {
+				return OutputHooks(os.Stdout, service_.Hooks())
+			}
+		} else if hooks, err := DecodeHooks(args[2:]); err != nil {
+			return err
+		} else if service_, err := gaffer.SetServiceHooks(service[1], hooks); err != nil {
+			return err
+		} else {
+			return OutputHooks(os.Stdout, service_.Hooks())
+		}
+	case "args":
+		if service_, err := gaffer.GetService(service[1]); err != nil {
+			return err
+		} else if service_, err := gaffer.SetServiceArgs(service[1], service_.FlagStyle(), args[2:]); err != nil {
+			return err
+		} else {
+			return OutputServices(os.Stdout, []rpc.GafferService{service_})
+		}
+	case "style":
+		if len(args) != 3 {
+			return gopi.ErrBadParameter
+		} else if style, err := rpc.FlagStyleForName(args[2]); err != nil {
+			return err
+		} else if service_, err := gaffer.GetService(service[1]); err != nil {
+			return err
+		} else if service_, err := gaffer.SetServiceArgs(service[1], style, service_.Args()); err != nil {
+			return err
+		} else {
+			return OutputServices(os.Stdout, []rpc.GafferService{service_})
+		}
+	case "labels":
+		if tuples, err := DecodeTuples(args[2:]); err != nil {
+			return err
+		} else if service_, err := gaffer.SetLabelsForService(service[1], tuples); err != nil {
+			return err
+		} else {
+			return OutputServices(os.Stdout, []rpc.GafferService{service_})
+		}
+	case "flags":
+		if len(args) == 2 {
+			return ListServiceFlags(service[1], gaffer)
+		} else if patch, err := DecodePatch(args[2:]); err != nil {
+			return err
+		} else if service_, err := gaffer.PatchFlagsForService(service[1], patch_version, patch); err != nil {
+			// Offer the flags the executable accepts
+			ListServiceFlags(service[1], gaffer)
+			return err
+		} else {
+			return OutputServices(os.Stdout, []rpc.GafferService{service_})
+		}
+	case "scale":
+		if len(args) != 3 {
+			return gopi.ErrBadParameter
+		} else if count, err := strconv.ParseUint(args[2], 10, 32); err != nil {
+			return gopi.ErrBadParameter
+		} else {
+			return WithProgress(func(progress chan<- rpc.GafferEvent) error {
+				return gaffer.ScaleService(service[1], uint(count), progress)
+			})
+		}
+	case "restart":
+		settle := time.Duration(0)
+		if len(args) > 3 {
+			return gopi.ErrBadParameter
+		} else if len(args) == 3 {
+			if duration, err := time.ParseDuration(args[2]); err != nil || duration < 0 {
+				return gopi.ErrBadParameter
+			} else {
+				settle = duration
+			}
+		}
+		return WithProgress(func(progress chan<- rpc.GafferEvent) error {
+			return gaffer.RestartService(service[1], settle, progress)
+		})
+	default:
+		return gopi.ErrNotImplemented
+	}
+}
+
+// ListServiceFlags outputs the flags accepted by the executable for
+// a service, together with the values set for the service
+func ListServiceFlags(name string, gaffer rpc.GafferClient) error {
+	if service, err := gaffer.GetService(name); err != nil {
+		return err
+	} else if flags, err := gaffer.ListFlagsForExecutable(service.Path()); err != nil {
+		return err
+	} else {
+		return OutputFlags(os.Stdout, flags, service.Flags())
+	}
+}
+
+// DecodeTuples returns tuples from <key>=<value> or <key> arguments,
+// where the key can have initial minus signs. Repeated keys have
+// more than one value
+func DecodeTuples(args []string) (rpc.Tuples, error) {
+	var tuples rpc.Tuples
+	tuples.RemoveAll()
+	for _, arg := range args {
+		key_value := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)
+		if len(key_value) == 1 {
+			key_value = append(key_value, "")
+		}
+		if err := tuples.AddStringForKey(key_value[0], key_value[1]); err != nil {
+			return tuples, err
+		}
+	}
+	return tuples, nil
+}
+
+// DecodePatch returns a patch from <key>=<value>, <key>+=<value>, <key>,
+// <key>- or *- arguments, where the key can have initial minus signs.
+// Repeated keys set more than one value, <key>+= adds to the existing
+// values, <key>- removes the key and *- removes all keys
+func DecodePatch(args []string) ([]rpc.GafferTuplesPatch, error) {
+	patch := make([]rpc.GafferTuplesPatch, 0, len(args))
+	set := make(map[string]bool)
+	for _, arg := range args {
+		arg = strings.TrimLeft(arg, "-")
+		key_value := strings.SplitN(arg, "=", 2)
+		if arg == "*-" {
+			patch = append(patch, rpc.GafferTuplesPatch{Op: rpc.GAFFER_TUPLES_CLEAR})
+		} else if len(key_value) == 1 && strings.HasSuffix(arg, "-") {
+			patch = append(patch, rpc.GafferTuplesPatch{Op: rpc.GAFFER_TUPLES_UNSET, Key: strings.TrimSuffix(arg, "-")})
+		} else if len(key_value) == 1 {
+			patch = append(patch, rpc.GafferTuplesPatch{Op: rpc.GAFFER_TUPLES_SET, Key: arg})
+		} else if strings.HasSuffix(key_value[0], "+") {
+			patch = append(patch, rpc.GafferTuplesPatch{Op: rpc.GAFFER_TUPLES_ADD, Key: strings.TrimSuffix(key_value[0], "+"), Value: key_value[1]})
+		} else if set[key_value[0]] {
+			patch = append(patch, rpc.GafferTuplesPatch{Op: rpc.GAFFER_TUPLES_ADD, Key: key_value[0], Value: key_value[1]})
+		} else {
+			set[key_value[0]] = true
+			patch = append(patch, rpc.GafferTuplesPatch{Op: rpc.GAFFER_TUPLES_SET, Key: key_value[0], Value: key_value[1]})
+		}
+	}
+	return patch, nil
+}
+
+// DecodeKeys returns keys from arguments, where the key can have
+// initial minus signs
+func DecodeKeys(args []string) []string {
+	keys := make([]string, len(args))
+	for i, arg := range args {
+		keys[i] = strings.TrimLeft(arg, "-")
+	}
+	return keys
+}
+
+// DecodeHooks returns hooks from <stage>=<command> or
+// <stage>:<timeout>=<command> arguments, or no hooks for a *- argument
+func DecodeHooks(args []string) ([]rpc.GafferHook, error) {
+	hooks := make([]rpc.GafferHook, 0, len(args))
+	if len(args) == 1 && args[0] == "*-" {
+		return hooks, nil
+	}
+	for _, arg := range args {
+		stage_command := strings.SplitN(arg, "=", 2)
+		if len(stage_command) != 2 {
+			return nil, fmt.Errorf("Syntax error: %v (expecting <stage>=<command>)", strconv.Quote(arg))
+		}
+		stage_timeout := strings.SplitN(stage_command[0], ":", 2)
+		hook := rpc.GafferHook{Command: stage_command[1]}
+		if stage, err := rpc.HookStageForName(stage_timeout[0]); err != nil {
+			return nil, err
+		} else {
+			hook.Stage = stage
+		}
+		if len(stage_timeout) == 2 {
+			if timeout, err := time.ParseDuration(stage_timeout[1]); err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("Syntax error: %v (invalid timeout)", strconv.Quote(stage_timeout[1]))
+			} else {
+				hook.Timeout = timeout
+			}
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
 
-	// Success
-	return nil
+// WithProgress calls a function which reports progress events, and outputs
+// the events as they are received
+func WithProgress(fn func(chan<- rpc.GafferEvent) error) error {
+	progress := make(chan rpc.GafferEvent)
+	done := make(chan struct{})
+	go func() {
+		OutputProgress(os.Stdout, progress)
+		close(done)
+	}()
+	err := fn(progress)
+	close(progress)
+	<-done
+	return err
 }
 
 func AddService(args []string, gaffer rpc.GafferClient, discovery rpc.DiscoveryClient) error {
@@ -0,0 +1,265 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+	rpc "github.com/djthorpe/gopi-rpc"
+	tablewriter "github.com/olekukonko/tablewriter"
+
+	// Modules
+	_ "github.com/djthorpe/gopi-rpc/sys/dns-sd"
+	_ "github.com/djthorpe/gopi-rpc/sys/grpc"
+	_ "github.com/djthorpe/gopi-rpc/sys/scheduler"
+	_ "github.com/djthorpe/gopi/sys/logger"
+
+	// Services
+	_ "github.com/djthorpe/gopi-rpc/rpc/grpc/gaffer"
+)
+
+const (
+	DELTA_RECONCILE = 10 * time.Second
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Commands are the first argument, and an empty command lists the jobs
+// and placements
+var (
+	commands = []struct {
+		Name        string
+		Description string
+	}{
+		{"", "List jobs and the instances placed on nodes"},
+		{"nodes", "List nodes with labels, capacity and running instances"},
+		{"add <service> (count=<n>) (selector=<labels>) (spread=<label>) (affinity=<service>,...) (antiaffinity=<service>,...)", "Set the job for a service"},
+		{"rm <service>", "Remove the job for a service, which stops the instances"},
+		{"run", "Place instances on nodes until CTRL+C is pressed"},
+	}
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func ListJobs(fh io.Writer, scheduler rpc.GafferScheduler) error {
+	jobs, err := scheduler.Jobs()
+	if err != nil {
+		return err
+	}
+	placements := make(map[string][]string, len(jobs))
+	for _, placement := range scheduler.Placements() {
+		placements[placement.Service] = append(placements[placement.Service], fmt.Sprint(placement.Node, "/", placement.Instance))
+	}
+	output := tablewriter.NewWriter(fh)
+	output.SetHeader([]string{"SERVICE", "COUNT", "SELECTOR", "SPREAD", "AFFINITY", "ANTI-AFFINITY", "PLACEMENTS"})
+	for _, job := range jobs {
+		sort.Strings(placements[job.Service])
+		output.Append([]string{
+			job.Service,
+			fmt.Sprint(job.Count),
+			RenderString(job.Selector),
+			RenderString(job.Spread),
+			RenderString(strings.Join(job.Affinity, "\n")),
+			RenderString(strings.Join(job.AntiAffinity, "\n")),
+			RenderString(strings.Join(placements[job.Service], "\n")),
+		})
+	}
+	output.Render()
+	return nil
+}
+
+func ListNodes(fh io.Writer, scheduler rpc.GafferScheduler) error {
+	nodes, err := scheduler.Nodes()
+	if err != nil {
+		return err
+	}
+	output := tablewriter.NewWriter(fh)
+	output.SetHeader([]string{"NODE", "LABELS", "CAPACITY", "RUNNING", "SERVICES", "STATUS"})
+	for _, node := range nodes {
+		capacity := "-"
+		if node.Capacity > 0 {
+			capacity = fmt.Sprint(node.Capacity)
+		}
+		services := make([]string, 0, len(node.Services))
+		for service, count := range node.Services {
+			services = append(services, fmt.Sprint(service, "=", count))
+		}
+		sort.Strings(services)
+		status := "ok"
+		if node.Error != nil {
+			status = node.Error.Error()
+		}
+		output.Append([]string{
+			node.Name,
+			RenderLabels(node.Labels),
+			capacity,
+			fmt.Sprint(node.Running),
+			RenderString(strings.Join(services, "\n")),
+			status,
+		})
+	}
+	output.Render()
+	return nil
+}
+
+// JobFromArgs returns a job from the service name and key=value arguments
+func JobFromArgs(args []string) (rpc.GafferJob, error) {
+	job := rpc.GafferJob{Count: 1}
+	if len(args) == 0 {
+		return job, gopi.ErrHelp
+	}
+	job.Service = args[0]
+	for _, arg := range args[1:] {
+		if kv := strings.SplitN(arg, "=", 2); len(kv) != 2 {
+			return job, fmt.Errorf("Invalid argument: %v", strconv.Quote(arg))
+		} else if key, value := strings.ToLower(strings.TrimSpace(kv[0])), strings.TrimSpace(kv[1]); key == "count" {
+			if count, err := strconv.ParseUint(value, 10, 32); err != nil {
+				return job, fmt.Errorf("Invalid count: %v", strconv.Quote(value))
+			} else {
+				job.Count = uint(count)
+			}
+		} else if key == "selector" {
+			job.Selector = value
+		} else if key == "spread" {
+			job.Spread = value
+		} else if key == "affinity" {
+			job.Affinity = SplitList(value)
+		} else if key == "antiaffinity" {
+			job.AntiAffinity = SplitList(value)
+		} else {
+			return job, fmt.Errorf("Invalid argument: %v", strconv.Quote(arg))
+		}
+	}
+	return job, nil
+}
+
+// Reconcile places instances on nodes until a signal is received
+func Reconcile(app *gopi.AppInstance, scheduler rpc.GafferScheduler) error {
+	delta, _ := app.AppFlags.GetDuration("delta")
+	if delta == 0 {
+		delta = DELTA_RECONCILE
+	}
+	for {
+		if err := scheduler.Reconcile(); err != nil {
+			app.Logger.Error("Reconcile: %v", err)
+		}
+		if app.WaitForSignalOrTimeout(delta) {
+			return nil
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func Main(app *gopi.AppInstance, done chan<- struct{}) error {
+	scheduler := app.ModuleInstance("scheduler").(rpc.GafferScheduler)
+	args := app.AppFlags.Args()
+	if len(args) == 0 {
+		return ListJobs(os.Stdout, scheduler)
+	}
+	switch args[0] {
+	case "nodes":
+		if len(args) != 1 {
+			return gopi.ErrHelp
+		}
+		return ListNodes(os.Stdout, scheduler)
+	case "add":
+		if job, err := JobFromArgs(args[1:]); err != nil {
+			return err
+		} else if err := scheduler.SetJob(job); err != nil {
+			return err
+		} else {
+			return ListJobs(os.Stdout, scheduler)
+		}
+	case "rm":
+		if len(args) != 2 {
+			return gopi.ErrHelp
+		} else if err := scheduler.RemoveJob(args[1]); err != nil {
+			return err
+		} else {
+			return ListJobs(os.Stdout, scheduler)
+		}
+	case "run":
+		if len(args) != 1 {
+			return gopi.ErrHelp
+		}
+		return Reconcile(app, scheduler)
+	default:
+		return gopi.ErrHelp
+	}
+}
+
+func Usage(flags *gopi.Flags) {
+	fh := os.Stdout
+
+	fmt.Fprintf(fh, "%v: Instance Scheduler for Gaffer\nhttps://github.com/djthorpe/gopi-rpc/\n\n", flags.Name())
+	fmt.Fprintf(fh, "Syntax:\n\n")
+	fmt.Fprintf(fh, "  %v (<flags>...) (<command>) (<argument>...)\n\n", flags.Name())
+	fmt.Fprintf(fh, "Commands:\n\n")
+	for _, command := range commands {
+		fmt.Fprintf(fh, "  %v %v\n", flags.Name(), command.Name)
+		fmt.Fprintf(fh, "        %v\n", command.Description)
+		fmt.Fprintf(fh, "\n")
+	}
+	fmt.Fprintf(fh, "Command line flags:\n\n")
+	flags.PrintDefaults()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func RenderString(value string) string {
+	if value == "" {
+		return "-"
+	} else {
+		return value
+	}
+}
+
+func RenderLabels(labels rpc.Tuples) string {
+	lines := make([]string, 0, labels.Len())
+	for _, key := range labels.Keys() {
+		lines = append(lines, key+"="+labels.StringForKey(key))
+	}
+	return RenderString(strings.Join(lines, "\n"))
+}
+
+// SplitList returns the comma-separated values, ignoring empty values
+func SplitList(value string) []string {
+	values := make([]string, 0)
+	for _, value := range strings.Split(value, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func main() {
+	// Create the configuration
+	config := gopi.NewAppConfig("scheduler", "discovery")
+
+	// Set usage
+	config.AppFlags.SetUsageFunc(Usage)
+
+	// Set flags
+	config.AppFlags.FlagDuration("delta", DELTA_RECONCILE, "Interval between placing instances when running")
+
+	// Run the command line tool
+	os.Exit(gopi.CommandLineTool2(config, Main))
+}
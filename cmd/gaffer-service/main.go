@@ -19,6 +19,7 @@ import (
 	_ "github.com/djthorpe/gopi-rpc/sys/dns-sd"
 	_ "github.com/djthorpe/gopi-rpc/sys/gaffer"
 	_ "github.com/djthorpe/gopi-rpc/sys/grpc"
+	_ "github.com/djthorpe/gopi-rpc/sys/webhook"
 	_ "github.com/djthorpe/gopi/sys/logger"
 
 	// Services
@@ -31,7 +32,7 @@ import (
 
 func main() {
 	// Create the configuration
-	config := gopi.NewAppConfig("rpc/gaffer:service", "rpc/version:service", "rpc/discovery:service")
+	config := gopi.NewAppConfig("rpc/gaffer:service", "rpc/version:service", "rpc/discovery:service", "webhook")
 
 	// Run the server and register all the services
 	os.Exit(rpc.Server(config))
@@ -13,8 +13,10 @@ import (
 	// Frameworks
 	"encoding/json"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/djthorpe/gopi"
@@ -32,6 +34,17 @@ type Gaffer interface {
 	GetGroups() []GafferServiceGroup
 	GetInstances() []GafferServiceInstance
 	GetExecutables(recursive bool) []string
+	GetExecutableForPath(path string) (GafferExecutable, error)
+
+	// Return the flags accepted by an executable, which are read
+	// by running the executable with the -help flag
+	GetFlagsForExecutable(path string) ([]GafferFlag, error)
+
+	// Upload executables into the binary root, and restore previous versions
+	// by checksum, or the most recent previous version when the checksum is
+	// empty
+	UploadExecutable(path string, data io.Reader, checksum string) (GafferExecutable, error)
+	RollbackExecutable(path, checksum string) (GafferExecutable, error)
 
 	// Services
 	AddServiceForPath(string) (GafferService, error)
@@ -41,11 +54,41 @@ type Gaffer interface {
 	SetServiceModeForName(string, GafferServiceMode) error
 	SetServiceInstanceCountForName(service string, count uint) error
 	SetServiceGroupsForName(service string, groups []string) error
+	SetServiceUpgradePolicyForName(service string, policy GafferUpgradePolicy) error
+	SetServiceLabelsForName(service string, labels Tuples) error
+	SetServiceArgsForName(service string, style GafferFlagStyle, args []string) error
+
+	// Mark flags and environment keys as secret, in addition to keys
+	// which match the secret key patterns. Values for secret keys are
+	// redacted, but are passed to instances
+	SetServiceSecretsForName(service string, keys []string) error
+	SetGroupSecretsForName(group string, keys []string) error
+
+	// Set which variables instances inherit from the gaffer environment,
+	// where allow is a list of variable names or patterns for the allow
+	// policy, and the files in the .env format which are read into the
+	// environment for a group when instances are started
+	SetServiceEnvPolicyForName(service string, policy GafferEnvPolicy, allow []string) error
+	SetGroupEnvPolicyForName(group string, policy GafferEnvPolicy, allow []string) error
+	SetGroupEnvFilesForName(group string, files []string) error
+
+	// Set the commands which are run at each stage of the lifecycle of
+	// an instance, replacing the existing hooks
+	SetServiceHooksForName(service string, hooks []GafferHook) error
+	SetGroupHooksForName(group string, hooks []GafferHook) error
+
+	// Patch flags and environment for services and groups. The version is the
+	// expected version of the service or group, or zero to skip the check
+	PatchServiceFlagsForName(service string, version uint64, patch []GafferTuplesPatch) error
+	PatchGroupFlagsForName(group string, version uint64, patch []GafferTuplesPatch) error
+	PatchGroupEnvForName(group string, version uint64, patch []GafferTuplesPatch) error
 
 	// Groups
 	GetGroupsForNames([]string) []GafferServiceGroup
+	ResolveGroupsForNames([]string) []GafferServiceGroup
 	AddGroupForName(string) (GafferServiceGroup, error)
 	SetGroupNameForName(group string, new string) error
+	SetGroupGroupsForName(group string, groups []string) error
 	RemoveGroupForName(string) error
 
 	// Tuples
@@ -53,11 +96,58 @@ type Gaffer interface {
 	SetGroupFlagsForName(string, Tuples) error
 	SetGroupEnvForName(string, Tuples) error
 
+	// Return the flags and environment for a service as they would be
+	// resolved when an instance is started, without starting an instance
+	ResolveServiceForName(service string) ([]GafferResolvedTuple, []GafferResolvedTuple, error)
+
+	// Return the persistent data directory for a service, or remove the
+	// contents of the directory when no instances of the service are running
+	GetServiceDataForName(service string) (GafferServiceData, error)
+	WipeServiceDataForName(service string) (GafferServiceData, error)
+
+	// Return events from the journal which match a query, in the order
+	// they were emitted, and the sequence number of the most recent event
+	QueryEvents(query GafferEventQuery) ([]GafferEvent, error)
+	EventSeq() uint64
+
+	// Return crash reports for instances which exited abnormally, most
+	// recent first, for services matching a name pattern, or return a
+	// crash report by identifier
+	ListCrashReports(service string) ([]GafferCrashReport, error)
+	GetCrashReportForId(id uint64) (GafferCrashReport, error)
+
+	// Record a call which changed services, groups or instances in the
+	// audit log, where secret values in the parameters are redacted, and
+	// return records from the audit log which match a query, in the order
+	// they were recorded
+	AppendAudit(peer, identity, method string, params Tuples, err error) error
+	QueryAudit(query GafferAuditQuery) ([]GafferAuditRecord, error)
+
 	// Instances
 	GetInstanceForId(id uint32) GafferServiceInstance
 	GenerateInstanceId() uint32
 	StartInstanceForServiceName(service string, id uint32) (GafferServiceInstance, error)
 	StopInstanceForId(id uint32) error
+	SetInstanceLabelsForId(id uint32, labels Tuples) (GafferServiceInstance, error)
+
+	// Signals, which are delivered to the process or the process group.
+	// When some instances cannot be signalled, the instances which were
+	// signalled are returned with the errors
+	SignalInstanceForId(id uint32, signal syscall.Signal, group bool) (GafferServiceInstance, error)
+	SignalInstancesForServiceName(service string, signal syscall.Signal, group bool) ([]GafferServiceInstance, error)
+	SignalInstancesForGroupName(group string, signal syscall.Signal, process_group bool) ([]GafferServiceInstance, error)
+
+	// Scale the number of running instances and perform rolling restarts,
+	// reporting progress on a channel which can be nil
+	ScaleServiceForName(service string, count uint, progress chan<- GafferEvent) error
+	RestartServiceForName(service string, settle time.Duration, progress chan<- GafferEvent) error
+
+	// Start, stop and restart every service in a group, returning a result
+	// for each service. When all is true, a failure stops the instances
+	// which were started by the operation
+	StartGroupForName(group string, all bool) ([]GafferServiceResult, error)
+	StopGroupForName(group string) ([]GafferServiceResult, error)
+	RestartGroupForName(group string, settle time.Duration, all bool) ([]GafferServiceResult, error)
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -72,13 +162,59 @@ type GafferService interface {
 	RunTime() time.Duration
 	IdleTime() time.Duration
 	Flags() Tuples
+	Labels() Tuples
 	IsMemberOfGroup(string) bool
+
+	// FlagStyle determines how flags are passed to the executable, and
+	// Args are positional arguments which follow the flags
+	FlagStyle() GafferFlagStyle
+	Args() []string
+
+	// Version is incremented when the flags or labels change
+	Version() uint64
+
+	// Secrets returns the keys for flags which are redacted
+	Secrets() []string
+
+	// EnvPolicy determines which variables instances inherit from the
+	// gaffer environment, and EnvAllow the variables for the allow policy
+	EnvPolicy() GafferEnvPolicy
+	EnvAllow() []string
+
+	// Hooks returns the commands which are run at each stage of the
+	// lifecycle of an instance
+	Hooks() []GafferHook
+
+	// UpgradePolicy determines what happens when the executable changes,
+	// and IsStale returns true when instances run an outdated executable
+	UpgradePolicy() GafferUpgradePolicy
+	IsStale() bool
 }
 
 type GafferServiceGroup interface {
 	Name() string
+
+	// Groups returns the groups which are included by the group
+	Groups() []string
 	Flags() Tuples
 	Env() Tuples
+
+	// Version is incremented when the flags or environment change
+	Version() uint64
+
+	// Secrets returns the keys for flags and environment which are redacted
+	Secrets() []string
+
+	// EnvPolicy and EnvAllow determine which variables instances inherit
+	// from the gaffer environment, and EnvFiles are files in the .env format
+	// which are read into the environment
+	EnvPolicy() GafferEnvPolicy
+	EnvAllow() []string
+	EnvFiles() []string
+
+	// Hooks returns the commands which are run at each stage of the
+	// lifecycle of an instance
+	Hooks() []GafferHook
 }
 
 type GafferServiceInstance interface {
@@ -86,9 +222,149 @@ type GafferServiceInstance interface {
 	Service() GafferService
 	Flags() Tuples
 	Env() Tuples
+
+	// Args returns the positional arguments, with variables expanded
+	Args() []string
+
+	// Labels are copied from the service when the instance is created
+	Labels() Tuples
 	Start() time.Time
 	Stop() time.Time
 	ExitCode() int64
+
+	// Executable returns the executable the instance was started from,
+	// or nil if the instance has not been started
+	Executable() GafferExecutable
+
+	// RunDir returns the directory created for the instance, which is
+	// removed when the instance stops
+	RunDir() string
+}
+
+// GafferServiceData is the persistent data directory for a service
+type GafferServiceData interface {
+	Service() string
+	Path() string
+
+	// Size returns the total size of the files in the directory, and Files
+	// returns the number of files
+	Size() int64
+	Files() uint
+
+	// ModTime returns the most recent modification time of the files
+	ModTime() time.Time
+}
+
+// GafferCrashReport records an instance which exited abnormally
+type GafferCrashReport interface {
+	Id() uint64
+	Service() string
+	Instance() uint32
+	Timestamp() time.Time
+
+	// ExitCode is -1 when the process was terminated by a signal, and
+	// Signal returns the name of the signal
+	ExitCode() int64
+	Signal() string
+	CoreDumped() bool
+
+	// Uptime is the time the instance was running
+	Uptime() time.Duration
+
+	// Stdout and Stderr return the last lines of output
+	Stdout() []string
+	Stderr() []string
+
+	// Flags, Env and Args are resolved for the instance, with secret
+	// values redacted
+	Flags() Tuples
+	Env() Tuples
+	Args() []string
+
+	// UserTime, SystemTime and MaxRSS (in kilobytes) are the resources
+	// used by the process
+	UserTime() time.Duration
+	SystemTime() time.Duration
+	MaxRSS() int64
+}
+
+// GafferAuditRecord records a call which changed services, groups or
+// instances
+type GafferAuditRecord interface {
+	Seq() uint64
+	Timestamp() time.Time
+
+	// Peer is the address of the caller, and Identity is the authenticated
+	// identity of the caller or an empty string
+	Peer() string
+	Identity() string
+
+	// Method is the name of the method called, and Params are the request
+	// parameters with secret values redacted
+	Method() string
+	Params() Tuples
+
+	// Error is the error returned by the call, or an empty string
+	Error() string
+}
+
+type GafferExecutable interface {
+	Path() string
+	Size() int64
+	ModTime() time.Time
+
+	// Checksum returns the hex-encoded SHA-256 of the executable
+	Checksum() string
+
+	// Arch returns the architecture of an ELF binary, or empty string
+	Arch() string
+
+	// IsGopi returns true if the executable was built with gopi
+	IsGopi() bool
+
+	// Services returns the names of services which reference the
+	// executable, when listing executables
+	Services() []string
+}
+
+type GafferFlag interface {
+	Name() string
+
+	// Type returns bool, duration, float, int, int64, string, uint,
+	// uint64 or the name of a value type
+	Type() string
+	Default() string
+	Usage() string
+}
+
+type GafferTupleValue interface {
+	Key() string
+	Value() string
+
+	// Origin returns "service" or "@<group>" for tuples, and "env", "gaffer"
+	// or "unresolved" for variables
+	Origin() string
+}
+
+type GafferResolvedTuple interface {
+	GafferTupleValue
+
+	// Raw returns the value before variables were expanded
+	Raw() string
+
+	// Variables returns the variables which were expanded in the value
+	Variables() []GafferTupleValue
+
+	// Overrides returns the lower-precedence values which were not used
+	Overrides() []GafferTupleValue
+}
+
+// GafferServiceResult is the result of a group operation for one service,
+// with the instances which were started or stopped
+type GafferServiceResult interface {
+	Service() GafferService
+	Instances() []GafferServiceInstance
+	Error() error
 }
 
 type GafferEvent interface {
@@ -99,6 +375,11 @@ type GafferEvent interface {
 	Group() GafferServiceGroup
 	Instance() GafferServiceInstance
 	Data() []byte
+
+	// Seq is the sequence number of the event in the journal, which
+	// increases for each event, and Timestamp is when it was emitted
+	Seq() uint64
+	Timestamp() time.Time
 }
 
 type GafferClient interface {
@@ -108,20 +389,32 @@ type GafferClient interface {
 	Ping() error
 
 	// Return list of executables which can be used as microservices
-	ListExecutables() ([]string, error)
+	ListExecutables() ([]GafferExecutable, error)
+
+	// Return the flags accepted by an executable
+	ListFlagsForExecutable(path string) ([]GafferFlag, error)
+
+	// Upload an executable, or restore a previous version of an executable
+	// by checksum, or the most recent previous version when the checksum is
+	// empty
+	UploadExecutable(path string, data io.ReadSeeker) (GafferExecutable, error)
+	RollbackExecutable(path, checksum string) (GafferExecutable, error)
 
 	// Return services
 	ListServices() ([]GafferService, error)
 	ListServicesForGroup(string) ([]GafferService, error)
+	ListServicesWithFilter(GafferFilter) ([]GafferService, error)
 	GetService(string) (GafferService, error)
 
 	// Return groups
 	ListGroups() ([]GafferServiceGroup, error)
 	ListGroupsForService(string) ([]GafferServiceGroup, error)
+	ListGroupsWithFilter(GafferFilter) ([]GafferServiceGroup, error)
 	GetGroup(string) (GafferServiceGroup, error)
 
 	// Return instances
 	ListInstances() ([]GafferServiceInstance, error)
+	ListInstancesWithFilter(GafferFilter) ([]GafferServiceInstance, error)
 
 	// Add services and groups
 	AddServiceForPath(path string, groups []string) (GafferService, error)
@@ -136,22 +429,259 @@ type GafferClient interface {
 	StartInstance(string, uint32) (GafferServiceInstance, error)
 	StopInstance(uint32) (GafferServiceInstance, error)
 
+	// Send a named signal to an instance, or the instances of a service or group
+	SignalInstance(id uint32, signal string, group bool) (GafferServiceInstance, error)
+	SignalService(service, signal string, group bool) ([]GafferServiceInstance, error)
+	SignalGroup(group, signal string, process_group bool) ([]GafferServiceInstance, error)
+
+	// Scale and restart service instances, streaming progress events
+	ScaleService(service string, count uint, progress chan<- GafferEvent) error
+	RestartService(service string, settle time.Duration, progress chan<- GafferEvent) error
+
+	// Start, stop and restart every service in a group
+	StartGroup(group string, all bool) ([]GafferServiceResult, error)
+	StopGroup(group string) ([]GafferServiceResult, error)
+	RestartGroup(group string, settle time.Duration, all bool) ([]GafferServiceResult, error)
+
 	// Set flags and env
 	SetFlagsForService(string, Tuples) (GafferService, error)
 	SetFlagsForGroup(string, Tuples) (GafferServiceGroup, error)
 	SetEnvForGroup(string, Tuples) (GafferServiceGroup, error)
 
+	// Patch flags and env, where version is the expected version of the
+	// service or group, or zero to skip the check
+	PatchFlagsForService(string, uint64, []GafferTuplesPatch) (GafferService, error)
+	PatchFlagsForGroup(string, uint64, []GafferTuplesPatch) (GafferServiceGroup, error)
+	PatchEnvForGroup(string, uint64, []GafferTuplesPatch) (GafferServiceGroup, error)
+
+	// Mark flags and env keys as secret
+	SetSecretsForService(string, []string) (GafferService, error)
+	SetSecretsForGroup(string, []string) (GafferServiceGroup, error)
+
+	// Set inherited environment and env files
+	SetServiceEnvPolicy(string, GafferEnvPolicy, []string) (GafferService, error)
+	SetGroupEnvPolicy(string, GafferEnvPolicy, []string) (GafferServiceGroup, error)
+	SetGroupEnvFiles(string, []string) (GafferServiceGroup, error)
+
+	// Set lifecycle hooks
+	SetServiceHooks(string, []GafferHook) (GafferService, error)
+	SetGroupHooks(string, []GafferHook) (GafferServiceGroup, error)
+
+	// Return the resolved flags and environment for a service
+	ResolveService(string) ([]GafferResolvedTuple, []GafferResolvedTuple, error)
+
+	// Return or wipe the data directory for a service
+	GetServiceData(string) (GafferServiceData, error)
+	WipeServiceData(string) (GafferServiceData, error)
+
+	// Return events from the journal
+	QueryEvents(GafferEventQuery) ([]GafferEvent, error)
+
+	// Return crash reports
+	ListCrashReports(service string) ([]GafferCrashReport, error)
+	GetCrashReport(id uint64) (GafferCrashReport, error)
+
+	// Return records from the audit log
+	QueryAudit(GafferAuditQuery) ([]GafferAuditRecord, error)
+
 	// Set other service parameters
 	SetServiceGroups(string, []string) (GafferService, error)
+	SetGroupGroups(string, []string) (GafferServiceGroup, error)
+	SetServiceUpgradePolicy(string, GafferUpgradePolicy) (GafferService, error)
+	SetServiceArgs(string, GafferFlagStyle, []string) (GafferService, error)
+
+	// Set labels for a service or an instance
+	SetLabelsForService(string, Tuples) (GafferService, error)
+	SetLabelsForInstance(uint32, Tuples) (GafferServiceInstance, error)
 
 	// Stream Events
 	StreamEvents(chan<- GafferEvent) error
+	StreamEventsWithFilter(GafferFilter, chan<- GafferEvent) error
+}
+
+// GafferScheduler places instances of services on gaffer nodes which are
+// discovered on the network
+type GafferScheduler interface {
+	gopi.Driver
+
+	// Return the jobs, and set or remove the job for a service. Jobs are
+	// read from a file which is read again when it changes
+	Jobs() ([]GafferJob, error)
+	SetJob(GafferJob) error
+	RemoveJob(service string) error
+
+	// Return the instances placed on nodes, which are recorded in a file
+	Placements() []GafferPlacement
+
+	// Return the nodes discovered on the network
+	Nodes() ([]*GafferNode, error)
+
+	// Reconcile discovers the nodes, forgets instances on nodes which have
+	// gone, and starts or stops instances so that each job has the number
+	// of instances requested. Instances placed for services without a job
+	// are stopped
+	Reconcile() error
+}
+
+// GafferFilter selects services, groups, instances and events. Empty
+// fields match everything
+type GafferFilter struct {
+	// Service and Group are name patterns, which can include the wildcards
+	// '*' and '?'. Services, instances and events match a group pattern
+	// when the service is a member of a matching group
+	Service string
+	Group   string
+
+	// Selector matches labels, for example "env=prod,tier!=edge"
+	Selector string
+
+	// State matches instances and instance events by state
+	State GafferInstanceState
+
+	// Sort is "name", "id" or "start", with a '-' prefix to reverse the
+	// order. Offset and Limit return a page of results. These are not
+	// used for events
+	Sort   string
+	Offset uint
+	Limit  uint
+
+	// Types and Instance match events by type and instance identifier,
+	// and After resumes a stream of events after a sequence number. These
+	// are only used for events
+	Types    []GafferEventType
+	Instance uint32
+	After    uint64
+}
+
+// GafferEventQuery selects events from the journal. Empty fields match
+// everything
+type GafferEventQuery struct {
+	// Start and End are the time range for events, where the end is
+	// exclusive. A zero time is unbounded
+	Start time.Time
+	End   time.Time
+
+	// Types of event to return
+	Types []GafferEventType
+
+	// Service and Group are name patterns, which can include the wildcards
+	// '*' and '?'. Events match a group pattern when the service was a
+	// member of a matching group when the event was emitted
+	Service string
+	Group   string
+
+	// Instance is an instance identifier
+	Instance uint32
+
+	// After returns events with a sequence number greater than After. An
+	// error is returned if some of these events have been removed from
+	// the journal
+	After uint64
+
+	// Limit returns the most recent events, up to the limit
+	Limit uint
+}
+
+// GafferAuditQuery selects records from the audit log. Empty fields match
+// everything
+type GafferAuditQuery struct {
+	// Start and End are the time range for records, where the end is
+	// exclusive. A zero time is unbounded
+	Start time.Time
+	End   time.Time
+
+	// Method, Identity and Name are patterns, which can include the
+	// wildcards '*' and '?'. Name matches the service, group or executable
+	// in the request parameters
+	Method   string
+	Identity string
+	Name     string
+
+	// Limit returns the most recent records, up to the limit
+	Limit uint
+}
+
+// GafferHook is a shell command which is run at a stage of the lifecycle
+// of an instance, with the environment of the instance
+type GafferHook struct {
+	Stage   GafferHookStage `json:"stage"`
+	Command string          `json:"command"`
+
+	// Timeout is the time the command can run before it is killed, or
+	// zero for the default
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// GafferTuplesPatch is an operation on flags or environment
+type GafferTuplesPatch struct {
+	Op    GafferTuplesOp
+	Key   string
+	Value string
+}
+
+// GafferJob requests a number of instances of a service, placed on
+// nodes where the service has been added
+type GafferJob struct {
+	Service string `json:"service"`
+	Count   uint   `json:"count"`
+
+	// Selector matches the labels of nodes which can run instances
+	Selector string `json:"selector,omitempty"`
+
+	// Spread is a node label, and instances are spread evenly across the
+	// values of the label, for example "zone". Instances are always spread
+	// across nodes
+	Spread string `json:"spread,omitempty"`
+
+	// Affinity are services which need to be running on a node, and
+	// AntiAffinity services which must not be running on a node
+	Affinity     []string `json:"affinity,omitempty"`
+	AntiAffinity []string `json:"anti_affinity,omitempty"`
+}
+
+// GafferPlacement is an instance placed on a node by the scheduler
+type GafferPlacement struct {
+	Service   string    `json:"service"`
+	Node      string    `json:"node"`
+	Instance  uint32    `json:"instance"`
+	Timestamp time.Time `json:"ts"`
+}
+
+// GafferNode is a gaffer service on which instances can be placed
+type GafferNode struct {
+	Name   string
+	Labels Tuples
+
+	// Capacity is the number of instances which can run on the node, or
+	// zero when there is no limit, and Running is the number of instances
+	// which are running
+	Capacity uint
+	Running  uint
+
+	// Services are the services added to the node, with the number of
+	// running instances of each service
+	Services map[string]uint
+
+	// Error is set when the node could not be reached
+	Error error
 }
 
 type GafferServiceMode uint
 
 type GafferEventType uint
 
+type GafferUpgradePolicy uint
+
+type GafferInstanceState uint
+
+type GafferFlagStyle uint
+
+type GafferTuplesOp uint
+
+type GafferEnvPolicy uint
+
+type GafferHookStage uint
+
 ////////////////////////////////////////////////////////////////////////////////
 // CONSTANTS
 
@@ -161,6 +691,48 @@ const (
 	GAFFER_MODE_AUTO
 )
 
+const (
+	GAFFER_UPGRADE_NONE    GafferUpgradePolicy = iota // Ignore executable changes
+	GAFFER_UPGRADE_STALE                              // Mark the service as stale
+	GAFFER_UPGRADE_RESTART                            // Rolling restart of the service
+)
+
+const (
+	GAFFER_FLAG_STYLE_SINGLE_DASH GafferFlagStyle = iota // -key=value
+	GAFFER_FLAG_STYLE_DOUBLE_DASH                        // --key=value
+	GAFFER_FLAG_STYLE_SEPARATE                           // --key value
+)
+
+const (
+	GAFFER_ENV_DEFAULT GafferEnvPolicy = iota // Use the policy of the groups, or clean
+	GAFFER_ENV_CLEAN                          // Do not inherit any variables
+	GAFFER_ENV_INHERIT                        // Inherit all variables
+	GAFFER_ENV_ALLOW                          // Inherit the allowed variables
+)
+
+const (
+	GAFFER_HOOK_NONE       GafferHookStage = iota
+	GAFFER_HOOK_PRE_START                  // Before the instance is started, a failure aborts the start
+	GAFFER_HOOK_POST_START                 // After the instance is started
+	GAFFER_HOOK_PRE_STOP                   // Before the instance is stopped
+	GAFFER_HOOK_POST_STOP                  // After the instance has exited
+	GAFFER_HOOK_MAX        = GAFFER_HOOK_POST_STOP
+)
+
+const (
+	GAFFER_TUPLES_SET   GafferTuplesOp = iota // Set a value for a key, replacing existing values
+	GAFFER_TUPLES_ADD                         // Add a value for a key
+	GAFFER_TUPLES_UNSET                       // Remove a key
+	GAFFER_TUPLES_CLEAR                       // Remove all keys
+)
+
+const (
+	GAFFER_INSTANCE_ANY     GafferInstanceState = iota // Any instance
+	GAFFER_INSTANCE_RUNNING                            // Instance has not stopped
+	GAFFER_INSTANCE_STOPPED                            // Instance stopped with exit code zero
+	GAFFER_INSTANCE_FAILED                             // Instance stopped with an error or was killed
+)
+
 const (
 	GAFFER_EVENT_NONE GafferEventType = iota
 	GAFFER_EVENT_SERVICE_ADD
@@ -177,6 +749,13 @@ const (
 	GAFFER_EVENT_INSTANCE_STOP_KILLED
 	GAFFER_EVENT_LOG_STDOUT
 	GAFFER_EVENT_LOG_STDERR
+	GAFFER_EVENT_INSTANCE_SIGNAL
+	GAFFER_EVENT_SERVICE_PROGRESS
+	GAFFER_EVENT_EXECUTABLE_CHANGE
+	GAFFER_EVENT_HOOK_STDOUT
+	GAFFER_EVENT_HOOK_STDERR
+	GAFFER_EVENT_HOOK_ERROR
+	GAFFER_EVENT_MAX = GAFFER_EVENT_HOOK_ERROR
 )
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -193,8 +772,117 @@ func (m GafferServiceMode) String() string {
 	}
 }
 
+func (p GafferUpgradePolicy) String() string {
+	switch p {
+	case GAFFER_UPGRADE_NONE:
+		return "GAFFER_UPGRADE_NONE"
+	case GAFFER_UPGRADE_STALE:
+		return "GAFFER_UPGRADE_STALE"
+	case GAFFER_UPGRADE_RESTART:
+		return "GAFFER_UPGRADE_RESTART"
+	default:
+		return "[?? Invalid GafferUpgradePolicy value]"
+	}
+}
+
+func (s GafferFlagStyle) String() string {
+	switch s {
+	case GAFFER_FLAG_STYLE_SINGLE_DASH:
+		return "GAFFER_FLAG_STYLE_SINGLE_DASH"
+	case GAFFER_FLAG_STYLE_DOUBLE_DASH:
+		return "GAFFER_FLAG_STYLE_DOUBLE_DASH"
+	case GAFFER_FLAG_STYLE_SEPARATE:
+		return "GAFFER_FLAG_STYLE_SEPARATE"
+	default:
+		return "[?? Invalid GafferFlagStyle value]"
+	}
+}
+
+func (p GafferEnvPolicy) String() string {
+	switch p {
+	case GAFFER_ENV_DEFAULT:
+		return "GAFFER_ENV_DEFAULT"
+	case GAFFER_ENV_CLEAN:
+		return "GAFFER_ENV_CLEAN"
+	case GAFFER_ENV_INHERIT:
+		return "GAFFER_ENV_INHERIT"
+	case GAFFER_ENV_ALLOW:
+		return "GAFFER_ENV_ALLOW"
+	default:
+		return "[?? Invalid GafferEnvPolicy value]"
+	}
+}
+
+func (s GafferHookStage) String() string {
+	switch s {
+	case GAFFER_HOOK_NONE:
+		return "GAFFER_HOOK_NONE"
+	case GAFFER_HOOK_PRE_START:
+		return "GAFFER_HOOK_PRE_START"
+	case GAFFER_HOOK_POST_START:
+		return "GAFFER_HOOK_POST_START"
+	case GAFFER_HOOK_PRE_STOP:
+		return "GAFFER_HOOK_PRE_STOP"
+	case GAFFER_HOOK_POST_STOP:
+		return "GAFFER_HOOK_POST_STOP"
+	default:
+		return "[?? Invalid GafferHookStage value]"
+	}
+}
+
+// String returns the stage, timeout and command for a hook
+func (h GafferHook) String() string {
+	if h.Timeout == 0 {
+		return fmt.Sprintf("%v=%v", h.Stage.Name(), strconv.Quote(h.Command))
+	} else {
+		return fmt.Sprintf("%v:%v=%v", h.Stage.Name(), h.Timeout, strconv.Quote(h.Command))
+	}
+}
+
+func (o GafferTuplesOp) String() string {
+	switch o {
+	case GAFFER_TUPLES_SET:
+		return "GAFFER_TUPLES_SET"
+	case GAFFER_TUPLES_ADD:
+		return "GAFFER_TUPLES_ADD"
+	case GAFFER_TUPLES_UNSET:
+		return "GAFFER_TUPLES_UNSET"
+	case GAFFER_TUPLES_CLEAR:
+		return "GAFFER_TUPLES_CLEAR"
+	default:
+		return "[?? Invalid GafferTuplesOp value]"
+	}
+}
+
+// String returns the operation and key, but not the value, which
+// could be secret
+func (p GafferTuplesPatch) String() string {
+	if p.Op == GAFFER_TUPLES_CLEAR {
+		return fmt.Sprint(p.Op)
+	} else {
+		return fmt.Sprintf("%v %v", p.Op, strconv.Quote(p.Key))
+	}
+}
+
+func (s GafferInstanceState) String() string {
+	switch s {
+	case GAFFER_INSTANCE_ANY:
+		return "GAFFER_INSTANCE_ANY"
+	case GAFFER_INSTANCE_RUNNING:
+		return "GAFFER_INSTANCE_RUNNING"
+	case GAFFER_INSTANCE_STOPPED:
+		return "GAFFER_INSTANCE_STOPPED"
+	case GAFFER_INSTANCE_FAILED:
+		return "GAFFER_INSTANCE_FAILED"
+	default:
+		return "[?? Invalid GafferInstanceState value]"
+	}
+}
+
 func (t GafferEventType) String() string {
 	switch t {
+	case GAFFER_EVENT_NONE:
+		return "GAFFER_EVENT_NONE"
 	case GAFFER_EVENT_SERVICE_ADD:
 		return "GAFFER_EVENT_SERVICE_ADD"
 	case GAFFER_EVENT_SERVICE_CHANGE:
@@ -223,6 +911,18 @@ func (t GafferEventType) String() string {
 		return "GAFFER_EVENT_INSTANCE_STOP_ERROR"
 	case GAFFER_EVENT_INSTANCE_STOP_KILLED:
 		return "GAFFER_EVENT_INSTANCE_STOP_KILLED"
+	case GAFFER_EVENT_INSTANCE_SIGNAL:
+		return "GAFFER_EVENT_INSTANCE_SIGNAL"
+	case GAFFER_EVENT_SERVICE_PROGRESS:
+		return "GAFFER_EVENT_SERVICE_PROGRESS"
+	case GAFFER_EVENT_EXECUTABLE_CHANGE:
+		return "GAFFER_EVENT_EXECUTABLE_CHANGE"
+	case GAFFER_EVENT_HOOK_STDOUT:
+		return "GAFFER_EVENT_HOOK_STDOUT"
+	case GAFFER_EVENT_HOOK_STDERR:
+		return "GAFFER_EVENT_HOOK_STDERR"
+	case GAFFER_EVENT_HOOK_ERROR:
+		return "GAFFER_EVENT_HOOK_ERROR"
 	default:
 		return "[?? Invalid GafferEventType value]"
 	}
@@ -257,3 +957,240 @@ func (m *GafferServiceMode) UnmarshalJSON(data []byte) error {
 	}
 	return nil
 }
+
+func (p GafferUpgradePolicy) MarshalJSON() ([]byte, error) {
+	switch p {
+	case GAFFER_UPGRADE_NONE:
+		return []byte("\"none\""), nil
+	case GAFFER_UPGRADE_STALE:
+		return []byte("\"stale\""), nil
+	case GAFFER_UPGRADE_RESTART:
+		return []byte("\"restart\""), nil
+	default:
+		return nil, fmt.Errorf("Syntax error: %v", p)
+	}
+}
+
+func (p *GafferUpgradePolicy) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	} else if policy, err := UpgradePolicyForName(s); err != nil {
+		return err
+	} else {
+		*p = policy
+	}
+	return nil
+}
+
+// UpgradePolicyForName returns an upgrade policy from one of the
+// names "none", "stale" or "restart"
+func UpgradePolicyForName(name string) (GafferUpgradePolicy, error) {
+	switch strings.ToLower(name) {
+	case "none", "":
+		return GAFFER_UPGRADE_NONE, nil
+	case "stale":
+		return GAFFER_UPGRADE_STALE, nil
+	case "restart":
+		return GAFFER_UPGRADE_RESTART, nil
+	default:
+		return GAFFER_UPGRADE_NONE, fmt.Errorf("Syntax error: %v (expecting 'none', 'stale' or 'restart')", strconv.Quote(name))
+	}
+}
+
+func (s GafferFlagStyle) MarshalJSON() ([]byte, error) {
+	switch s {
+	case GAFFER_FLAG_STYLE_SINGLE_DASH:
+		return []byte("\"single\""), nil
+	case GAFFER_FLAG_STYLE_DOUBLE_DASH:
+		return []byte("\"double\""), nil
+	case GAFFER_FLAG_STYLE_SEPARATE:
+		return []byte("\"separate\""), nil
+	default:
+		return nil, fmt.Errorf("Syntax error: %v", s)
+	}
+}
+
+func (s *GafferFlagStyle) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	} else if style, err := FlagStyleForName(str); err != nil {
+		return err
+	} else {
+		*s = style
+	}
+	return nil
+}
+
+// FlagStyleForName returns a flag style from one of the names "single"
+// (-key=value), "double" (--key=value) or "separate" (--key value)
+func FlagStyleForName(name string) (GafferFlagStyle, error) {
+	switch strings.ToLower(name) {
+	case "single", "":
+		return GAFFER_FLAG_STYLE_SINGLE_DASH, nil
+	case "double":
+		return GAFFER_FLAG_STYLE_DOUBLE_DASH, nil
+	case "separate":
+		return GAFFER_FLAG_STYLE_SEPARATE, nil
+	default:
+		return GAFFER_FLAG_STYLE_SINGLE_DASH, fmt.Errorf("Syntax error: %v (expecting 'single', 'double' or 'separate')", strconv.Quote(name))
+	}
+}
+
+func (p GafferEnvPolicy) MarshalJSON() ([]byte, error) {
+	switch p {
+	case GAFFER_ENV_DEFAULT:
+		return []byte("\"default\""), nil
+	case GAFFER_ENV_CLEAN:
+		return []byte("\"clean\""), nil
+	case GAFFER_ENV_INHERIT:
+		return []byte("\"inherit\""), nil
+	case GAFFER_ENV_ALLOW:
+		return []byte("\"allow\""), nil
+	default:
+		return nil, fmt.Errorf("Syntax error: %v", p)
+	}
+}
+
+func (p *GafferEnvPolicy) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	} else if policy, err := EnvPolicyForName(str); err != nil {
+		return err
+	} else {
+		*p = policy
+	}
+	return nil
+}
+
+// EnvPolicyForName returns an environment policy from one of the names
+// "default", "clean", "inherit" or "allow"
+func EnvPolicyForName(name string) (GafferEnvPolicy, error) {
+	switch strings.ToLower(name) {
+	case "default", "":
+		return GAFFER_ENV_DEFAULT, nil
+	case "clean":
+		return GAFFER_ENV_CLEAN, nil
+	case "inherit":
+		return GAFFER_ENV_INHERIT, nil
+	case "allow":
+		return GAFFER_ENV_ALLOW, nil
+	default:
+		return GAFFER_ENV_DEFAULT, fmt.Errorf("Syntax error: %v (expecting 'default', 'clean', 'inherit' or 'allow')", strconv.Quote(name))
+	}
+}
+
+func (s GafferHookStage) MarshalJSON() ([]byte, error) {
+	if name := s.Name(); name == "" {
+		return nil, fmt.Errorf("Syntax error: %v", s)
+	} else {
+		return json.Marshal(name)
+	}
+}
+
+func (s *GafferHookStage) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	} else if stage, err := HookStageForName(str); err != nil {
+		return err
+	} else {
+		*s = stage
+	}
+	return nil
+}
+
+// HookStageForName returns a hook stage from one of the names "pre-start",
+// "post-start", "pre-stop" or "post-stop"
+func HookStageForName(name string) (GafferHookStage, error) {
+	name_ := strings.Replace(strings.ToLower(name), "_", "-", -1)
+	for s := GAFFER_HOOK_PRE_START; s <= GAFFER_HOOK_MAX; s++ {
+		if s.Name() == name_ {
+			return s, nil
+		}
+	}
+	return GAFFER_HOOK_NONE, fmt.Errorf("Syntax error: %v (expecting 'pre-start', 'post-start', 'pre-stop' or 'post-stop')", strconv.Quote(name))
+}
+
+// Name returns the name of a hook stage, such as "pre-start", or an
+// empty string for an invalid stage
+func (s GafferHookStage) Name() string {
+	if s == GAFFER_HOOK_NONE || s > GAFFER_HOOK_MAX {
+		return ""
+	} else {
+		return strings.Replace(strings.ToLower(strings.TrimPrefix(s.String(), "GAFFER_HOOK_")), "_", "-", -1)
+	}
+}
+
+func (t GafferEventType) MarshalJSON() ([]byte, error) {
+	if name := t.name(); name == "" {
+		return nil, fmt.Errorf("Syntax error: %v", t)
+	} else {
+		return json.Marshal(name)
+	}
+}
+
+func (t *GafferEventType) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	} else if type_, err := EventTypeForName(str); err != nil {
+		return err
+	} else {
+		*t = type_
+	}
+	return nil
+}
+
+// EventTypeForName returns an event type from a name such as
+// "instance_stop_error", ignoring case and the GAFFER_EVENT_ prefix
+func EventTypeForName(name string) (GafferEventType, error) {
+	name_ := strings.TrimPrefix(strings.ToLower(name), "gaffer_event_")
+	for t := GAFFER_EVENT_NONE; t <= GAFFER_EVENT_MAX; t++ {
+		if t.name() == name_ {
+			return t, nil
+		}
+	}
+	return GAFFER_EVENT_NONE, fmt.Errorf("Syntax error: %v (invalid event type)", strconv.Quote(name))
+}
+
+// name returns the lowercase name of an event type without the prefix,
+// or an empty string for an invalid event type
+func (t GafferEventType) name() string {
+	if t > GAFFER_EVENT_MAX {
+		return ""
+	} else {
+		return strings.ToLower(strings.TrimPrefix(t.String(), "GAFFER_EVENT_"))
+	}
+}
+
+// InstanceStateForInstance returns the state of an instance, where an
+// instance which has not yet stopped is considered to be running
+func InstanceStateForInstance(instance GafferServiceInstance) GafferInstanceState {
+	if instance.Stop().IsZero() {
+		return GAFFER_INSTANCE_RUNNING
+	} else if instance.ExitCode() == 0 {
+		return GAFFER_INSTANCE_STOPPED
+	} else {
+		return GAFFER_INSTANCE_FAILED
+	}
+}
+
+// InstanceStateForName returns an instance state from one of the
+// names "any", "running", "stopped" or "failed"
+func InstanceStateForName(name string) (GafferInstanceState, error) {
+	switch strings.ToLower(name) {
+	case "any", "":
+		return GAFFER_INSTANCE_ANY, nil
+	case "running":
+		return GAFFER_INSTANCE_RUNNING, nil
+	case "stopped":
+		return GAFFER_INSTANCE_STOPPED, nil
+	case "failed":
+		return GAFFER_INSTANCE_FAILED, nil
+	default:
+		return GAFFER_INSTANCE_ANY, fmt.Errorf("Syntax error: %v (expecting 'any', 'running', 'stopped' or 'failed')", strconv.Quote(name))
+	}
+}
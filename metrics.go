@@ -0,0 +1,126 @@
+/*
+  Go Language Raspberry Pi Interface
+  (c) Copyright David Thorpe 2019
+  All Rights Reserved
+
+  Documentation http://djthorpe.github.io/gopi/
+  For Licensing and Usage information, please see LICENSE.md
+*/
+
+package rpc
+
+import (
+	"fmt"
+
+	// Frameworks
+	"github.com/djthorpe/gopi"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// MetricType is the type of a metric family
+type MetricType uint
+
+// MetricFamily is a set of metrics with the same name and type, which are
+// distinguished by their labels
+type MetricFamily struct {
+	Name    string
+	Help    string
+	Type    MetricType
+	Metrics []Metric
+}
+
+// Metric is a value with labels. Histograms have the cumulative count of
+// observations for each bucket, and the count and sum of all observations
+type Metric struct {
+	Labels  []MetricLabel
+	Value   float64
+	Buckets []MetricBucket
+	Count   uint64
+	Sum     float64
+}
+
+// MetricLabel is a label name and value
+type MetricLabel struct {
+	Name  string
+	Value string
+}
+
+// MetricBucket is the number of observations less than or equal to an
+// upper bound
+type MetricBucket struct {
+	UpperBound float64
+	Count      uint64
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	METRIC_TYPE_NONE MetricType = iota
+	METRIC_TYPE_COUNTER
+	METRIC_TYPE_GAUGE
+	METRIC_TYPE_HISTOGRAM
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// INTERFACES
+
+// MetricsCollector is implemented by modules which expose metrics
+type MetricsCollector interface {
+	// Metrics returns the current value of the metrics
+	Metrics() []*MetricFamily
+}
+
+// Metrics serves the metrics from the collectors
+type Metrics interface {
+	gopi.Driver
+
+	// Add a collector
+	AddCollector(MetricsCollector) error
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// METRICS
+
+// NewMetricFamily returns an empty metric family
+func NewMetricFamily(name, help string, type_ MetricType) *MetricFamily {
+	return &MetricFamily{name, help, type_, nil}
+}
+
+// Add a metric with a value and labels, which are name and value pairs
+func (this *MetricFamily) Add(value float64, labels ...string) {
+	this.Metrics = append(this.Metrics, Metric{Labels: NewMetricLabels(labels...), Value: value})
+}
+
+// NewMetricLabels returns labels from name and value pairs
+func NewMetricLabels(labels ...string) []MetricLabel {
+	metric_labels := make([]MetricLabel, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		metric_labels = append(metric_labels, MetricLabel{labels[i], labels[i+1]})
+	}
+	return metric_labels
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (t MetricType) String() string {
+	switch t {
+	case METRIC_TYPE_NONE:
+		return "untyped"
+	case METRIC_TYPE_COUNTER:
+		return "counter"
+	case METRIC_TYPE_GAUGE:
+		return "gauge"
+	case METRIC_TYPE_HISTOGRAM:
+		return "histogram"
+	default:
+		return "[?? Invalid MetricType value]"
+	}
+}
+
+func (this *MetricFamily) String() string {
+	return fmt.Sprintf("<rpc.MetricFamily>{ name=%v type=%v metrics=%v }", this.Name, this.Type, len(this.Metrics))
+}
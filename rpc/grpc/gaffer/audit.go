@@ -0,0 +1,224 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package gaffer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	// Frameworks
+	rpc "github.com/djthorpe/gopi-rpc"
+	grpc "github.com/djthorpe/gopi-rpc/sys/grpc"
+	ggrpc "google.golang.org/grpc"
+
+	// Protocol buffers
+	pb "github.com/djthorpe/gopi-rpc/rpc/protobuf/gaffer"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// auditStream records the first message received on a stream, which is
+// the request for server streaming methods, and replaces the context so
+// that the caller is recorded when the call is authorized
+type auditStream struct {
+	ggrpc.ServerStream
+	ctx context.Context
+	req interface{}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	// AUDIT_SERVICE is the prefix for gaffer methods
+	AUDIT_SERVICE = "/gopi.Gaffer/"
+)
+
+var (
+	// AUDIT_METHODS are the methods which change services, groups or
+	// instances, and are recorded in the audit log
+	AUDIT_METHODS = map[string]bool{
+		"UploadExecutable": true, "RollbackExecutable": true,
+		"AddService": true, "RemoveService": true, "SetServiceParameters": true,
+		"AddGroup": true, "RemoveGroup": true, "SetGroupParameters": true,
+		"SetGroupFlags": true, "SetGroupEnv": true, "SetServiceFlags": true,
+		"PatchGroupFlags": true, "PatchGroupEnv": true, "PatchServiceFlags": true,
+		"SetServiceSecrets": true, "SetGroupSecrets": true,
+		"SetServiceEnvPolicy": true, "SetGroupEnvPolicy": true, "SetGroupEnvFiles": true,
+		"SetServiceHooks": true, "SetGroupHooks": true, "SetServiceArgs": true,
+		"SetServiceLabels": true, "SetInstanceLabels": true,
+		"WipeServiceData": true, "SetServiceUpgradePolicy": true,
+		"StartInstance": true, "StopInstance": true,
+		"SignalInstance": true, "SignalService": true, "SignalGroup": true,
+		"ScaleService": true, "RestartService": true,
+		"StartGroup": true, "StopGroup": true, "RestartGroup": true,
+	}
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// INTERCEPTORS
+
+func (this *service) auditUnaryInterceptor(ctx context.Context, req interface{}, info *ggrpc.UnaryServerInfo, handler ggrpc.UnaryHandler) (interface{}, error) {
+	if method := auditMethod(info.FullMethod); method == "" {
+		return handler(ctx, req)
+	} else {
+		ctx = grpc.WithCaller(ctx)
+		resp, err := handler(ctx, req)
+		this.audit(ctx, method, req, err)
+		return resp, err
+	}
+}
+
+func (this *service) auditStreamInterceptor(srv interface{}, stream ggrpc.ServerStream, info *ggrpc.StreamServerInfo, handler ggrpc.StreamHandler) error {
+	if method := auditMethod(info.FullMethod); method == "" {
+		return handler(srv, stream)
+	} else {
+		stream_ := &auditStream{ServerStream: stream, ctx: grpc.WithCaller(stream.Context())}
+		err := handler(srv, stream_)
+		this.audit(stream_.ctx, method, stream_.req, err)
+		return err
+	}
+}
+
+// audit records a call in the audit log
+func (this *service) audit(ctx context.Context, method string, req interface{}, err error) {
+	if gaffer := this.gaffer; gaffer == nil {
+		return
+	} else if err_ := gaffer.AppendAudit(grpc.PeerForContext(ctx), grpc.IdentityForContext(ctx), method, paramsForRequest(req), err); err_ != nil {
+		this.log.Warn("Audit: %v: %v", method, err_)
+	}
+}
+
+func (this *auditStream) Context() context.Context {
+	return this.ctx
+}
+
+func (this *auditStream) RecvMsg(m interface{}) error {
+	err := this.ServerStream.RecvMsg(m)
+	if err == nil && this.req == nil {
+		this.req = m
+	}
+	return err
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PARAMETERS
+
+// auditMethod returns the name of a gaffer method which is recorded in the
+// audit log, or an empty string
+func auditMethod(name string) string {
+	if strings.HasPrefix(name, AUDIT_SERVICE) == false {
+		return ""
+	} else if method := strings.TrimPrefix(name, AUDIT_SERVICE); AUDIT_METHODS[method] == false {
+		return ""
+	} else {
+		return method
+	}
+}
+
+// paramsForRequest returns the parameters for a request. Flags, environment
+// and labels are named <param>.<key>, and patch operations <op>.<key>, so
+// that secret values can be redacted
+func paramsForRequest(req interface{}) rpc.Tuples {
+	params := rpc.Tuples{}
+	switch req := req.(type) {
+	case *pb.UploadExecutableRequest:
+		setParam(&params, "path", req.Path)
+		setParam(&params, "checksum", req.Checksum)
+	case *pb.RollbackExecutableRequest:
+		setParam(&params, "path", req.Path)
+		setParam(&params, "checksum", req.Checksum)
+	case *pb.NameRequest:
+		setParam(&params, "name", req.Name)
+	case *pb.ServiceRequest:
+		setParam(&params, "name", req.Name)
+		setParam(&params, "groups", req.Groups...)
+	case *pb.GroupRequest:
+		setParam(&params, "name", req.Name)
+		setParam(&params, "groups", req.Groups...)
+	case *pb.InstanceId:
+		setParam(&params, "id", fmt.Sprint(req.Id))
+	case *pb.StartInstanceRequest:
+		setParam(&params, "service", req.Service)
+		setParam(&params, "id", fmt.Sprint(req.Id))
+	case *pb.SignalRequest:
+		setParam(&params, "id", fmt.Sprint(req.Id))
+		setParam(&params, "name", req.Name)
+		setParam(&params, "signal", req.Signal)
+		setParam(&params, "process_group", fmt.Sprint(req.ProcessGroup))
+	case *pb.ScaleServiceRequest:
+		setParam(&params, "name", req.Name)
+		setParam(&params, "instance_count", fmt.Sprint(req.InstanceCount))
+	case *pb.RestartServiceRequest:
+		setParam(&params, "name", req.Name)
+		setParam(&params, "settle_time", fmt.Sprint(durationFromProto(req.SettleTime)))
+	case *pb.GroupOperationRequest:
+		setParam(&params, "name", req.Name)
+		setParam(&params, "all_or_nothing", fmt.Sprint(req.AllOrNothing))
+		setParam(&params, "settle_time", fmt.Sprint(durationFromProto(req.SettleTime)))
+	case *pb.SetTuplesRequest:
+		setParam(&params, "name", req.Name)
+		setTuplesParam(&params, "tuples", fromProtoTuples(req.Tuples))
+	case *pb.PatchTuplesRequest:
+		setParam(&params, "name", req.Name)
+		setParam(&params, "version", fmt.Sprint(req.Version))
+		for _, op := range fromProtoTuplesPatch(req.Ops) {
+			name := strings.ToLower(strings.TrimPrefix(fmt.Sprint(op.Op), "GAFFER_TUPLES_"))
+			if op.Op == rpc.GAFFER_TUPLES_CLEAR {
+				params.AddStringForKey(name, "")
+			} else {
+				params.AddStringForKey(name+"."+op.Key, op.Value)
+			}
+		}
+	case *pb.SetSecretsRequest:
+		setParam(&params, "name", req.Name)
+		setParam(&params, "keys", req.Keys...)
+	case *pb.SetEnvPolicyRequest:
+		setParam(&params, "name", req.Name)
+		setParam(&params, "policy", fmt.Sprint(rpc.GafferEnvPolicy(req.Policy)))
+		setParam(&params, "allow", req.Allow...)
+	case *pb.SetEnvFilesRequest:
+		setParam(&params, "name", req.Name)
+		setParam(&params, "files", req.Files...)
+	case *pb.SetHooksRequest:
+		setParam(&params, "name", req.Name)
+		for _, hook := range fromProtoHooks(req.Hooks) {
+			params.AddStringForKey("hooks", fmt.Sprint(hook))
+		}
+	case *pb.SetServiceArgsRequest:
+		setParam(&params, "name", req.Name)
+		setParam(&params, "flag_style", fmt.Sprint(rpc.GafferFlagStyle(req.FlagStyle)))
+		setParam(&params, "args", req.Args...)
+	case *pb.SetInstanceLabelsRequest:
+		setParam(&params, "id", fmt.Sprint(req.Id))
+		setTuplesParam(&params, "labels", fromProtoTuples(req.Labels))
+	case *pb.SetUpgradePolicyRequest:
+		setParam(&params, "name", req.Name)
+		setParam(&params, "policy", fmt.Sprint(rpc.GafferUpgradePolicy(req.Policy)))
+	}
+	return params
+}
+
+// setParam sets the values for a parameter, ignoring empty values
+func setParam(params *rpc.Tuples, key string, values ...string) {
+	if len(values) == 0 || (len(values) == 1 && values[0] == "") {
+		return
+	} else {
+		params.SetStringsForKey(key, values)
+	}
+}
+
+// setTuplesParam sets the values for each key in tuples as <param>.<key>
+func setTuplesParam(params *rpc.Tuples, param string, tuples rpc.Tuples) {
+	for _, key := range tuples.Keys() {
+		params.SetStringsForKey(param+"."+key, tuples.StringsForKey(key))
+	}
+}
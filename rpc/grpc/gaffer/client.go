@@ -10,8 +10,11 @@ package gaffer
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"time"
 
 	// Frameworks
 	gopi "github.com/djthorpe/gopi"
@@ -20,7 +23,10 @@ import (
 
 	// Protocol buffers
 	pb "github.com/djthorpe/gopi-rpc/rpc/protobuf/gaffer"
+	ptypes "github.com/golang/protobuf/ptypes"
 	empty "github.com/golang/protobuf/ptypes/empty"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
 )
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -31,6 +37,20 @@ type Client struct {
 	conn gopi.RPCClientConn
 }
 
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	// UPLOAD_CHUNK_SIZE is the maximum size of data in each upload message
+	UPLOAD_CHUNK_SIZE = 64 * 1024
+
+	// STREAM_RETRY_COUNT is the number of times to reconnect a stream of
+	// events without receiving an event, and STREAM_RETRY_DELAY is the
+	// delay before reconnecting, which increases with each retry
+	STREAM_RETRY_COUNT = 10
+	STREAM_RETRY_DELAY = time.Second
+)
+
 ////////////////////////////////////////////////////////////////////////////////
 // NEW
 
@@ -69,14 +89,86 @@ func (this *Client) Ping() error {
 	}
 }
 
-func (this *Client) ListExecutables() ([]string, error) {
+func (this *Client) ListExecutables() ([]rpc.GafferExecutable, error) {
 	this.conn.Lock()
 	defer this.conn.Unlock()
 
 	if reply, err := this.GafferClient.ListExecutables(this.NewContext(), &empty.Empty{}); err != nil {
 		return nil, err
 	} else {
-		return reply.Path, nil
+		return fromProtoExecutableArray(reply.Executable), nil
+	}
+}
+
+// UploadExecutable sends an executable in chunks, with the SHA-256 checksum
+// computed before the upload starts
+func (this *Client) UploadExecutable(path string, data io.ReadSeeker) (rpc.GafferExecutable, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	// Compute the checksum and rewind
+	hash := sha256.New()
+	if _, err := io.Copy(hash, data); err != nil {
+		return nil, err
+	} else if _, err := data.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	stream, err := this.GafferClient.UploadExecutable(this.NewContext())
+	if err != nil {
+		return nil, err
+	}
+	req := &pb.UploadExecutableRequest{
+		Path:     path,
+		Checksum: hex.EncodeToString(hash.Sum(nil)),
+	}
+	buf := make([]byte, UPLOAD_CHUNK_SIZE)
+	for {
+		n, err := data.Read(buf)
+		if n > 0 || req.Path != "" {
+			req.Data = buf[:n]
+			if err := stream.Send(req); err != nil {
+				return nil, err
+			}
+			req = &pb.UploadExecutableRequest{}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if reply, err := stream.CloseAndRecv(); err != nil {
+		return nil, err
+	} else {
+		return fromProtoExecutable(reply), nil
+	}
+}
+
+func (this *Client) RollbackExecutable(path, checksum string) (rpc.GafferExecutable, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.RollbackExecutable(this.NewContext(), &pb.RollbackExecutableRequest{
+		Path:     path,
+		Checksum: checksum,
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoExecutable(reply), nil
+	}
+}
+
+func (this *Client) ListFlagsForExecutable(path string) ([]rpc.GafferFlag, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.ListExecutableFlags(this.NewContext(), &pb.NameRequest{
+		Name: path,
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoFlagArray(reply.Flag), nil
 	}
 }
 
@@ -107,6 +199,17 @@ func (this *Client) ListServicesForGroup(group string) ([]rpc.GafferService, err
 	}
 }
 
+func (this *Client) ListServicesWithFilter(filter rpc.GafferFilter) ([]rpc.GafferService, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.ListServices(this.NewContext(), toProtoFilter(filter)); err != nil {
+		return nil, err
+	} else {
+		return fromProtoServiceArray(reply.Service), nil
+	}
+}
+
 func (this *Client) GetService(service string) (rpc.GafferService, error) {
 	this.conn.Lock()
 	defer this.conn.Unlock()
@@ -150,6 +253,17 @@ func (this *Client) ListGroupsForService(service string) ([]rpc.GafferServiceGro
 	}
 }
 
+func (this *Client) ListGroupsWithFilter(filter rpc.GafferFilter) ([]rpc.GafferServiceGroup, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.ListGroups(this.NewContext(), toProtoFilter(filter)); err != nil {
+		return nil, err
+	} else {
+		return fromProtoGroupArray(reply.Group), nil
+	}
+}
+
 func (this *Client) GetGroup(group string) (rpc.GafferServiceGroup, error) {
 	this.conn.Lock()
 	defer this.conn.Unlock()
@@ -177,6 +291,17 @@ func (this *Client) ListInstances() ([]rpc.GafferServiceInstance, error) {
 	}
 }
 
+func (this *Client) ListInstancesWithFilter(filter rpc.GafferFilter) ([]rpc.GafferServiceInstance, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.ListInstances(this.NewContext(), toProtoFilter(filter)); err != nil {
+		return nil, err
+	} else {
+		return fromProtoInstanceArray(reply.Instance), nil
+	}
+}
+
 func (this *Client) AddServiceForPath(path string, groups []string) (rpc.GafferService, error) {
 	this.conn.Lock()
 	defer this.conn.Unlock()
@@ -268,6 +393,174 @@ func (this *Client) StopInstance(id uint32) (rpc.GafferServiceInstance, error) {
 	}
 }
 
+func (this *Client) SignalInstance(id uint32, signal string, group bool) (rpc.GafferServiceInstance, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.SignalInstance(this.NewContext(), &pb.SignalRequest{
+		Id:           id,
+		Signal:       signal,
+		ProcessGroup: group,
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoInstance(reply), nil
+	}
+}
+
+func (this *Client) SignalService(service, signal string, group bool) ([]rpc.GafferServiceInstance, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.SignalService(this.NewContext(), &pb.SignalRequest{
+		Name:         service,
+		Signal:       signal,
+		ProcessGroup: group,
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoInstanceArray(reply.Instance), nil
+	}
+}
+
+func (this *Client) SignalGroup(group, signal string, process_group bool) ([]rpc.GafferServiceInstance, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.SignalGroup(this.NewContext(), &pb.SignalRequest{
+		Name:         group,
+		Signal:       signal,
+		ProcessGroup: process_group,
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoInstanceArray(reply.Instance), nil
+	}
+}
+
+func (this *Client) ResolveService(service string) ([]rpc.GafferResolvedTuple, []rpc.GafferResolvedTuple, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.ResolveService(this.NewContext(), &pb.NameRequest{
+		Name: service,
+	}); err != nil {
+		return nil, nil, err
+	} else {
+		return fromProtoResolvedTupleArray(reply.Flags), fromProtoResolvedTupleArray(reply.Env), nil
+	}
+}
+
+func (this *Client) GetServiceData(service string) (rpc.GafferServiceData, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.GetServiceData(this.NewContext(), &pb.NameRequest{
+		Name: service,
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoServiceData(reply), nil
+	}
+}
+
+func (this *Client) WipeServiceData(service string) (rpc.GafferServiceData, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.WipeServiceData(this.NewContext(), &pb.NameRequest{
+		Name: service,
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoServiceData(reply), nil
+	}
+}
+
+func (this *Client) SetServiceUpgradePolicy(service string, policy rpc.GafferUpgradePolicy) (rpc.GafferService, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.SetServiceUpgradePolicy(this.NewContext(), &pb.SetUpgradePolicyRequest{
+		Name:   service,
+		Policy: pb.Service_UpgradePolicy(policy),
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoService(reply), nil
+	}
+}
+
+func (this *Client) ScaleService(service string, count uint, progress chan<- rpc.GafferEvent) error {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if stream, err := this.GafferClient.ScaleService(this.NewContext(), &pb.ScaleServiceRequest{
+		Name:          service,
+		InstanceCount: uint32(count),
+	}); err != nil {
+		return err
+	} else {
+		return recvProgress(stream, progress)
+	}
+}
+
+func (this *Client) RestartService(service string, settle time.Duration, progress chan<- rpc.GafferEvent) error {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if stream, err := this.GafferClient.RestartService(this.NewContext(), &pb.RestartServiceRequest{
+		Name:       service,
+		SettleTime: ptypes.DurationProto(settle),
+	}); err != nil {
+		return err
+	} else {
+		return recvProgress(stream, progress)
+	}
+}
+
+func (this *Client) StartGroup(group string, all bool) ([]rpc.GafferServiceResult, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.StartGroup(this.NewContext(), &pb.GroupOperationRequest{
+		Name:         group,
+		AllOrNothing: all,
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoServiceResultArray(reply.Result), nil
+	}
+}
+
+func (this *Client) StopGroup(group string) ([]rpc.GafferServiceResult, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.StopGroup(this.NewContext(), &pb.GroupOperationRequest{
+		Name: group,
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoServiceResultArray(reply.Result), nil
+	}
+}
+
+func (this *Client) RestartGroup(group string, settle time.Duration, all bool) ([]rpc.GafferServiceResult, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.RestartGroup(this.NewContext(), &pb.GroupOperationRequest{
+		Name:         group,
+		AllOrNothing: all,
+		SettleTime:   ptypes.DurationProto(settle),
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoServiceResultArray(reply.Result), nil
+	}
+}
+
 func (this *Client) SetFlagsForService(service string, tuples rpc.Tuples) (rpc.GafferService, error) {
 	this.conn.Lock()
 	defer this.conn.Unlock()
@@ -282,6 +575,164 @@ func (this *Client) SetFlagsForService(service string, tuples rpc.Tuples) (rpc.G
 	}
 }
 
+func (this *Client) PatchFlagsForService(service string, version uint64, patch []rpc.GafferTuplesPatch) (rpc.GafferService, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.PatchServiceFlags(this.NewContext(), &pb.PatchTuplesRequest{
+		Name:    service,
+		Version: version,
+		Ops:     toProtoTuplesPatch(patch),
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoService(reply), nil
+	}
+}
+
+func (this *Client) SetSecretsForService(service string, keys []string) (rpc.GafferService, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.SetServiceSecrets(this.NewContext(), &pb.SetSecretsRequest{
+		Name: service,
+		Keys: keys,
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoService(reply), nil
+	}
+}
+
+func (this *Client) SetSecretsForGroup(group string, keys []string) (rpc.GafferServiceGroup, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.SetGroupSecrets(this.NewContext(), &pb.SetSecretsRequest{
+		Name: group,
+		Keys: keys,
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoGroup(reply), nil
+	}
+}
+
+func (this *Client) SetServiceEnvPolicy(service string, policy rpc.GafferEnvPolicy, allow []string) (rpc.GafferService, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.SetServiceEnvPolicy(this.NewContext(), &pb.SetEnvPolicyRequest{
+		Name:   service,
+		Policy: pb.Service_EnvPolicy(policy),
+		Allow:  allow,
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoService(reply), nil
+	}
+}
+
+func (this *Client) SetGroupEnvPolicy(group string, policy rpc.GafferEnvPolicy, allow []string) (rpc.GafferServiceGroup, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.SetGroupEnvPolicy(this.NewContext(), &pb.SetEnvPolicyRequest{
+		Name:   group,
+		Policy: pb.Service_EnvPolicy(policy),
+		Allow:  allow,
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoGroup(reply), nil
+	}
+}
+
+func (this *Client) SetGroupEnvFiles(group string, files []string) (rpc.GafferServiceGroup, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.SetGroupEnvFiles(this.NewContext(), &pb.SetEnvFilesRequest{
+		Name:  group,
+		Files: files,
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoGroup(reply), nil
+	}
+}
+
+func (this *Client) SetServiceHooks(service string, hooks []rpc.GafferHook) (rpc.GafferService, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.SetServiceHooks(this.NewContext(), &pb.SetHooksRequest{
+		Name:  service,
+		Hooks: toProtoHooks(hooks),
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoService(reply), nil
+	}
+}
+
+func (this *Client) SetGroupHooks(group string, hooks []rpc.GafferHook) (rpc.GafferServiceGroup, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.SetGroupHooks(this.NewContext(), &pb.SetHooksRequest{
+		Name:  group,
+		Hooks: toProtoHooks(hooks),
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoGroup(reply), nil
+	}
+}
+
+func (this *Client) SetServiceArgs(service string, style rpc.GafferFlagStyle, args []string) (rpc.GafferService, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.SetServiceArgs(this.NewContext(), &pb.SetServiceArgsRequest{
+		Name:      service,
+		FlagStyle: pb.Service_FlagStyle(style),
+		Args:      args,
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoService(reply), nil
+	}
+}
+
+func (this *Client) SetLabelsForService(service string, labels rpc.Tuples) (rpc.GafferService, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.SetServiceLabels(this.NewContext(), &pb.SetTuplesRequest{
+		Name:   service,
+		Tuples: toProtoTuples(labels),
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoService(reply), nil
+	}
+}
+
+func (this *Client) SetLabelsForInstance(id uint32, labels rpc.Tuples) (rpc.GafferServiceInstance, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.SetInstanceLabels(this.NewContext(), &pb.SetInstanceLabelsRequest{
+		Id:     id,
+		Labels: toProtoTuples(labels),
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoInstance(reply), nil
+	}
+}
+
 func (this *Client) SetFlagsForGroup(group string, tuples rpc.Tuples) (rpc.GafferServiceGroup, error) {
 	this.conn.Lock()
 	defer this.conn.Unlock()
@@ -310,6 +761,36 @@ func (this *Client) SetEnvForGroup(group string, tuples rpc.Tuples) (rpc.GafferS
 	}
 }
 
+func (this *Client) PatchFlagsForGroup(group string, version uint64, patch []rpc.GafferTuplesPatch) (rpc.GafferServiceGroup, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.PatchGroupFlags(this.NewContext(), &pb.PatchTuplesRequest{
+		Name:    group,
+		Version: version,
+		Ops:     toProtoTuplesPatch(patch),
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoGroup(reply), nil
+	}
+}
+
+func (this *Client) PatchEnvForGroup(group string, version uint64, patch []rpc.GafferTuplesPatch) (rpc.GafferServiceGroup, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.PatchGroupEnv(this.NewContext(), &pb.PatchTuplesRequest{
+		Name:    group,
+		Version: version,
+		Ops:     toProtoTuplesPatch(patch),
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoGroup(reply), nil
+	}
+}
+
 func (this *Client) SetServiceGroups(service string, groups []string) (rpc.GafferService, error) {
 	this.conn.Lock()
 	defer this.conn.Unlock()
@@ -324,27 +805,140 @@ func (this *Client) SetServiceGroups(service string, groups []string) (rpc.Gaffe
 	}
 }
 
+func (this *Client) SetGroupGroups(group string, groups []string) (rpc.GafferServiceGroup, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.SetGroupParameters(this.NewContext(), &pb.GroupRequest{
+		Name:   group,
+		Groups: groups,
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoGroup(reply), nil
+	}
+}
+
+func (this *Client) QueryEvents(query rpc.GafferEventQuery) ([]rpc.GafferEvent, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.QueryEvents(this.NewContext(), toProtoEventQuery(query)); err != nil {
+		return nil, err
+	} else {
+		return fromProtoEventArray(reply.Events), nil
+	}
+}
+
+func (this *Client) ListCrashReports(service string) ([]rpc.GafferCrashReport, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.ListCrashReports(this.NewContext(), &pb.NameRequest{
+		Name: service,
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoCrashReportArray(reply.Reports), nil
+	}
+}
+
+func (this *Client) GetCrashReport(id uint64) (rpc.GafferCrashReport, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.GetCrashReport(this.NewContext(), &pb.CrashReportId{
+		Id: id,
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtoCrashReport(reply), nil
+	}
+}
+
+func (this *Client) QueryAudit(query rpc.GafferAuditQuery) ([]rpc.GafferAuditRecord, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+
+	if reply, err := this.GafferClient.QueryAudit(this.NewContext(), toProtoAuditQuery(query)); err != nil {
+		return nil, err
+	} else {
+		return fromProtoAuditRecordArray(reply.Records), nil
+	}
+}
+
 func (this *Client) StreamEvents(events chan<- rpc.GafferEvent) error {
+	return this.StreamEventsWithFilter(rpc.GafferFilter{}, events)
+}
+
+// StreamEventsWithFilter sends events to a channel until the stream ends.
+// When the connection is lost, the stream is reconnected and resumed after
+// the last event considered by the server, so that events are not missed
+// or repeated
+func (this *Client) StreamEventsWithFilter(filter rpc.GafferFilter, events chan<- rpc.GafferEvent) error {
 	this.conn.Lock()
 	defer this.conn.Unlock()
 
-	// Keep reading from stream
-	if stream, err := this.GafferClient.StreamEvents(this.NewContext(), &empty.Empty{}); err != nil {
-		return err
+	for retry := 0; ; retry++ {
+		if after, received, err := this.streamEvents(filter, events); err == nil {
+			return nil
+		} else if status.Code(err) != codes.Unavailable {
+			return err
+		} else if received {
+			// The stream was connected, so resume after the last event
+			filter.After, retry = after, 0
+		} else if retry >= STREAM_RETRY_COUNT {
+			return err
+		}
+		time.Sleep(STREAM_RETRY_DELAY * time.Duration(retry+1))
+	}
+}
+
+// streamEvents reads events from a stream and returns the sequence number
+// of the last event considered by the server, and whether any message was
+// received. Heartbeats carry the sequence number but are not sent to the
+// channel
+func (this *Client) streamEvents(filter rpc.GafferFilter, events chan<- rpc.GafferEvent) (uint64, bool, error) {
+	after, received := filter.After, false
+	if stream, err := this.GafferClient.StreamEvents(this.NewContext(), toProtoFilter(filter)); err != nil {
+		return after, received, err
 	} else {
 		for {
 			if msg, err := stream.Recv(); err == io.EOF {
-				break
+				return after, received, nil
 			} else if err != nil {
-				return err
-			} else if evt := fromProtoEvent(msg); evt != nil {
-				events <- evt
+				return after, received, err
+			} else {
+				received = true
+				if msg.Seq > after {
+					after = msg.Seq
+				}
+				if msg.Type == pb.GafferEvent_NONE {
+					continue
+				} else if evt := fromProtoEvent(msg); evt != nil {
+					events <- evt
+				}
 			}
 		}
 	}
+}
 
-	// Success
-	return nil
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// recvProgress reads progress events from a stream until it ends
+func recvProgress(stream interface {
+	Recv() (*pb.GafferEvent, error)
+}, progress chan<- rpc.GafferEvent) error {
+	for {
+		if msg, err := stream.Recv(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		} else if evt := fromProtoEvent(msg); evt != nil && progress != nil {
+			progress <- evt
+		}
+	}
 }
 
 ////////////////////////////////////////////////////////////////////////////////
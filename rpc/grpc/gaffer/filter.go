@@ -0,0 +1,311 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package gaffer
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	// Frameworks
+	rpc "github.com/djthorpe/gopi-rpc"
+
+	// Protocol buffers
+	pb "github.com/djthorpe/gopi-rpc/rpc/protobuf/gaffer"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// filter matches services, groups, instances and events against
+// a request filter
+type filter struct {
+	gaffer   rpc.Gaffer
+	service  string
+	group    string
+	selector rpc.LabelSelector
+	state    rpc.GafferInstanceState
+	sort     string
+	reverse  bool
+	offset   uint
+	limit    uint
+	types    []rpc.GafferEventType
+	instance uint32
+	after    uint64
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// NEW FILTER
+
+// newFilter returns a filter from a request. The value and type fields are
+// mapped onto the service and group patterns
+func newFilter(gaffer rpc.Gaffer, req *pb.RequestFilter) (*filter, error) {
+	this := &filter{gaffer: gaffer}
+	if req == nil {
+		return this, nil
+	}
+
+	this.service, this.group = req.Service, req.Group
+	switch req.Type {
+	case pb.RequestFilter_SERVICE:
+		this.service = req.Value
+	case pb.RequestFilter_GROUP:
+		this.group = req.Value
+	}
+	for _, pattern := range []string{this.service, this.group} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("Invalid pattern: %v", strconv.Quote(pattern))
+		}
+	}
+
+	if selector, err := rpc.ParseLabelSelector(req.Selector); err != nil {
+		return nil, err
+	} else {
+		this.selector = selector
+	}
+
+	this.state = rpc.GafferInstanceState(req.State)
+	this.sort = strings.TrimPrefix(req.Sort, "-")
+	this.reverse = strings.HasPrefix(req.Sort, "-")
+	switch this.sort {
+	case "", "name", "id", "start":
+		break
+	default:
+		return nil, fmt.Errorf("Invalid sort: %v (expecting 'name', 'id' or 'start')", strconv.Quote(req.Sort))
+	}
+
+	this.offset, this.limit = uint(req.Offset), uint(req.Limit)
+	this.types = fromProtoEventTypes(req.Types)
+	this.instance, this.after = req.Instance, req.After
+	return this, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// MATCH
+
+// MatchService returns true if a service matches the service and group
+// patterns and the label selector
+func (this *filter) MatchService(service rpc.GafferService) bool {
+	if service == nil {
+		return false
+	} else if matchPattern(this.service, service.Name()) == false {
+		return false
+	} else if this.selector.Matches(service.Labels()) == false {
+		return false
+	} else {
+		return this.matchGroups(service)
+	}
+}
+
+// MatchGroup returns true if a group matches the group pattern. When
+// a service pattern or label selector is set, the group also needs to
+// include a matching service
+func (this *filter) MatchGroup(group rpc.GafferServiceGroup) bool {
+	if group == nil {
+		return false
+	} else if matchPattern(this.group, group.Name()) == false {
+		return false
+	} else if this.service == "" && this.selector.IsEmpty() {
+		return true
+	}
+	for _, service := range this.gaffer.GetServices() {
+		if matchPattern(this.service, service.Name()) == false || this.selector.Matches(service.Labels()) == false {
+			continue
+		}
+		for _, group_ := range this.gaffer.ResolveGroupsForNames(service.Groups()) {
+			if group_.Name() == group.Name() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MatchInstance returns true if an instance matches the service and group
+// patterns, the label selector and the instance state
+func (this *filter) MatchInstance(instance rpc.GafferServiceInstance) bool {
+	if instance == nil || instance.Service() == nil {
+		return false
+	} else if matchPattern(this.service, instance.Service().Name()) == false {
+		return false
+	} else if this.selector.Matches(instance.Labels()) == false {
+		return false
+	} else if this.state != rpc.GAFFER_INSTANCE_ANY && this.state != rpc.InstanceStateForInstance(instance) {
+		return false
+	} else {
+		return this.matchGroups(instance.Service())
+	}
+}
+
+// MatchEvent returns true if an event matches the filter. Instance events
+// are matched against the instance, service events against the service
+// and group events against the group. When an instance state is set, only
+// instance events are matched
+func (this *filter) MatchEvent(evt rpc.GafferEvent) bool {
+	if this.matchType(evt.Type()) == false {
+		return false
+	} else if this.instance != 0 && (evt.Instance() == nil || evt.Instance().Id() != this.instance) {
+		return false
+	} else if evt.Instance() != nil {
+		return this.MatchInstance(evt.Instance())
+	} else if this.state != rpc.GAFFER_INSTANCE_ANY {
+		return false
+	} else if evt.Service() != nil {
+		return this.MatchService(evt.Service())
+	} else if evt.Group() != nil {
+		return this.MatchGroup(evt.Group())
+	} else {
+		return this.service == "" && this.group == "" && this.selector.IsEmpty()
+	}
+}
+
+// matchType returns true if there are no event types or the type is one
+// of the event types
+func (this *filter) matchType(t rpc.GafferEventType) bool {
+	if len(this.types) == 0 {
+		return true
+	}
+	for _, t_ := range this.types {
+		if t == t_ {
+			return true
+		}
+	}
+	return false
+}
+
+// Query returns a query for events in the journal after the sequence
+// number. The label selector and instance state are not recorded in the
+// journal, so are not used to match events from the journal
+func (this *filter) Query() rpc.GafferEventQuery {
+	return rpc.GafferEventQuery{
+		Types:    this.types,
+		Service:  this.service,
+		Group:    this.group,
+		Instance: this.instance,
+		After:    this.after,
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// SORT AND PAGINATE
+
+func (this *filter) Services(services []rpc.GafferService) []rpc.GafferService {
+	services_ := make([]rpc.GafferService, 0, len(services))
+	for _, service := range services {
+		if this.MatchService(service) {
+			services_ = append(services_, service)
+		}
+	}
+	if this.sort != "" {
+		sort.SliceStable(services_, func(i, j int) bool {
+			return this.less(services_[i].Name() < services_[j].Name(), services_[j].Name() < services_[i].Name())
+		})
+	}
+	start, end := this.page(len(services_))
+	return services_[start:end]
+}
+
+func (this *filter) Groups(groups []rpc.GafferServiceGroup) []rpc.GafferServiceGroup {
+	groups_ := make([]rpc.GafferServiceGroup, 0, len(groups))
+	for _, group := range groups {
+		if this.MatchGroup(group) {
+			groups_ = append(groups_, group)
+		}
+	}
+	if this.sort != "" {
+		sort.SliceStable(groups_, func(i, j int) bool {
+			return this.less(groups_[i].Name() < groups_[j].Name(), groups_[j].Name() < groups_[i].Name())
+		})
+	}
+	start, end := this.page(len(groups_))
+	return groups_[start:end]
+}
+
+func (this *filter) Instances(instances []rpc.GafferServiceInstance) []rpc.GafferServiceInstance {
+	instances_ := make([]rpc.GafferServiceInstance, 0, len(instances))
+	for _, instance := range instances {
+		if this.MatchInstance(instance) {
+			instances_ = append(instances_, instance)
+		}
+	}
+	switch this.sort {
+	case "name":
+		sort.SliceStable(instances_, func(i, j int) bool {
+			a, b := instances_[i].Service().Name(), instances_[j].Service().Name()
+			if a == b {
+				return this.less(instances_[i].Id() < instances_[j].Id(), instances_[j].Id() < instances_[i].Id())
+			} else {
+				return this.less(a < b, b < a)
+			}
+		})
+	case "id":
+		sort.SliceStable(instances_, func(i, j int) bool {
+			return this.less(instances_[i].Id() < instances_[j].Id(), instances_[j].Id() < instances_[i].Id())
+		})
+	case "start":
+		sort.SliceStable(instances_, func(i, j int) bool {
+			a, b := instances_[i].Start(), instances_[j].Start()
+			return this.less(a.Before(b), b.Before(a))
+		})
+	}
+	start, end := this.page(len(instances_))
+	return instances_[start:end]
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// matchGroups returns true if there is no group pattern, or the service
+// is a member of a group matching the pattern, including included groups
+func (this *filter) matchGroups(service rpc.GafferService) bool {
+	if this.group == "" {
+		return true
+	}
+	for _, group := range this.gaffer.ResolveGroupsForNames(service.Groups()) {
+		if matchPattern(this.group, group.Name()) {
+			return true
+		}
+	}
+	return false
+}
+
+// less returns the comparison in ascending or descending order
+func (this *filter) less(ascending, descending bool) bool {
+	if this.reverse {
+		return descending
+	} else {
+		return ascending
+	}
+}
+
+// page returns the start and end of a page of results
+func (this *filter) page(count int) (int, int) {
+	start := int(this.offset)
+	if start > count {
+		start = count
+	}
+	end := count
+	if this.limit > 0 && start+int(this.limit) < end {
+		end = start + int(this.limit)
+	}
+	return start, end
+}
+
+// matchPattern returns true if the pattern is empty or matches the name
+func matchPattern(pattern, name string) bool {
+	if pattern == "" {
+		return true
+	} else if match, err := path.Match(pattern, name); err != nil {
+		return false
+	} else {
+		return match
+	}
+}
@@ -9,6 +9,7 @@
 package gaffer
 
 import (
+	"errors"
 	"time"
 
 	// Frameworks
@@ -18,6 +19,7 @@ import (
 	// Protocol buffers
 	pb "github.com/djthorpe/gopi-rpc/rpc/protobuf/gaffer"
 	ptypes "github.com/golang/protobuf/ptypes"
+	duration "github.com/golang/protobuf/ptypes/duration"
 )
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -39,6 +41,38 @@ type pb_event struct {
 	pb *pb.GafferEvent
 }
 
+type pb_executable struct {
+	pb *pb.Executable
+}
+
+type pb_flag struct {
+	pb *pb.Flag
+}
+
+type pb_resolved_tuple struct {
+	pb *pb.ResolvedTuple
+}
+
+type pb_tuple_value struct {
+	pb *pb.TupleValue
+}
+
+type pb_service_result struct {
+	pb *pb.ServiceResult
+}
+
+type pb_service_data struct {
+	pb *pb.ServiceData
+}
+
+type pb_crash_report struct {
+	pb *pb.CrashReport
+}
+
+type pb_audit_record struct {
+	pb *pb.AuditRecord
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // SERVICES
 
@@ -55,6 +89,16 @@ func toProtoFromService(service rpc.GafferService) *pb.Service {
 		RunTime:       ptypes.DurationProto(service.RunTime()),
 		IdleTime:      ptypes.DurationProto(service.IdleTime()),
 		Flags:         toProtoTuples(service.Flags()),
+		UpgradePolicy: pb.Service_UpgradePolicy(service.UpgradePolicy()),
+		Stale:         service.IsStale(),
+		Labels:        toProtoTuples(service.Labels()),
+		FlagStyle:     pb.Service_FlagStyle(service.FlagStyle()),
+		Args:          service.Args(),
+		Version:       service.Version(),
+		Secrets:       service.Secrets(),
+		EnvPolicy:     pb.Service_EnvPolicy(service.EnvPolicy()),
+		EnvAllow:      service.EnvAllow(),
+		Hooks:         toProtoHooks(service.Hooks()),
 	}
 }
 
@@ -94,9 +138,16 @@ func toProtoFromGroup(group rpc.GafferServiceGroup) *pb.Group {
 		return nil
 	}
 	return &pb.Group{
-		Name:  group.Name(),
-		Flags: toProtoTuples(group.Flags()),
-		Env:   toProtoTuples(group.Env()),
+		Name:      group.Name(),
+		Flags:     toProtoTuples(group.Flags()),
+		Env:       toProtoTuples(group.Env()),
+		Groups:    group.Groups(),
+		Version:   group.Version(),
+		Secrets:   group.Secrets(),
+		EnvPolicy: pb.Service_EnvPolicy(group.EnvPolicy()),
+		EnvAllow:  group.EnvAllow(),
+		EnvFiles:  group.EnvFiles(),
+		Hooks:     toProtoHooks(group.Hooks()),
 	}
 }
 
@@ -141,13 +192,17 @@ func toProtoFromInstance(instance rpc.GafferServiceInstance) *pb.Instance {
 		return nil
 	} else {
 		return &pb.Instance{
-			Id:       instance.Id(),
-			Service:  toProtoFromService(instance.Service()),
-			Flags:    toProtoTuples(instance.Flags()),
-			Env:      toProtoTuples(instance.Env()),
-			StartTs:  start_ts,
-			StopTs:   stop_ts,
-			ExitCode: instance.ExitCode(),
+			Id:         instance.Id(),
+			Service:    toProtoFromService(instance.Service()),
+			Flags:      toProtoTuples(instance.Flags()),
+			Env:        toProtoTuples(instance.Env()),
+			StartTs:    start_ts,
+			StopTs:     stop_ts,
+			ExitCode:   instance.ExitCode(),
+			Executable: toProtoFromExecutable(instance.Executable()),
+			Labels:     toProtoTuples(instance.Labels()),
+			Args:       instance.Args(),
+			RunDir:     instance.RunDir(),
 		}
 	}
 }
@@ -180,6 +235,297 @@ func fromProtoInstanceArray(instances []*pb.Instance) []rpc.GafferServiceInstanc
 	return instances_
 }
 
+////////////////////////////////////////////////////////////////////////////////
+// EXECUTABLES
+
+func toProtoFromExecutable(executable rpc.GafferExecutable) *pb.Executable {
+	if executable == nil {
+		return nil
+	} else if mod_time, err := ptypes.TimestampProto(executable.ModTime()); err != nil {
+		return nil
+	} else {
+		return &pb.Executable{
+			Path:     executable.Path(),
+			Size:     executable.Size(),
+			ModTime:  mod_time,
+			Checksum: executable.Checksum(),
+			Arch:     executable.Arch(),
+			Gopi:     executable.IsGopi(),
+			Services: executable.Services(),
+		}
+	}
+}
+
+func fromProtoExecutableArray(executables []*pb.Executable) []rpc.GafferExecutable {
+	if executables == nil {
+		return nil
+	}
+	executables_ := make([]rpc.GafferExecutable, len(executables))
+	for i, executable := range executables {
+		executables_[i] = fromProtoExecutable(executable)
+	}
+	return executables_
+}
+
+func fromProtoExecutable(executable *pb.Executable) rpc.GafferExecutable {
+	if executable == nil {
+		return nil
+	} else {
+		return &pb_executable{executable}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// SERVICE DATA
+
+func toProtoFromServiceData(data rpc.GafferServiceData) *pb.ServiceData {
+	if data == nil {
+		return nil
+	} else if mod_time, err := ptypes.TimestampProto(data.ModTime()); err != nil {
+		return nil
+	} else {
+		return &pb.ServiceData{
+			Service: data.Service(),
+			Path:    data.Path(),
+			Size:    data.Size(),
+			Files:   uint32(data.Files()),
+			ModTime: mod_time,
+		}
+	}
+}
+
+func fromProtoServiceData(data *pb.ServiceData) rpc.GafferServiceData {
+	if data == nil {
+		return nil
+	} else {
+		return &pb_service_data{data}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CRASH REPORTS
+
+func toProtoFromCrashReport(report rpc.GafferCrashReport) *pb.CrashReport {
+	if report == nil {
+		return nil
+	} else if ts, err := ptypes.TimestampProto(report.Timestamp()); err != nil {
+		return nil
+	} else {
+		return &pb.CrashReport{
+			Id:         report.Id(),
+			Service:    report.Service(),
+			Instance:   report.Instance(),
+			Ts:         ts,
+			ExitCode:   report.ExitCode(),
+			Signal:     report.Signal(),
+			CoreDumped: report.CoreDumped(),
+			Uptime:     ptypes.DurationProto(report.Uptime()),
+			Stdout:     report.Stdout(),
+			Stderr:     report.Stderr(),
+			Flags:      toProtoTuples(report.Flags()),
+			Env:        toProtoTuples(report.Env()),
+			Args:       report.Args(),
+			UserTime:   ptypes.DurationProto(report.UserTime()),
+			SystemTime: ptypes.DurationProto(report.SystemTime()),
+			MaxRss:     report.MaxRSS(),
+		}
+	}
+}
+
+func toProtoFromCrashReportArray(reports []rpc.GafferCrashReport) []*pb.CrashReport {
+	if reports == nil {
+		return nil
+	}
+	reports_ := make([]*pb.CrashReport, 0, len(reports))
+	for _, report := range reports {
+		if report_ := toProtoFromCrashReport(report); report_ != nil {
+			reports_ = append(reports_, report_)
+		}
+	}
+	return reports_
+}
+
+func fromProtoCrashReport(report *pb.CrashReport) rpc.GafferCrashReport {
+	if report == nil {
+		return nil
+	} else {
+		return &pb_crash_report{report}
+	}
+}
+
+func fromProtoCrashReportArray(reports []*pb.CrashReport) []rpc.GafferCrashReport {
+	if reports == nil {
+		return nil
+	}
+	reports_ := make([]rpc.GafferCrashReport, len(reports))
+	for i, report := range reports {
+		reports_[i] = fromProtoCrashReport(report)
+	}
+	return reports_
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// AUDIT
+
+func toProtoFromAuditRecord(record rpc.GafferAuditRecord) *pb.AuditRecord {
+	if record == nil {
+		return nil
+	} else if ts, err := ptypes.TimestampProto(record.Timestamp()); err != nil {
+		return nil
+	} else {
+		return &pb.AuditRecord{
+			Seq:      record.Seq(),
+			Ts:       ts,
+			Peer:     record.Peer(),
+			Identity: record.Identity(),
+			Method:   record.Method(),
+			Params:   toProtoTuples(record.Params()),
+			Error:    record.Error(),
+		}
+	}
+}
+
+func toProtoFromAuditRecordArray(records []rpc.GafferAuditRecord) []*pb.AuditRecord {
+	if records == nil {
+		return nil
+	}
+	records_ := make([]*pb.AuditRecord, 0, len(records))
+	for _, record := range records {
+		if record_ := toProtoFromAuditRecord(record); record_ != nil {
+			records_ = append(records_, record_)
+		}
+	}
+	return records_
+}
+
+func fromProtoAuditRecordArray(records []*pb.AuditRecord) []rpc.GafferAuditRecord {
+	if records == nil {
+		return nil
+	}
+	records_ := make([]rpc.GafferAuditRecord, len(records))
+	for i, record := range records {
+		records_[i] = &pb_audit_record{record}
+	}
+	return records_
+}
+
+func toProtoAuditQuery(query rpc.GafferAuditQuery) *pb.QueryAuditRequest {
+	req := &pb.QueryAuditRequest{
+		Method:   query.Method,
+		Identity: query.Identity,
+		Name:     query.Name,
+		Limit:    uint32(query.Limit),
+	}
+	if query.Start.IsZero() == false {
+		req.Start, _ = ptypes.TimestampProto(query.Start)
+	}
+	if query.End.IsZero() == false {
+		req.End, _ = ptypes.TimestampProto(query.End)
+	}
+	return req
+}
+
+func fromProtoAuditQuery(req *pb.QueryAuditRequest) rpc.GafferAuditQuery {
+	query := rpc.GafferAuditQuery{
+		Method:   req.Method,
+		Identity: req.Identity,
+		Name:     req.Name,
+		Limit:    uint(req.Limit),
+	}
+	if req.Start != nil {
+		query.Start, _ = ptypes.Timestamp(req.Start)
+	}
+	if req.End != nil {
+		query.End, _ = ptypes.Timestamp(req.End)
+	}
+	return query
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// FLAGS
+
+func toProtoFromFlagArray(flags []rpc.GafferFlag) []*pb.Flag {
+	if flags == nil {
+		return nil
+	}
+	flags_ := make([]*pb.Flag, len(flags))
+	for i, flag := range flags {
+		flags_[i] = &pb.Flag{
+			Name:    flag.Name(),
+			Type:    flag.Type(),
+			Default: flag.Default(),
+			Usage:   flag.Usage(),
+		}
+	}
+	return flags_
+}
+
+func fromProtoFlagArray(flags []*pb.Flag) []rpc.GafferFlag {
+	if flags == nil {
+		return nil
+	}
+	flags_ := make([]rpc.GafferFlag, len(flags))
+	for i, flag := range flags {
+		flags_[i] = &pb_flag{flag}
+	}
+	return flags_
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// RESOLVED TUPLES
+
+func toProtoFromResolvedTupleArray(tuples []rpc.GafferResolvedTuple) []*pb.ResolvedTuple {
+	if tuples == nil {
+		return nil
+	}
+	tuples_ := make([]*pb.ResolvedTuple, len(tuples))
+	for i, tuple := range tuples {
+		tuples_[i] = &pb.ResolvedTuple{
+			Key:       tuple.Key(),
+			Value:     tuple.Value(),
+			Origin:    tuple.Origin(),
+			Raw:       tuple.Raw(),
+			Variables: toProtoFromTupleValueArray(tuple.Variables()),
+			Overrides: toProtoFromTupleValueArray(tuple.Overrides()),
+		}
+	}
+	return tuples_
+}
+
+func toProtoFromTupleValueArray(values []rpc.GafferTupleValue) []*pb.TupleValue {
+	if values == nil {
+		return nil
+	}
+	values_ := make([]*pb.TupleValue, len(values))
+	for i, value := range values {
+		values_[i] = &pb.TupleValue{
+			Key:    value.Key(),
+			Value:  value.Value(),
+			Origin: value.Origin(),
+		}
+	}
+	return values_
+}
+
+func fromProtoResolvedTupleArray(tuples []*pb.ResolvedTuple) []rpc.GafferResolvedTuple {
+	if tuples == nil {
+		return nil
+	}
+	tuples_ := make([]rpc.GafferResolvedTuple, len(tuples))
+	for i, tuple := range tuples {
+		tuples_[i] = &pb_resolved_tuple{tuple}
+	}
+	return tuples_
+}
+
+func fromProtoTupleValueArray(values []*pb.TupleValue) []rpc.GafferTupleValue {
+	values_ := make([]rpc.GafferTupleValue, len(values))
+	for i, value := range values {
+		values_[i] = &pb_tuple_value{value}
+	}
+	return values_
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // EVENTS
 
@@ -187,14 +533,144 @@ func toProtoEvent(evt rpc.GafferEvent) *pb.GafferEvent {
 	if evt == nil {
 		return nil
 	}
+	ts := ptypes.TimestampNow()
+	if evt.Timestamp().IsZero() == false {
+		if ts_, err := ptypes.TimestampProto(evt.Timestamp()); err == nil {
+			ts = ts_
+		}
+	}
 	return &pb.GafferEvent{
 		Type:     pb.GafferEvent_Type(evt.Type()),
 		Service:  toProtoFromService(evt.Service()),
 		Group:    toProtoFromGroup(evt.Group()),
 		Instance: toProtoFromInstance(evt.Instance()),
 		Data:     evt.Data(),
-		Ts:       ptypes.TimestampNow(),
+		Ts:       ts,
+		Seq:      evt.Seq(),
+	}
+}
+
+func toProtoEventArray(events []rpc.GafferEvent) []*pb.GafferEvent {
+	if events == nil {
+		return nil
+	}
+	events_ := make([]*pb.GafferEvent, len(events))
+	for i, evt := range events {
+		events_[i] = toProtoEvent(evt)
+	}
+	return events_
+}
+
+func fromProtoEventArray(events []*pb.GafferEvent) []rpc.GafferEvent {
+	if events == nil {
+		return nil
+	}
+	events_ := make([]rpc.GafferEvent, len(events))
+	for i, evt := range events {
+		events_[i] = fromProtoEvent(evt)
+	}
+	return events_
+}
+
+func toProtoEventQuery(query rpc.GafferEventQuery) *pb.QueryEventsRequest {
+	req := &pb.QueryEventsRequest{
+		Types:    toProtoEventTypes(query.Types),
+		Service:  query.Service,
+		Group:    query.Group,
+		Instance: query.Instance,
+		Limit:    uint32(query.Limit),
+		After:    query.After,
+	}
+	if query.Start.IsZero() == false {
+		req.Start, _ = ptypes.TimestampProto(query.Start)
+	}
+	if query.End.IsZero() == false {
+		req.End, _ = ptypes.TimestampProto(query.End)
 	}
+	return req
+}
+
+func fromProtoEventQuery(req *pb.QueryEventsRequest) rpc.GafferEventQuery {
+	query := rpc.GafferEventQuery{
+		Types:    fromProtoEventTypes(req.Types),
+		Service:  req.Service,
+		Group:    req.Group,
+		Instance: req.Instance,
+		Limit:    uint(req.Limit),
+		After:    req.After,
+	}
+	if req.Start != nil {
+		query.Start, _ = ptypes.Timestamp(req.Start)
+	}
+	if req.End != nil {
+		query.End, _ = ptypes.Timestamp(req.End)
+	}
+	return query
+}
+
+func toProtoFromServiceResultArray(results []rpc.GafferServiceResult) []*pb.ServiceResult {
+	if results == nil {
+		return nil
+	}
+	results_ := make([]*pb.ServiceResult, len(results))
+	for i, result := range results {
+		results_[i] = &pb.ServiceResult{
+			Service:  toProtoFromService(result.Service()),
+			Instance: toProtoFromInstanceArray(result.Instances(), nil),
+		}
+		if err := result.Error(); err != nil {
+			results_[i].Error = err.Error()
+		}
+	}
+	return results_
+}
+
+func fromProtoServiceResultArray(results []*pb.ServiceResult) []rpc.GafferServiceResult {
+	if results == nil {
+		return nil
+	}
+	results_ := make([]rpc.GafferServiceResult, len(results))
+	for i, result := range results {
+		results_[i] = &pb_service_result{result}
+	}
+	return results_
+}
+
+func toProtoFilter(filter rpc.GafferFilter) *pb.RequestFilter {
+	return &pb.RequestFilter{
+		Service:  filter.Service,
+		Group:    filter.Group,
+		Selector: filter.Selector,
+		State:    pb.RequestFilter_InstanceState(filter.State),
+		Sort:     filter.Sort,
+		Offset:   uint32(filter.Offset),
+		Limit:    uint32(filter.Limit),
+		Types:    toProtoEventTypes(filter.Types),
+		Instance: filter.Instance,
+		After:    filter.After,
+	}
+}
+
+func toProtoEventTypes(types []rpc.GafferEventType) []pb.GafferEvent_Type {
+	if types == nil {
+		return nil
+	}
+	types_ := make([]pb.GafferEvent_Type, len(types))
+	for i, t := range types {
+		types_[i] = pb.GafferEvent_Type(t)
+	}
+	return types_
+}
+
+func fromProtoEventTypes(types []pb.GafferEvent_Type) []rpc.GafferEventType {
+	if types == nil {
+		return nil
+	}
+	types_ := make([]rpc.GafferEventType, len(types))
+	for i, t := range types {
+		types_[i] = rpc.GafferEventType(t)
+	}
+	return types_
 }
 
 func fromProtoEvent(evt *pb.GafferEvent) rpc.GafferEvent {
@@ -209,12 +685,14 @@ func fromProtoEvent(evt *pb.GafferEvent) rpc.GafferEvent {
 
 func toProtoTuples(tuples rpc.Tuples) *pb.Tuples {
 	proto := &pb.Tuples{
-		Tuples: make([]*pb.Tuple, tuples.Len()),
+		Tuples: make([]*pb.Tuple, 0, tuples.Len()),
 	}
-	for i, key := range tuples.Keys() {
-		proto.Tuples[i] = &pb.Tuple{
-			Key:   key,
-			Value: tuples.StringForKey(key),
+	for _, key := range tuples.Keys() {
+		for _, value := range tuples.StringsForKey(key) {
+			proto.Tuples = append(proto.Tuples, &pb.Tuple{
+				Key:   key,
+				Value: value,
+			})
 		}
 	}
 	return proto
@@ -228,7 +706,7 @@ func fromProtoTuples(proto *pb.Tuples) rpc.Tuples {
 	// Copy over the tuples
 	tuples := rpc.Tuples{}
 	for _, tuple := range proto.Tuples {
-		if err := tuples.SetStringForKey(tuple.Key, tuple.Value); err != nil {
+		if err := tuples.AddStringForKey(tuple.Key, tuple.Value); err != nil {
 			return rpc.Tuples{}
 		}
 	}
@@ -237,6 +715,63 @@ func fromProtoTuples(proto *pb.Tuples) rpc.Tuples {
 	return tuples
 }
 
+func toProtoTuplesPatch(patch []rpc.GafferTuplesPatch) []*pb.TupleOp {
+	ops := make([]*pb.TupleOp, len(patch))
+	for i, op := range patch {
+		ops[i] = &pb.TupleOp{
+			Op:    pb.TupleOp_Op(op.Op),
+			Key:   op.Key,
+			Value: op.Value,
+		}
+	}
+	return ops
+}
+
+func fromProtoTuplesPatch(ops []*pb.TupleOp) []rpc.GafferTuplesPatch {
+	patch := make([]rpc.GafferTuplesPatch, 0, len(ops))
+	for _, op := range ops {
+		if op != nil {
+			patch = append(patch, rpc.GafferTuplesPatch{
+				Op:    rpc.GafferTuplesOp(op.Op),
+				Key:   op.Key,
+				Value: op.Value,
+			})
+		}
+	}
+	return patch
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// HOOKS
+
+func toProtoHooks(hooks []rpc.GafferHook) []*pb.Hook {
+	proto := make([]*pb.Hook, len(hooks))
+	for i, hook := range hooks {
+		proto[i] = &pb.Hook{
+			Stage:   pb.Hook_Stage(hook.Stage),
+			Command: hook.Command,
+		}
+		if hook.Timeout != 0 {
+			proto[i].Timeout = ptypes.DurationProto(hook.Timeout)
+		}
+	}
+	return proto
+}
+
+func fromProtoHooks(proto []*pb.Hook) []rpc.GafferHook {
+	hooks := make([]rpc.GafferHook, 0, len(proto))
+	for _, hook := range proto {
+		if hook != nil {
+			hooks = append(hooks, rpc.GafferHook{
+				Stage:   rpc.GafferHookStage(hook.Stage),
+				Command: hook.Command,
+				Timeout: durationFromProto(hook.Timeout),
+			})
+		}
+	}
+	return hooks
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // SERVICE IMPLEMENTATION
 
@@ -308,6 +843,86 @@ func (this *pb_service) Flags() rpc.Tuples {
 	}
 }
 
+func (this *pb_service) Labels() rpc.Tuples {
+	if this.pb == nil {
+		return rpc.Tuples{}
+	} else {
+		return fromProtoTuples(this.pb.Labels)
+	}
+}
+
+func (this *pb_service) FlagStyle() rpc.GafferFlagStyle {
+	if this.pb == nil {
+		return rpc.GAFFER_FLAG_STYLE_SINGLE_DASH
+	} else {
+		return rpc.GafferFlagStyle(this.pb.FlagStyle)
+	}
+}
+
+func (this *pb_service) Args() []string {
+	if this.pb == nil {
+		return nil
+	} else {
+		return this.pb.Args
+	}
+}
+
+func (this *pb_service) Version() uint64 {
+	if this.pb == nil {
+		return 0
+	} else {
+		return this.pb.Version
+	}
+}
+
+func (this *pb_service) Secrets() []string {
+	if this.pb == nil {
+		return nil
+	} else {
+		return this.pb.Secrets
+	}
+}
+
+func (this *pb_service) EnvPolicy() rpc.GafferEnvPolicy {
+	if this.pb == nil {
+		return rpc.GAFFER_ENV_DEFAULT
+	} else {
+		return rpc.GafferEnvPolicy(this.pb.EnvPolicy)
+	}
+}
+
+func (this *pb_service) Hooks() []rpc.GafferHook {
+	if this.pb == nil {
+		return nil
+	} else {
+		return fromProtoHooks(this.pb.Hooks)
+	}
+}
+
+func (this *pb_service) EnvAllow() []string {
+	if this.pb == nil {
+		return nil
+	} else {
+		return this.pb.EnvAllow
+	}
+}
+
+func (this *pb_service) UpgradePolicy() rpc.GafferUpgradePolicy {
+	if this.pb == nil {
+		return rpc.GAFFER_UPGRADE_NONE
+	} else {
+		return rpc.GafferUpgradePolicy(this.pb.UpgradePolicy)
+	}
+}
+
+func (this *pb_service) IsStale() bool {
+	if this.pb == nil {
+		return false
+	} else {
+		return this.pb.Stale
+	}
+}
+
 func (this *pb_service) IsMemberOfGroup(group string) bool {
 	if this.pb == nil {
 		return false
@@ -332,6 +947,62 @@ func (this *pb_group) Name() string {
 	}
 }
 
+func (this *pb_group) Groups() []string {
+	if this.pb == nil {
+		return nil
+	} else {
+		return this.pb.Groups
+	}
+}
+
+func (this *pb_group) Version() uint64 {
+	if this.pb == nil {
+		return 0
+	} else {
+		return this.pb.Version
+	}
+}
+
+func (this *pb_group) Secrets() []string {
+	if this.pb == nil {
+		return nil
+	} else {
+		return this.pb.Secrets
+	}
+}
+
+func (this *pb_group) EnvPolicy() rpc.GafferEnvPolicy {
+	if this.pb == nil {
+		return rpc.GAFFER_ENV_DEFAULT
+	} else {
+		return rpc.GafferEnvPolicy(this.pb.EnvPolicy)
+	}
+}
+
+func (this *pb_group) EnvAllow() []string {
+	if this.pb == nil {
+		return nil
+	} else {
+		return this.pb.EnvAllow
+	}
+}
+
+func (this *pb_group) Hooks() []rpc.GafferHook {
+	if this.pb == nil {
+		return nil
+	} else {
+		return fromProtoHooks(this.pb.Hooks)
+	}
+}
+
+func (this *pb_group) EnvFiles() []string {
+	if this.pb == nil {
+		return nil
+	} else {
+		return this.pb.EnvFiles
+	}
+}
+
 func (this *pb_group) Flags() rpc.Tuples {
 	if this.pb == nil {
 		return rpc.Tuples{}
@@ -383,6 +1054,22 @@ func (this *pb_instance) Env() rpc.Tuples {
 	}
 }
 
+func (this *pb_instance) Args() []string {
+	if this.pb == nil {
+		return nil
+	} else {
+		return this.pb.Args
+	}
+}
+
+func (this *pb_instance) Labels() rpc.Tuples {
+	if this.pb == nil {
+		return rpc.Tuples{}
+	} else {
+		return fromProtoTuples(this.pb.Labels)
+	}
+}
+
 func (this *pb_instance) Start() time.Time {
 	if this.pb == nil {
 		return time.Time{}
@@ -411,6 +1098,248 @@ func (this *pb_instance) ExitCode() int64 {
 	}
 }
 
+func (this *pb_instance) Executable() rpc.GafferExecutable {
+	if this.pb == nil {
+		return nil
+	} else {
+		return fromProtoExecutable(this.pb.Executable)
+	}
+}
+
+func (this *pb_instance) RunDir() string {
+	if this.pb == nil {
+		return ""
+	} else {
+		return this.pb.RunDir
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// SERVICE DATA IMPLEMENTATION
+
+func (this *pb_service_data) Service() string {
+	return this.pb.Service
+}
+
+func (this *pb_service_data) Path() string {
+	return this.pb.Path
+}
+
+func (this *pb_service_data) Size() int64 {
+	return this.pb.Size
+}
+
+func (this *pb_service_data) Files() uint {
+	return uint(this.pb.Files)
+}
+
+func (this *pb_service_data) ModTime() time.Time {
+	if ts, err := ptypes.Timestamp(this.pb.ModTime); err != nil {
+		return time.Time{}
+	} else {
+		return ts
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CRASH REPORT IMPLEMENTATION
+
+func (this *pb_crash_report) Id() uint64 {
+	return this.pb.Id
+}
+
+func (this *pb_crash_report) Service() string {
+	return this.pb.Service
+}
+
+func (this *pb_crash_report) Instance() uint32 {
+	return this.pb.Instance
+}
+
+func (this *pb_crash_report) Timestamp() time.Time {
+	if ts, err := ptypes.Timestamp(this.pb.Ts); err != nil {
+		return time.Time{}
+	} else {
+		return ts
+	}
+}
+
+func (this *pb_crash_report) ExitCode() int64 {
+	return this.pb.ExitCode
+}
+
+func (this *pb_crash_report) Signal() string {
+	return this.pb.Signal
+}
+
+func (this *pb_crash_report) CoreDumped() bool {
+	return this.pb.CoreDumped
+}
+
+func (this *pb_crash_report) Uptime() time.Duration {
+	return durationFromProto(this.pb.Uptime)
+}
+
+func (this *pb_crash_report) Stdout() []string {
+	return this.pb.Stdout
+}
+
+func (this *pb_crash_report) Stderr() []string {
+	return this.pb.Stderr
+}
+
+func (this *pb_crash_report) Flags() rpc.Tuples {
+	return fromProtoTuples(this.pb.Flags)
+}
+
+func (this *pb_crash_report) Env() rpc.Tuples {
+	return fromProtoTuples(this.pb.Env)
+}
+
+func (this *pb_crash_report) Args() []string {
+	return this.pb.Args
+}
+
+func (this *pb_crash_report) UserTime() time.Duration {
+	return durationFromProto(this.pb.UserTime)
+}
+
+func (this *pb_crash_report) SystemTime() time.Duration {
+	return durationFromProto(this.pb.SystemTime)
+}
+
+func (this *pb_crash_report) MaxRSS() int64 {
+	return this.pb.MaxRss
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// AUDIT RECORD IMPLEMENTATION
+
+func (this *pb_audit_record) Seq() uint64 {
+	return this.pb.Seq
+}
+
+func (this *pb_audit_record) Timestamp() time.Time {
+	if ts, err := ptypes.Timestamp(this.pb.Ts); err != nil {
+		return time.Time{}
+	} else {
+		return ts
+	}
+}
+
+func (this *pb_audit_record) Peer() string {
+	return this.pb.Peer
+}
+
+func (this *pb_audit_record) Identity() string {
+	return this.pb.Identity
+}
+
+func (this *pb_audit_record) Method() string {
+	return this.pb.Method
+}
+
+func (this *pb_audit_record) Params() rpc.Tuples {
+	return fromProtoTuples(this.pb.Params)
+}
+
+func (this *pb_audit_record) Error() string {
+	return this.pb.Error
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// EXECUTABLE IMPLEMENTATION
+
+func (this *pb_executable) Path() string {
+	return this.pb.Path
+}
+
+func (this *pb_executable) Size() int64 {
+	return this.pb.Size
+}
+
+func (this *pb_executable) ModTime() time.Time {
+	if ts, err := ptypes.Timestamp(this.pb.ModTime); err != nil {
+		return time.Time{}
+	} else {
+		return ts
+	}
+}
+
+func (this *pb_executable) Checksum() string {
+	return this.pb.Checksum
+}
+
+func (this *pb_executable) Arch() string {
+	return this.pb.Arch
+}
+
+func (this *pb_executable) IsGopi() bool {
+	return this.pb.Gopi
+}
+
+func (this *pb_executable) Services() []string {
+	return this.pb.Services
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// RESOLVED TUPLE IMPLEMENTATION
+
+func (this *pb_resolved_tuple) Key() string {
+	return this.pb.Key
+}
+
+func (this *pb_resolved_tuple) Value() string {
+	return this.pb.Value
+}
+
+func (this *pb_resolved_tuple) Origin() string {
+	return this.pb.Origin
+}
+
+func (this *pb_resolved_tuple) Raw() string {
+	return this.pb.Raw
+}
+
+func (this *pb_resolved_tuple) Variables() []rpc.GafferTupleValue {
+	return fromProtoTupleValueArray(this.pb.Variables)
+}
+
+func (this *pb_resolved_tuple) Overrides() []rpc.GafferTupleValue {
+	return fromProtoTupleValueArray(this.pb.Overrides)
+}
+
+func (this *pb_tuple_value) Key() string {
+	return this.pb.Key
+}
+
+func (this *pb_tuple_value) Value() string {
+	return this.pb.Value
+}
+
+func (this *pb_tuple_value) Origin() string {
+	return this.pb.Origin
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// FLAG IMPLEMENTATION
+
+func (this *pb_flag) Name() string {
+	return this.pb.Name
+}
+
+func (this *pb_flag) Type() string {
+	return this.pb.Type
+}
+
+func (this *pb_flag) Default() string {
+	return this.pb.Default
+}
+
+func (this *pb_flag) Usage() string {
+	return this.pb.Usage
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // EVENT IMPLEMENTATION
 
@@ -435,7 +1364,7 @@ func (this *pb_event) Service() rpc.GafferService {
 		return nil
 	} else if this.pb.Service != nil {
 		return fromProtoService(this.pb.Service)
-	} else if this.pb.Instance.Service != nil {
+	} else if this.pb.Instance != nil && this.pb.Instance.Service != nil {
 		return fromProtoService(this.pb.Instance.Service)
 	} else {
 		return nil
@@ -443,7 +1372,7 @@ func (this *pb_event) Service() rpc.GafferService {
 }
 
 func (this *pb_event) Group() rpc.GafferServiceGroup {
-	if this.pb == nil {
+	if this.pb == nil || this.pb.Group == nil {
 		return nil
 	} else {
 		return fromProtoGroup(this.pb.Group)
@@ -451,7 +1380,7 @@ func (this *pb_event) Group() rpc.GafferServiceGroup {
 }
 
 func (this *pb_event) Instance() rpc.GafferServiceInstance {
-	if this.pb == nil {
+	if this.pb == nil || this.pb.Instance == nil {
 		return nil
 	} else {
 		return fromProtoInstance(this.pb.Instance)
@@ -465,3 +1394,62 @@ func (this *pb_event) Data() []byte {
 		return this.pb.Data
 	}
 }
+
+func (this *pb_event) Seq() uint64 {
+	if this.pb == nil {
+		return 0
+	} else {
+		return this.pb.Seq
+	}
+}
+
+func (this *pb_event) Timestamp() time.Time {
+	if this.pb == nil || this.pb.Ts == nil {
+		return time.Time{}
+	} else if ts, err := ptypes.Timestamp(this.pb.Ts); err != nil {
+		return time.Time{}
+	} else {
+		return ts
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// SERVICE RESULT IMPLEMENTATION
+
+func (this *pb_service_result) Service() rpc.GafferService {
+	if this.pb == nil {
+		return nil
+	} else {
+		return fromProtoService(this.pb.Service)
+	}
+}
+
+func (this *pb_service_result) Instances() []rpc.GafferServiceInstance {
+	if this.pb == nil {
+		return nil
+	} else {
+		return fromProtoInstanceArray(this.pb.Instance)
+	}
+}
+
+func (this *pb_service_result) Error() error {
+	if this.pb == nil || this.pb.Error == "" {
+		return nil
+	} else {
+		return errors.New(this.pb.Error)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// durationFromProto returns a duration, or zero if the duration is not set
+func durationFromProto(proto *duration.Duration) time.Duration {
+	if proto == nil {
+		return 0
+	} else if duration, err := ptypes.Duration(proto); err != nil {
+		return 0
+	} else {
+		return duration
+	}
+}
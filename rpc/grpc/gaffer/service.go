@@ -11,6 +11,8 @@ package gaffer
 import (
 	"context"
 	"fmt"
+	"io"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,6 +24,7 @@ import (
 
 	// Protocol buffers
 	pb "github.com/djthorpe/gopi-rpc/rpc/protobuf/gaffer"
+	ptypes "github.com/golang/protobuf/ptypes"
 	empty "github.com/golang/protobuf/ptypes/empty"
 )
 
@@ -41,6 +44,12 @@ type service struct {
 	event.Publisher
 }
 
+// uploadReader reads executable data from an upload stream
+type uploadReader struct {
+	stream pb.Gaffer_UploadExecutableServer
+	data   []byte
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // OPEN AND CLOSE
 
@@ -56,8 +65,13 @@ func (config Service) Open(log gopi.Logger) (gopi.Driver, error) {
 		return nil, gopi.ErrBadParameter
 	}
 
-	// Register service with GRPC server
-	pb.RegisterGafferServer(config.Server.(grpc.GRPCServer).GRPCServer(), this)
+	// Register service with GRPC server, and record calls which change
+	// services, groups or instances in the audit log, including calls
+	// which are denied
+	server := config.Server.(grpc.GRPCServer)
+	pb.RegisterGafferServer(server.GRPCServer(), this)
+	server.AddUnaryInterceptor(this.auditUnaryInterceptor)
+	server.AddStreamInterceptor(this.auditStreamInterceptor)
 
 	// Start background task which reports on all events (for debugging)
 	this.Tasks.Start(this.EventTask)
@@ -117,51 +131,72 @@ func (this *service) ListExecutables(context.Context, *empty.Empty) (*pb.ListExe
 	this.log.Debug("<grpc.service.gaffer.ListExecutables>{ }")
 
 	recursive := true
-	executables := this.gaffer.GetExecutables(recursive)
+	paths := this.gaffer.GetExecutables(recursive)
+	executables := make([]*pb.Executable, 0, len(paths))
+	for _, path := range paths {
+		if executable, err := this.gaffer.GetExecutableForPath(path); err != nil {
+			this.log.Warn("ListExecutables: %v: %v", path, err)
+		} else {
+			executables = append(executables, toProtoFromExecutable(executable))
+		}
+	}
 
 	return &pb.ListExecutablesReply{
-		Path: executables,
+		Path:       paths,
+		Executable: executables,
 	}, nil
 }
 
-// List services
-func (this *service) ListServices(_ context.Context, req *pb.RequestFilter) (*pb.ListServicesReply, error) {
-	this.log.Debug("<grpc.service.gaffer.ListServices>{ req=%v }", req)
+// UploadExecutable receives an executable from a stream of chunks
+func (this *service) UploadExecutable(stream pb.Gaffer_UploadExecutableServer) error {
+	this.log.Debug("<grpc.service.gaffer.UploadExecutable>{ }")
 
-	// Where one service is required
-	if req.Type == pb.RequestFilter_SERVICE {
-		service := this.gaffer.GetServiceForName(req.Value)
-		if service == nil {
-			return &pb.ListServicesReply{
-				Service: []*pb.Service{},
-			}, nil
-		} else {
-			return &pb.ListServicesReply{
-				Service: []*pb.Service{toProtoFromService(service)},
-			}, nil
-		}
+	if req, err := stream.Recv(); err == io.EOF {
+		return gopi.ErrBadParameter
+	} else if err != nil {
+		return err
+	} else if executable, err := this.gaffer.UploadExecutable(req.Path, &uploadReader{stream, req.Data}, req.Checksum); err != nil {
+		return err
+	} else {
+		return stream.SendAndClose(toProtoFromExecutable(executable))
 	}
+}
 
-	// Obtain all services
-	services := this.gaffer.GetServices()
-	if len(services) == 0 {
-		return &pb.ListServicesReply{}, nil
+// RollbackExecutable restores a previous version of an executable
+func (this *service) RollbackExecutable(_ context.Context, req *pb.RollbackExecutableRequest) (*pb.Executable, error) {
+	this.log.Debug("<grpc.service.gaffer.RollbackExecutable>{ req=%v }", req)
+
+	if executable, err := this.gaffer.RollbackExecutable(req.Path, req.Checksum); err != nil {
+		return nil, err
+	} else {
+		return toProtoFromExecutable(executable), nil
 	}
+}
 
-	if req.Type == pb.RequestFilter_GROUP {
-		// Where services should be returned filtered by group name
-		return &pb.ListServicesReply{
-			Service: toProtoFromServiceArray(services, func(s rpc.GafferService) bool {
-				return s.IsMemberOfGroup(req.Value)
-			}),
+// ListExecutableFlags returns the flags accepted by an executable
+func (this *service) ListExecutableFlags(_ context.Context, req *pb.NameRequest) (*pb.ListFlagsReply, error) {
+	this.log.Debug("<grpc.service.gaffer.ListExecutableFlags>{ req=%v }", req)
+
+	if flags, err := this.gaffer.GetFlagsForExecutable(req.Name); err != nil {
+		return nil, err
+	} else {
+		return &pb.ListFlagsReply{
+			Flag: toProtoFromFlagArray(flags),
 		}, nil
-	} else if req.Type == pb.RequestFilter_NONE {
-		// Where all services should be returned (no filtering)
+	}
+}
+
+// List services
+func (this *service) ListServices(_ context.Context, req *pb.RequestFilter) (*pb.ListServicesReply, error) {
+	this.log.Debug("<grpc.service.gaffer.ListServices>{ req=%v }", req)
+
+	if filter, err := newFilter(this.gaffer, req); err != nil {
+		return nil, err
+	} else {
+		services := filter.Services(this.gaffer.GetServices())
 		return &pb.ListServicesReply{
 			Service: toProtoFromServiceArray(services, nil),
 		}, nil
-	} else {
-		return nil, gopi.ErrNotImplemented
 	}
 }
 
@@ -169,81 +204,38 @@ func (this *service) ListServices(_ context.Context, req *pb.RequestFilter) (*pb
 func (this *service) ListGroups(_ context.Context, req *pb.RequestFilter) (*pb.ListGroupsReply, error) {
 	this.log.Debug("<grpc.service.gaffer.ListGroups>{ req=%v }", req)
 
-	// Where one group is required
-	if req.Type == pb.RequestFilter_GROUP {
-		groups := this.gaffer.GetGroupsForNames([]string{req.Value})
-		if len(groups) == 0 {
-			return &pb.ListGroupsReply{
-				Group: []*pb.Group{},
-			}, nil
-		} else {
-			return &pb.ListGroupsReply{
-				Group: toProtoFromGroupArray(groups, nil),
-			}, nil
-		}
-	}
-
-	// Where groups of a service are required
-	if req.Type == pb.RequestFilter_SERVICE {
-		if service := this.gaffer.GetServiceForName(req.Value); service == nil {
-			return nil, gopi.ErrNotFound
-		} else {
-			groups := this.gaffer.GetGroupsForNames(service.Groups())
-			return &pb.ListGroupsReply{
-				Group: toProtoFromGroupArray(groups, nil),
-			}, nil
-		}
+	// Where groups of a service are required, the service needs to exist
+	if req.Type == pb.RequestFilter_SERVICE && this.gaffer.GetServiceForName(req.Value) == nil {
+		return nil, gopi.ErrNotFound
 	}
 
-	// Obtain all groups
-	if req.Type == pb.RequestFilter_NONE {
-		groups := this.gaffer.GetGroups()
+	if filter, err := newFilter(this.gaffer, req); err != nil {
+		return nil, err
+	} else {
+		groups := filter.Groups(this.gaffer.GetGroups())
 		return &pb.ListGroupsReply{
 			Group: toProtoFromGroupArray(groups, nil),
 		}, nil
 	}
-
-	return nil, gopi.ErrNotImplemented
 }
 
 // List instances
 func (this *service) ListInstances(_ context.Context, req *pb.RequestFilter) (*pb.ListInstancesReply, error) {
 	this.log.Debug("<grpc.service.gaffer.ListInstances>{ req=%v }", req)
 
-	// Get instances
-	instances := this.gaffer.GetInstances()
-
-	// Obtain all instances
-	if req.Type == pb.RequestFilter_NONE {
-		return &pb.ListInstancesReply{
-			Instance: toProtoFromInstanceArray(instances, nil),
-		}, nil
-	}
-
-	// Obtain instances for a service
-	if req.Type == pb.RequestFilter_SERVICE {
-		if service := this.gaffer.GetServiceForName(req.Value); service == nil {
-			return nil, gopi.ErrNotFound
-		} else {
-			return &pb.ListInstancesReply{
-				Instance: toProtoFromInstanceArray(instances, func(i rpc.GafferServiceInstance) bool {
-					return i.Service() == service
-				}),
-			}, nil
-		}
+	// Where instances of a service are required, the service needs to exist
+	if req.Type == pb.RequestFilter_SERVICE && this.gaffer.GetServiceForName(req.Value) == nil {
+		return nil, gopi.ErrNotFound
 	}
 
-	// Obtain instances for services in a particular group
-	if req.Type == pb.RequestFilter_SERVICE {
+	if filter, err := newFilter(this.gaffer, req); err != nil {
+		return nil, err
+	} else {
+		instances := filter.Instances(this.gaffer.GetInstances())
 		return &pb.ListInstancesReply{
-			Instance: toProtoFromInstanceArray(instances, func(i rpc.GafferServiceInstance) bool {
-				return i.Service().IsMemberOfGroup(req.Value)
-			}),
+			Instance: toProtoFromInstanceArray(instances, nil),
 		}, nil
 	}
-
-	// Filter not implemented
-	return nil, gopi.ErrNotImplemented
 }
 
 // Add a service
@@ -278,6 +270,68 @@ func (this *service) SetServiceParameters(_ context.Context, req *pb.ServiceRequ
 	}
 }
 
+// Set parameters for a group
+func (this *service) SetGroupParameters(_ context.Context, req *pb.GroupRequest) (*pb.Group, error) {
+	this.log.Debug("<grpc.service.gaffer.SetGroupParameters>{ req=%v }", req)
+
+	if groups := this.gaffer.GetGroupsForNames([]string{req.Name}); len(groups) != 1 {
+		return nil, gopi.ErrNotFound
+	} else if err := this.gaffer.SetGroupGroupsForName(req.Name, req.Groups); err != nil && err != gopi.ErrNotModified {
+		return nil, err
+	} else {
+		return toProtoFromGroup(groups[0]), nil
+	}
+}
+
+// Resolve flags and environment for a service
+func (this *service) ResolveService(_ context.Context, req *pb.NameRequest) (*pb.ResolveServiceReply, error) {
+	this.log.Debug("<grpc.service.gaffer.ResolveService>{ req=%v }", req)
+
+	if flags, env, err := this.gaffer.ResolveServiceForName(req.Name); err != nil {
+		return nil, err
+	} else {
+		return &pb.ResolveServiceReply{
+			Flags: toProtoFromResolvedTupleArray(flags),
+			Env:   toProtoFromResolvedTupleArray(env),
+		}, nil
+	}
+}
+
+// Return the data directory for a service
+func (this *service) GetServiceData(_ context.Context, req *pb.NameRequest) (*pb.ServiceData, error) {
+	this.log.Debug("<grpc.service.gaffer.GetServiceData>{ req=%v }", req)
+
+	if data, err := this.gaffer.GetServiceDataForName(req.Name); err != nil {
+		return nil, err
+	} else {
+		return toProtoFromServiceData(data), nil
+	}
+}
+
+// Remove the contents of the data directory for a service
+func (this *service) WipeServiceData(_ context.Context, req *pb.NameRequest) (*pb.ServiceData, error) {
+	this.log.Debug("<grpc.service.gaffer.WipeServiceData>{ req=%v }", req)
+
+	if data, err := this.gaffer.WipeServiceDataForName(req.Name); err != nil {
+		return nil, err
+	} else {
+		return toProtoFromServiceData(data), nil
+	}
+}
+
+// Set upgrade policy for a service
+func (this *service) SetServiceUpgradePolicy(_ context.Context, req *pb.SetUpgradePolicyRequest) (*pb.Service, error) {
+	this.log.Debug("<grpc.service.gaffer.SetServiceUpgradePolicy>{ req=%v }", req)
+
+	if err := this.gaffer.SetServiceUpgradePolicyForName(req.Name, rpc.GafferUpgradePolicy(req.Policy)); err != nil && err != gopi.ErrNotModified {
+		return nil, err
+	} else if service := this.gaffer.GetServiceForName(req.Name); service == nil {
+		return nil, gopi.ErrNotFound
+	} else {
+		return toProtoFromService(service), nil
+	}
+}
+
 // Add a group
 func (this *service) AddGroup(_ context.Context, req *pb.NameRequest) (*pb.Group, error) {
 	this.log.Debug("<grpc.service.gaffer.AddGroup>{ req=%v }", req)
@@ -348,7 +402,7 @@ func (this *service) StopInstance(_ context.Context, req *pb.InstanceId) (*pb.In
 
 // Set group flags
 func (this *service) SetGroupFlags(_ context.Context, req *pb.SetTuplesRequest) (*pb.Group, error) {
-	this.log.Debug("<grpc.service.gaffer.SetGroupFlags>{ req=%v }", req)
+	this.log.Debug("<grpc.service.gaffer.SetGroupFlags>{ name=%v }", strconv.Quote(req.Name))
 
 	if err := this.gaffer.SetGroupFlagsForName(req.Name, fromProtoTuples(req.Tuples)); err != nil {
 		return nil, err
@@ -363,7 +417,7 @@ func (this *service) SetGroupFlags(_ context.Context, req *pb.SetTuplesRequest)
 
 // Set group env
 func (this *service) SetGroupEnv(_ context.Context, req *pb.SetTuplesRequest) (*pb.Group, error) {
-	this.log.Debug("<grpc.service.gaffer.SetGroupEnv>{ req=%v }", req)
+	this.log.Debug("<grpc.service.gaffer.SetGroupEnv>{ name=%v }", strconv.Quote(req.Name))
 
 	if err := this.gaffer.SetGroupEnvForName(req.Name, fromProtoTuples(req.Tuples)); err != nil {
 		return nil, err
@@ -378,7 +432,7 @@ func (this *service) SetGroupEnv(_ context.Context, req *pb.SetTuplesRequest) (*
 
 // Set service flags
 func (this *service) SetServiceFlags(_ context.Context, req *pb.SetTuplesRequest) (*pb.Service, error) {
-	this.log.Debug("<grpc.service.gaffer.SetServiceFlags>{ req=%v }", req)
+	this.log.Debug("<grpc.service.gaffer.SetServiceFlags>{ name=%v }", strconv.Quote(req.Name))
 
 	if err := this.gaffer.SetServiceFlagsForName(req.Name, fromProtoTuples(req.Tuples)); err != nil {
 		return nil, err
@@ -389,11 +443,392 @@ func (this *service) SetServiceFlags(_ context.Context, req *pb.SetTuplesRequest
 	}
 }
 
+// Patch group flags
+func (this *service) PatchGroupFlags(_ context.Context, req *pb.PatchTuplesRequest) (*pb.Group, error) {
+	this.log.Debug("<grpc.service.gaffer.PatchGroupFlags>{ name=%v }", strconv.Quote(req.Name))
+
+	if err := this.gaffer.PatchGroupFlagsForName(req.Name, req.Version, fromProtoTuplesPatch(req.Ops)); err != nil {
+		return nil, err
+	} else if groups := this.gaffer.GetGroupsForNames([]string{req.Name}); len(groups) == 0 {
+		return nil, gopi.ErrNotFound
+	} else if len(groups) > 1 {
+		return nil, gopi.ErrAppError
+	} else {
+		return toProtoFromGroup(groups[0]), nil
+	}
+}
+
+// Patch group env
+func (this *service) PatchGroupEnv(_ context.Context, req *pb.PatchTuplesRequest) (*pb.Group, error) {
+	this.log.Debug("<grpc.service.gaffer.PatchGroupEnv>{ name=%v }", strconv.Quote(req.Name))
+
+	if err := this.gaffer.PatchGroupEnvForName(req.Name, req.Version, fromProtoTuplesPatch(req.Ops)); err != nil {
+		return nil, err
+	} else if groups := this.gaffer.GetGroupsForNames([]string{req.Name}); len(groups) == 0 {
+		return nil, gopi.ErrNotFound
+	} else if len(groups) > 1 {
+		return nil, gopi.ErrAppError
+	} else {
+		return toProtoFromGroup(groups[0]), nil
+	}
+}
+
+// Patch service flags
+func (this *service) PatchServiceFlags(_ context.Context, req *pb.PatchTuplesRequest) (*pb.Service, error) {
+	this.log.Debug("<grpc.service.gaffer.PatchServiceFlags>{ name=%v }", strconv.Quote(req.Name))
+
+	if err := this.gaffer.PatchServiceFlagsForName(req.Name, req.Version, fromProtoTuplesPatch(req.Ops)); err != nil {
+		return nil, err
+	} else if service := this.gaffer.GetServiceForName(req.Name); service == nil {
+		return nil, gopi.ErrNotFound
+	} else {
+		return toProtoFromService(service), nil
+	}
+}
+
+// Set service secrets
+func (this *service) SetServiceSecrets(_ context.Context, req *pb.SetSecretsRequest) (*pb.Service, error) {
+	this.log.Debug("<grpc.service.gaffer.SetServiceSecrets>{ req=%v }", req)
+
+	if err := this.gaffer.SetServiceSecretsForName(req.Name, req.Keys); err != nil {
+		return nil, err
+	} else if service := this.gaffer.GetServiceForName(req.Name); service == nil {
+		return nil, gopi.ErrNotFound
+	} else {
+		return toProtoFromService(service), nil
+	}
+}
+
+// Set group secrets
+func (this *service) SetGroupSecrets(_ context.Context, req *pb.SetSecretsRequest) (*pb.Group, error) {
+	this.log.Debug("<grpc.service.gaffer.SetGroupSecrets>{ req=%v }", req)
+
+	if err := this.gaffer.SetGroupSecretsForName(req.Name, req.Keys); err != nil {
+		return nil, err
+	} else if groups := this.gaffer.GetGroupsForNames([]string{req.Name}); len(groups) == 0 {
+		return nil, gopi.ErrNotFound
+	} else if len(groups) > 1 {
+		return nil, gopi.ErrAppError
+	} else {
+		return toProtoFromGroup(groups[0]), nil
+	}
+}
+
+// Set service env policy
+func (this *service) SetServiceEnvPolicy(_ context.Context, req *pb.SetEnvPolicyRequest) (*pb.Service, error) {
+	this.log.Debug("<grpc.service.gaffer.SetServiceEnvPolicy>{ req=%v }", req)
+
+	if err := this.gaffer.SetServiceEnvPolicyForName(req.Name, rpc.GafferEnvPolicy(req.Policy), req.Allow); err != nil {
+		return nil, err
+	} else if service := this.gaffer.GetServiceForName(req.Name); service == nil {
+		return nil, gopi.ErrNotFound
+	} else {
+		return toProtoFromService(service), nil
+	}
+}
+
+// Set group env policy
+func (this *service) SetGroupEnvPolicy(_ context.Context, req *pb.SetEnvPolicyRequest) (*pb.Group, error) {
+	this.log.Debug("<grpc.service.gaffer.SetGroupEnvPolicy>{ req=%v }", req)
+
+	if err := this.gaffer.SetGroupEnvPolicyForName(req.Name, rpc.GafferEnvPolicy(req.Policy), req.Allow); err != nil {
+		return nil, err
+	} else if groups := this.gaffer.GetGroupsForNames([]string{req.Name}); len(groups) == 0 {
+		return nil, gopi.ErrNotFound
+	} else if len(groups) > 1 {
+		return nil, gopi.ErrAppError
+	} else {
+		return toProtoFromGroup(groups[0]), nil
+	}
+}
+
+// Set group env files
+func (this *service) SetGroupEnvFiles(_ context.Context, req *pb.SetEnvFilesRequest) (*pb.Group, error) {
+	this.log.Debug("<grpc.service.gaffer.SetGroupEnvFiles>{ req=%v }", req)
+
+	if err := this.gaffer.SetGroupEnvFilesForName(req.Name, req.Files); err != nil {
+		return nil, err
+	} else if groups := this.gaffer.GetGroupsForNames([]string{req.Name}); len(groups) == 0 {
+		return nil, gopi.ErrNotFound
+	} else if len(groups) > 1 {
+		return nil, gopi.ErrAppError
+	} else {
+		return toProtoFromGroup(groups[0]), nil
+	}
+}
+
+// Set service hooks
+func (this *service) SetServiceHooks(_ context.Context, req *pb.SetHooksRequest) (*pb.Service, error) {
+	this.log.Debug("<grpc.service.gaffer.SetServiceHooks>{ req=%v }", req)
+
+	if err := this.gaffer.SetServiceHooksForName(req.Name, fromProtoHooks(req.Hooks)); err != nil {
+		return nil, err
+	} else if service := this.gaffer.GetServiceForName(req.Name); service == nil {
+		return nil, gopi.ErrNotFound
+	} else {
+		return toProtoFromService(service), nil
+	}
+}
+
+// Set group hooks
+func (this *service) SetGroupHooks(_ context.Context, req *pb.SetHooksRequest) (*pb.Group, error) {
+	this.log.Debug("<grpc.service.gaffer.SetGroupHooks>{ req=%v }", req)
+
+	if err := this.gaffer.SetGroupHooksForName(req.Name, fromProtoHooks(req.Hooks)); err != nil {
+		return nil, err
+	} else if groups := this.gaffer.GetGroupsForNames([]string{req.Name}); len(groups) == 0 {
+		return nil, gopi.ErrNotFound
+	} else if len(groups) > 1 {
+		return nil, gopi.ErrAppError
+	} else {
+		return toProtoFromGroup(groups[0]), nil
+	}
+}
+
+// Set service flag style and positional arguments
+func (this *service) SetServiceArgs(_ context.Context, req *pb.SetServiceArgsRequest) (*pb.Service, error) {
+	this.log.Debug("<grpc.service.gaffer.SetServiceArgs>{ req=%v }", req)
+
+	if err := this.gaffer.SetServiceArgsForName(req.Name, rpc.GafferFlagStyle(req.FlagStyle), req.Args); err != nil {
+		return nil, err
+	} else if service := this.gaffer.GetServiceForName(req.Name); service == nil {
+		return nil, gopi.ErrNotFound
+	} else {
+		return toProtoFromService(service), nil
+	}
+}
+
+// Set service labels
+func (this *service) SetServiceLabels(_ context.Context, req *pb.SetTuplesRequest) (*pb.Service, error) {
+	this.log.Debug("<grpc.service.gaffer.SetServiceLabels>{ req=%v }", req)
+
+	if err := this.gaffer.SetServiceLabelsForName(req.Name, fromProtoTuples(req.Tuples)); err != nil {
+		return nil, err
+	} else if service := this.gaffer.GetServiceForName(req.Name); service == nil {
+		return nil, gopi.ErrNotFound
+	} else {
+		return toProtoFromService(service), nil
+	}
+}
+
+// Set instance labels
+func (this *service) SetInstanceLabels(_ context.Context, req *pb.SetInstanceLabelsRequest) (*pb.Instance, error) {
+	this.log.Debug("<grpc.service.gaffer.SetInstanceLabels>{ req=%v }", req)
+
+	if instance, err := this.gaffer.SetInstanceLabelsForId(req.Id, fromProtoTuples(req.Labels)); err != nil {
+		return nil, err
+	} else {
+		return toProtoFromInstance(instance), nil
+	}
+}
+
+// Send a signal to an instance
+func (this *service) SignalInstance(_ context.Context, req *pb.SignalRequest) (*pb.Instance, error) {
+	this.log.Debug("<grpc.service.gaffer.SignalInstance>{ req=%v }", req)
+
+	if signal, err := rpc.SignalForName(req.Signal); err != nil {
+		return nil, err
+	} else if instance, err := this.gaffer.SignalInstanceForId(req.Id, signal, req.ProcessGroup); err != nil {
+		return nil, err
+	} else {
+		return toProtoFromInstance(instance), nil
+	}
+}
+
+// Send a signal to all running instances of a service
+func (this *service) SignalService(_ context.Context, req *pb.SignalRequest) (*pb.ListInstancesReply, error) {
+	this.log.Debug("<grpc.service.gaffer.SignalService>{ req=%v }", req)
+
+	if signal, err := rpc.SignalForName(req.Signal); err != nil {
+		return nil, err
+	} else if instances, err := this.gaffer.SignalInstancesForServiceName(req.Name, signal, req.ProcessGroup); err != nil {
+		return nil, err
+	} else {
+		return &pb.ListInstancesReply{
+			Instance: toProtoFromInstanceArray(instances, nil),
+		}, nil
+	}
+}
+
+// Send a signal to all running instances of services in a group
+func (this *service) SignalGroup(_ context.Context, req *pb.SignalRequest) (*pb.ListInstancesReply, error) {
+	this.log.Debug("<grpc.service.gaffer.SignalGroup>{ req=%v }", req)
+
+	if signal, err := rpc.SignalForName(req.Signal); err != nil {
+		return nil, err
+	} else if instances, err := this.gaffer.SignalInstancesForGroupName(req.Name, signal, req.ProcessGroup); err != nil {
+		return nil, err
+	} else {
+		return &pb.ListInstancesReply{
+			Instance: toProtoFromInstanceArray(instances, nil),
+		}, nil
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// SCALE AND RESTART
+
+// Scale the number of running instances for a service, streaming progress
+func (this *service) ScaleService(req *pb.ScaleServiceRequest, stream pb.Gaffer_ScaleServiceServer) error {
+	this.log.Debug("<grpc.service.gaffer.ScaleService>{ req=%v }", req)
+
+	progress := make(chan rpc.GafferEvent)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- this.gaffer.ScaleServiceForName(req.Name, uint(req.InstanceCount), progress)
+		close(progress)
+	}()
+	this.sendProgress(stream, progress)
+	return <-errs
+}
+
+// Rolling restart of the running instances for a service, streaming progress
+func (this *service) RestartService(req *pb.RestartServiceRequest, stream pb.Gaffer_RestartServiceServer) error {
+	this.log.Debug("<grpc.service.gaffer.RestartService>{ req=%v }", req)
+
+	settle := time.Duration(0)
+	if req.SettleTime != nil {
+		if duration, err := ptypes.Duration(req.SettleTime); err != nil {
+			return err
+		} else {
+			settle = duration
+		}
+	}
+
+	progress := make(chan rpc.GafferEvent)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- this.gaffer.RestartServiceForName(req.Name, settle, progress)
+		close(progress)
+	}()
+	this.sendProgress(stream, progress)
+	return <-errs
+}
+
+// Start every service in a group
+func (this *service) StartGroup(_ context.Context, req *pb.GroupOperationRequest) (*pb.GroupOperationReply, error) {
+	this.log.Debug("<grpc.service.gaffer.StartGroup>{ req=%v }", req)
+
+	if results, err := this.gaffer.StartGroupForName(req.Name, req.AllOrNothing); err != nil {
+		return nil, err
+	} else {
+		return &pb.GroupOperationReply{
+			Result: toProtoFromServiceResultArray(results),
+		}, nil
+	}
+}
+
+// Stop every service in a group
+func (this *service) StopGroup(_ context.Context, req *pb.GroupOperationRequest) (*pb.GroupOperationReply, error) {
+	this.log.Debug("<grpc.service.gaffer.StopGroup>{ req=%v }", req)
+
+	if results, err := this.gaffer.StopGroupForName(req.Name); err != nil {
+		return nil, err
+	} else {
+		return &pb.GroupOperationReply{
+			Result: toProtoFromServiceResultArray(results),
+		}, nil
+	}
+}
+
+// Restart every service in a group
+func (this *service) RestartGroup(_ context.Context, req *pb.GroupOperationRequest) (*pb.GroupOperationReply, error) {
+	this.log.Debug("<grpc.service.gaffer.RestartGroup>{ req=%v }", req)
+
+	settle := time.Duration(0)
+	if req.SettleTime != nil {
+		if duration, err := ptypes.Duration(req.SettleTime); err != nil {
+			return nil, err
+		} else {
+			settle = duration
+		}
+	}
+
+	if results, err := this.gaffer.RestartGroupForName(req.Name, settle, req.AllOrNothing); err != nil {
+		return nil, err
+	} else {
+		return &pb.GroupOperationReply{
+			Result: toProtoFromServiceResultArray(results),
+		}, nil
+	}
+}
+
+// sendProgress sends progress events on a stream until the progress
+// channel is closed. Once the stream fails, remaining events are discarded
+func (this *service) sendProgress(stream interface {
+	Send(*pb.GafferEvent) error
+}, progress <-chan rpc.GafferEvent) {
+	ok := true
+	for evt := range progress {
+		if ok == false {
+			continue
+		} else if err := stream.Send(toProtoEvent(evt)); err != nil {
+			this.log.Warn("sendProgress: %v", err)
+			ok = false
+		}
+	}
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // STREAM EVENTS
 
-func (this *service) StreamEvents(_ *empty.Empty, stream pb.Gaffer_StreamEventsServer) error {
-	this.log.Debug2("<grpc.service.gaffer.StreamEvents>{ }")
+// Query events from the journal
+func (this *service) QueryEvents(_ context.Context, req *pb.QueryEventsRequest) (*pb.QueryEventsReply, error) {
+	this.log.Debug("<grpc.service.gaffer.QueryEvents>{ req=%v }", req)
+
+	if events, err := this.gaffer.QueryEvents(fromProtoEventQuery(req)); err != nil {
+		return nil, err
+	} else {
+		return &pb.QueryEventsReply{
+			Events: toProtoEventArray(events),
+		}, nil
+	}
+}
+
+// Return crash reports, most recent first
+func (this *service) ListCrashReports(_ context.Context, req *pb.NameRequest) (*pb.ListCrashReportsReply, error) {
+	this.log.Debug("<grpc.service.gaffer.ListCrashReports>{ req=%v }", req)
+
+	if reports, err := this.gaffer.ListCrashReports(req.Name); err != nil {
+		return nil, err
+	} else {
+		return &pb.ListCrashReportsReply{
+			Reports: toProtoFromCrashReportArray(reports),
+		}, nil
+	}
+}
+
+// Return a crash report
+func (this *service) GetCrashReport(_ context.Context, req *pb.CrashReportId) (*pb.CrashReport, error) {
+	this.log.Debug("<grpc.service.gaffer.GetCrashReport>{ req=%v }", req)
+
+	if report, err := this.gaffer.GetCrashReportForId(req.Id); err != nil {
+		return nil, err
+	} else {
+		return toProtoFromCrashReport(report), nil
+	}
+}
+
+// Return records from the audit log
+func (this *service) QueryAudit(_ context.Context, req *pb.QueryAuditRequest) (*pb.QueryAuditReply, error) {
+	this.log.Debug("<grpc.service.gaffer.QueryAudit>{ req=%v }", req)
+
+	if records, err := this.gaffer.QueryAudit(fromProtoAuditQuery(req)); err != nil {
+		return nil, err
+	} else {
+		return &pb.QueryAuditReply{
+			Records: toProtoFromAuditRecordArray(records),
+		}, nil
+	}
+}
+
+func (this *service) StreamEvents(req *pb.RequestFilter, stream pb.Gaffer_StreamEventsServer) error {
+	this.log.Debug2("<grpc.service.gaffer.StreamEvents>{ req=%v }", req)
+
+	filter, err := newFilter(this.gaffer, req)
+	if err != nil {
+		return err
+	}
 
 	// Subscribe to channel for incoming events, and continue until cancel request is received, send
 	// empty events occasionally to ensure the channel is still alive
@@ -401,22 +836,66 @@ func (this *service) StreamEvents(_ *empty.Empty, stream pb.Gaffer_StreamEventsS
 	cancel := this.Subscribe()
 	ticker := time.NewTicker(time.Second)
 
+	// Events are subscribed to before the sequence number is read, so every
+	// later event is received. When resuming, the events from the journal
+	// after the sequence number in the filter are sent, and events which
+	// are also received are not sent again. Events received while the
+	// journal is sent are buffered, so that emitting events is not held up.
+	// The sequence number of the last event considered is sent with each
+	// heartbeat, so that the client can resume from it even when no events
+	// match the filter
+	done := make(chan struct{})
+	buffered := this.bufferEvents(events, done)
+	after, err := this.sendJournal(filter, stream, this.gaffer.EventSeq())
+	close(done)
+	pending := <-buffered
+	if err == nil {
+		err = stream.Send(&pb.GafferEvent{Seq: after})
+	}
+	if err != nil {
+		ticker.Stop()
+		this.gaffer.Unsubscribe(events)
+		this.Unsubscribe(cancel)
+		return err
+	}
+
+	// sendEvent sends an event which matches the filter and has not been
+	// sent already, and returns false if the stream should be ended
+	sendEvent := func(evt gopi.Event) bool {
+		if evt_, ok := evt.(rpc.GafferEvent); ok == false {
+			this.log.Warn("StreamEvents: Ignoring event: %v", evt)
+		} else if evt_.Seq() <= after {
+			return true
+		} else if after = evt_.Seq(); filter.MatchEvent(evt_) == false {
+			return true
+		} else if err := stream.Send(toProtoEvent(evt_)); err != nil {
+			this.log.Warn("StreamEvents: %v", err)
+			return false
+		}
+		return true
+	}
+
+	// Send the events received while the journal was sent
+	for _, evt := range pending {
+		if sendEvent(evt) == false {
+			ticker.Stop()
+			this.gaffer.Unsubscribe(events)
+			this.Unsubscribe(cancel)
+			return nil
+		}
+	}
+
 FOR_LOOP:
 	for {
 		select {
 		case evt := <-events:
 			if evt == nil {
 				break FOR_LOOP
-			} else if evt_, ok := evt.(rpc.GafferEvent); ok {
-				if err := stream.Send(toProtoEvent(evt_)); err != nil {
-					this.log.Warn("StreamEvents: %v", err)
-					break FOR_LOOP
-				}
-			} else {
-				this.log.Warn("StreamEvents: Ignoring event: %v", evt)
+			} else if sendEvent(evt) == false {
+				break FOR_LOOP
 			}
 		case <-ticker.C:
-			if err := stream.Send(&pb.GafferEvent{}); err != nil {
+			if err := stream.Send(&pb.GafferEvent{Seq: after}); err != nil {
 				this.log.Warn("StreamEvents: %v", err)
 				break FOR_LOOP
 			}
@@ -436,6 +915,69 @@ FOR_LOOP:
 	return nil
 }
 
+// bufferEvents reads events until done is closed, and then returns the
+// events read on the returned channel
+func (this *service) bufferEvents(events <-chan gopi.Event, done <-chan struct{}) <-chan []gopi.Event {
+	buffered := make(chan []gopi.Event, 1)
+	go func() {
+		pending := make([]gopi.Event, 0)
+		for {
+			select {
+			case evt := <-events:
+				if evt == nil {
+					// The channel is closed, so stop reading from it
+					events = nil
+				} else {
+					pending = append(pending, evt)
+				}
+			case <-done:
+				buffered <- pending
+				return
+			}
+		}
+	}()
+	return buffered
+}
+
+// sendJournal sends the events from the journal which match the filter and
+// were emitted after the sequence number in the filter, and returns the
+// sequence number of the last event in the journal, or seq if it is later
+func (this *service) sendJournal(filter *filter, stream pb.Gaffer_StreamEventsServer, seq uint64) (uint64, error) {
+	if filter.after == 0 {
+		return seq, nil
+	} else if events, err := this.gaffer.QueryEvents(filter.Query()); err != nil {
+		return 0, err
+	} else {
+		for _, evt := range events {
+			if evt.Seq() > seq {
+				seq = evt.Seq()
+			}
+			if filter.MatchEvent(evt) == false {
+				continue
+			} else if err := stream.Send(toProtoEvent(evt)); err != nil {
+				return 0, err
+			}
+		}
+		return seq, nil
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// UPLOAD READER
+
+func (this *uploadReader) Read(p []byte) (int, error) {
+	for len(this.data) == 0 {
+		if req, err := this.stream.Recv(); err != nil {
+			return 0, err
+		} else {
+			this.data = req.Data
+		}
+	}
+	n := copy(p, this.data)
+	this.data = this.data[n:]
+	return n, nil
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // BACKGROUND TASKS
 
@@ -464,7 +1006,7 @@ FOR_LOOP:
 
 func (this *service) EventPrint(evt rpc.GafferEvent) {
 	switch evt.Type() {
-	case rpc.GAFFER_EVENT_LOG_STDERR, rpc.GAFFER_EVENT_LOG_STDOUT:
+	case rpc.GAFFER_EVENT_LOG_STDERR, rpc.GAFFER_EVENT_LOG_STDOUT, rpc.GAFFER_EVENT_HOOK_STDERR, rpc.GAFFER_EVENT_HOOK_STDOUT:
 		line := strings.Trim(string(evt.Data()), "\n")
 		this.log.Debug2("%v[%v]: %v", evt.Service().Name(), evt.Instance().Id(), line)
 	default:
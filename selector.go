@@ -0,0 +1,178 @@
+/*
+  Go Language Raspberry Pi Interface
+  (c) Copyright David Thorpe 2019
+  All Rights Reserved
+
+  Documentation http://djthorpe.github.io/gopi/
+  For Licensing and Usage information, please see LICENSE.md
+*/
+
+package rpc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// LabelSelector matches labels against a comma-separated list of
+// requirements, which all need to be met. A requirement is one of
+// key=value, key==value, key!=value, key (the key exists) or !key
+// (the key does not exist)
+type LabelSelector struct {
+	requirements []*requirement
+}
+
+type requirement struct {
+	key, value string
+	op         selectorOp
+}
+
+type selectorOp uint
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	selectorEquals selectorOp = iota
+	selectorNotEquals
+	selectorExists
+	selectorNotExists
+)
+
+const (
+	// LABEL_TXT_PREFIX is the prefix for labels in the TXT records of a
+	// service record, which are in the form label.<key>=<value>
+	LABEL_TXT_PREFIX = "label."
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// ParseLabelSelector returns a label selector from a string, or an
+// error if the string could not be parsed. An empty string returns
+// a selector which matches everything
+func ParseLabelSelector(str string) (LabelSelector, error) {
+	var this LabelSelector
+	if strings.TrimSpace(str) == "" {
+		return this, nil
+	}
+	for _, elem := range strings.Split(str, ",") {
+		elem = strings.TrimSpace(elem)
+		r := new(requirement)
+		if pos := strings.Index(elem, "!="); pos >= 0 {
+			r.key, r.value, r.op = elem[:pos], elem[pos+2:], selectorNotEquals
+		} else if pos := strings.Index(elem, "=="); pos >= 0 {
+			r.key, r.value, r.op = elem[:pos], elem[pos+2:], selectorEquals
+		} else if pos := strings.Index(elem, "="); pos >= 0 {
+			r.key, r.value, r.op = elem[:pos], elem[pos+1:], selectorEquals
+		} else if strings.HasPrefix(elem, "!") {
+			r.key, r.op = elem[1:], selectorNotExists
+		} else {
+			r.key, r.op = elem, selectorExists
+		}
+		r.key, r.value = strings.TrimSpace(r.key), strings.TrimSpace(r.value)
+		if reTupleKey.MatchString(r.key) == false {
+			return LabelSelector{}, fmt.Errorf("Invalid label selector: %v", strconv.Quote(elem))
+		}
+		this.requirements = append(this.requirements, r)
+	}
+	return this, nil
+}
+
+// ParseLabels returns labels from a comma-separated list of key=value
+// pairs, or an error if the string could not be parsed
+func ParseLabels(str string) (Tuples, error) {
+	var labels Tuples
+	for _, elem := range strings.Split(str, ",") {
+		if elem = strings.TrimSpace(elem); elem == "" {
+			continue
+		} else if pos := strings.Index(elem, "="); pos < 0 {
+			return Tuples{}, fmt.Errorf("Invalid label: %v", strconv.Quote(elem))
+		} else if key, value := strings.TrimSpace(elem[:pos]), strings.TrimSpace(elem[pos+1:]); reTupleKey.MatchString(key) == false {
+			return Tuples{}, fmt.Errorf("Invalid label: %v", strconv.Quote(elem))
+		} else if err := labels.SetStringForKey(key, value); err != nil {
+			return Tuples{}, err
+		}
+	}
+	return labels, nil
+}
+
+// TextForLabels returns TXT records for labels
+func TextForLabels(labels Tuples) []string {
+	text := make([]string, 0, labels.Len())
+	for _, key := range labels.Keys() {
+		text = append(text, LABEL_TXT_PREFIX+key+"="+labels.StringForKey(key))
+	}
+	return text
+}
+
+// LabelsForText returns labels from TXT records, ignoring records which
+// are not labels
+func LabelsForText(text []string) Tuples {
+	var labels Tuples
+	for _, txt := range text {
+		if strings.HasPrefix(txt, LABEL_TXT_PREFIX) == false {
+			continue
+		} else if pos := strings.Index(txt, "="); pos < 0 {
+			continue
+		} else if key := txt[len(LABEL_TXT_PREFIX):pos]; reTupleKey.MatchString(key) {
+			labels.SetStringForKey(key, txt[pos+1:])
+		}
+	}
+	return labels
+}
+
+// IsEmpty returns true if the selector matches everything
+func (this LabelSelector) IsEmpty() bool {
+	return len(this.requirements) == 0
+}
+
+// Matches returns true if labels meet all the requirements
+func (this LabelSelector) Matches(labels Tuples) bool {
+	for _, r := range this.requirements {
+		exists := labels.ExistsForKey(r.key)
+		switch r.op {
+		case selectorEquals:
+			if exists == false || labels.StringForKey(r.key) != r.value {
+				return false
+			}
+		case selectorNotEquals:
+			if exists && labels.StringForKey(r.key) == r.value {
+				return false
+			}
+		case selectorExists:
+			if exists == false {
+				return false
+			}
+		case selectorNotExists:
+			if exists {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this LabelSelector) String() string {
+	strs := make([]string, len(this.requirements))
+	for i, r := range this.requirements {
+		switch r.op {
+		case selectorEquals:
+			strs[i] = r.key + "=" + r.value
+		case selectorNotEquals:
+			strs[i] = r.key + "!=" + r.value
+		case selectorExists:
+			strs[i] = r.key
+		case selectorNotExists:
+			strs[i] = "!" + r.key
+		}
+	}
+	return strings.Join(strs, ",")
+}
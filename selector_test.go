@@ -0,0 +1,65 @@
+package rpc_test
+
+import (
+	"testing"
+
+	// Frameworks
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+func Test_Selector_001(t *testing.T) {
+	for _, str := range []string{"", "env=prod", "env==prod,tier!=edge", "ssl", "!debug", " env = prod , ssl "} {
+		if _, err := rpc.ParseLabelSelector(str); err != nil {
+			t.Errorf("ParseLabelSelector(%v): %v", str, err)
+		}
+	}
+	for _, str := range []string{"=prod", "env=prod,", "!", "1env=prod", "env prod"} {
+		if _, err := rpc.ParseLabelSelector(str); err == nil {
+			t.Errorf("ParseLabelSelector(%v): Expected error", str)
+		}
+	}
+}
+
+func Test_Selector_002(t *testing.T) {
+	var labels rpc.Tuples
+	labels.SetStringForKey("env", "prod")
+	labels.SetStringForKey("tier", "web")
+	labels.SetStringForKey("ssl", "")
+
+	tests := map[string]bool{
+		"":                    true,
+		"env=prod":            true,
+		"env=dev":             false,
+		"env=prod,tier!=edge": true,
+		"env=prod,tier!=web":  false,
+		"ssl":                 true,
+		"!ssl":                false,
+		"!debug":              true,
+		"debug":               false,
+		"debug!=true":         true,
+	}
+	for str, expected := range tests {
+		if selector, err := rpc.ParseLabelSelector(str); err != nil {
+			t.Errorf("ParseLabelSelector(%v): %v", str, err)
+		} else if selector.Matches(labels) != expected {
+			t.Errorf("Matches(%v): Expected %v", str, expected)
+		}
+	}
+}
+
+func Test_Selector_003(t *testing.T) {
+	if labels, err := rpc.ParseLabels("zone=garage, arch=arm"); err != nil {
+		t.Error(err)
+	} else if labels.StringForKey("zone") != "garage" || labels.StringForKey("arch") != "arm" {
+		t.Error("Unexpected labels", labels)
+	} else if text := rpc.TextForLabels(labels); len(text) != 2 || text[0] != "label.zone=garage" {
+		t.Error("Unexpected text", text)
+	} else if labels_ := rpc.LabelsForText(append(text, "ssl=1", "label.=x")); labels_.Equals(labels) == false {
+		t.Error("Unexpected labels from text", labels_)
+	}
+	for _, str := range []string{"zone", "=garage", "1zone=garage"} {
+		if _, err := rpc.ParseLabels(str); err == nil {
+			t.Errorf("ParseLabels(%v): Expected error", str)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+/*
+  Go Language Raspberry Pi Interface
+  (c) Copyright David Thorpe 2019
+  All Rights Reserved
+
+  Documentation http://djthorpe.github.io/gopi/
+  For Licensing and Usage information, please see LICENSE.md
+*/
+
+package rpc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+var (
+	signals = map[string]syscall.Signal{
+		"HUP":   syscall.SIGHUP,
+		"INT":   syscall.SIGINT,
+		"QUIT":  syscall.SIGQUIT,
+		"KILL":  syscall.SIGKILL,
+		"USR1":  syscall.SIGUSR1,
+		"USR2":  syscall.SIGUSR2,
+		"PIPE":  syscall.SIGPIPE,
+		"ALRM":  syscall.SIGALRM,
+		"TERM":  syscall.SIGTERM,
+		"CHLD":  syscall.SIGCHLD,
+		"CONT":  syscall.SIGCONT,
+		"STOP":  syscall.SIGSTOP,
+		"TSTP":  syscall.SIGTSTP,
+		"TTIN":  syscall.SIGTTIN,
+		"TTOU":  syscall.SIGTTOU,
+		"WINCH": syscall.SIGWINCH,
+	}
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// SignalForName returns a signal from a name such as "HUP" or "SIGHUP"
+// or from a signal number, or an error if the signal is not recognized
+func SignalForName(name string) (syscall.Signal, error) {
+	name_ := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(name)), "SIG")
+	if signal, exists := signals[name_]; exists {
+		return signal, nil
+	} else if value, err := strconv.ParseUint(name_, 10, 32); err == nil {
+		for _, signal := range signals {
+			if uint64(signal) == value {
+				return signal, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("Invalid signal: %v", strconv.Quote(name))
+}
+
+// NameForSignal returns the name of a signal without the "SIG" prefix,
+// or the signal number if the signal is not recognized
+func NameForSignal(signal syscall.Signal) string {
+	for name, signal_ := range signals {
+		if signal == signal_ {
+			return name
+		}
+	}
+	return fmt.Sprint(int(signal))
+}
@@ -0,0 +1,37 @@
+package rpc_test
+
+import (
+	"syscall"
+	"testing"
+
+	// Frameworks
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+func Test_Signal_001(t *testing.T) {
+	for _, name := range []string{"HUP", "hup", "SIGHUP", "sighup", "1"} {
+		if signal, err := rpc.SignalForName(name); err != nil {
+			t.Errorf("SignalForName(%v): %v", name, err)
+		} else if signal != syscall.SIGHUP {
+			t.Errorf("SignalForName(%v): Expected SIGHUP, got %v", name, signal)
+		}
+	}
+}
+
+func Test_Signal_002(t *testing.T) {
+	for _, name := range []string{"", "SIG", "HUPP", "-1", "9999"} {
+		if _, err := rpc.SignalForName(name); err == nil {
+			t.Errorf("SignalForName(%v): Expected error", name)
+		}
+	}
+}
+
+func Test_Signal_003(t *testing.T) {
+	if name := rpc.NameForSignal(syscall.SIGUSR1); name != "USR1" {
+		t.Errorf("Expected USR1, got %v", name)
+	} else if signal, err := rpc.SignalForName(name); err != nil {
+		t.Error(err)
+	} else if signal != syscall.SIGUSR1 {
+		t.Errorf("Expected SIGUSR1, got %v", signal)
+	}
+}
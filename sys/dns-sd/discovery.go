@@ -302,6 +302,25 @@ func (this *discovery) ServiceInstances(service string) []gopi.RPCServiceRecord
 	return records
 }
 
+////////////////////////////////////////////////////////////////////////////////
+// METRICS
+
+// Metrics returns the number of cached records by source, and the number
+// of queries sent and answers received
+func (this *discovery) Metrics() []*rpc.MetricFamily {
+	records := rpc.NewMetricFamily("discovery_records", "Cached service records by source", rpc.METRIC_TYPE_GAUGE)
+	records.Add(float64(len(this.Config.GetServices("", rpc.DISCOVERY_TYPE_DNS))), "source", "dns")
+	records.Add(float64(len(this.Config.GetServices("", rpc.DISCOVERY_TYPE_DB))), "source", "db")
+
+	queries_, answers_ := this.Listener.Counters()
+	queries := rpc.NewMetricFamily("discovery_queries_total", "Queries sent", rpc.METRIC_TYPE_COUNTER)
+	queries.Add(float64(queries_))
+	answers := rpc.NewMetricFamily("discovery_answers_total", "Messages with answers received", rpc.METRIC_TYPE_COUNTER)
+	answers.Add(float64(answers_))
+
+	return []*rpc.MetricFamily{records, queries, answers}
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // STRINGIFY
 
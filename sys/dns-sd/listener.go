@@ -48,6 +48,11 @@ type Listener struct {
 	errors    chan<- error
 	services  chan<- rpc.ServiceRecord
 	questions chan<- Question
+
+	// Number of queries sent and messages with answers received
+	counters sync.Mutex
+	queries  uint64
+	answers  uint64
 }
 
 type Question struct {
@@ -172,6 +177,10 @@ func (this *Listener) QueryAll(msg *dns.Msg, ctx context.Context) error {
 		case <-ticker.C:
 			if err := this.multicast_send(msg, 0); err != nil {
 				return err
+			} else {
+				this.counters.Lock()
+				this.queries++
+				this.counters.Unlock()
 			}
 			if n > 0 {
 				// Restart timer to send query again
@@ -186,6 +195,14 @@ func (this *Listener) QueryAll(msg *dns.Msg, ctx context.Context) error {
 	}
 }
 
+// Counters returns the number of queries sent and the number of messages
+// with answers received
+func (this *Listener) Counters() (uint64, uint64) {
+	this.counters.Lock()
+	defer this.counters.Unlock()
+	return this.queries, this.answers
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // ANSWER
 
@@ -357,6 +374,10 @@ func (this *Listener) parse_packet(packet []byte, ifIndex int, from net.Addr) er
 	}
 	if len(msg.Answer) == 0 {
 		return nil
+	} else {
+		this.counters.Lock()
+		this.answers++
+		this.counters.Unlock()
 	}
 
 	// Make the entry
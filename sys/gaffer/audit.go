@@ -0,0 +1,298 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package gaffer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// audit appends records of calls which changed services, groups or
+// instances to a file. Records are never removed from the file
+type audit struct {
+	sync.Mutex
+
+	log  gopi.Logger
+	path string
+	seq  uint64
+	fh   *os.File
+}
+
+// AuditRecord is a call recorded in the audit log
+type AuditRecord struct {
+	Seq_      uint64     `json:"seq"`
+	Ts_       time.Time  `json:"ts"`
+	Peer_     string     `json:"peer,omitempty"`
+	Identity_ string     `json:"identity,omitempty"`
+	Method_   string     `json:"method"`
+	Params_   rpc.Tuples `json:"params"`
+	Error_    string     `json:"error,omitempty"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	// AUDIT_EXT is the extension of the audit log, which is written next
+	// to the configuration file
+	AUDIT_EXT = ".audit"
+)
+
+var (
+	// AUDIT_NAMES are the request parameters matched by the name in an
+	// audit query
+	AUDIT_NAMES = []string{"name", "service", "path"}
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// INIT / DESTROY
+
+func (this *audit) Init(path string, logger gopi.Logger) error {
+	logger.Debug("<gaffer.audit.Init>{ path=%v }", strconv.Quote(path))
+
+	this.log = logger
+	this.path = path
+
+	// Without a path, calls are not recorded
+	if this.path == "" {
+		return nil
+	}
+
+	// Continue the sequence from the last record
+	if records, err := this.read(); err != nil {
+		return err
+	} else if len(records) > 0 {
+		this.seq = records[len(records)-1].Seq_
+	}
+
+	// Open the audit log for appending
+	if fh, err := os.OpenFile(this.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600); err != nil {
+		return err
+	} else {
+		this.fh = fh
+	}
+
+	// Success
+	return nil
+}
+
+func (this *audit) Destroy() error {
+	this.log.Debug("<gaffer.audit.Destroy>{ path=%v }", strconv.Quote(this.path))
+	this.Lock()
+	defer this.Unlock()
+
+	if this.fh != nil {
+		if err := this.fh.Close(); err != nil {
+			return err
+		}
+		this.fh = nil
+	}
+
+	// Success
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// APPEND AND QUERY
+
+// Append sets the sequence number and timestamp for a record and writes
+// it to the audit log
+func (this *audit) Append(record *AuditRecord) error {
+	this.Lock()
+	defer this.Unlock()
+
+	if this.fh == nil {
+		return nil
+	}
+
+	this.seq++
+	record.Seq_, record.Ts_ = this.seq, time.Now()
+	if data, err := json.Marshal(record); err != nil {
+		return err
+	} else if _, err := this.fh.Write(append(data, '\n')); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+// Query returns the records in the audit log which match a query
+func (this *audit) Query(query rpc.GafferAuditQuery) ([]*AuditRecord, error) {
+	this.Lock()
+	defer this.Unlock()
+
+	if this.path == "" {
+		return nil, fmt.Errorf("Missing -gaffer.audit path")
+	}
+	for _, pattern := range []string{query.Method, query.Identity, query.Name} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("Invalid pattern: %v", strconv.Quote(pattern))
+		}
+	}
+
+	records, err := this.read()
+	if err != nil {
+		return nil, err
+	}
+	matched := make([]*AuditRecord, 0, len(records))
+	for _, record := range records {
+		if record.Matches(query) {
+			matched = append(matched, record)
+		}
+	}
+	if query.Limit > 0 && uint(len(matched)) > query.Limit {
+		matched = matched[uint(len(matched))-query.Limit:]
+	}
+	return matched, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// read returns the records in the audit log. Lines which cannot be decoded
+// are skipped
+func (this *audit) read() ([]*AuditRecord, error) {
+	fh, err := os.Open(this.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	records := make([]*AuditRecord, 0)
+	reader := bufio.NewReader(fh)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			record := new(AuditRecord)
+			if err := json.Unmarshal(line, record); err != nil {
+				this.log.Warn("Audit: %v: %v", this.path, err)
+			} else {
+				records = append(records, record)
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// redactParams returns request parameters where values for secret flag
+// and environment keys are redacted. Parameters for flags and environment
+// are named <param>.<key>, and a key is secret when it matches a secret
+// key pattern or is marked secret for any service or group
+func (this *config) redactParams(params rpc.Tuples) rpc.Tuples {
+	this.Lock()
+	defer this.Unlock()
+
+	params = params.Copy()
+	for _, key := range params.Keys() {
+		if i := strings.Index(key, "."); i < 0 {
+			continue
+		} else if this.isSecret(key[i+1:]) {
+			params.SetStringForKey(key, rpc.TUPLES_REDACTED)
+		}
+	}
+	return params
+}
+
+// isSecret returns true if a key matches a secret key pattern or is marked
+// secret for any service or group
+func (this *config) isSecret(key string) bool {
+	if this.matchSecret(key) {
+		return true
+	}
+	for _, service := range this.Services {
+		if stringArrayContains(service.Secrets_, key) {
+			return true
+		}
+	}
+	for _, group := range this.ServiceGroups {
+		if stringArrayContains(group.Secrets_, key) {
+			return true
+		}
+	}
+	return false
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// AUDIT RECORD
+
+// Matches returns true if the record matches a query
+func (this *AuditRecord) Matches(query rpc.GafferAuditQuery) bool {
+	if query.Start.IsZero() == false && this.Ts_.Before(query.Start) {
+		return false
+	} else if query.End.IsZero() == false && this.Ts_.Before(query.End) == false {
+		return false
+	} else if query.Method != "" && matchName(query.Method, this.Method_) == false {
+		return false
+	} else if query.Identity != "" && matchName(query.Identity, this.Identity_) == false {
+		return false
+	}
+	if query.Name != "" {
+		for _, key := range AUDIT_NAMES {
+			if matchName(query.Name, this.Params_.StringForKey(key)) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func (this *AuditRecord) Seq() uint64 {
+	return this.Seq_
+}
+
+func (this *AuditRecord) Timestamp() time.Time {
+	return this.Ts_
+}
+
+func (this *AuditRecord) Peer() string {
+	return this.Peer_
+}
+
+func (this *AuditRecord) Identity() string {
+	return this.Identity_
+}
+
+func (this *AuditRecord) Method() string {
+	return this.Method_
+}
+
+func (this *AuditRecord) Params() rpc.Tuples {
+	return this.Params_
+}
+
+func (this *AuditRecord) Error() string {
+	return this.Error_
+}
+
+func (this *AuditRecord) String() string {
+	return fmt.Sprintf("<gaffer.AuditRecord>{ seq=%v ts=%v peer=%v identity=%v method=%v params=%v error=%v }", this.Seq_, this.Ts_.Format(time.RFC3339), strconv.Quote(this.Peer_), strconv.Quote(this.Identity_), this.Method_, this.Params_, strconv.Quote(this.Error_))
+}
@@ -15,6 +15,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -44,6 +45,10 @@ type config struct {
 	root     string
 	modified bool
 
+	// Key patterns for secret keys, and the key for encrypting secrets
+	patterns []string
+	key      []byte
+
 	sync.Mutex
 	event.Tasks
 }
@@ -78,6 +83,11 @@ func (this *config) Init(config Gaffer, logger gopi.Logger) error {
 	this.Services = make([]*Service, 0)
 	this.ServiceGroups = make([]*ServiceGroup, 0)
 
+	// Set patterns for secret keys and read the key for encrypting secrets
+	if err := this.initSecrets(config.SecretPatterns, config.KeyPath); err != nil {
+		return err
+	}
+
 	// Read or create file
 	if config.Path != "" {
 		if err := this.ReadPath(config.Path); err != nil {
@@ -205,6 +215,8 @@ func (this *config) WritePath(path string, indent bool) error {
 		defer fh.Close()
 		if err := this.Writer(fh, this.Services, indent); err != nil {
 			return err
+		} else if err := this.WriteSecrets(secretsPath(path)); err != nil {
+			return err
 		} else {
 			this.modified = false
 		}
@@ -227,6 +239,12 @@ func (this *config) ReadPath_(path string) error {
 		} else {
 			this.modified = false
 		}
+		if err := this.ReadSecrets(secretsPath(path)); err != nil {
+			return err
+		} else if this.markAllSecrets() {
+			// Write back so that secret values are moved to the secrets file
+			this.modified = true
+		}
 	}
 
 	// Success
@@ -252,13 +270,14 @@ func (this *config) Reader(fh io.Reader) error {
 	return nil
 }
 
-// Writer writes an array of service records to a io.Writer object
+// Writer writes an array of service records to a io.Writer object, with
+// the values for secret keys redacted
 func (this *config) Writer(fh io.Writer, records []*Service, indent bool) error {
 	enc := json.NewEncoder(fh)
 	if indent {
 		enc.SetIndent("", "  ")
 	}
-	if err := enc.Encode(this.config_); err != nil {
+	if err := enc.Encode(this.redacted()); err != nil {
 		return err
 	}
 	// Success
@@ -348,6 +367,65 @@ func (this *config) GetGroupsByName(groups []string) []*ServiceGroup {
 	return groups_
 }
 
+// ResolveGroups returns an array of groups and the groups they include,
+// in order of precedence, or nil if any of the groups could not be found.
+// Each group is followed by the groups it includes, from left to right,
+// and groups which are included more than once are only returned once
+func (this *config) ResolveGroups(groups []string) []*ServiceGroup {
+	this.log.Debug2("<gaffer.config>ResolveGroups{ groups=%v }", groups)
+	resolved := make([]*ServiceGroup, 0, len(groups))
+	visited := make(map[string]bool)
+	var resolve func([]string) bool
+	resolve = func(groups []string) bool {
+		for _, name := range groups {
+			if visited[name] {
+				continue
+			} else if groups_ := this.GetGroupsByName([]string{name}); len(groups_) != 1 {
+				return false
+			} else {
+				visited[name] = true
+				resolved = append(resolved, groups_[0])
+				if resolve(groups_[0].Groups_) == false {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	if resolve(groups) == false {
+		return nil
+	} else {
+		return resolved
+	}
+}
+
+// IsMemberOfGroup returns true if a service is a member of a group, or of
+// a group which includes the group
+func (this *config) IsMemberOfGroup(service *Service, group string) bool {
+	for _, group_ := range this.ResolveGroups(service.Groups_) {
+		if group_.Name_ == group {
+			return true
+		}
+	}
+	return false
+}
+
+// GroupsForGroupByName returns an array of groups which include
+// a particular group, by name
+func (this *config) GroupsForGroupByName(group string) []*ServiceGroup {
+	this.log.Debug2("<gaffer.config>GroupsForGroup{ group=%v }", group)
+	groups := make([]*ServiceGroup, 0)
+	for _, group_ := range this.ServiceGroups {
+		for _, name := range group_.Groups_ {
+			if name == group {
+				groups = append(groups, group_)
+				break
+			}
+		}
+	}
+	return groups
+}
+
 func (this *config) GenerateNameFromExecutable(executable string) (string, error) {
 	this.log.Debug2("<gaffer.config>GenerateNameFromExecutable{ executable=%v }", strconv.Quote(executable))
 
@@ -367,12 +445,12 @@ func (this *config) GenerateNameFromExecutable(executable string) (string, error
 }
 
 // ServicesForGroupByName returns an array of services which contain a
-// particular group, by name
+// particular group, by name, either directly or through included groups
 func (this *config) ServicesForGroupByName(group string) []*Service {
 	this.log.Debug2("<gaffer.config>ServicesForGroup{ group=%v }", group)
 	services := make([]*Service, 0)
 	for _, service := range this.Services {
-		if service.IsMemberOfGroup(group) {
+		if this.IsMemberOfGroup(service, group) {
 			services = append(services, service)
 		}
 	}
@@ -424,7 +502,7 @@ func (this *config) RemoveGroup(group *ServiceGroup) error {
 }
 
 func (this *config) SetServiceFlags(service *Service, tuples rpc.Tuples) error {
-	this.log.Debug2("<gaffer.config>SetServiceFlags{ service=%v tuples=%v }", service, tuples)
+	this.log.Debug2("<gaffer.config>SetServiceFlags{ service=%v keys=%v }", service, tuples.Keys())
 	if service == nil {
 		return gopi.ErrBadParameter
 	}
@@ -434,12 +512,92 @@ func (this *config) SetServiceFlags(service *Service, tuples rpc.Tuples) error {
 		this.Lock()
 		defer this.Unlock()
 		service.Flags_ = tuples
+		service.Secrets_ = this.markSecrets(service.Secrets_, tuples)
+		service.Version_++
 		this.modified = true
 		return nil
 	}
 
 }
 
+func (this *config) SetServiceArgs(service *Service, style rpc.GafferFlagStyle, args []string) error {
+	this.log.Debug2("<gaffer.config>SetServiceArgs{ service=%v style=%v args=%v }", service, style, args)
+	if service == nil {
+		return gopi.ErrBadParameter
+	} else if service.FlagStyle_ == style && stringArrayEquals(service.Args_, args) {
+		return gopi.ErrNotModified
+	} else {
+		this.Lock()
+		defer this.Unlock()
+		service.FlagStyle_ = style
+		service.Args_ = append([]string{}, args...)
+		this.modified = true
+		return nil
+	}
+}
+
+func (this *config) SetServiceLabels(service *Service, labels rpc.Tuples) error {
+	this.log.Debug2("<gaffer.config>SetServiceLabels{ service=%v labels=%v }", service, labels)
+	if service == nil {
+		return gopi.ErrBadParameter
+	} else if service.Labels_.Equals(labels) {
+		return gopi.ErrNotModified
+	} else {
+		this.Lock()
+		defer this.Unlock()
+		service.Labels_ = labels
+		service.Version_++
+		this.modified = true
+		return nil
+	}
+}
+
+func (this *config) SetServiceInstanceCount(service *Service, count uint) error {
+	this.log.Debug2("<gaffer.config>SetServiceInstanceCount{ service=%v count=%v }", service, count)
+	if service == nil {
+		return gopi.ErrBadParameter
+	} else if service.InstanceCount_ == count {
+		return gopi.ErrNotModified
+	} else {
+		this.Lock()
+		defer this.Unlock()
+		service.InstanceCount_ = count
+		this.modified = true
+		return nil
+	}
+}
+
+func (this *config) SetServiceUpgradePolicy(service *Service, policy rpc.GafferUpgradePolicy) error {
+	this.log.Debug2("<gaffer.config>SetServiceUpgradePolicy{ service=%v policy=%v }", service, policy)
+	if service == nil {
+		return gopi.ErrBadParameter
+	} else if service.UpgradePolicy_ == policy {
+		return gopi.ErrNotModified
+	} else {
+		this.Lock()
+		defer this.Unlock()
+		service.UpgradePolicy_ = policy
+		this.modified = true
+		return nil
+	}
+}
+
+// SetServiceStale marks a service as running an outdated executable,
+// which is not written to the configuration file
+func (this *config) SetServiceStale(service *Service, stale bool) error {
+	this.log.Debug2("<gaffer.config>SetServiceStale{ service=%v stale=%v }", service, stale)
+	if service == nil {
+		return gopi.ErrBadParameter
+	} else if service.stale == stale {
+		return gopi.ErrNotModified
+	} else {
+		this.Lock()
+		defer this.Unlock()
+		service.stale = stale
+		return nil
+	}
+}
+
 func (this *config) SetServiceGroups(service *Service, groups []string) error {
 	this.log.Debug2("<gaffer.config>SetServiceGroups{ service=%v groups=%v }", service, groups)
 	if service == nil || groups == nil {
@@ -458,8 +616,30 @@ func (this *config) SetServiceGroups(service *Service, groups []string) error {
 	}
 }
 
+// SetGroupGroups sets the groups which a group includes, and returns
+// an error if the group would include itself
+func (this *config) SetGroupGroups(group *ServiceGroup, groups []string) error {
+	this.log.Debug2("<gaffer.config>SetGroupGroups{ group=%v groups=%v }", group, groups)
+	if group == nil || groups == nil {
+		return gopi.ErrBadParameter
+	} else if stringArrayEquals(group.Groups_, groups) == true {
+		return gopi.ErrNotModified
+	} else if cycle := this.cycleForGroup(group.Name_, groups, nil); cycle != nil {
+		return fmt.Errorf("Group cycle: @%v", strings.Join(cycle, " -> @"))
+	} else {
+		this.Lock()
+		defer this.Unlock()
+		group.Groups_ = make([]string, len(groups))
+		for i, group_ := range groups {
+			group.Groups_[i] = group_
+		}
+		this.modified = true
+		return nil
+	}
+}
+
 func (this *config) SetGroupFlags(group *ServiceGroup, tuples rpc.Tuples) error {
-	this.log.Debug2("<gaffer.config>SetGroupFlags{ group=%v tuples=%v }", group, tuples)
+	this.log.Debug2("<gaffer.config>SetGroupFlags{ group=%v keys=%v }", group, tuples.Keys())
 	if group == nil {
 		return gopi.ErrBadParameter
 	}
@@ -469,13 +649,15 @@ func (this *config) SetGroupFlags(group *ServiceGroup, tuples rpc.Tuples) error
 		this.Lock()
 		defer this.Unlock()
 		group.Flags_ = tuples
+		group.Secrets_ = this.markSecrets(group.Secrets_, tuples)
+		group.Version_++
 		this.modified = true
 		return nil
 	}
 }
 
 func (this *config) SetGroupEnv(group *ServiceGroup, tuples rpc.Tuples) error {
-	this.log.Debug2("<gaffer.config>SetGroupEnv{ group=%v tuples=%v }", group, tuples)
+	this.log.Debug2("<gaffer.config>SetGroupEnv{ group=%v keys=%v }", group, tuples.Keys())
 	if group == nil {
 		return gopi.ErrBadParameter
 	}
@@ -485,6 +667,131 @@ func (this *config) SetGroupEnv(group *ServiceGroup, tuples rpc.Tuples) error {
 		this.Lock()
 		defer this.Unlock()
 		group.Env_ = tuples
+		group.Secrets_ = this.markSecrets(group.Secrets_, tuples)
+		group.Version_++
+		this.modified = true
+		return nil
+	}
+}
+
+// SetServiceEnvPolicy sets the variables which instances of a service
+// inherit from the gaffer environment
+func (this *config) SetServiceEnvPolicy(service *Service, policy rpc.GafferEnvPolicy, allow []string) error {
+	this.log.Debug2("<gaffer.config>SetServiceEnvPolicy{ service=%v policy=%v allow=%v }", service, policy, allow)
+	if service == nil {
+		return gopi.ErrBadParameter
+	} else if service.EnvPolicy_ == policy && stringArrayEquals(service.EnvAllow_, allow) {
+		return gopi.ErrNotModified
+	} else {
+		this.Lock()
+		defer this.Unlock()
+		service.EnvPolicy_ = policy
+		service.EnvAllow_ = append([]string{}, allow...)
+		this.modified = true
+		return nil
+	}
+}
+
+// SetGroupEnvPolicy sets the variables which instances of services in
+// a group inherit from the gaffer environment
+func (this *config) SetGroupEnvPolicy(group *ServiceGroup, policy rpc.GafferEnvPolicy, allow []string) error {
+	this.log.Debug2("<gaffer.config>SetGroupEnvPolicy{ group=%v policy=%v allow=%v }", group, policy, allow)
+	if group == nil {
+		return gopi.ErrBadParameter
+	} else if group.EnvPolicy_ == policy && stringArrayEquals(group.EnvAllow_, allow) {
+		return gopi.ErrNotModified
+	} else {
+		this.Lock()
+		defer this.Unlock()
+		group.EnvPolicy_ = policy
+		group.EnvAllow_ = append([]string{}, allow...)
+		group.Version_++
+		this.modified = true
+		return nil
+	}
+}
+
+// SetGroupEnvFiles sets the env files which are read into the environment
+// for a group
+func (this *config) SetGroupEnvFiles(group *ServiceGroup, files []string) error {
+	this.log.Debug2("<gaffer.config>SetGroupEnvFiles{ group=%v files=%v }", group, files)
+	if group == nil {
+		return gopi.ErrBadParameter
+	} else if stringArrayEquals(group.EnvFiles_, files) {
+		return gopi.ErrNotModified
+	} else {
+		this.Lock()
+		defer this.Unlock()
+		group.EnvFiles_ = append([]string{}, files...)
+		group.Version_++
+		this.modified = true
+		return nil
+	}
+}
+
+// SetServiceHooks replaces the lifecycle hooks for a service
+func (this *config) SetServiceHooks(service *Service, hooks []rpc.GafferHook) error {
+	this.log.Debug2("<gaffer.config>SetServiceHooks{ service=%v hooks=%v }", service, hooks)
+	if service == nil {
+		return gopi.ErrBadParameter
+	} else if hooksEquals(service.Hooks_, hooks) {
+		return gopi.ErrNotModified
+	} else {
+		this.Lock()
+		defer this.Unlock()
+		service.Hooks_ = append([]rpc.GafferHook{}, hooks...)
+		this.modified = true
+		return nil
+	}
+}
+
+// SetGroupHooks replaces the lifecycle hooks for a group
+func (this *config) SetGroupHooks(group *ServiceGroup, hooks []rpc.GafferHook) error {
+	this.log.Debug2("<gaffer.config>SetGroupHooks{ group=%v hooks=%v }", group, hooks)
+	if group == nil {
+		return gopi.ErrBadParameter
+	} else if hooksEquals(group.Hooks_, hooks) {
+		return gopi.ErrNotModified
+	} else {
+		this.Lock()
+		defer this.Unlock()
+		group.Hooks_ = append([]rpc.GafferHook{}, hooks...)
+		this.modified = true
+		return nil
+	}
+}
+
+// SetServiceSecrets marks flags for a service as secret. Keys which match
+// a secret key pattern remain secret
+func (this *config) SetServiceSecrets(service *Service, keys []string) error {
+	this.log.Debug2("<gaffer.config>SetServiceSecrets{ service=%v keys=%v }", service, keys)
+	if service == nil {
+		return gopi.ErrBadParameter
+	} else if secrets := this.markSecrets(keys, service.Flags_); stringArrayEquals(service.Secrets_, secrets) {
+		return gopi.ErrNotModified
+	} else {
+		this.Lock()
+		defer this.Unlock()
+		service.Secrets_ = secrets
+		service.Version_++
+		this.modified = true
+		return nil
+	}
+}
+
+// SetGroupSecrets marks flags and environment for a group as secret. Keys
+// which match a secret key pattern remain secret
+func (this *config) SetGroupSecrets(group *ServiceGroup, keys []string) error {
+	this.log.Debug2("<gaffer.config>SetGroupSecrets{ group=%v keys=%v }", group, keys)
+	if group == nil {
+		return gopi.ErrBadParameter
+	} else if secrets := this.markSecrets(keys, group.Flags_, group.Env_); stringArrayEquals(group.Secrets_, secrets) {
+		return gopi.ErrNotModified
+	} else {
+		this.Lock()
+		defer this.Unlock()
+		group.Secrets_ = secrets
+		group.Version_++
 		this.modified = true
 		return nil
 	}
@@ -529,6 +836,33 @@ FOR_LOOP:
 	return nil
 }
 
+// cycleForGroup returns the chain of groups from a group back to itself
+// through included groups, or nil if there is no cycle
+func (this *config) cycleForGroup(group string, groups []string, chain []string) []string {
+	chain = append(chain, group)
+	for _, name := range groups {
+		if name == chain[0] {
+			return append(chain, name)
+		} else if groups_ := this.GetGroupsByName([]string{name}); len(groups_) != 1 {
+			continue
+		} else if stringArrayContains(chain, name) {
+			continue
+		} else if cycle := this.cycleForGroup(name, groups_[0].Groups_, chain); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+func stringArrayContains(arr []string, value string) bool {
+	for _, elem := range arr {
+		if elem == value {
+			return true
+		}
+	}
+	return false
+}
+
 func stringArrayEquals(a, b []string) bool {
 	if len(a) != len(b) {
 		return false
@@ -0,0 +1,350 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package gaffer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// crashes stores crash reports for instances which exited abnormally, and
+// removes the oldest reports when there are too many or they are too old
+type crashes struct {
+	sync.Mutex
+
+	log     gopi.Logger
+	path    string
+	count   uint
+	age     time.Duration
+	id      uint64
+	reports []*CrashReport
+}
+
+// CrashReport records the exit status, last lines of output, resolved
+// flags and environment and resource usage of an instance
+type CrashReport struct {
+	Id_         uint64        `json:"id"`
+	Service_    string        `json:"service"`
+	Instance_   uint32        `json:"instance"`
+	Ts_         time.Time     `json:"ts"`
+	ExitCode_   int64         `json:"exit_code"`
+	Signal_     string        `json:"signal,omitempty"`
+	CoreDumped_ bool          `json:"core_dumped,omitempty"`
+	Uptime_     time.Duration `json:"uptime"`
+	Stdout_     []string      `json:"stdout,omitempty"`
+	Stderr_     []string      `json:"stderr,omitempty"`
+	Flags_      rpc.Tuples    `json:"flags"`
+	Env_        rpc.Tuples    `json:"env"`
+	Args_       []string      `json:"args,omitempty"`
+	UserTime_   time.Duration `json:"user_time"`
+	SystemTime_ time.Duration `json:"system_time"`
+	MaxRSS_     int64         `json:"max_rss"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	// CRASH_FOLDER is the folder next to the configuration file for crash
+	// reports, when the crash report path is not set
+	CRASH_FOLDER = "crash"
+
+	// CRASH_EXT is the extension of crash report files
+	CRASH_EXT = ".json"
+
+	// CRASH_COUNT is the default maximum number of crash reports retained
+	CRASH_COUNT = 100
+
+	// CRASH_AGE is the default age after which crash reports are removed
+	CRASH_AGE = 7 * 24 * time.Hour
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// INIT / DESTROY
+
+func (this *crashes) Init(config Gaffer, path string, logger gopi.Logger) error {
+	logger.Debug("<gaffer.crashes.Init>{ path=%v count=%v age=%v }", strconv.Quote(path), config.CrashCount, config.CrashAge)
+
+	this.log = logger
+	this.path = path
+	if config.CrashCount == 0 {
+		this.count = CRASH_COUNT
+	} else {
+		this.count = config.CrashCount
+	}
+	if config.CrashAge == 0 {
+		this.age = CRASH_AGE
+	} else {
+		this.age = config.CrashAge
+	}
+
+	// Without a path, crash reports are retained in memory
+	if this.path == "" {
+		return nil
+	}
+
+	// Read existing reports and continue the identifiers
+	if err := os.MkdirAll(this.path, 0700); err != nil {
+		return err
+	} else if err := this.read(); err != nil {
+		return err
+	}
+	for _, report := range this.reports {
+		if report.Id_ > this.id {
+			this.id = report.Id_
+		}
+	}
+
+	// Remove old reports
+	this.expire()
+
+	// Success
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// ADD, LIST AND GET
+
+// Add sets the identifier for a crash report and stores it
+func (this *crashes) Add(report *CrashReport) error {
+	this.Lock()
+	defer this.Unlock()
+
+	this.id++
+	report.Id_ = this.id
+	this.reports = append(this.reports, report)
+	if err := this.write(report); err != nil {
+		return err
+	}
+
+	// Remove old reports
+	this.expire()
+
+	// Success
+	return nil
+}
+
+// List returns the crash reports for services which match a pattern,
+// most recent first
+func (this *crashes) List(service string) ([]*CrashReport, error) {
+	this.Lock()
+	defer this.Unlock()
+
+	if _, err := path.Match(service, ""); err != nil {
+		return nil, fmt.Errorf("Invalid pattern: %v", strconv.Quote(service))
+	}
+
+	this.expire()
+	reports := make([]*CrashReport, 0, len(this.reports))
+	for i := len(this.reports) - 1; i >= 0; i-- {
+		if service == "" || matchName(service, this.reports[i].Service_) {
+			reports = append(reports, this.reports[i])
+		}
+	}
+	return reports, nil
+}
+
+// Get returns a crash report by identifier
+func (this *crashes) Get(id uint64) *CrashReport {
+	this.Lock()
+	defer this.Unlock()
+
+	for _, report := range this.reports {
+		if report.Id_ == id {
+			return report
+		}
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// read loads the crash reports in the folder, oldest first. Files which
+// cannot be decoded are skipped
+func (this *crashes) read() error {
+	files, err := ioutil.ReadDir(this.path)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.Mode().IsRegular() == false || filepath.Ext(file.Name()) != CRASH_EXT {
+			continue
+		} else if data, err := ioutil.ReadFile(filepath.Join(this.path, file.Name())); err != nil {
+			return err
+		} else {
+			report := new(CrashReport)
+			if err := json.Unmarshal(data, report); err != nil {
+				this.log.Warn("Crash report: %v: %v", file.Name(), err)
+			} else {
+				this.reports = append(this.reports, report)
+			}
+		}
+	}
+	sort.Slice(this.reports, func(i, j int) bool {
+		return this.reports[i].Id_ < this.reports[j].Id_
+	})
+	return nil
+}
+
+// write stores a crash report in the folder
+func (this *crashes) write(report *CrashReport) error {
+	if this.path == "" {
+		return nil
+	} else if data, err := json.MarshalIndent(report, "", "  "); err != nil {
+		return err
+	} else {
+		return ioutil.WriteFile(this.filename(report), data, 0600)
+	}
+}
+
+// expire removes the oldest crash reports when there are too many, and
+// reports which are too old
+func (this *crashes) expire() {
+	for len(this.reports) > 0 {
+		report := this.reports[0]
+		if uint(len(this.reports)) <= this.count && time.Since(report.Ts_) <= this.age {
+			break
+		}
+		if this.path != "" {
+			if err := os.Remove(this.filename(report)); err != nil && os.IsNotExist(err) == false {
+				this.log.Warn("Crash report: %v", err)
+			}
+		}
+		this.reports = this.reports[1:]
+	}
+}
+
+func (this *crashes) filename(report *CrashReport) string {
+	return filepath.Join(this.path, fmt.Sprint(report.Id_)+CRASH_EXT)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CRASH REPORT
+
+// NewCrashReport returns a crash report for an instance which has exited,
+// with secret values redacted
+func NewCrashReport(instance *ServiceInstance) *CrashReport {
+	this := &CrashReport{
+		Service_:  instance.Service_.Name_,
+		Instance_: instance.Id_,
+		Ts_:       instance.Stop_,
+		Flags_:    instance.Flags(),
+		Env_:      instance.Env(),
+		Args_:     instance.Args(),
+	}
+	if this.Ts_.IsZero() {
+		this.Ts_ = time.Now()
+	}
+	if instance.Start_.IsZero() == false {
+		this.Uptime_ = this.Ts_.Sub(instance.Start_)
+	}
+	if process := instance.process; process != nil {
+		this.ExitCode_ = process.ExitCode()
+		this.Stdout_, this.Stderr_ = process.Stdout(), process.Stderr()
+		status, rusage := process.WaitStatus()
+		if status.Signaled() {
+			this.Signal_ = rpc.NameForSignal(status.Signal())
+			this.CoreDumped_ = status.CoreDump()
+		}
+		if rusage != nil {
+			this.UserTime_ = time.Duration(rusage.Utime.Nano())
+			this.SystemTime_ = time.Duration(rusage.Stime.Nano())
+			this.MaxRSS_ = int64(rusage.Maxrss)
+		}
+	}
+	return this
+}
+
+func (this *CrashReport) Id() uint64 {
+	return this.Id_
+}
+
+func (this *CrashReport) Service() string {
+	return this.Service_
+}
+
+func (this *CrashReport) Instance() uint32 {
+	return this.Instance_
+}
+
+func (this *CrashReport) Timestamp() time.Time {
+	return this.Ts_
+}
+
+func (this *CrashReport) ExitCode() int64 {
+	return this.ExitCode_
+}
+
+func (this *CrashReport) Signal() string {
+	return this.Signal_
+}
+
+func (this *CrashReport) CoreDumped() bool {
+	return this.CoreDumped_
+}
+
+func (this *CrashReport) Uptime() time.Duration {
+	return this.Uptime_
+}
+
+func (this *CrashReport) Stdout() []string {
+	return this.Stdout_
+}
+
+func (this *CrashReport) Stderr() []string {
+	return this.Stderr_
+}
+
+func (this *CrashReport) Flags() rpc.Tuples {
+	return this.Flags_
+}
+
+func (this *CrashReport) Env() rpc.Tuples {
+	return this.Env_
+}
+
+func (this *CrashReport) Args() []string {
+	return this.Args_
+}
+
+func (this *CrashReport) UserTime() time.Duration {
+	return this.UserTime_
+}
+
+func (this *CrashReport) SystemTime() time.Duration {
+	return this.SystemTime_
+}
+
+func (this *CrashReport) MaxRSS() int64 {
+	return this.MaxRSS_
+}
+
+func (this *CrashReport) String() string {
+	status := fmt.Sprintf("exit_code=%v", this.ExitCode_)
+	if this.Signal_ != "" {
+		status = fmt.Sprintf("signal=%v core_dumped=%v", this.Signal_, this.CoreDumped_)
+	}
+	return fmt.Sprintf("<gaffer.CrashReport>{ id=%v service=%v instance=%v %v uptime=%v }", this.Id_, strconv.Quote(this.Service_), this.Instance_, status, this.Uptime_)
+}
@@ -0,0 +1,280 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package gaffer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	// Frameworks
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// dirs creates persistent data directories for services and ephemeral
+// run directories for instances
+type dirs struct {
+	data, run string
+	mode      os.FileMode
+	uid, gid  int
+}
+
+// ServiceData is the data directory for a service, with the number and
+// total size of the files in the directory
+type ServiceData struct {
+	Service_ string    `json:"service"`
+	Path_    string    `json:"path"`
+	Size_    int64     `json:"size"`
+	Files_   uint      `json:"files"`
+	ModTime_ time.Time `json:"mod_time"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	// DIR_MODE is the default permissions for data and run directories
+	DIR_MODE = os.FileMode(0750)
+
+	// DATA_FOLDER is the folder next to the configuration file for data
+	// directories, when the data root is not set
+	DATA_FOLDER = "data"
+
+	// RUN_FOLDER is the folder in the temporary directory for run
+	// directories, when the run root is not set
+	RUN_FOLDER = "gaffer"
+
+	// Variables which are expanded to the data directory for the service
+	// and the run directory for the instance
+	VAR_DATADIR = "service.datadir"
+	VAR_RUNDIR  = "instance.rundir"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// INIT
+
+func (this *dirs) Init(config Gaffer) error {
+	this.data = config.DataRoot
+	this.run = config.RunRoot
+	if this.run == "" {
+		this.run = filepath.Join(os.TempDir(), RUN_FOLDER)
+	}
+	if config.DirMode == 0 {
+		this.mode = DIR_MODE
+	} else {
+		this.mode = config.DirMode & os.ModePerm
+	}
+	if uid, gid, err := ownerForName(config.DirOwner); err != nil {
+		return err
+	} else {
+		this.uid, this.gid = uid, gid
+	}
+
+	// Success
+	return nil
+}
+
+// ownerForName returns the user and group identifiers for a name in the form
+// <user>, <user>:<group> or :<group>, where users and groups are names or
+// numeric identifiers. Returns -1 for the user or group when not set
+func ownerForName(name string) (int, int, error) {
+	uid, gid := -1, -1
+	if name == "" {
+		return uid, gid, nil
+	}
+	user_group := strings.SplitN(name, ":", 2)
+	if user_group[0] != "" {
+		if id, err := strconv.ParseUint(user_group[0], 10, 32); err == nil {
+			uid = int(id)
+		} else if user_, err := user.Lookup(user_group[0]); err != nil {
+			return uid, gid, err
+		} else if id, err := strconv.Atoi(user_.Uid); err != nil {
+			return uid, gid, err
+		} else {
+			uid = id
+		}
+	}
+	if len(user_group) == 2 && user_group[1] != "" {
+		if id, err := strconv.ParseUint(user_group[1], 10, 32); err == nil {
+			gid = int(id)
+		} else if group_, err := user.LookupGroup(user_group[1]); err != nil {
+			return uid, gid, err
+		} else if id, err := strconv.Atoi(group_.Gid); err != nil {
+			return uid, gid, err
+		} else {
+			gid = id
+		}
+	}
+	return uid, gid, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// DIRECTORIES
+
+// DataDir returns the data directory for a service, or an empty string if
+// there is no data root
+func (this *dirs) DataDir(service *Service) string {
+	if this.data == "" {
+		return ""
+	} else {
+		return filepath.Join(this.data, service.Name_)
+	}
+}
+
+// RunDir returns the run directory for an instance
+func (this *dirs) RunDir(service *Service, id uint32) string {
+	return filepath.Join(this.run, service.Name_, fmt.Sprint(id))
+}
+
+// Create makes the data directory for a service if it doesn't exist and
+// the run directory for an instance, and returns the paths
+func (this *dirs) Create(service *Service, id uint32) (string, string, error) {
+	datadir, rundir := this.DataDir(service), this.RunDir(service, id)
+	if datadir != "" {
+		if err := this.mkdir(datadir); err != nil {
+			return "", "", err
+		}
+	}
+	if err := this.mkdir(rundir); err != nil {
+		return "", "", err
+	}
+	return datadir, rundir, nil
+}
+
+// Remove deletes a run directory and its contents
+func (this *dirs) Remove(rundir string) error {
+	if rundir == "" {
+		return nil
+	} else if err := os.RemoveAll(rundir); err != nil {
+		return err
+	} else {
+		// Remove the directory for the service when empty
+		os.Remove(filepath.Dir(rundir))
+		return nil
+	}
+}
+
+// mkdir creates a directory with the permissions and ownership set
+func (this *dirs) mkdir(path string) error {
+	if err := os.MkdirAll(path, this.mode); err != nil {
+		return err
+	} else if err := os.Chmod(path, this.mode); err != nil {
+		return err
+	} else if this.uid >= 0 || this.gid >= 0 {
+		return os.Chown(path, this.uid, this.gid)
+	} else {
+		return nil
+	}
+}
+
+// Expander returns a function which expands the data directory for a
+// service and the run directory for an instance, or else calls expander
+func (this *dirs) Expander(datadir, rundir string, expander func(string) string) func(string) string {
+	return func(key string) string {
+		if key == VAR_DATADIR && datadir != "" {
+			return datadir
+		} else if key == VAR_RUNDIR && rundir != "" {
+			return rundir
+		} else {
+			return expander(key)
+		}
+	}
+}
+
+// replaceDir replaces a directory with a new directory in the values
+// of tuples and in arguments
+func replaceDir(dir, new string, args []string, tuples ...*rpc.Tuples) {
+	for i, arg := range args {
+		args[i] = strings.Replace(arg, dir, new, -1)
+	}
+	for _, tuples := range tuples {
+		for _, key := range tuples.Keys() {
+			values := tuples.StringsForKey(key)
+			for i, value := range values {
+				values[i] = strings.Replace(value, dir, new, -1)
+			}
+			tuples.SetStringsForKey(key, values)
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// SERVICE DATA
+
+// NewServiceData returns the number of files, total size and most recent
+// modification time for the data directory of a service
+func NewServiceData(service *Service, path string) (*ServiceData, error) {
+	this := &ServiceData{Service_: service.Name_, Path_: path}
+	if err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if info.ModTime().After(this.ModTime_) {
+			this.ModTime_ = info.ModTime()
+		}
+		if info.Mode().IsRegular() {
+			this.Files_ += 1
+			this.Size_ += info.Size()
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return this, nil
+}
+
+// wipeDir removes the contents of a directory, but not the directory itself
+func wipeDir(path string) error {
+	if files, err := ioutil.ReadDir(path); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	} else {
+		for _, file := range files {
+			if err := os.RemoveAll(filepath.Join(path, file.Name())); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func (this *ServiceData) Service() string {
+	return this.Service_
+}
+
+func (this *ServiceData) Path() string {
+	return this.Path_
+}
+
+func (this *ServiceData) Size() int64 {
+	return this.Size_
+}
+
+func (this *ServiceData) Files() uint {
+	return this.Files_
+}
+
+func (this *ServiceData) ModTime() time.Time {
+	return this.ModTime_
+}
+
+func (this *ServiceData) String() string {
+	return fmt.Sprintf("<gaffer.ServiceData>{ service=%v path=%v files=%v size=%v }", strconv.Quote(this.Service_), strconv.Quote(this.Path_), this.Files_, this.Size_)
+}
@@ -0,0 +1,160 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package gaffer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	// Frameworks
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+var (
+	// ENV_ALLOW_DEFAULT are the variables inherited with the allow
+	// policy when no variables are listed
+	ENV_ALLOW_DEFAULT = []string{"PATH", "HOME", "USER", "LANG", "LC_*", "TZ", "TMPDIR"}
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// ENV FILES
+
+// ReadEnvFile returns the environment from a file in the .env format
+func ReadEnvFile(path string) (rpc.Tuples, error) {
+	if fh, err := os.Open(path); err != nil {
+		return rpc.Tuples{}, err
+	} else {
+		defer fh.Close()
+		if env, err := ReadEnv(fh); err != nil {
+			return rpc.Tuples{}, fmt.Errorf("%v: %v", path, err)
+		} else {
+			return env, nil
+		}
+	}
+}
+
+// ReadEnv returns the environment from lines of key=value. Blank lines and
+// lines starting with '#' are ignored, and keys can be preceded by "export".
+// Values in double quotes are unquoted, and the quotes are removed from
+// values in single quotes without unescaping
+func ReadEnv(r io.Reader) (rpc.Tuples, error) {
+	var env rpc.Tuples
+	env.RemoveAll()
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		text = strings.TrimSpace(strings.TrimPrefix(text, "export "))
+		key_value := strings.SplitN(text, "=", 2)
+		if len(key_value) != 2 {
+			return env, fmt.Errorf("Line %v: Expected key=value", line)
+		}
+		key, value := strings.TrimSpace(key_value[0]), strings.TrimSpace(key_value[1])
+		if strings.HasPrefix(value, "\"") {
+			if value_, err := strconv.Unquote(value); err != nil {
+				return env, fmt.Errorf("Line %v: Invalid value for %v", line, key)
+			} else {
+				value = value_
+			}
+		} else if len(value) >= 2 && strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") {
+			value = value[1 : len(value)-1]
+		}
+		if err := env.SetStringForKey(key, value); err != nil {
+			return env, fmt.Errorf("Line %v: %v", line, err)
+		}
+	}
+	return env, scanner.Err()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// HOST ENVIRONMENT
+
+// EnvPolicyForService returns the policy for inheriting the gaffer
+// environment and the allowed variables. The policy for the service is
+// used, or else the first group which sets a policy, or else the clean policy
+func EnvPolicyForService(service *Service, groups []*ServiceGroup) (rpc.GafferEnvPolicy, []string) {
+	if service.EnvPolicy_ != rpc.GAFFER_ENV_DEFAULT {
+		return service.EnvPolicy_, service.EnvAllow_
+	}
+	for _, group := range groups {
+		if group.EnvPolicy_ != rpc.GAFFER_ENV_DEFAULT {
+			return group.EnvPolicy_, group.EnvAllow_
+		}
+	}
+	return rpc.GAFFER_ENV_CLEAN, nil
+}
+
+// hostEnv returns the variables inherited from the gaffer environment for
+// a policy. Variables which are not valid keys are not inherited
+func hostEnv(policy rpc.GafferEnvPolicy, allow []string) rpc.Tuples {
+	var env rpc.Tuples
+	env.RemoveAll()
+	if policy == rpc.GAFFER_ENV_ALLOW && len(allow) == 0 {
+		allow = ENV_ALLOW_DEFAULT
+	}
+	for _, variable := range os.Environ() {
+		key_value := strings.SplitN(variable, "=", 2)
+		if len(key_value) != 2 {
+			continue
+		} else if policy == rpc.GAFFER_ENV_INHERIT || (policy == rpc.GAFFER_ENV_ALLOW && matchEnvAllow(allow, key_value[0])) {
+			env.SetStringForKey(key_value[0], key_value[1])
+		}
+	}
+	return env
+}
+
+// matchEnvAllow returns true if a variable name matches an allowed
+// name or pattern
+func matchEnvAllow(allow []string, key string) bool {
+	for _, pattern := range allow {
+		if match, _ := filepath.Match(pattern, key); match {
+			return true
+		}
+	}
+	return false
+}
+
+// checkEnvPolicy returns an error if the allowed variables are set for a
+// policy other than allow, or a pattern is invalid
+func checkEnvPolicy(policy rpc.GafferEnvPolicy, allow []string) error {
+	if policy > rpc.GAFFER_ENV_ALLOW {
+		return fmt.Errorf("Invalid policy: %v", policy)
+	} else if policy != rpc.GAFFER_ENV_ALLOW && len(allow) > 0 {
+		return fmt.Errorf("Allowed variables require the allow policy")
+	}
+	for _, pattern := range allow {
+		if _, err := filepath.Match(pattern, ""); err != nil || pattern == "" {
+			return fmt.Errorf("Invalid variable pattern: %v", strconv.Quote(pattern))
+		}
+	}
+	return nil
+}
+
+// checkEnvFiles returns an error if a path is not absolute or the file
+// cannot be read
+func checkEnvFiles(files []string) error {
+	for _, path := range files {
+		if filepath.IsAbs(path) == false {
+			return fmt.Errorf("Env file path is not absolute: %v", strconv.Quote(path))
+		} else if _, err := ReadEnvFile(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
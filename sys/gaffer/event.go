@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	// Frameworks
 	gopi "github.com/djthorpe/gopi"
@@ -28,6 +29,11 @@ type Event struct {
 	Group_    rpc.GafferServiceGroup
 	Instance_ rpc.GafferServiceInstance
 	Data_     []byte
+
+	// Sequence number and timestamp, which are set when the event is
+	// emitted
+	Seq_ uint64
+	Ts_  time.Time
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -41,6 +47,12 @@ func NewEventWithService(source gopi.Driver, type_ rpc.GafferEventType, service
 	return this
 }
 
+func NewEventWithServiceData(source gopi.Driver, type_ rpc.GafferEventType, service rpc.GafferService, data []byte) *Event {
+	this := NewEventWithService(source, type_, service)
+	this.Data_ = data
+	return this
+}
+
 func NewEventWithGroup(source gopi.Driver, type_ rpc.GafferEventType, group rpc.GafferServiceGroup) *Event {
 	this := new(Event)
 	this.Source_ = source
@@ -88,19 +100,37 @@ func (this *Event) Service() rpc.GafferService {
 }
 
 func (this *Event) Group() rpc.GafferServiceGroup {
-	return this.Group_
+	if this.Group_ == nil {
+		return nil
+	} else {
+		return this.Group_
+	}
 }
 
 func (this *Event) Instance() rpc.GafferServiceInstance {
-	return this.Instance_
+	if this.Instance_ == nil {
+		return nil
+	} else {
+		return this.Instance_
+	}
 }
 
 func (this *Event) Data() []byte {
 	return this.Data_
 }
 
+func (this *Event) Seq() uint64 {
+	return this.Seq_
+}
+
+func (this *Event) Timestamp() time.Time {
+	return this.Ts_
+}
+
 func (this *Event) String() string {
-	if this.Service_ != nil {
+	if this.Service_ != nil && this.Data_ != nil {
+		return fmt.Sprintf("<%v>{ %v %v %v }", this.Name(), this.Type_, this.Service_, strconv.Quote(string(this.Data_)))
+	} else if this.Service_ != nil {
 		return fmt.Sprintf("<%v>{ %v %v }", this.Name(), this.Type_, this.Service_)
 	} else if this.Group_ != nil {
 		return fmt.Sprintf("<%v>{ %v %v }", this.Name(), this.Type_, this.Group_)
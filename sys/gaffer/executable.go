@@ -0,0 +1,268 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package gaffer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Executable records the file an instance was started from
+type Executable struct {
+	// Path is the absolute path to the executable, or the path relative
+	// to the binary root when listing executables
+	Path_ string `json:"path"`
+
+	// Size of the executable in bytes
+	Size_ int64 `json:"size"`
+
+	// ModTime is the modification time of the executable
+	ModTime_ time.Time `json:"mtime"`
+
+	// Checksum is the hex-encoded SHA-256 of the executable
+	Checksum_ string `json:"sha256"`
+
+	// Arch is the architecture of an ELF binary, or empty otherwise
+	Arch_ string `json:"arch,omitempty"`
+
+	// Gopi is true if the executable was built with the gopi framework
+	Gopi_ bool `json:"gopi,omitempty"`
+
+	// Services which reference the executable, when listing executables
+	Services_ []string `json:"services,omitempty"`
+
+	// Flags accepted by the executable, or nil if not yet read
+	flags []*Flag
+}
+
+// Executables caches executable checksums, which are only re-computed
+// when the size or modification time of a file changes
+type Executables struct {
+	sync.Mutex
+	executables map[string]*Executable
+}
+
+// markerWriter detects a marker in data written to it
+type markerWriter struct {
+	marker []byte
+	tail   []byte
+	found  bool
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	// GOPI_MARKER is contained in executables built with the gopi framework
+	GOPI_MARKER = "github.com/djthorpe/gopi."
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// EXECUTABLE IMPLEMENTATION
+
+func NewExecutable(path string) (*Executable, error) {
+	if path == "" {
+		return nil, gopi.ErrBadParameter
+	} else if stat, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if stat.Mode().IsRegular() == false {
+		return nil, fmt.Errorf("Not a regular file: %v", path)
+	} else if checksum, gopi, err := scanPath(path); err != nil {
+		return nil, err
+	} else {
+		this := new(Executable)
+		this.Path_ = path
+		this.Size_ = stat.Size()
+		this.ModTime_ = stat.ModTime()
+		this.Checksum_ = checksum
+		this.Arch_ = archForPath(path)
+		this.Gopi_ = gopi
+		return this, nil
+	}
+}
+
+// CopyExecutable returns a copy of an executable with a path relative to
+// the binary root and the services which reference it
+func CopyExecutable(executable *Executable, path string, services []string) *Executable {
+	this := new(Executable)
+	*this = *executable
+	this.Path_ = path
+	this.Services_ = services
+	return this
+}
+
+func (this *Executable) Path() string {
+	return this.Path_
+}
+
+func (this *Executable) Size() int64 {
+	return this.Size_
+}
+
+func (this *Executable) ModTime() time.Time {
+	return this.ModTime_
+}
+
+func (this *Executable) Checksum() string {
+	return this.Checksum_
+}
+
+func (this *Executable) Arch() string {
+	return this.Arch_
+}
+
+func (this *Executable) IsGopi() bool {
+	return this.Gopi_
+}
+
+func (this *Executable) Services() []string {
+	return this.Services_
+}
+
+// Equals returns true if two executables have the same contents
+func (this *Executable) Equals(other *Executable) bool {
+	if this == nil || other == nil {
+		return this == other
+	} else {
+		return this.Size_ == other.Size_ && this.Checksum_ == other.Checksum_
+	}
+}
+
+func (this *Executable) String() string {
+	return fmt.Sprintf("<gaffer.Executable>{ path=%v size=%v mtime=%v sha256=%v arch=%v gopi=%v services=%v }", strconv.Quote(this.Path_), this.Size_, this.ModTime_.Format(time.RFC3339), this.Checksum_, strconv.Quote(this.Arch_), this.Gopi_, this.Services_)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// EXECUTABLES IMPLEMENTATION
+
+// Get returns the executable at a path, re-using the cached checksum if the
+// file size and modification time have not changed
+func (this *Executables) Get(path string) (*Executable, error) {
+	this.Lock()
+	defer this.Unlock()
+
+	if this.executables == nil {
+		this.executables = make(map[string]*Executable)
+	}
+	if stat, err := os.Stat(path); err != nil {
+		delete(this.executables, path)
+		return nil, err
+	} else if executable, exists := this.executables[path]; exists && executable.Size_ == stat.Size() && executable.ModTime_.Equal(stat.ModTime()) {
+		return executable, nil
+	} else if executable, err := NewExecutable(path); err != nil {
+		delete(this.executables, path)
+		return nil, err
+	} else {
+		this.executables[path] = executable
+		return executable, nil
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// ELF BINARIES
+
+// isElfForHost returns an error if the file at path is not an ELF binary
+// for the host architecture
+func isElfForHost(path string) error {
+	if arch := archForPath(path); arch == "" {
+		return fmt.Errorf("Not an ELF binary")
+	} else if arch != runtime.GOARCH {
+		return fmt.Errorf("Invalid architecture %v (expected %v)", arch, runtime.GOARCH)
+	}
+
+	// Success
+	return nil
+}
+
+// archForPath returns the architecture of an ELF binary using GOARCH
+// names where possible, or an empty string if the file is not an ELF binary
+func archForPath(path string) string {
+	fh, err := elf.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer fh.Close()
+	switch fh.Machine {
+	case elf.EM_386:
+		return "386"
+	case elf.EM_X86_64:
+		return "amd64"
+	case elf.EM_ARM:
+		return "arm"
+	case elf.EM_AARCH64:
+		return "arm64"
+	case elf.EM_MIPS:
+		if fh.ByteOrder == binary.LittleEndian {
+			return "mipsle"
+		} else {
+			return "mips"
+		}
+	case elf.EM_PPC64:
+		if fh.ByteOrder == binary.LittleEndian {
+			return "ppc64le"
+		} else {
+			return "ppc64"
+		}
+	case elf.EM_S390:
+		return "s390x"
+	default:
+		return fh.Machine.String()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// scanPath returns the SHA-256 checksum of a file and whether it
+// was built with the gopi framework
+func scanPath(path string) (string, bool, error) {
+	if fh, err := os.Open(path); err != nil {
+		return "", false, err
+	} else {
+		defer fh.Close()
+		hash := sha256.New()
+		marker := &markerWriter{marker: []byte(GOPI_MARKER)}
+		if _, err := io.Copy(io.MultiWriter(hash, marker), fh); err != nil {
+			return "", false, err
+		} else {
+			return hex.EncodeToString(hash.Sum(nil)), marker.found, nil
+		}
+	}
+}
+
+func (this *markerWriter) Write(data []byte) (int, error) {
+	if this.found == false {
+		buf := append(this.tail, data...)
+		if bytes.Contains(buf, this.marker) {
+			this.found = true
+			this.tail = nil
+		} else if len(buf) >= len(this.marker) {
+			this.tail = append([]byte{}, buf[len(buf)-len(this.marker)+1:]...)
+		} else {
+			this.tail = buf
+		}
+	}
+	return len(data), nil
+}
@@ -0,0 +1,95 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package gaffer_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	// Frameworks
+	gaffer "github.com/djthorpe/gopi-rpc/sys/gaffer"
+)
+
+func Test_Executable_001(t *testing.T) {
+	if _, err := gaffer.NewExecutable(""); err == nil {
+		t.Error("Expected error for empty path")
+	} else if _, err := gaffer.NewExecutable("/nonexistent/path"); err == nil {
+		t.Error("Expected error for missing path")
+	}
+}
+
+func Test_Executable_002(t *testing.T) {
+	fh, err := ioutil.TempFile("", "executable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fh.Name())
+	fh.WriteString("hello, world")
+	fh.Close()
+
+	// SHA-256 of "hello, world"
+	if executable, err := gaffer.NewExecutable(fh.Name()); err != nil {
+		t.Error(err)
+	} else if executable.Size() != 12 {
+		t.Error("Unexpected size", executable.Size())
+	} else if executable.Checksum() != "09ca7e4eaa6e8ae9c7d261167129184883644d07dfba7cbfbc4c8a2e08360d5b" {
+		t.Error("Unexpected checksum", executable.Checksum())
+	}
+}
+
+func Test_Executable_003(t *testing.T) {
+	fh, err := ioutil.TempFile("", "executable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fh.Name())
+	fh.WriteString("version 1")
+	fh.Close()
+
+	executables := new(gaffer.Executables)
+	if a, err := executables.Get(fh.Name()); err != nil {
+		t.Error(err)
+	} else if b, err := executables.Get(fh.Name()); err != nil {
+		t.Error(err)
+	} else if a != b {
+		t.Error("Expected cached executable")
+	} else if err := ioutil.WriteFile(fh.Name(), []byte("version 2"), 0644); err != nil {
+		t.Error(err)
+	} else if err := os.Chtimes(fh.Name(), time.Now(), a.ModTime().Add(time.Second)); err != nil {
+		t.Error(err)
+	} else if c, err := executables.Get(fh.Name()); err != nil {
+		t.Error(err)
+	} else if c.Equals(a) {
+		t.Error("Expected executable to have changed")
+	}
+}
+
+func Test_Executable_004(t *testing.T) {
+	fh, err := ioutil.TempFile("", "executable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fh.Name())
+
+	// Write the gopi marker across a read buffer boundary
+	fh.Write(bytes.Repeat([]byte{0}, 32*1024-5))
+	fh.WriteString(gaffer.GOPI_MARKER)
+	fh.Close()
+
+	if executable, err := gaffer.NewExecutable(fh.Name()); err != nil {
+		t.Error(err)
+	} else if executable.IsGopi() == false {
+		t.Error("Expected gopi executable")
+	} else if executable.Arch() != "" {
+		t.Error("Expected empty arch for non-ELF file")
+	}
+}
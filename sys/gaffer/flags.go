@@ -0,0 +1,302 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package gaffer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	// Frameworks
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Flag is a command-line flag accepted by an executable
+type Flag struct {
+	Name_    string `json:"name"`
+	Type_    string `json:"type"`
+	Default_ string `json:"default,omitempty"`
+	Usage_   string `json:"usage,omitempty"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	// FLAGS_TIMEOUT is the time allowed for an executable to print usage
+	FLAGS_TIMEOUT = 2 * time.Second
+)
+
+var (
+	// Usage is printed by the flag package as "  -name type" followed
+	// by indented lines of usage text, which can end with the default value.
+	// Single character bool flags have usage on the same line
+	reFlagLine    = regexp.MustCompile("^  -([^\\s=]+)(?: ([^\\s]+))?(?:\t(.*))?$")
+	reFlagUsage   = regexp.MustCompile("^    \t(.*)$")
+	reFlagDefault = regexp.MustCompile("(?s)^(.*) \\(default (.*)\\)$")
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// FLAG IMPLEMENTATION
+
+func (this *Flag) Name() string {
+	return this.Name_
+}
+
+func (this *Flag) Type() string {
+	return this.Type_
+}
+
+func (this *Flag) Default() string {
+	return this.Default_
+}
+
+func (this *Flag) Usage() string {
+	return this.Usage_
+}
+
+// Check returns an error if a value cannot be parsed for the flag type.
+// An empty value sets a bool flag, and values which are expanded when
+// an instance is started are not checked
+func (this *Flag) Check(value string) error {
+	if strings.Contains(value, "${") {
+		return nil
+	} else if value == "" {
+		if this.Type_ != "bool" {
+			return fmt.Errorf("Flag -%v requires a %v value", this.Name_, this.Type_)
+		} else {
+			return nil
+		}
+	}
+	var err error
+	switch this.Type_ {
+	case "bool":
+		_, err = strconv.ParseBool(value)
+	case "int", "int64":
+		_, err = strconv.ParseInt(value, 0, 64)
+	case "uint", "uint64":
+		_, err = strconv.ParseUint(value, 0, 64)
+	case "float":
+		_, err = strconv.ParseFloat(value, 64)
+	case "duration":
+		_, err = time.ParseDuration(value)
+	}
+	if err != nil {
+		return fmt.Errorf("Flag -%v requires a %v value: %v", this.Name_, this.Type_, strconv.Quote(value))
+	} else {
+		return nil
+	}
+}
+
+func (this *Flag) String() string {
+	return fmt.Sprintf("<gaffer.Flag>{ name=%v type=%v default=%v usage=%v }", strconv.Quote(this.Name_), this.Type_, strconv.Quote(this.Default_), strconv.Quote(this.Usage_))
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// EXECUTABLES IMPLEMENTATION
+
+// Flags returns the flags accepted by a gopi executable, which are read by
+// running the executable with the -help flag. The flags are cached until
+// the executable changes
+func (this *Executables) Flags(path string) ([]*Flag, error) {
+	executable, err := this.Get(path)
+	if err != nil {
+		return nil, err
+	} else if executable.Gopi_ == false {
+		return nil, fmt.Errorf("Not a gopi executable: %v", path)
+	}
+
+	this.Lock()
+	flags := executable.flags
+	this.Unlock()
+	if flags != nil {
+		return flags, nil
+	}
+
+	// Introspect without holding the lock
+	if flags, err := flagsForPath(path); err != nil {
+		return nil, err
+	} else {
+		this.Lock()
+		executable.flags = flags
+		this.Unlock()
+		return flags, nil
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CHECK TUPLES
+
+// checkServiceFlags returns an error if tuples contain keys which are not
+// flags of the executable for a service, or values which do not match the
+// flag types. Tuples are not checked when the flags cannot be read
+func (this *gaffer) checkServiceFlags(service *Service, tuples rpc.Tuples) error {
+	if flags := this.flagsForService(service); flags == nil {
+		return nil
+	} else if unknown, err := checkFlags(flags, tuples); err != nil {
+		return err
+	} else if len(unknown) > 0 {
+		return fmt.Errorf("Unknown flags for %v: -%v", strconv.Quote(service.Name_), strings.Join(unknown, " -"))
+	} else {
+		return nil
+	}
+}
+
+// checkGroupFlags returns an error if tuples contain values which do not
+// match the flag types for the services in a group. Keys which are not
+// flags of any service in the group are logged as a warning, since group
+// flags are only used by the services which accept them
+func (this *gaffer) checkGroupFlags(group *ServiceGroup, tuples rpc.Tuples) error {
+	known := make(map[string]bool)
+	checked := false
+	for _, service := range this.config.ServicesForGroupByName(group.Name_) {
+		if flags := this.flagsForService(service); flags == nil {
+			continue
+		} else if _, err := checkFlags(flags, tuples); err != nil {
+			return fmt.Errorf("%v: %v", service.Name_, err)
+		} else {
+			checked = true
+			for _, key := range tuples.Keys() {
+				if flagForName(flags, key) != nil {
+					known[key] = true
+				}
+			}
+		}
+	}
+	if checked {
+		for _, key := range tuples.Keys() {
+			if known[key] == false {
+				this.log.Warn("SetGroupFlags: Flag -%v is not used by any service in group @%v", key, group.Name_)
+			}
+		}
+	}
+
+	// Success
+	return nil
+}
+
+// flagsForService returns the flags of the executable for a service, or nil
+// if the flags cannot be read
+func (this *gaffer) flagsForService(service *Service) []*Flag {
+	if root, err := this.config.Root(); err != nil {
+		return nil
+	} else if flags, err := this.Instances.GetFlagsForPath(filepath.Join(root, service.Path_)); err != nil {
+		this.log.Debug("%v: %v", service.Name_, err)
+		return nil
+	} else {
+		return flags
+	}
+}
+
+// checkFlags returns the keys which are not flags of the executable, and an
+// error for the first value which does not match the type of the flag
+func checkFlags(flags []*Flag, tuples rpc.Tuples) ([]string, error) {
+	unknown := make([]string, 0)
+	for _, key := range tuples.Keys() {
+		flag := flagForName(flags, key)
+		if flag == nil {
+			unknown = append(unknown, key)
+			continue
+		}
+		for _, value := range tuples.StringsForKey(key) {
+			if err := flag.Check(value); err != nil {
+				return unknown, err
+			}
+		}
+	}
+	return unknown, nil
+}
+
+func flagForName(flags []*Flag, name string) *Flag {
+	for _, flag := range flags {
+		if flag.Name_ == name {
+			return flag
+		}
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// flagsForPath runs an executable with the -help flag and parses the output
+func flagsForPath(path string) ([]*Flag, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), FLAGS_TIMEOUT)
+	defer cancel()
+
+	// The flag package exits with an error after printing usage, so
+	// the exit status is ignored unless no flags were printed
+	cmd := exec.CommandContext(ctx, path, "-help")
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("Timeout reading flags for %v", path)
+	} else if flags := ParseFlags(bytes.NewReader(output)); len(flags) > 0 {
+		return flags, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Unable to read flags for %v: %v", path, err)
+	} else {
+		return flags, nil
+	}
+}
+
+// ParseFlags parses the output of flag.PrintDefaults and returns
+// the flags sorted by name. Lines which are not part of a flag
+// description are ignored
+func ParseFlags(r io.Reader) []*Flag {
+	flags := make([]*Flag, 0)
+	scanner := bufio.NewScanner(r)
+	var flag *Flag
+	for scanner.Scan() {
+		line := scanner.Text()
+		if match := reFlagLine.FindStringSubmatch(line); match != nil {
+			flag = &Flag{Name_: match[1], Type_: match[2], Usage_: match[3]}
+			if flag.Type_ == "" {
+				flag.Type_ = "bool"
+			}
+			flags = append(flags, flag)
+		} else if match := reFlagUsage.FindStringSubmatch(line); match != nil && flag != nil {
+			if flag.Usage_ != "" {
+				flag.Usage_ += "\n"
+			}
+			flag.Usage_ += match[1]
+		} else {
+			flag = nil
+		}
+	}
+
+	// Separate the default values from the usage, string
+	// values are quoted
+	for _, flag := range flags {
+		if match := reFlagDefault.FindStringSubmatch(flag.Usage_); match != nil {
+			flag.Usage_ = match[1]
+			if value, err := strconv.Unquote(match[2]); err == nil && strings.HasPrefix(match[2], "\"") {
+				flag.Default_ = value
+			} else {
+				flag.Default_ = match[2]
+			}
+		}
+	}
+
+	sort.Slice(flags, func(i, j int) bool {
+		return flags[i].Name_ < flags[j].Name_
+	})
+	return flags
+}
@@ -0,0 +1,83 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package gaffer_test
+
+import (
+	"bytes"
+	"flag"
+	"testing"
+	"time"
+
+	// Frameworks
+	gaffer "github.com/djthorpe/gopi-rpc/sys/gaffer"
+)
+
+func Test_Flags_001(t *testing.T) {
+	buf := new(bytes.Buffer)
+	flagset := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagset.SetOutput(buf)
+	flagset.Bool("v", false, "Verbose")
+	flagset.Bool("debug", false, "Debug output")
+	flagset.String("addr", "localhost", "Service `address`")
+	flagset.Uint("rpc.port", 8080, "Port\nfor the server")
+	flagset.Duration("timeout", time.Second, "Timeout")
+	flagset.String("name", "", "Name")
+	flagset.Usage = func() {
+		buf.WriteString("Usage of test:\n")
+		flagset.PrintDefaults()
+	}
+	flagset.Parse([]string{"-help"})
+
+	flags := gaffer.ParseFlags(buf)
+	expected := []struct{ name, kind, def, usage string }{
+		{"addr", "address", "localhost", "Service address"},
+		{"debug", "bool", "", "Debug output"},
+		{"name", "string", "", "Name"},
+		{"rpc.port", "uint", "8080", "Port\nfor the server"},
+		{"timeout", "duration", "1s", "Timeout"},
+		{"v", "bool", "", "Verbose"},
+	}
+	if len(flags) != len(expected) {
+		t.Fatalf("Expected %v flags, got %v", len(expected), flags)
+	}
+	for i, e := range expected {
+		if flags[i].Name() != e.name || flags[i].Type() != e.kind || flags[i].Default() != e.def || flags[i].Usage() != e.usage {
+			t.Errorf("Unexpected flag %v, expected %v", flags[i], e)
+		}
+	}
+}
+
+func Test_Flags_002(t *testing.T) {
+	tests := []struct {
+		kind, value string
+		ok          bool
+	}{
+		{"bool", "", true},
+		{"bool", "false", true},
+		{"bool", "maybe", false},
+		{"uint", "80", true},
+		{"uint", "-1", false},
+		{"uint", "", false},
+		{"int", "-1", true},
+		{"float", "1.5", true},
+		{"float", "x", false},
+		{"duration", "10s", true},
+		{"duration", "10", false},
+		{"string", "anything", true},
+		{"uint", "${rpc.port}", true},
+	}
+	for _, test := range tests {
+		flag := &gaffer.Flag{Name_: "test", Type_: test.kind}
+		if err := flag.Check(test.value); test.ok && err != nil {
+			t.Errorf("Unexpected error for %v=%v: %v", test.kind, test.value, err)
+		} else if test.ok == false && err == nil {
+			t.Errorf("Expected error for %v=%v", test.kind, test.value)
+		}
+	}
+}
@@ -15,11 +15,14 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	// Frameworks
 	gopi "github.com/djthorpe/gopi"
 	rpc "github.com/djthorpe/gopi-rpc"
+	errors "github.com/djthorpe/gopi/util/errors"
 	event "github.com/djthorpe/gopi/util/event"
 )
 
@@ -36,13 +39,73 @@ type Gaffer struct {
 	MaxInstances uint32
 	DeltaCleanup time.Duration
 
+	// DeltaWatch is the interval for checking executables for changes
+	DeltaWatch time.Duration
+
+	// Versions is the number of previous versions of uploaded executables
+	// to keep, and UploadSize is the maximum size of an uploaded executable
+	// in bytes
+	Versions   uint
+	UploadSize int64
+
+	// SecretPatterns are key patterns for flags and environment which are
+	// secret, and KeyPath is a file with a key for encrypting secrets
+	SecretPatterns []string
+	KeyPath        string
+
+	// DataRoot is the directory for service data directories, and RunRoot
+	// the directory for instance run directories. DirMode and DirOwner are
+	// the permissions and ownership for the directories
+	DataRoot string
+	RunRoot  string
+	DirMode  os.FileMode
+	DirOwner string
+
+	// JournalPath is the file where events are recorded, and JournalSize
+	// and JournalAge are the maximum size of the journal and age of events
+	JournalPath string
+	JournalSize int64
+	JournalAge  time.Duration
+
+	// AuditPath is the file where calls which change services, groups
+	// or instances are recorded
+	AuditPath string
+
+	// CrashPath is the folder where crash reports are stored, CrashCount
+	// and CrashAge are the maximum number and age of crash reports, and
+	// CrashLines is the number of lines of output in a crash report
+	CrashPath  string
+	CrashCount uint
+	CrashAge   time.Duration
+	CrashLines uint
+
+	// HookTimeout is the time a hook can run for when the hook does not
+	// set a timeout
+	HookTimeout time.Duration
+
 	// Appflags
 	AppFlags *gopi.Flags
 }
 
 type gaffer struct {
-	log gopi.Logger
-	evt chan rpc.GafferEvent
+	log      gopi.Logger
+	evt      chan rpc.GafferEvent
+	rollouts rollouts
+	upgrades upgrades
+	versions uint
+	uploads  uploads
+	journal  journal
+	audit    audit
+	crashes  crashes
+	metrics  metrics
+
+	// edits serializes changes to flags and environment, so that the
+	// version can be checked before a patch is applied
+	edits sync.Mutex
+
+	// emits serializes events, so that they are delivered to subscribers
+	// in the order of their sequence numbers
+	emits sync.Mutex
 
 	config
 	Instances
@@ -77,6 +140,30 @@ func (config Gaffer) Open(logger gopi.Logger) (gopi.Driver, error) {
 		logger.Debug2("Config.Init returned nil")
 		return nil, err
 	}
+	if config.JournalPath == "" && this.config.path != "" {
+		config.JournalPath = strings.TrimSuffix(this.config.path, filepath.Ext(this.config.path)) + JOURNAL_EXT
+	}
+	if err := this.journal.Init(config, config.JournalPath, logger); err != nil {
+		logger.Debug2("Journal.Init returned nil")
+		return nil, err
+	}
+	if config.AuditPath == "" && this.config.path != "" {
+		config.AuditPath = strings.TrimSuffix(this.config.path, filepath.Ext(this.config.path)) + AUDIT_EXT
+	}
+	if err := this.audit.Init(config.AuditPath, logger); err != nil {
+		logger.Debug2("Audit.Init returned nil")
+		return nil, err
+	}
+	if config.CrashPath == "" && this.config.path != "" {
+		config.CrashPath = filepath.Join(filepath.Dir(this.config.path), CRASH_FOLDER)
+	}
+	if err := this.crashes.Init(config, config.CrashPath, logger); err != nil {
+		logger.Debug2("Crashes.Init returned nil")
+		return nil, err
+	}
+	if config.DataRoot == "" && this.config.path != "" {
+		config.DataRoot = filepath.Join(filepath.Dir(this.config.path), DATA_FOLDER)
+	}
 	if err := this.Instances.Init(config, logger); err != nil {
 		logger.Debug2("Instances.Init returned nil")
 		return nil, err
@@ -85,6 +172,30 @@ func (config Gaffer) Open(logger gopi.Logger) (gopi.Driver, error) {
 	// Start background task which starts and stops instances
 	this.Tasks.Start(this.InstanceTask, this.LoggingTask)
 
+	// Set number of previous versions to keep for uploaded executables
+	// and the maximum size of an upload
+	if config.Versions == 0 {
+		this.versions = VERSIONS_KEEP
+	} else {
+		this.versions = config.Versions
+	}
+	if config.UploadSize == 0 {
+		this.uploads.size = UPLOAD_SIZE
+	} else {
+		this.uploads.size = config.UploadSize
+	}
+
+	// Start background task which watches for executable changes
+	if config.DeltaWatch == 0 {
+		this.upgrades.delta = DELTA_WATCH
+	} else {
+		this.upgrades.delta = config.DeltaWatch
+	}
+	this.Tasks.Start(this.ExecutableTask)
+
+	// Start background task which removes old events from the journal
+	this.Tasks.Start(this.JournalTask)
+
 	// Success
 	return this, nil
 }
@@ -105,6 +216,12 @@ func (this *gaffer) Close() error {
 	close(this.evt)
 
 	// Release resources, etc
+	if err := this.journal.Destroy(); err != nil {
+		return err
+	}
+	if err := this.audit.Destroy(); err != nil {
+		return err
+	}
 	if err := this.Instances.Destroy(); err != nil {
 		return err
 	}
@@ -139,25 +256,12 @@ func (this *gaffer) GetExecutables(recursive bool) []string {
 	if root, err := this.config.Root(); err != nil {
 		this.log.Error("Executables: %v", err)
 		return nil
-	} else if err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if path == root {
-			return nil
-		} else if info.IsDir() && recursive == false {
-			return filepath.SkipDir
-		}
-		if info.Mode().IsRegular() && isExecutableFileAtPath(path) == nil {
-			// Trim prefix
-			sep := string(filepath.Separator)
-			path := strings.TrimPrefix(strings.TrimPrefix(path, root), sep)
-
-			// Append
-			if reExecutableName.MatchString(path) {
-				executables = append(executables, path)
-			} else {
-				this.log.Warn("Ignoring path: %v", strconv.Quote(path))
-			}
+	} else if err := walkExecutables(root, recursive, func(path string) {
+		if reExecutableName.MatchString(path) {
+			executables = append(executables, path)
+		} else {
+			this.log.Warn("Ignoring path: %v", strconv.Quote(path))
 		}
-		return nil
 	}); err != nil {
 		this.log.Error("Executables: %v", err)
 		return nil
@@ -166,6 +270,53 @@ func (this *gaffer) GetExecutables(recursive bool) []string {
 	return executables
 }
 
+// GetExecutableForPath returns the size, modification time, checksum and
+// architecture of an executable relative to the binary root, and the names
+// of the services which reference it
+func (this *gaffer) GetExecutableForPath(path string) (rpc.GafferExecutable, error) {
+	this.log.Debug2("<gaffer>GetExecutableForPath{ path=%v }", strconv.Quote(path))
+
+	if root, err := this.config.Root(); err != nil {
+		return nil, err
+	} else if dest, err := pathForExecutable(root, path); err != nil {
+		return nil, err
+	} else if executable, err := this.Instances.GetExecutableForPath(dest); os.IsNotExist(err) {
+		return nil, gopi.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	} else {
+		services := make([]string, 0)
+		for _, service := range this.config.Services {
+			if service.Path_ == path {
+				services = append(services, service.Name_)
+			}
+		}
+		return CopyExecutable(executable, path, services), nil
+	}
+}
+
+// GetFlagsForExecutable returns the flags accepted by a gopi executable,
+// relative to the binary root
+func (this *gaffer) GetFlagsForExecutable(path string) ([]rpc.GafferFlag, error) {
+	this.log.Debug2("<gaffer>GetFlagsForExecutable{ path=%v }", strconv.Quote(path))
+
+	if root, err := this.config.Root(); err != nil {
+		return nil, err
+	} else if dest, err := pathForExecutable(root, path); err != nil {
+		return nil, err
+	} else if flags, err := this.Instances.GetFlagsForPath(dest); os.IsNotExist(err) {
+		return nil, gopi.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	} else {
+		flags_ := make([]rpc.GafferFlag, len(flags))
+		for i, flag := range flags {
+			flags_[i] = flag
+		}
+		return flags_, nil
+	}
+}
+
 // AddServiceForPath returns a new default service based on the executable
 // or returns an error if the executable was not found or invalid. On success,
 // the service is added to the configuration
@@ -258,6 +409,21 @@ func (this *gaffer) GetGroupsForNames(groups []string) []rpc.GafferServiceGroup
 	}
 }
 
+// ResolveGroupsForNames returns an array of groups and the groups they
+// include, in order of precedence
+func (this *gaffer) ResolveGroupsForNames(groups []string) []rpc.GafferServiceGroup {
+	this.log.Debug2("<gaffer>ResolveGroupsForNames{ groups=%v }", groups)
+	if groups_ := this.config.ResolveGroups(groups); groups_ == nil {
+		return nil
+	} else {
+		groups__ := make([]rpc.GafferServiceGroup, len(groups_))
+		for i, group := range groups_ {
+			groups__[i] = group
+		}
+		return groups__
+	}
+}
+
 // Remove a group
 func (this *gaffer) RemoveGroupForName(group string) error {
 	this.log.Debug2("<gaffer>RemoveGroupForName{ group=%v }", strconv.Quote(group))
@@ -271,6 +437,12 @@ func (this *gaffer) RemoveGroupForName(group string) error {
 			services_[i] = strconv.Quote(service.Name())
 		}
 		return fmt.Errorf("Group %v is in use by services %v", strconv.Quote(group), strings.Join(services_, ","))
+	} else if groups_ := this.config.GroupsForGroupByName(group); len(groups_) != 0 {
+		groups__ := make([]string, len(groups_))
+		for i, group_ := range groups_ {
+			groups__[i] = strconv.Quote(group_.Name())
+		}
+		return fmt.Errorf("Group %v is included by groups %v", strconv.Quote(group), strings.Join(groups__, ","))
 	} else if group_ := groups[0]; group_ == nil {
 		return gopi.ErrNotFound
 	} else if err := this.config.RemoveGroup(groups[0]); err != nil {
@@ -340,6 +512,53 @@ func (this *gaffer) SetGroupNameForName(group string, new string) error {
 	return gopi.ErrNotImplemented
 }
 
+func (this *gaffer) SetGroupGroupsForName(group string, groups []string) error {
+	this.log.Debug2("<gaffer>SetGroupGroupsForName{ group=%v groups=%v }", strconv.Quote(group), groups)
+
+	if group == "" {
+		return gopi.ErrBadParameter
+	} else if group_ := this.config.GetGroupsByName([]string{group}); len(group_) != 1 {
+		return gopi.ErrNotFound
+	} else if groups_ := this.config.GetGroupsByName(groups); len(groups_) != len(groups) {
+		return gopi.ErrNotFound
+	} else if err := this.config.SetGroupGroups(group_[0], groups); err != nil {
+		return err
+	} else {
+		this.EmitGroup(rpc.GAFFER_EVENT_GROUP_CHANGE, group_[0])
+		return nil
+	}
+}
+
+func (this *gaffer) SetServiceLabelsForName(service string, labels rpc.Tuples) error {
+	this.log.Debug2("<gaffer>SetServiceLabelsForName{ service=%v labels=%v }", strconv.Quote(service), labels)
+	this.edits.Lock()
+	defer this.edits.Unlock()
+	if service == "" {
+		return gopi.ErrBadParameter
+	} else if service_ := this.config.GetServiceByName(service); service_ == nil {
+		return gopi.ErrNotFound
+	} else if err := this.config.SetServiceLabels(service_, labels); err != nil {
+		return err
+	} else {
+		this.EmitService(rpc.GAFFER_EVENT_SERVICE_CHANGE, service_)
+		return nil
+	}
+}
+
+func (this *gaffer) SetServiceArgsForName(service string, style rpc.GafferFlagStyle, args []string) error {
+	this.log.Debug2("<gaffer>SetServiceArgsForName{ service=%v style=%v args=%v }", strconv.Quote(service), style, args)
+	if service == "" {
+		return gopi.ErrBadParameter
+	} else if service_ := this.config.GetServiceByName(service); service_ == nil {
+		return gopi.ErrNotFound
+	} else if err := this.config.SetServiceArgs(service_, style, args); err != nil {
+		return err
+	} else {
+		this.EmitService(rpc.GAFFER_EVENT_SERVICE_CHANGE, service_)
+		return nil
+	}
+}
+
 func (this *gaffer) SetServiceModeForName(service string, mode rpc.GafferServiceMode) error {
 	this.log.Debug2("<gaffer>SetServiceModeForName{ service=%v mode=%v }", strconv.Quote(service), mode)
 	return gopi.ErrNotImplemented
@@ -347,7 +566,16 @@ func (this *gaffer) SetServiceModeForName(service string, mode rpc.GafferService
 
 func (this *gaffer) SetServiceInstanceCountForName(service string, count uint) error {
 	this.log.Debug2("<gaffer>SetServiceInstanceCountForName{ service=%v count=%v }", strconv.Quote(service), count)
-	return gopi.ErrNotImplemented
+	if service == "" {
+		return gopi.ErrBadParameter
+	} else if service_ := this.config.GetServiceByName(service); service_ == nil {
+		return gopi.ErrNotFound
+	} else if err := this.config.SetServiceInstanceCount(service_, count); err != nil {
+		return err
+	} else {
+		this.EmitService(rpc.GAFFER_EVENT_SERVICE_CHANGE, service_)
+		return nil
+	}
 }
 
 func (this *gaffer) SetServiceGroupsForName(service string, groups []string) error {
@@ -366,6 +594,20 @@ func (this *gaffer) SetServiceGroupsForName(service string, groups []string) err
 	}
 }
 
+func (this *gaffer) SetServiceUpgradePolicyForName(service string, policy rpc.GafferUpgradePolicy) error {
+	this.log.Debug2("<gaffer>SetServiceUpgradePolicyForName{ service=%v policy=%v }", strconv.Quote(service), policy)
+	if service == "" {
+		return gopi.ErrBadParameter
+	} else if service_ := this.config.GetServiceByName(service); service_ == nil {
+		return gopi.ErrNotFound
+	} else if err := this.config.SetServiceUpgradePolicy(service_, policy); err != nil {
+		return err
+	} else {
+		this.EmitService(rpc.GAFFER_EVENT_SERVICE_CHANGE, service_)
+		return nil
+	}
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // INSTANCES
 
@@ -388,18 +630,213 @@ func (this *gaffer) StartInstanceForServiceName(service string, id uint32) (rpc.
 		return nil, gopi.ErrBadParameter
 	} else if service_ := this.config.GetServiceByName(service); service_ == nil {
 		return nil, gopi.ErrNotFound
-	} else if groups := this.config.GetGroupsByName(service_.Groups_); groups == nil {
+	} else if groups := this.config.ResolveGroups(service_.Groups_); groups == nil {
 		return nil, gopi.ErrBadParameter
 	} else if root, err := this.Root(); err != nil {
 		return nil, err
 	} else if instance, err := this.Instances.NewInstance(id, service_, groups, root); err != nil {
 		return nil, err
 	} else {
+		// Inherited and env file values are also secret when they match
+		// a secret key pattern
+		instance.Secrets_ = this.config.markSecrets(instance.Secrets_, instance.Flags_, instance.Env_)
 		this.EmitInstance(rpc.GAFFER_EVENT_INSTANCE_ADD, instance)
 		return instance, nil
 	}
 }
 
+// ResolveServiceForName returns the flags and environment for a service as
+// they would be resolved when an instance is started. Variables provided by
+// gaffer, such as an unused port, may differ when an instance is started
+func (this *gaffer) ResolveServiceForName(service string) ([]rpc.GafferResolvedTuple, []rpc.GafferResolvedTuple, error) {
+	this.log.Debug2("<gaffer>ResolveServiceForName{ service=%v }", strconv.Quote(service))
+	if service == "" {
+		return nil, nil, gopi.ErrBadParameter
+	} else if service_ := this.config.GetServiceByName(service); service_ == nil {
+		return nil, nil, gopi.ErrNotFound
+	} else if groups := this.config.ResolveGroups(service_.Groups_); groups == nil {
+		return nil, nil, gopi.ErrBadParameter
+	} else if flags_, env_, flags, env, err := ResolveTuples(service_, groups, this.Instances.dirs.Expander(this.Instances.dirs.DataDir(service_), "", this.Instances.TupleExpander)); err != nil {
+		return nil, nil, err
+	} else {
+		// Redact secret values
+		secrets := this.config.markSecrets(secretsForInstance(service_, groups, flags, env), flags_, env_)
+		redactResolved(flags, secrets)
+		redactResolved(env, secrets)
+
+		flags_ := make([]rpc.GafferResolvedTuple, len(flags))
+		for i, flag := range flags {
+			flags_[i] = flag
+		}
+		env_ := make([]rpc.GafferResolvedTuple, len(env))
+		for i, e := range env {
+			env_[i] = e
+		}
+		return flags_, env_, nil
+	}
+}
+
+// GetServiceDataForName returns the data directory for a service
+func (this *gaffer) GetServiceDataForName(service string) (rpc.GafferServiceData, error) {
+	this.log.Debug2("<gaffer>GetServiceDataForName{ service=%v }", strconv.Quote(service))
+	if service == "" {
+		return nil, gopi.ErrBadParameter
+	} else if service_ := this.config.GetServiceByName(service); service_ == nil {
+		return nil, gopi.ErrNotFound
+	} else if path := this.Instances.dirs.DataDir(service_); path == "" {
+		return nil, fmt.Errorf("Missing -gaffer.data path")
+	} else {
+		return NewServiceData(service_, path)
+	}
+}
+
+// WipeServiceDataForName removes the contents of the data directory for a
+// service, when no instances of the service are running
+func (this *gaffer) WipeServiceDataForName(service string) (rpc.GafferServiceData, error) {
+	this.log.Debug2("<gaffer>WipeServiceDataForName{ service=%v }", strconv.Quote(service))
+	if service == "" {
+		return nil, gopi.ErrBadParameter
+	} else if service_ := this.config.GetServiceByName(service); service_ == nil {
+		return nil, gopi.ErrNotFound
+	} else if path := this.Instances.dirs.DataDir(service_); path == "" {
+		return nil, fmt.Errorf("Missing -gaffer.data path")
+	} else if instances := this.runningInstancesForService(service_); len(instances) > 0 {
+		return nil, fmt.Errorf("Service %v has running instances", strconv.Quote(service))
+	} else if err := wipeDir(path); err != nil {
+		return nil, err
+	} else {
+		return NewServiceData(service_, path)
+	}
+}
+
+// QueryEvents returns events from the journal which match a query. When
+// there is no journal file, events after a sequence number are returned
+// from the recent events kept in memory
+func (this *gaffer) QueryEvents(query rpc.GafferEventQuery) ([]rpc.GafferEvent, error) {
+	this.log.Debug2("<gaffer>QueryEvents{ query=%+v }", query)
+	if query.After > 0 {
+		if recent, ok := this.journal.Recent(query); ok {
+			events := make([]rpc.GafferEvent, len(recent))
+			for i, evt := range recent {
+				events[i] = evt
+			}
+			return events, nil
+		}
+	}
+	if entries, err := this.journal.Query(query); err != nil {
+		return nil, err
+	} else {
+		events := make([]rpc.GafferEvent, len(entries))
+		for i, entry := range entries {
+			events[i] = this.eventForEntry(entry)
+		}
+		return events, nil
+	}
+}
+
+// EventSeq returns the sequence number of the most recent event
+func (this *gaffer) EventSeq() uint64 {
+	return this.journal.Seq()
+}
+
+// eventForEntry returns an event for a journal entry with the instance or
+// service which exists now, so that the event can be matched by labels and
+// instance state. An instance which has gone is given the labels of the
+// service, which are copied to instances when they are created
+func (this *gaffer) eventForEntry(entry *JournalEntry) *Event {
+	evt := entry.Event()
+	service := this.config.GetServiceByName(entry.Service_)
+	if entry.Instance_ == 0 {
+		if service != nil {
+			evt.Service_ = service
+		}
+	} else if instance := this.Instances.GetInstanceForId(entry.Instance_); instance != nil {
+		evt.Instance_ = instance
+	} else if instance, ok := evt.Instance_.(*ServiceInstance); ok {
+		if service != nil {
+			instance.Service_ = service
+			instance.Labels_ = service.Labels_.Copy()
+		}
+		switch entry.Type_ {
+		case rpc.GAFFER_EVENT_INSTANCE_STOP_OK, rpc.GAFFER_EVENT_INSTANCE_STOP_ERROR, rpc.GAFFER_EVENT_INSTANCE_STOP_KILLED:
+			instance.Stop_ = entry.Ts_
+		}
+	}
+	return evt
+}
+
+// AppendAudit records a call in the audit log, redacting the values of
+// secret flags and environment in the parameters
+func (this *gaffer) AppendAudit(peer, identity, method string, params rpc.Tuples, err error) error {
+	this.log.Debug2("<gaffer>AppendAudit{ peer=%v identity=%v method=%v err=%v }", strconv.Quote(peer), strconv.Quote(identity), method, err)
+	record := &AuditRecord{
+		Peer_:     peer,
+		Identity_: identity,
+		Method_:   method,
+		Params_:   this.config.redactParams(params),
+	}
+	if err != nil {
+		record.Error_ = err.Error()
+	}
+	return this.audit.Append(record)
+}
+
+// QueryAudit returns records from the audit log which match a query
+func (this *gaffer) QueryAudit(query rpc.GafferAuditQuery) ([]rpc.GafferAuditRecord, error) {
+	this.log.Debug2("<gaffer>QueryAudit{ query=%+v }", query)
+	if records, err := this.audit.Query(query); err != nil {
+		return nil, err
+	} else {
+		records_ := make([]rpc.GafferAuditRecord, len(records))
+		for i, record := range records {
+			records_[i] = record
+		}
+		return records_, nil
+	}
+}
+
+// ListCrashReports returns crash reports for services matching a
+// pattern, most recent first
+func (this *gaffer) ListCrashReports(service string) ([]rpc.GafferCrashReport, error) {
+	this.log.Debug2("<gaffer>ListCrashReports{ service=%v }", strconv.Quote(service))
+	if reports, err := this.crashes.List(service); err != nil {
+		return nil, err
+	} else {
+		reports_ := make([]rpc.GafferCrashReport, len(reports))
+		for i, report := range reports {
+			reports_[i] = report
+		}
+		return reports_, nil
+	}
+}
+
+// GetCrashReportForId returns a crash report by identifier
+func (this *gaffer) GetCrashReportForId(id uint64) (rpc.GafferCrashReport, error) {
+	this.log.Debug2("<gaffer>GetCrashReportForId{ id=%v }", id)
+	if id == 0 {
+		return nil, gopi.ErrBadParameter
+	} else if report := this.crashes.Get(id); report == nil {
+		return nil, gopi.ErrNotFound
+	} else {
+		return report, nil
+	}
+}
+
+// SetInstanceLabelsForId replaces the labels for an instance. The labels
+// are not retained when the configuration is written
+func (this *gaffer) SetInstanceLabelsForId(id uint32, labels rpc.Tuples) (rpc.GafferServiceInstance, error) {
+	this.log.Debug2("<gaffer>SetInstanceLabelsForId{ id=%v labels=%v }", id, labels)
+	if id == 0 {
+		return nil, gopi.ErrBadParameter
+	} else if instance := this.Instances.GetInstanceForId(id); instance == nil {
+		return nil, gopi.ErrNotFound
+	} else if err := this.Instances.SetLabels(instance, labels); err != nil && err != gopi.ErrNotModified {
+		return nil, err
+	} else {
+		return instance, nil
+	}
+}
+
 func (this *gaffer) StopInstanceForId(id uint32) error {
 	this.log.Debug2("<gaffer>StopInstanceForId{ id=%v }", id)
 	if id == 0 {
@@ -410,7 +847,7 @@ func (this *gaffer) StopInstanceForId(id uint32) error {
 		return gopi.ErrNotFound
 	} else if instance.IsRunning() == false {
 		return gopi.ErrOutOfOrder
-	} else if err := this.Instances.Stop(instance); err != nil {
+	} else if err := this.Instances.Stop(instance, this.evt); err != nil {
 		return err
 	}
 
@@ -418,17 +855,102 @@ func (this *gaffer) StopInstanceForId(id uint32) error {
 	return nil
 }
 
+////////////////////////////////////////////////////////////////////////////////
+// SIGNALS
+
+// SignalInstanceForId delivers a signal to a running instance, or to the
+// process group of the instance when group is true
+func (this *gaffer) SignalInstanceForId(id uint32, signal syscall.Signal, group bool) (rpc.GafferServiceInstance, error) {
+	this.log.Debug2("<gaffer>SignalInstanceForId{ id=%v signal=%v group=%v }", id, signal, group)
+	if id == 0 || signal == 0 {
+		return nil, gopi.ErrBadParameter
+	}
+
+	if instance := this.Instances.GetInstanceForId(id); instance == nil {
+		return nil, gopi.ErrNotFound
+	} else if instance.IsRunning() == false {
+		return nil, gopi.ErrOutOfOrder
+	} else if err := this.signalInstance(instance, signal, group); err != nil {
+		return nil, err
+	} else {
+		return instance, nil
+	}
+}
+
+// SignalInstancesForServiceName delivers a signal to all running instances
+// of a service, and returns the instances which were signalled
+func (this *gaffer) SignalInstancesForServiceName(service string, signal syscall.Signal, group bool) ([]rpc.GafferServiceInstance, error) {
+	this.log.Debug2("<gaffer>SignalInstancesForServiceName{ service=%v signal=%v group=%v }", strconv.Quote(service), signal, group)
+	if service == "" || signal == 0 {
+		return nil, gopi.ErrBadParameter
+	} else if service_ := this.config.GetServiceByName(service); service_ == nil {
+		return nil, gopi.ErrNotFound
+	} else {
+		return this.signalInstances(func(instance *ServiceInstance) bool {
+			return instance.Service_ == service_
+		}, signal, group)
+	}
+}
+
+// SignalInstancesForGroupName delivers a signal to all running instances
+// of services which are members of a group, including through groups which
+// include the group, and returns the instances which were signalled
+func (this *gaffer) SignalInstancesForGroupName(group string, signal syscall.Signal, process_group bool) ([]rpc.GafferServiceInstance, error) {
+	this.log.Debug2("<gaffer>SignalInstancesForGroupName{ group=%v signal=%v process_group=%v }", strconv.Quote(group), signal, process_group)
+	if group == "" || signal == 0 {
+		return nil, gopi.ErrBadParameter
+	} else if groups := this.config.GetGroupsByName([]string{group}); len(groups) != 1 {
+		return nil, gopi.ErrNotFound
+	} else {
+		return this.signalInstances(func(instance *ServiceInstance) bool {
+			return this.config.IsMemberOfGroup(instance.Service_, group)
+		}, signal, process_group)
+	}
+}
+
+// signalInstances delivers a signal to the running instances which match a
+// filter, and returns the instances which were signalled. Failing to signal
+// an instance does not prevent the others from being signalled, and the
+// errors are returned together
+func (this *gaffer) signalInstances(filter func(*ServiceInstance) bool, signal syscall.Signal, group bool) ([]rpc.GafferServiceInstance, error) {
+	instances := make([]rpc.GafferServiceInstance, 0)
+	errs := errors.CompoundError{}
+	for _, instance := range this.Instances.GetInstances() {
+		if instance_, ok := instance.(*ServiceInstance); ok == false {
+			errs.Add(gopi.ErrAppError)
+		} else if filter(instance_) == false || instance_.IsRunning() == false {
+			continue
+		} else if err := this.signalInstance(instance_, signal, group); err != nil {
+			errs.Add(fmt.Errorf("Instance %v: %v", instance_.Id(), err))
+		} else {
+			instances = append(instances, instance_)
+		}
+	}
+	return instances, errs.ErrorOrSelf()
+}
+
+func (this *gaffer) signalInstance(instance *ServiceInstance, signal syscall.Signal, group bool) error {
+	if err := this.Instances.Signal(instance, signal, group); err != nil {
+		return err
+	} else {
+		this.EmitInstanceData(rpc.GAFFER_EVENT_INSTANCE_SIGNAL, instance, []byte(rpc.NameForSignal(signal)))
+		return nil
+	}
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // TUPLES
 
 func (this *gaffer) SetServiceFlagsForName(service string, tuples rpc.Tuples) error {
-	this.log.Debug2("<gaffer>SetServiceFlagsForName{ service=%v tuples=%v }", strconv.Quote(service), tuples)
+	this.log.Debug2("<gaffer>SetServiceFlagsForName{ service=%v keys=%v }", strconv.Quote(service), tuples.Keys())
+	this.edits.Lock()
+	defer this.edits.Unlock()
 	if service == "" {
 		return gopi.ErrBadParameter
 	}
 	if service_ := this.config.GetServiceByName(service); service_ == nil {
 		return gopi.ErrNotFound
-	} else if err := this.config.SetServiceFlags(service_, tuples); err != nil {
+	} else if err := this.setServiceFlags(service_, restoreRedacted(tuples, service_.Flags_)); err != nil {
 		return err
 	} else {
 		return nil
@@ -436,13 +958,15 @@ func (this *gaffer) SetServiceFlagsForName(service string, tuples rpc.Tuples) er
 }
 
 func (this *gaffer) SetGroupFlagsForName(group string, tuples rpc.Tuples) error {
-	this.log.Debug2("<gaffer>SetGroupFlagsForName{ group=%v tuples=%v }", strconv.Quote(group), tuples)
+	this.log.Debug2("<gaffer>SetGroupFlagsForName{ group=%v keys=%v }", strconv.Quote(group), tuples.Keys())
+	this.edits.Lock()
+	defer this.edits.Unlock()
 	if group == "" {
 		return gopi.ErrBadParameter
 	}
 	if group_ := this.config.GetGroupsByName([]string{group}); len(group_) == 0 {
 		return gopi.ErrNotFound
-	} else if err := this.config.SetGroupFlags(group_[0], tuples); err != nil {
+	} else if err := this.setGroupFlags(group_[0], restoreRedacted(tuples, group_[0].Flags_)); err != nil {
 		return err
 	} else {
 		return nil
@@ -450,26 +974,316 @@ func (this *gaffer) SetGroupFlagsForName(group string, tuples rpc.Tuples) error
 }
 
 func (this *gaffer) SetGroupEnvForName(group string, tuples rpc.Tuples) error {
-	this.log.Debug2("<gaffer>SetGroupEnvForName{ group=%v tuples=%v }", strconv.Quote(group), tuples)
+	this.log.Debug2("<gaffer>SetGroupEnvForName{ group=%v keys=%v }", strconv.Quote(group), tuples.Keys())
+	this.edits.Lock()
+	defer this.edits.Unlock()
+	if group == "" {
+		return gopi.ErrBadParameter
+	}
+	if group_ := this.config.GetGroupsByName([]string{group}); len(group_) == 0 {
+		return gopi.ErrNotFound
+	} else if err := this.config.SetGroupEnv(group_[0], restoreRedacted(tuples, group_[0].Env_)); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+// PatchServiceFlagsForName applies a patch to the flags for a service. When
+// version is not zero, the patch is only applied if it matches the current
+// version of the service
+func (this *gaffer) PatchServiceFlagsForName(service string, version uint64, patch []rpc.GafferTuplesPatch) error {
+	this.log.Debug2("<gaffer>PatchServiceFlagsForName{ service=%v version=%v patch=%v }", strconv.Quote(service), version, patch)
+	this.edits.Lock()
+	defer this.edits.Unlock()
+	if service == "" {
+		return gopi.ErrBadParameter
+	}
+	if service_ := this.config.GetServiceByName(service); service_ == nil {
+		return gopi.ErrNotFound
+	} else if err := checkVersion(service_.Name_, version, service_.Version_); err != nil {
+		return err
+	} else if tuples, err := service_.Flags_.Patch(patch); err != nil {
+		return err
+	} else if err := this.setServiceFlags(service_, restoreRedacted(tuples, service_.Flags_)); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+// PatchGroupFlagsForName applies a patch to the flags for a group. When
+// version is not zero, the patch is only applied if it matches the current
+// version of the group
+func (this *gaffer) PatchGroupFlagsForName(group string, version uint64, patch []rpc.GafferTuplesPatch) error {
+	this.log.Debug2("<gaffer>PatchGroupFlagsForName{ group=%v version=%v patch=%v }", strconv.Quote(group), version, patch)
+	this.edits.Lock()
+	defer this.edits.Unlock()
 	if group == "" {
 		return gopi.ErrBadParameter
 	}
 	if group_ := this.config.GetGroupsByName([]string{group}); len(group_) == 0 {
 		return gopi.ErrNotFound
-	} else if err := this.config.SetGroupEnv(group_[0], tuples); err != nil {
+	} else if err := checkVersion("@"+group_[0].Name_, version, group_[0].Version_); err != nil {
+		return err
+	} else if tuples, err := group_[0].Flags_.Patch(patch); err != nil {
+		return err
+	} else if err := this.setGroupFlags(group_[0], restoreRedacted(tuples, group_[0].Flags_)); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+// PatchGroupEnvForName applies a patch to the environment for a group. When
+// version is not zero, the patch is only applied if it matches the current
+// version of the group
+func (this *gaffer) PatchGroupEnvForName(group string, version uint64, patch []rpc.GafferTuplesPatch) error {
+	this.log.Debug2("<gaffer>PatchGroupEnvForName{ group=%v version=%v patch=%v }", strconv.Quote(group), version, patch)
+	this.edits.Lock()
+	defer this.edits.Unlock()
+	if group == "" {
+		return gopi.ErrBadParameter
+	}
+	if group_ := this.config.GetGroupsByName([]string{group}); len(group_) == 0 {
+		return gopi.ErrNotFound
+	} else if err := checkVersion("@"+group_[0].Name_, version, group_[0].Version_); err != nil {
+		return err
+	} else if tuples, err := group_[0].Env_.Patch(patch); err != nil {
+		return err
+	} else if err := this.config.SetGroupEnv(group_[0], restoreRedacted(tuples, group_[0].Env_)); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+// SetServiceSecretsForName marks flags for a service as secret, so that
+// their values are redacted
+func (this *gaffer) SetServiceSecretsForName(service string, keys []string) error {
+	this.log.Debug2("<gaffer>SetServiceSecretsForName{ service=%v keys=%v }", strconv.Quote(service), keys)
+	this.edits.Lock()
+	defer this.edits.Unlock()
+	if service == "" || checkSecretKeys(keys) == false {
+		return gopi.ErrBadParameter
+	}
+	if service_ := this.config.GetServiceByName(service); service_ == nil {
+		return gopi.ErrNotFound
+	} else if err := this.config.SetServiceSecrets(service_, keys); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+// SetGroupSecretsForName marks flags and environment for a group as
+// secret, so that their values are redacted
+func (this *gaffer) SetGroupSecretsForName(group string, keys []string) error {
+	this.log.Debug2("<gaffer>SetGroupSecretsForName{ group=%v keys=%v }", strconv.Quote(group), keys)
+	this.edits.Lock()
+	defer this.edits.Unlock()
+	if group == "" || checkSecretKeys(keys) == false {
+		return gopi.ErrBadParameter
+	}
+	if group_ := this.config.GetGroupsByName([]string{group}); len(group_) == 0 {
+		return gopi.ErrNotFound
+	} else if err := this.config.SetGroupSecrets(group_[0], keys); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+// SetServiceEnvPolicyForName sets the variables which instances of a
+// service inherit from the gaffer environment
+func (this *gaffer) SetServiceEnvPolicyForName(service string, policy rpc.GafferEnvPolicy, allow []string) error {
+	this.log.Debug2("<gaffer>SetServiceEnvPolicyForName{ service=%v policy=%v allow=%v }", strconv.Quote(service), policy, allow)
+	if service == "" {
+		return gopi.ErrBadParameter
+	} else if err := checkEnvPolicy(policy, allow); err != nil {
+		return err
+	} else if service_ := this.config.GetServiceByName(service); service_ == nil {
+		return gopi.ErrNotFound
+	} else if err := this.config.SetServiceEnvPolicy(service_, policy, allow); err != nil {
+		return err
+	} else {
+		this.EmitService(rpc.GAFFER_EVENT_SERVICE_CHANGE, service_)
+		return nil
+	}
+}
+
+// SetGroupEnvPolicyForName sets the variables which instances of services
+// in a group inherit from the gaffer environment
+func (this *gaffer) SetGroupEnvPolicyForName(group string, policy rpc.GafferEnvPolicy, allow []string) error {
+	this.log.Debug2("<gaffer>SetGroupEnvPolicyForName{ group=%v policy=%v allow=%v }", strconv.Quote(group), policy, allow)
+	if group == "" {
+		return gopi.ErrBadParameter
+	} else if err := checkEnvPolicy(policy, allow); err != nil {
+		return err
+	} else if group_ := this.config.GetGroupsByName([]string{group}); len(group_) == 0 {
+		return gopi.ErrNotFound
+	} else if err := this.config.SetGroupEnvPolicy(group_[0], policy, allow); err != nil {
+		return err
+	} else {
+		this.EmitGroup(rpc.GAFFER_EVENT_GROUP_CHANGE, group_[0])
+		return nil
+	}
+}
+
+// SetGroupEnvFilesForName sets the files in the .env format which are read
+// into the environment for a group when instances are started. The files
+// need to exist and be readable
+func (this *gaffer) SetGroupEnvFilesForName(group string, files []string) error {
+	this.log.Debug2("<gaffer>SetGroupEnvFilesForName{ group=%v files=%v }", strconv.Quote(group), files)
+	if group == "" {
+		return gopi.ErrBadParameter
+	} else if err := checkEnvFiles(files); err != nil {
+		return err
+	} else if group_ := this.config.GetGroupsByName([]string{group}); len(group_) == 0 {
+		return gopi.ErrNotFound
+	} else if err := this.config.SetGroupEnvFiles(group_[0], files); err != nil {
+		return err
+	} else {
+		this.EmitGroup(rpc.GAFFER_EVENT_GROUP_CHANGE, group_[0])
+		return nil
+	}
+}
+
+// SetServiceHooksForName replaces the commands which are run at each stage
+// of the lifecycle of instances of a service
+func (this *gaffer) SetServiceHooksForName(service string, hooks []rpc.GafferHook) error {
+	this.log.Debug2("<gaffer>SetServiceHooksForName{ service=%v hooks=%v }", strconv.Quote(service), hooks)
+	if service == "" {
+		return gopi.ErrBadParameter
+	} else if err := checkHooks(hooks); err != nil {
+		return err
+	} else if service_ := this.config.GetServiceByName(service); service_ == nil {
+		return gopi.ErrNotFound
+	} else if err := this.config.SetServiceHooks(service_, hooks); err != nil {
+		return err
+	} else {
+		this.EmitService(rpc.GAFFER_EVENT_SERVICE_CHANGE, service_)
+		return nil
+	}
+}
+
+// SetGroupHooksForName replaces the commands which are run at each stage
+// of the lifecycle of instances of services in a group
+func (this *gaffer) SetGroupHooksForName(group string, hooks []rpc.GafferHook) error {
+	this.log.Debug2("<gaffer>SetGroupHooksForName{ group=%v hooks=%v }", strconv.Quote(group), hooks)
+	if group == "" {
+		return gopi.ErrBadParameter
+	} else if err := checkHooks(hooks); err != nil {
+		return err
+	} else if group_ := this.config.GetGroupsByName([]string{group}); len(group_) == 0 {
+		return gopi.ErrNotFound
+	} else if err := this.config.SetGroupHooks(group_[0], hooks); err != nil {
+		return err
+	} else {
+		this.EmitGroup(rpc.GAFFER_EVENT_GROUP_CHANGE, group_[0])
+		return nil
+	}
+}
+
+// setServiceFlags checks the flags for a service before setting them
+func (this *gaffer) setServiceFlags(service *Service, tuples rpc.Tuples) error {
+	if err := this.checkServiceFlags(service, tuples); err != nil {
 		return err
 	} else {
+		return this.config.SetServiceFlags(service, tuples)
+	}
+}
+
+// setGroupFlags checks the flags for a group before setting them
+func (this *gaffer) setGroupFlags(group *ServiceGroup, tuples rpc.Tuples) error {
+	if err := this.checkGroupFlags(group, tuples); err != nil {
+		return err
+	} else {
+		return this.config.SetGroupFlags(group, tuples)
+	}
+}
+
+// checkSecretKeys returns false if any key is not a valid tuple key
+func checkSecretKeys(keys []string) bool {
+	for _, key := range keys {
+		if reServiceGroupName.MatchString(key) == false {
+			return false
+		}
+	}
+	return true
+}
+
+// checkVersion returns an error if an expected version is set and
+// does not match the current version
+func checkVersion(name string, expected, current uint64) error {
+	if expected == 0 || expected == current {
 		return nil
+	} else {
+		return fmt.Errorf("Version mismatch for %v (expected %v, current %v)", name, expected, current)
 	}
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 // EMIT
 
+// Emit sets the sequence number and timestamp for an event and records it
+// in the journal, before it is delivered to subscribers
+func (this *gaffer) Emit(evt gopi.Event) {
+	this.emits.Lock()
+	defer this.emits.Unlock()
+	if evt_, ok := evt.(*Event); ok {
+		if err := this.journal.Append(evt_, this.groupsForEvent(evt_)); err != nil {
+			this.log.Warn("Journal: %v", err)
+		}
+		this.metrics.Event(evt_)
+	}
+	this.Publisher.Emit(evt)
+}
+
+// walkExecutables calls a function with the path of each executable under
+// the binary root, relative to the root. Folders which start with a period
+// are skipped
+func walkExecutables(root string, recursive bool, fn func(path string)) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		} else if path == root {
+			return nil
+		} else if info.IsDir() && (recursive == false || strings.HasPrefix(info.Name(), ".")) {
+			return filepath.SkipDir
+		}
+		if info.Mode().IsRegular() && isExecutableFileAtPath(path) == nil {
+			sep := string(filepath.Separator)
+			fn(strings.TrimPrefix(strings.TrimPrefix(path, root), sep))
+		}
+		return nil
+	})
+}
+
+// groupsForEvent returns the names of the groups for the service of an
+// event, including included groups
+func (this *gaffer) groupsForEvent(evt *Event) []string {
+	if service := evt.Service(); service == nil {
+		return nil
+	} else if groups := this.config.ResolveGroups(service.Groups()); len(groups) == 0 {
+		return nil
+	} else {
+		names := make([]string, len(groups))
+		for i, group := range groups {
+			names[i] = group.Name_
+		}
+		return names
+	}
+}
+
 func (this *gaffer) EmitService(t rpc.GafferEventType, service rpc.GafferService) {
 	this.Emit(NewEventWithService(this, t, service))
 }
 
+func (this *gaffer) EmitServiceData(t rpc.GafferEventType, service rpc.GafferService, data []byte) {
+	this.Emit(NewEventWithServiceData(this, t, service, data))
+}
+
 func (this *gaffer) EmitGroup(t rpc.GafferEventType, group rpc.GafferServiceGroup) {
 	this.Emit(NewEventWithGroup(this, t, group))
 }
@@ -478,6 +1292,10 @@ func (this *gaffer) EmitInstance(t rpc.GafferEventType, instance rpc.GafferServi
 	this.Emit(NewEventWithInstance(this, t, instance))
 }
 
+func (this *gaffer) EmitInstanceData(t rpc.GafferEventType, instance rpc.GafferServiceInstance, data []byte) {
+	this.Emit(NewEventWithInstanceData(this, t, instance, data))
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // BACKGROUND TASKS
 
@@ -513,8 +1331,29 @@ func (this *gaffer) InstanceTaskHandler(evt rpc.GafferEvent) error {
 			return gopi.ErrBadParameter
 		} else if instance_, ok := instance.(*ServiceInstance); ok == false {
 			return gopi.ErrBadParameter
-		} else if err := this.Instances.Start(instance_, this.evt); err != nil {
+		} else {
+			// Start the instance in the background, as starting the instance
+			// sends events which are emitted to this task
+			go func() {
+				if err := this.Instances.Start(instance_, this.evt); err != nil {
+					this.log.Error("InstanceTask: %v: %v", evt, err)
+				}
+			}()
+		}
+	case rpc.GAFFER_EVENT_INSTANCE_STOP_ERROR:
+		// Create a crash report when an instance exits abnormally
+		if instance := evt.Instance(); instance == nil {
+			return gopi.ErrBadParameter
+		} else if instance_, ok := instance.(*ServiceInstance); ok == false {
+			return gopi.ErrBadParameter
+		} else if instance_.process == nil || instance_.process.Crashed() == false {
+			return nil
+		} else if report := NewCrashReport(instance_); report == nil {
+			return gopi.ErrAppError
+		} else if err := this.crashes.Add(report); err != nil {
 			return err
+		} else {
+			this.log.Warn("Instance %v of %v crashed: %v", instance_.Id_, strconv.Quote(instance_.Service_.Name_), report)
 		}
 	}
 	// Return success
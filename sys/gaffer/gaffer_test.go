@@ -1,10 +1,19 @@
 package gaffer_test
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strconv"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	// Frameworks
 	gopi "github.com/djthorpe/gopi"
@@ -258,6 +267,1127 @@ func Test_Gaffer_Groups_013(t *testing.T) {
 	}
 }
 
+func Test_Gaffer_Signal_014(t *testing.T) {
+	if gaffer, err := NewGafferForPath("/bin"); err != nil {
+		t.Fatalf("Test_Gaffer_014: %v", err)
+	} else {
+		defer gaffer.Close()
+
+		if _, err := gaffer.SignalInstanceForId(0, syscall.SIGHUP, false); err != gopi.ErrBadParameter {
+			t.Errorf("Expected ErrBadParameter, got %v", err)
+		} else if _, err := gaffer.SignalInstanceForId(1, syscall.SIGHUP, false); err != gopi.ErrNotFound {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		} else if _, err := gaffer.SignalInstancesForServiceName("test", syscall.SIGHUP, false); err != gopi.ErrNotFound {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		} else if _, err := gaffer.AddGroupForName("test"); err != nil {
+			t.Errorf("AddGroupForName: %v", err)
+		} else if instances, err := gaffer.SignalInstancesForGroupName("test", syscall.SIGHUP, true); err != nil {
+			t.Errorf("SignalInstancesForGroupName: %v", err)
+		} else if len(instances) != 0 {
+			t.Error("Expected len(instances) == 0")
+		}
+	}
+}
+
+func Test_Gaffer_Scale_015(t *testing.T) {
+	if gaffer, err := NewGafferForPath("/bin"); err != nil {
+		t.Fatalf("Test_Gaffer_015: %v", err)
+	} else {
+		defer gaffer.Close()
+
+		if err := gaffer.ScaleServiceForName("", 1, nil); err != gopi.ErrBadParameter {
+			t.Errorf("Expected ErrBadParameter, got %v", err)
+		} else if err := gaffer.ScaleServiceForName("test", 1, nil); err != gopi.ErrNotFound {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		} else if err := gaffer.RestartServiceForName("test", 0, nil); err != gopi.ErrNotFound {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		} else if service, err := gaffer.AddServiceForPath("ls"); err != nil {
+			t.Errorf("AddServiceForPath: %v", err)
+		} else if err := gaffer.ScaleServiceForName(service.Name(), 0, nil); err != nil {
+			t.Errorf("ScaleServiceForName: %v", err)
+		} else if count := gaffer.GetServiceForName(service.Name()).InstanceCount(); count != 0 {
+			t.Errorf("Expected instance count 0, got %v", count)
+		} else if err := gaffer.RestartServiceForName(service.Name(), 0, nil); err != nil {
+			t.Errorf("RestartServiceForName: %v", err)
+		}
+
+		// The instance count is restored when an instance cannot be started
+		if service, err := gaffer.AddServiceForPath("sh"); err != nil {
+			t.Errorf("AddServiceForPath: %v", err)
+		} else if err := gaffer.SetServiceHooksForName(service.Name(), []rpc.GafferHook{
+			rpc.GafferHook{Stage: rpc.GAFFER_HOOK_PRE_START, Command: "exit 3"},
+		}); err != nil {
+			t.Errorf("SetServiceHooksForName: %v", err)
+		} else if count := gaffer.GetServiceForName(service.Name()).InstanceCount(); count != 1 {
+			t.Errorf("Expected instance count 1, got %v", count)
+		} else if err := gaffer.ScaleServiceForName(service.Name(), 3, nil); err == nil {
+			t.Error("Expected error when scaling up")
+		} else if count := gaffer.GetServiceForName(service.Name()).InstanceCount(); count != 1 {
+			t.Errorf("Expected instance count 1, got %v", count)
+		}
+	}
+}
+
+func Test_Gaffer_Upload_016(t *testing.T) {
+	if gaffer, err := NewGafferForPath("/nonexistent"); err != nil {
+		t.Fatalf("Test_Gaffer_016: %v", err)
+	} else {
+		defer gaffer.Close()
+
+		// Upload the test binary, which is an ELF binary for this host
+		exec, err := os.Executable()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(exec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash := sha256.Sum256(data)
+		checksum := hex.EncodeToString(hash[:])
+
+		for _, path := range []string{"../test", "a/../../test", ".versions/test", "/test", "a//test"} {
+			if _, err := gaffer.UploadExecutable(path, bytes.NewReader(data), checksum); err == nil {
+				t.Errorf("Expected error for path %v", strconv.Quote(path))
+			}
+		}
+		if _, err := gaffer.UploadExecutable("test", bytes.NewReader(data), "00"); err == nil {
+			t.Error("Expected checksum error")
+		} else if _, err := gaffer.UploadExecutable("test", strings.NewReader("#!/bin/sh"), "3af71adb278ad4af33c144b78fa1ae708da03b773d98324ae991a7daedb53ca2"); err == nil || strings.Contains(err.Error(), "ELF") == false {
+			t.Error("Expected error for non-ELF file", err)
+		} else if _, err := gaffer.RollbackExecutable("test", ""); err == nil {
+			t.Error("Expected error for rollback without previous versions")
+		} else if executable, err := gaffer.UploadExecutable("bin/test", bytes.NewReader(data), checksum); err != nil {
+			t.Error(err)
+		} else if executable.Checksum() != checksum {
+			t.Error("Unexpected checksum", executable.Checksum())
+		} else if executable.Arch() != runtime.GOARCH || executable.IsGopi() == false {
+			t.Error("Unexpected arch or gopi flag", executable)
+		} else if len(executable.Services()) != 0 {
+			t.Error("Unexpected services", executable.Services())
+		} else if service, err := gaffer.AddServiceForPath("bin/test"); err != nil {
+			t.Error(err)
+		} else if executable, err := gaffer.GetExecutableForPath("bin/test"); err != nil {
+			t.Error(err)
+		} else if services := executable.Services(); len(services) != 1 || services[0] != service.Name() {
+			t.Error("Unexpected services", services)
+		} else if executables := gaffer.GetExecutables(true); len(executables) != 1 || executables[0] != "bin/test" {
+			t.Error("Unexpected executables", executables)
+		}
+
+		// Upload a second version, and then restore each version where
+		// the executable which is replaced is kept
+		data2 := append(append([]byte{}, data...), 0)
+		hash2 := sha256.Sum256(data2)
+		checksum2 := hex.EncodeToString(hash2[:])
+		if _, err := gaffer.UploadExecutable("bin/test", bytes.NewReader(data2), checksum2); err != nil {
+			t.Error(err)
+		} else if executable, err := gaffer.RollbackExecutable("bin/test", ""); err != nil {
+			t.Error(err)
+		} else if executable.Checksum() != checksum {
+			t.Error("Unexpected checksum", executable.Checksum())
+		} else if executable, err := gaffer.RollbackExecutable("bin/test", checksum2); err != nil {
+			t.Error(err)
+		} else if executable.Checksum() != checksum2 {
+			t.Error("Unexpected checksum", executable.Checksum())
+		} else if executable, err := gaffer.RollbackExecutable("bin/test", strings.ToUpper(checksum)); err != nil {
+			t.Error(err)
+		} else if executable.Checksum() != checksum {
+			t.Error("Unexpected checksum", executable.Checksum())
+		} else if _, err := gaffer.RollbackExecutable("bin/test", "00"); err == nil {
+			t.Error("Expected error for rollback to unknown checksum")
+		}
+	}
+
+	// Uploads larger than the maximum size are rejected
+	folder, err := ioutil.TempDir("", TEST_FOLDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	if gaffer, err := NewGafferWithConfig(gaffer.Gaffer{BinRoot: folder, UploadSize: 1024}); err != nil {
+		t.Fatal(err)
+	} else {
+		defer gaffer.Close()
+		data := bytes.Repeat([]byte{0}, 1025)
+		hash := sha256.Sum256(data)
+		if _, err := gaffer.UploadExecutable("test", bytes.NewReader(data), hex.EncodeToString(hash[:])); err == nil || strings.Contains(err.Error(), "larger") == false {
+			t.Error("Expected error for large upload", err)
+		} else if _, err := os.Stat(filepath.Join(folder, "test")); os.IsNotExist(err) == false {
+			t.Error("Expected no executable", err)
+		}
+	}
+}
+
+func Test_Gaffer_Groups_017(t *testing.T) {
+	if gaffer, err := NewGafferForPath("/bin"); err != nil {
+		t.Fatalf("Test_Gaffer_017: %v", err)
+	} else {
+		defer gaffer.Close()
+
+		for _, name := range []string{"prod", "ssl", "logging"} {
+			if _, err := gaffer.AddGroupForName(name); err != nil {
+				t.Fatalf("AddGroupForName: %v", err)
+			}
+		}
+		var prod, ssl, logging rpc.Tuples
+		prod.SetStringForKey("name", "prod")
+		ssl.SetStringForKey("name", "ssl")
+		ssl.SetStringForKey("ssl", "")
+		logging.SetStringForKey("log", "${LOG}")
+		if err := gaffer.SetGroupFlagsForName("prod", prod); err != nil {
+			t.Error(err)
+		} else if err := gaffer.SetGroupFlagsForName("ssl", ssl); err != nil {
+			t.Error(err)
+		} else if err := gaffer.SetGroupFlagsForName("logging", logging); err != nil {
+			t.Error(err)
+		}
+
+		if err := gaffer.SetGroupGroupsForName("prod", []string{"missing"}); err != gopi.ErrNotFound {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		} else if err := gaffer.SetGroupGroupsForName("prod", []string{"ssl", "logging"}); err != nil {
+			t.Errorf("SetGroupGroupsForName: %v", err)
+		} else if err := gaffer.SetGroupGroupsForName("logging", []string{"prod"}); err == nil {
+			t.Error("Expected cycle error")
+		} else if err := gaffer.SetGroupGroupsForName("prod", []string{"prod"}); err == nil {
+			t.Error("Expected cycle error")
+		} else if err := gaffer.RemoveGroupForName("ssl"); err == nil {
+			t.Error("Expected error removing included group")
+		} else if groups := gaffer.ResolveGroupsForNames([]string{"prod"}); len(groups) != 3 {
+			t.Errorf("Expected three groups, got %v", groups)
+		} else if groups[0].Name() != "prod" || groups[1].Name() != "ssl" || groups[2].Name() != "logging" {
+			t.Errorf("Unexpected order, got %v", groups)
+		} else if service, err := gaffer.AddServiceForPath("ls"); err != nil {
+			t.Errorf("AddServiceForPath: %v", err)
+		} else if err := gaffer.SetServiceGroupsForName(service.Name(), []string{"prod"}); err != nil {
+			t.Errorf("SetServiceGroupsForName: %v", err)
+		} else if flags, _, err := gaffer.ResolveServiceForName(service.Name()); err != nil {
+			t.Errorf("ResolveServiceForName: %v", err)
+		} else if len(flags) != 3 {
+			t.Errorf("Expected three flags, got %v", flags)
+		} else if flags[0].Key() != "name" || flags[0].Value() != "prod" || flags[0].Origin() != "@prod" || len(flags[0].Overrides()) != 1 {
+			t.Errorf("Unexpected flag %v", flags[0])
+		} else if flags[1].Key() != "ssl" || flags[1].Origin() != "@ssl" {
+			t.Errorf("Unexpected flag %v", flags[1])
+		} else if flags[2].Key() != "log" || flags[2].Origin() != "@logging" || flags[2].Variables()[0].Origin() != "unresolved" {
+			t.Errorf("Unexpected flag %v", flags[2])
+		}
+	}
+}
+
+func Test_Gaffer_Labels_018(t *testing.T) {
+	if gaffer, err := NewGafferForPath("/bin"); err != nil {
+		t.Fatalf("Test_Gaffer_018: %v", err)
+	} else {
+		defer gaffer.Close()
+
+		var labels rpc.Tuples
+		labels.SetStringForKey("env", "prod")
+		selector, _ := rpc.ParseLabelSelector("env=prod")
+		if service, err := gaffer.AddServiceForPath("ls"); err != nil {
+			t.Errorf("AddServiceForPath: %v", err)
+		} else if err := gaffer.SetServiceLabelsForName(service.Name(), labels); err != nil {
+			t.Errorf("SetServiceLabelsForName: %v", err)
+		} else if err := gaffer.SetServiceLabelsForName(service.Name(), labels); err != gopi.ErrNotModified {
+			t.Errorf("Expected ErrNotModified, got %v", err)
+		} else if service := gaffer.GetServiceForName(service.Name()); selector.Matches(service.Labels()) == false {
+			t.Errorf("Expected labels to match, got %v", service.Labels())
+		} else if _, err := gaffer.SetInstanceLabelsForId(1, labels); err != gopi.ErrNotFound {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	}
+}
+
+func Test_Gaffer_Groups_019(t *testing.T) {
+	if gaffer, err := NewGafferForPath("/bin"); err != nil {
+		t.Fatalf("Test_Gaffer_019: %v", err)
+	} else {
+		defer gaffer.Close()
+
+		if _, err := gaffer.StartGroupForName("", false); err != gopi.ErrBadParameter {
+			t.Errorf("Expected ErrBadParameter, got %v", err)
+		} else if _, err := gaffer.StopGroupForName("test"); err != gopi.ErrNotFound {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		} else if _, err := gaffer.AddGroupForName("test"); err != nil {
+			t.Errorf("AddGroupForName: %v", err)
+		} else if _, err := gaffer.RestartGroupForName("test", 0, true); err == nil {
+			t.Error("Expected error for group without services")
+		} else if service, err := gaffer.AddServiceForPath("ls"); err != nil {
+			t.Errorf("AddServiceForPath: %v", err)
+		} else if err := gaffer.SetServiceGroupsForName(service.Name(), []string{"test"}); err != nil {
+			t.Errorf("SetServiceGroupsForName: %v", err)
+		} else if err := gaffer.SetServiceInstanceCountForName(service.Name(), 0); err != nil {
+			t.Errorf("SetServiceInstanceCountForName: %v", err)
+		} else if results, err := gaffer.StartGroupForName("test", true); err != nil {
+			t.Errorf("StartGroupForName: %v", err)
+		} else if len(results) != 1 || results[0].Error() != nil || len(results[0].Instances()) != 0 {
+			t.Errorf("Unexpected results: %v", results)
+		} else if results, err := gaffer.StopGroupForName("test"); err != nil {
+			t.Errorf("StopGroupForName: %v", err)
+		} else if len(results) != 1 || results[0].Service().Name() != service.Name() {
+			t.Errorf("Unexpected results: %v", results)
+		}
+	}
+}
+
+func Test_Gaffer_Patch_020(t *testing.T) {
+	if gaffer, err := NewGafferForPath("/bin"); err != nil {
+		t.Fatalf("Test_Gaffer_020: %v", err)
+	} else {
+		defer gaffer.Close()
+
+		set := []rpc.GafferTuplesPatch{
+			rpc.GafferTuplesPatch{Op: rpc.GAFFER_TUPLES_SET, Key: "HOME", Value: "/tmp"},
+			rpc.GafferTuplesPatch{Op: rpc.GAFFER_TUPLES_SET, Key: "USER", Value: "gaffer"},
+		}
+		unset := []rpc.GafferTuplesPatch{
+			rpc.GafferTuplesPatch{Op: rpc.GAFFER_TUPLES_UNSET, Key: "HOME"},
+		}
+		if err := gaffer.PatchGroupEnvForName("test", 0, set); err != gopi.ErrNotFound {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		} else if group, err := gaffer.AddGroupForName("test"); err != nil {
+			t.Errorf("AddGroupForName: %v", err)
+		} else if group.Version() != 0 {
+			t.Errorf("Expected version 0, got %v", group.Version())
+		} else if err := gaffer.PatchGroupEnvForName("test", 0, set); err != nil {
+			t.Errorf("PatchGroupEnvForName: %v", err)
+		} else if err := gaffer.PatchGroupEnvForName("test", 2, unset); err == nil {
+			t.Error("Expected version mismatch")
+		} else if err := gaffer.PatchGroupEnvForName("test", 1, unset); err != nil {
+			t.Errorf("PatchGroupEnvForName: %v", err)
+		} else if groups := gaffer.GetGroupsForNames([]string{"test"}); len(groups) != 1 {
+			t.Error("Expected one group")
+		} else if env := groups[0].Env(); env.Len() != 1 || env.StringForKey("USER") != "gaffer" {
+			t.Errorf("Unexpected env: %v", env)
+		} else if groups[0].Version() != 2 {
+			t.Errorf("Expected version 2, got %v", groups[0].Version())
+		}
+	}
+}
+
+func Test_Gaffer_Secrets_021(t *testing.T) {
+	folder, err := ioutil.TempDir("", TEST_FOLDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	key := filepath.Join(folder, "key")
+	if err := ioutil.WriteFile(key, []byte("test key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Set a secret value in the environment
+	config := gaffer.Gaffer{
+		Path:           folder,
+		BinRoot:        "/bin",
+		SecretPatterns: []string{"*token*"},
+		KeyPath:        key,
+	}
+	var env rpc.Tuples
+	env.SetStringForKey("API_TOKEN", "abc123")
+	env.SetStringForKey("USER", "gaffer")
+	if gaffer_, err := NewGafferWithConfig(config); err != nil {
+		t.Fatal(err)
+	} else if _, err := gaffer_.AddGroupForName("test"); err != nil {
+		t.Error(err)
+	} else if err := gaffer_.SetGroupEnvForName("test", env); err != nil {
+		t.Error(err)
+	} else if group := gaffer_.GetGroupsForNames([]string{"test"})[0]; redacted(group.Env(), "API_TOKEN") == false {
+		t.Errorf("Expected redacted value, got %v", group.Env())
+	} else if strings.Contains(fmt.Sprint(group), "abc123") {
+		t.Errorf("Expected redacted value in %v", group)
+	} else if err := gaffer_.SetGroupEnvForName("test", group.Env()); err != gopi.ErrNotModified {
+		t.Errorf("Expected ErrNotModified when setting redacted values, got %v", err)
+	} else if err := gaffer_.SetGroupSecretsForName("test", []string{"USER"}); err != nil {
+		t.Error(err)
+	} else if err := gaffer_.Close(); err != nil {
+		t.Error(err)
+	}
+
+	// Secret values are not written to the configuration file, and the
+	// secrets file is encrypted
+	if data, err := ioutil.ReadFile(filepath.Join(folder, "gaffer.json")); err != nil {
+		t.Error(err)
+	} else if bytes.Contains(data, []byte("abc123")) || bytes.Contains(data, []byte("gaffer\"")) {
+		t.Errorf("Secret values in configuration: %v", string(data))
+	} else if data, err := ioutil.ReadFile(filepath.Join(folder, "gaffer.secrets")); err != nil {
+		t.Error(err)
+	} else if bytes.Contains(data, []byte("abc123")) {
+		t.Error("Expected encrypted secrets")
+	}
+
+	// Secret values are restored when the configuration is read
+	if gaffer_, err := NewGafferWithConfig(config); err != nil {
+		t.Error(err)
+	} else if group, ok := gaffer_.GetGroupsForNames([]string{"test"})[0].(*gaffer.ServiceGroup); ok == false {
+		t.Error("Expected *gaffer.ServiceGroup")
+	} else if group.Env_.StringForKey("API_TOKEN") != "abc123" || group.Env_.StringForKey("USER") != "gaffer" {
+		t.Errorf("Unexpected environment: %v", group.Env_.Keys())
+	} else if err := gaffer_.Close(); err != nil {
+		t.Error(err)
+	}
+
+	// The key is required to read the secrets
+	config.KeyPath = ""
+	if _, err := NewGafferWithConfig(config); err == nil {
+		t.Error("Expected error without key")
+	}
+}
+
+func Test_Gaffer_Dirs_022(t *testing.T) {
+	folder, err := ioutil.TempDir("", TEST_FOLDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	gaffer_, err := NewGafferWithConfig(gaffer.Gaffer{
+		Path:    folder,
+		BinRoot: "/bin",
+		RunRoot: filepath.Join(folder, "run"),
+		DirMode: 0700,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gaffer_.Close()
+
+	// Receive stop events for instances
+	events, stopped, done := gaffer_.Subscribe(), make(chan rpc.GafferEvent, 1), make(chan struct{})
+	defer gaffer_.Unsubscribe(events)
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case evt := <-events:
+				if evt_, ok := evt.(rpc.GafferEvent); ok && (evt_.Type() == rpc.GAFFER_EVENT_INSTANCE_STOP_OK || evt_.Type() == rpc.GAFFER_EVENT_INSTANCE_STOP_ERROR) {
+					stopped <- evt_
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// The instance writes a file into the data directory and checks
+	// the run directory exists
+	service, err := gaffer_.AddServiceForPath("sh")
+	if err != nil {
+		t.Fatal(err)
+	} else if err := gaffer_.SetServiceArgsForName(service.Name(), rpc.GAFFER_FLAG_STYLE_SINGLE_DASH, []string{"-c", "touch ${service.datadir}/data && test -d ${instance.rundir}"}); err != nil {
+		t.Fatal(err)
+	}
+	instance, err := gaffer_.StartInstanceForServiceName(service.Name(), gaffer_.GenerateInstanceId())
+	if err != nil {
+		t.Fatal(err)
+	} else if strings.HasPrefix(instance.RunDir(), filepath.Join(folder, "run", service.Name())) == false {
+		t.Errorf("Unexpected run directory: %v", instance.RunDir())
+	} else if stat, err := os.Stat(instance.RunDir()); err != nil {
+		t.Error(err)
+	} else if stat.Mode().Perm() != 0700 {
+		t.Errorf("Unexpected permissions: %v", stat.Mode())
+	}
+
+	// Wait for the instance to stop
+	select {
+	case evt := <-stopped:
+		if evt.Type() == rpc.GAFFER_EVENT_INSTANCE_STOP_ERROR {
+			t.Fatalf("Instance stopped with error: %v", string(evt.Data()))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for instance to stop")
+	}
+
+	// The run directory is removed and the data directory is retained
+	if _, err := os.Stat(instance.RunDir()); os.IsNotExist(err) == false {
+		t.Errorf("Expected run directory to be removed: %v", instance.RunDir())
+	} else if data, err := gaffer_.GetServiceDataForName(service.Name()); err != nil {
+		t.Error(err)
+	} else if data.Path() != filepath.Join(folder, gaffer.DATA_FOLDER, service.Name()) || data.Files() != 1 {
+		t.Errorf("Unexpected service data: %v", data)
+	} else if data, err := gaffer_.WipeServiceDataForName(service.Name()); err != nil {
+		t.Error(err)
+	} else if data.Files() != 0 {
+		t.Errorf("Unexpected service data: %v", data)
+	} else if _, err := os.Stat(data.Path()); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Gaffer_Journal_023(t *testing.T) {
+	folder, err := ioutil.TempDir("", TEST_FOLDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	gaffer_, err := NewGafferWithConfig(gaffer.Gaffer{Path: folder, BinRoot: "/bin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var labels rpc.Tuples
+	labels.SetStringForKey("env", "prod")
+	if _, err := gaffer_.AddGroupForName("a"); err != nil {
+		t.Fatal(err)
+	} else if service, err := gaffer_.AddServiceForPath("sh"); err != nil {
+		t.Fatal(err)
+	} else if err := gaffer_.SetServiceGroupsForName(service.Name(), []string{"a"}); err != nil {
+		t.Fatal(err)
+	} else if err := gaffer_.SetServiceLabelsForName(service.Name(), labels); err != nil {
+		t.Fatal(err)
+	}
+
+	// Query by type, group and service
+	if events, err := gaffer_.QueryEvents(rpc.GafferEventQuery{Types: []rpc.GafferEventType{rpc.GAFFER_EVENT_GROUP_ADD}}); err != nil {
+		t.Fatal(err)
+	} else if len(events) != 1 || events[0].Group().Name() != "a" || events[0].Seq() == 0 || events[0].Timestamp().IsZero() {
+		t.Errorf("Unexpected events: %v", events)
+	}
+	if events, err := gaffer_.QueryEvents(rpc.GafferEventQuery{Group: "a"}); err != nil {
+		t.Fatal(err)
+	} else if len(events) != 2 || events[1].Type() != rpc.GAFFER_EVENT_SERVICE_CHANGE || events[1].Service().Name() != "sh" {
+		t.Errorf("Unexpected events: %v", events)
+	}
+	if events, err := gaffer_.QueryEvents(rpc.GafferEventQuery{Service: "s*", Limit: 1}); err != nil {
+		t.Fatal(err)
+	} else if len(events) != 1 || events[0].Type() != rpc.GAFFER_EVENT_SERVICE_CHANGE {
+		t.Errorf("Unexpected events: %v", events)
+	}
+	if events, err := gaffer_.QueryEvents(rpc.GafferEventQuery{End: time.Now().Add(-time.Hour)}); err != nil {
+		t.Fatal(err)
+	} else if len(events) != 0 {
+		t.Errorf("Unexpected events: %v", events)
+	}
+	if err := gaffer_.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The sequence continues when the journal is opened again, and the
+	// oldest events are removed when the journal is too large
+	gaffer_, err = NewGafferWithConfig(gaffer.Gaffer{Path: folder, BinRoot: "/bin", JournalSize: 512})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gaffer_.Close()
+	for i := 0; i < 10; i++ {
+		if _, err := gaffer_.AddGroupForName(fmt.Sprint("b", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if waitForJournal(filepath.Join(folder, "gaffer"+gaffer.JOURNAL_EXT), 512) == false {
+		t.Error("Timeout waiting for events to be removed")
+	}
+	if events, err := gaffer_.QueryEvents(rpc.GafferEventQuery{}); err != nil {
+		t.Fatal(err)
+	} else if len(events) == 0 || len(events) >= 13 {
+		t.Errorf("Expected events to be removed: %v", events)
+	} else if last := events[len(events)-1]; last.Seq() != 13 || last.Group().Name() != "b9" {
+		t.Errorf("Unexpected event: %v", last)
+	} else if stat, err := os.Stat(filepath.Join(folder, "gaffer"+gaffer.JOURNAL_EXT)); err != nil {
+		t.Error(err)
+	} else if stat.Size() > 512 {
+		t.Errorf("Unexpected journal size: %v", stat.Size())
+	}
+}
+
+func Test_Gaffer_Journal_024(t *testing.T) {
+	folder, err := ioutil.TempDir("", TEST_FOLDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	gaffer_, err := NewGafferWithConfig(gaffer.Gaffer{Path: folder, BinRoot: "/bin", JournalSize: 512})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gaffer_.Close()
+	for i := 0; i < 3; i++ {
+		if _, err := gaffer_.AddGroupForName(fmt.Sprint("a", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Resume after a sequence number
+	if events, err := gaffer_.QueryEvents(rpc.GafferEventQuery{After: 1}); err != nil {
+		t.Fatal(err)
+	} else if len(events) != 2 || events[0].Seq() != 2 || events[1].Seq() != 3 {
+		t.Errorf("Unexpected events: %v", events)
+	} else if events, err := gaffer_.QueryEvents(rpc.GafferEventQuery{After: 3}); err != nil {
+		t.Fatal(err)
+	} else if len(events) != 0 {
+		t.Errorf("Unexpected events: %v", events)
+	}
+
+	// Resuming fails when events have been removed from the journal
+	for i := 0; i < 10; i++ {
+		if _, err := gaffer_.AddGroupForName(fmt.Sprint("b", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if waitForJournal(filepath.Join(folder, "gaffer"+gaffer.JOURNAL_EXT), 512) == false {
+		t.Error("Timeout waiting for events to be removed")
+	}
+	if _, err := gaffer_.QueryEvents(rpc.GafferEventQuery{After: 1}); err == nil {
+		t.Error("Expected error when events have been removed")
+	} else if events, err := gaffer_.QueryEvents(rpc.GafferEventQuery{After: 12}); err != nil {
+		t.Error(err)
+	} else if len(events) != 1 || events[0].Group().Name() != "b9" {
+		t.Errorf("Unexpected events: %v", events)
+	}
+}
+
+func Test_Gaffer_Crash_025(t *testing.T) {
+	folder, err := ioutil.TempDir("", TEST_FOLDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	gaffer_, err := NewGafferWithConfig(gaffer.Gaffer{Path: folder, BinRoot: "/bin", CrashLines: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gaffer_.Close()
+
+	// Receive stop events for instances
+	events, stopped, done := gaffer_.Subscribe(), make(chan rpc.GafferEvent, 1), make(chan struct{})
+	defer gaffer_.Unsubscribe(events)
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case evt := <-events:
+				if evt_, ok := evt.(rpc.GafferEvent); ok && (evt_.Type() == rpc.GAFFER_EVENT_INSTANCE_STOP_OK || evt_.Type() == rpc.GAFFER_EVENT_INSTANCE_STOP_ERROR) {
+					stopped <- evt_
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// The instance exits with an error, and then is terminated by a signal
+	service, err := gaffer_.AddServiceForPath("sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, script := range []string{"echo a; echo b; echo c; echo d >&2; exit 3", "kill -TERM 0"} {
+		if err := gaffer_.SetServiceArgsForName(service.Name(), rpc.GAFFER_FLAG_STYLE_SINGLE_DASH, []string{"-c", script}); err != nil {
+			t.Fatal(err)
+		} else if _, err := gaffer_.StartInstanceForServiceName(service.Name(), gaffer_.GenerateInstanceId()); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case evt := <-stopped:
+			if evt.Type() != rpc.GAFFER_EVENT_INSTANCE_STOP_ERROR {
+				t.Fatalf("Unexpected event: %v", evt)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for instance to stop")
+		}
+	}
+
+	// Reports are created in the background, most recent first
+	var reports []rpc.GafferCrashReport
+	for i := 0; i < 50 && len(reports) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+		if reports, err = gaffer_.ListCrashReports(""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(reports) != 2 {
+		t.Fatalf("Unexpected reports: %v", reports)
+	} else if reports[0].Signal() != "TERM" || reports[0].Id() != 2 {
+		t.Errorf("Unexpected report: %v", reports[0])
+	} else if reports[1].ExitCode() != 3 || reports[1].Signal() != "" || reports[1].Service() != service.Name() {
+		t.Errorf("Unexpected report: %v", reports[1])
+	} else if stdout := reports[1].Stdout(); len(stdout) != 2 || stdout[0] != "b" || stdout[1] != "c" {
+		t.Errorf("Unexpected stdout: %q", stdout)
+	} else if stderr := reports[1].Stderr(); len(stderr) != 1 || stderr[0] != "d" {
+		t.Errorf("Unexpected stderr: %q", stderr)
+	} else if _, err := os.Stat(filepath.Join(folder, gaffer.CRASH_FOLDER, "1"+gaffer.CRASH_EXT)); err != nil {
+		t.Error(err)
+	}
+
+	// Return a report by identifier
+	if report, err := gaffer_.GetCrashReportForId(1); err != nil {
+		t.Error(err)
+	} else if report.ExitCode() != 3 {
+		t.Errorf("Unexpected report: %v", report)
+	} else if _, err := gaffer_.GetCrashReportForId(3); err != gopi.ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	} else if reports, err := gaffer_.ListCrashReports("other"); err != nil {
+		t.Error(err)
+	} else if len(reports) != 0 {
+		t.Errorf("Unexpected reports: %v", reports)
+	}
+}
+
+func Test_Gaffer_Hooks_026(t *testing.T) {
+	folder, err := ioutil.TempDir("", TEST_FOLDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	gaffer_, err := NewGafferWithConfig(gaffer.Gaffer{Path: folder, BinRoot: "/bin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gaffer_.Close()
+
+	// Receive instance and hook events
+	events, received, done := gaffer_.Subscribe(), make(chan rpc.GafferEvent, 10), make(chan struct{})
+	defer gaffer_.Unsubscribe(events)
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case evt := <-events:
+				if evt_, ok := evt.(rpc.GafferEvent); ok && evt_.Instance() != nil && evt_.Type() != rpc.GAFFER_EVENT_INSTANCE_ADD {
+					received <- evt_
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	// Return events for an instance until it stops or a hook fails
+	wait := func() []string {
+		types := make([]string, 0)
+		for {
+			select {
+			case evt := <-received:
+				types = append(types, strings.TrimPrefix(fmt.Sprint(evt.Type()), "GAFFER_EVENT_"))
+				switch evt.Type() {
+				case rpc.GAFFER_EVENT_HOOK_STDOUT, rpc.GAFFER_EVENT_HOOK_STDERR, rpc.GAFFER_EVENT_HOOK_ERROR:
+					types = append(types, strings.TrimSpace(string(evt.Data())))
+				}
+				if evt.Type() == rpc.GAFFER_EVENT_HOOK_ERROR || evt.Type() == rpc.GAFFER_EVENT_INSTANCE_STOP_OK || evt.Type() == rpc.GAFFER_EVENT_INSTANCE_STOP_ERROR {
+					return types
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Timeout waiting for instance")
+			}
+		}
+	}
+
+	// Group hooks run before service hooks, with the instance environment
+	var env rpc.Tuples
+	env.SetStringForKey("FOO", "bar")
+	service, err := gaffer_.AddServiceForPath("sh")
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := gaffer_.AddGroupForName("hooks"); err != nil {
+		t.Fatal(err)
+	} else if err := gaffer_.SetServiceGroupsForName(service.Name(), []string{"hooks"}); err != nil {
+		t.Fatal(err)
+	} else if err := gaffer_.SetGroupEnvForName("hooks", env); err != nil {
+		t.Fatal(err)
+	} else if err := gaffer_.SetServiceArgsForName(service.Name(), rpc.GAFFER_FLAG_STYLE_SINGLE_DASH, []string{"-c", "true"}); err != nil {
+		t.Fatal(err)
+	} else if err := gaffer_.SetGroupHooksForName("hooks", []rpc.GafferHook{
+		rpc.GafferHook{Stage: rpc.GAFFER_HOOK_PRE_START, Command: "echo $FOO $GAFFER_HOOK"},
+	}); err != nil {
+		t.Fatal(err)
+	} else if err := gaffer_.SetServiceHooksForName(service.Name(), []rpc.GafferHook{
+		rpc.GafferHook{Stage: rpc.GAFFER_HOOK_PRE_START, Command: "echo service"},
+		rpc.GafferHook{Stage: rpc.GAFFER_HOOK_POST_STOP, Command: "echo stopped >&2"},
+	}); err != nil {
+		t.Fatal(err)
+	} else if hooks := gaffer_.GetServiceForName(service.Name()).Hooks(); len(hooks) != 2 {
+		t.Fatalf("Unexpected hooks: %v", hooks)
+	}
+	if _, err := gaffer_.StartInstanceForServiceName(service.Name(), gaffer_.GenerateInstanceId()); err != nil {
+		t.Fatal(err)
+	} else if types := strings.Join(wait(), ","); types != "HOOK_STDOUT,bar pre-start,HOOK_STDOUT,service,INSTANCE_RUN,HOOK_STDERR,stopped,INSTANCE_STOP_OK" {
+		t.Errorf("Unexpected events: %v", types)
+	}
+
+	// A pre-start hook which is killed after the timeout aborts the start
+	if err := gaffer_.SetServiceHooksForName(service.Name(), []rpc.GafferHook{
+		rpc.GafferHook{Stage: rpc.GAFFER_HOOK_PRE_START, Command: "sleep 10", Timeout: 100 * time.Millisecond},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if instance, err := gaffer_.StartInstanceForServiceName(service.Name(), gaffer_.GenerateInstanceId()); err != nil {
+		t.Fatal(err)
+	} else if types := wait(); len(types) != 4 || types[2] != "HOOK_ERROR" || strings.Contains(types[3], "Killed after 100ms") == false {
+		t.Errorf("Unexpected events: %q", types)
+	} else if instance.Start().IsZero() == false || instance.Stop().IsZero() {
+		t.Errorf("Unexpected instance: %v", instance)
+	}
+
+	// A pre-start hook which fails removes the instance and its run directory
+	if err := gaffer_.SetServiceHooksForName(service.Name(), []rpc.GafferHook{
+		rpc.GafferHook{Stage: rpc.GAFFER_HOOK_PRE_START, Command: "exit 3"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if instance, err := gaffer_.StartInstanceForServiceName(service.Name(), gaffer_.GenerateInstanceId()); err != nil {
+		t.Fatal(err)
+	} else if types := wait(); len(types) != 4 || types[2] != "HOOK_ERROR" || strings.Contains(types[3], "exit status 3") == false {
+		t.Errorf("Unexpected events: %q", types)
+	} else if instance.Start().IsZero() == false || instance.Stop().IsZero() {
+		t.Errorf("Unexpected instance: %v", instance)
+	} else if gaffer_.GetInstanceForId(instance.Id()) != nil {
+		t.Errorf("Expected instance %v to be removed", instance.Id())
+	} else if _, err := os.Stat(instance.RunDir()); instance.RunDir() == "" || os.IsNotExist(err) == false {
+		t.Errorf("Expected run directory %q to be removed", instance.RunDir())
+	}
+
+	// Hooks need a stage and a command
+	if err := gaffer_.SetServiceHooksForName(service.Name(), []rpc.GafferHook{rpc.GafferHook{Command: "true"}}); err == nil {
+		t.Error("Expected error for hook without stage")
+	} else if err := gaffer_.SetServiceHooksForName(service.Name(), []rpc.GafferHook{rpc.GafferHook{Stage: rpc.GAFFER_HOOK_PRE_STOP}}); err == nil {
+		t.Error("Expected error for hook without command")
+	}
+}
+
+func Test_Gaffer_Metrics_027(t *testing.T) {
+	folder, err := ioutil.TempDir("", TEST_FOLDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	gaffer_, err := NewGafferWithConfig(gaffer.Gaffer{Path: folder, BinRoot: "/bin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gaffer_.Close()
+
+	// Receive run and stop events for instances
+	events, changed, done := gaffer_.Subscribe(), make(chan rpc.GafferEvent, 1), make(chan struct{})
+	defer gaffer_.Unsubscribe(events)
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case evt := <-events:
+				if evt_, ok := evt.(rpc.GafferEvent); ok && (evt_.Type() == rpc.GAFFER_EVENT_INSTANCE_RUN || evt_.Type() == rpc.GAFFER_EVENT_INSTANCE_STOP_ERROR) {
+					changed <- evt_
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// The first instance exits with an error, and the second is running
+	service, err := gaffer_.AddServiceForPath("sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var instance rpc.GafferServiceInstance
+	for _, script := range []string{"exit 3", "exec sleep 10"} {
+		if err := gaffer_.SetServiceArgsForName(service.Name(), rpc.GAFFER_FLAG_STYLE_SINGLE_DASH, []string{"-c", script}); err != nil {
+			t.Fatal(err)
+		} else if instance, err = gaffer_.StartInstanceForServiceName(service.Name(), gaffer_.GenerateInstanceId()); err != nil {
+			t.Fatal(err)
+		}
+		for _, expected := range []rpc.GafferEventType{rpc.GAFFER_EVENT_INSTANCE_RUN, rpc.GAFFER_EVENT_INSTANCE_STOP_ERROR} {
+			if script == "exec sleep 10" && expected == rpc.GAFFER_EVENT_INSTANCE_STOP_ERROR {
+				break
+			}
+			select {
+			case evt := <-changed:
+				if evt.Type() != expected {
+					t.Fatalf("Unexpected event: %v", evt)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Timeout waiting for instance")
+			}
+		}
+	}
+
+	// Index the samples by name and labels
+	samples := make(map[string]float64)
+	for _, family := range gaffer_.(rpc.MetricsCollector).Metrics() {
+		for _, metric := range family.Metrics {
+			key := family.Name
+			for _, label := range metric.Labels {
+				key += " " + label.Name + "=" + label.Value
+			}
+			samples[key] = metric.Value
+		}
+	}
+	name := service.Name()
+	if samples["gaffer_instance_starts_total service="+name] != 2 {
+		t.Error("Unexpected starts:", samples)
+	} else if samples["gaffer_instance_restarts_total service="+name] != 1 {
+		t.Error("Unexpected restarts:", samples)
+	} else if samples["gaffer_instance_exits_total service="+name+" code=3"] != 1 {
+		t.Error("Unexpected exits:", samples)
+	} else if samples["gaffer_instances service="+name+" state=running"] != 1 || samples["gaffer_instances service="+name+" state=stopped"] != 1 {
+		t.Error("Unexpected instances:", samples)
+	} else if _, exists := samples["gaffer_instance_uptime_seconds service="+name+" instance="+fmt.Sprint(instance.Id())]; exists == false {
+		t.Error("Missing uptime:", samples)
+	}
+
+	// Stop the running instance and wait for it to stop
+	if err := gaffer_.StopInstanceForId(instance.Id()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for instance to stop")
+	}
+}
+
+func Test_Gaffer_Audit_028(t *testing.T) {
+	folder, err := ioutil.TempDir("", TEST_FOLDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	// Without a configuration path there is no audit log
+	if gaffer_, err := NewGafferForPath("/bin"); err != nil {
+		t.Fatal(err)
+	} else if _, err := gaffer_.QueryAudit(rpc.GafferAuditQuery{}); err == nil {
+		t.Error("Expected error without audit log")
+	} else if err := gaffer_.Close(); err != nil {
+		t.Error(err)
+	}
+
+	// Record calls, where secret values are redacted
+	gaffer_, err := NewGafferWithConfig(gaffer.Gaffer{Path: folder, BinRoot: "/bin", SecretPatterns: []string{"*password*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var params rpc.Tuples
+	params.SetStringForKey("name", "db")
+	params.SetStringForKey("tuples.DB_PASSWORD", "abc123")
+	params.SetStringForKey("tuples.DB_USER", "gaffer")
+	if err := gaffer_.AppendAudit("127.0.0.1:1000", "admin", "SetGroupEnv", params, nil); err != nil {
+		t.Fatal(err)
+	} else if err := gaffer_.AppendAudit("127.0.0.1:1001", "", "RemoveGroup", params, gopi.ErrNotFound); err != nil {
+		t.Fatal(err)
+	} else if err := gaffer_.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(folder, "gaffer"+gaffer.AUDIT_EXT)); err != nil {
+		t.Fatal(err)
+	} else if bytes.Contains(data, []byte("abc123")) {
+		t.Errorf("Secret values in audit log: %v", string(data))
+	}
+
+	// The sequence continues when the audit log is opened again
+	gaffer_, err = NewGafferWithConfig(gaffer.Gaffer{Path: folder, BinRoot: "/bin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gaffer_.Close()
+	if err := gaffer_.AppendAudit("127.0.0.1:1002", "operator", "StopInstance", rpc.Tuples{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Query by method, identity and name
+	if records, err := gaffer_.QueryAudit(rpc.GafferAuditQuery{}); err != nil {
+		t.Fatal(err)
+	} else if len(records) != 3 || records[2].Seq() != 3 || records[2].Method() != "StopInstance" {
+		t.Errorf("Unexpected records: %v", records)
+	}
+	if records, err := gaffer_.QueryAudit(rpc.GafferAuditQuery{Method: "Set*"}); err != nil {
+		t.Fatal(err)
+	} else if len(records) != 1 || records[0].Peer() != "127.0.0.1:1000" || records[0].Identity() != "admin" || records[0].Error() != "" {
+		t.Errorf("Unexpected records: %v", records)
+	} else if params := records[0].Params(); redacted(params, "tuples.DB_PASSWORD") == false || params.StringForKey("tuples.DB_USER") != "gaffer" {
+		t.Errorf("Unexpected params: %v", params)
+	}
+	if records, err := gaffer_.QueryAudit(rpc.GafferAuditQuery{Name: "d?", Limit: 1}); err != nil {
+		t.Fatal(err)
+	} else if len(records) != 1 || records[0].Method() != "RemoveGroup" || records[0].Error() != gopi.ErrNotFound.Error() {
+		t.Errorf("Unexpected records: %v", records)
+	}
+	if records, err := gaffer_.QueryAudit(rpc.GafferAuditQuery{Identity: "op*"}); err != nil {
+		t.Fatal(err)
+	} else if len(records) != 1 || records[0].Seq() != 3 {
+		t.Errorf("Unexpected records: %v", records)
+	}
+	if _, err := gaffer_.QueryAudit(rpc.GafferAuditQuery{Method: "["}); err == nil {
+		t.Error("Expected error for invalid pattern")
+	}
+}
+
+func Test_Gaffer_Upgrade_029(t *testing.T) {
+	folder, err := ioutil.TempDir("", TEST_FOLDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	root := filepath.Join(folder, "bin")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(filepath.Join(root, "a"), []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	gaffer_, err := NewGafferWithConfig(gaffer.Gaffer{Path: folder, BinRoot: root, DeltaWatch: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gaffer_.Close()
+	if _, err := gaffer_.AddServiceForPath("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Receive executable events until unsubscribed
+	events, received := gaffer_.Subscribe(), make(chan rpc.GafferEvent, 10)
+	defer gaffer_.Unsubscribe(events)
+	go func() {
+		for evt := range events {
+			if evt_, ok := evt.(rpc.GafferEvent); ok && evt_.Type() == rpc.GAFFER_EVENT_EXECUTABLE_CHANGE {
+				select {
+				case received <- evt_:
+				default:
+				}
+			}
+		}
+	}()
+	wait := func() rpc.GafferEvent {
+		select {
+		case evt := <-received:
+			return evt
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for event")
+			return nil
+		}
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	// A new executable which is not used by a service
+	if err := ioutil.WriteFile(filepath.Join(root, "b"), []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	} else if evt := wait(); evt.Service() != nil || filepath.Base(string(evt.Data())) != "b" {
+		t.Errorf("Unexpected event: %v", evt)
+	}
+
+	// A replaced executable which is used by a service
+	if err := ioutil.WriteFile(filepath.Join(root, "a"), []byte("#!/bin/sh\nexit 2\n"), 0755); err != nil {
+		t.Fatal(err)
+	} else if evt := wait(); evt.Service() == nil || evt.Service().Name() != "a" || filepath.Base(string(evt.Data())) != "a" {
+		t.Errorf("Unexpected event: %v", evt)
+	}
+}
+
+func Test_Gaffer_Secrets_030(t *testing.T) {
+	folder, err := ioutil.TempDir("", TEST_FOLDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	// Write the log to a file, so that the command line can be checked
+	path := filepath.Join(folder, "gaffer.log")
+	log, err := gopi.Open(logger.Config{Level: logger.LOG_DEBUG, Path: path}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	driver, err := gopi.Open(gaffer.Gaffer{Path: folder, BinRoot: "/bin", SecretPatterns: []string{"*password*"}}, log.(gopi.Logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gaffer_ := driver.(rpc.Gaffer)
+	defer gaffer_.Close()
+
+	// Receive stop events for instances
+	events, stopped, done := gaffer_.Subscribe(), make(chan rpc.GafferEvent, 1), make(chan struct{})
+	defer gaffer_.Unsubscribe(events)
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case evt := <-events:
+				if evt_, ok := evt.(rpc.GafferEvent); ok && (evt_.Type() == rpc.GAFFER_EVENT_INSTANCE_STOP_OK || evt_.Type() == rpc.GAFFER_EVENT_INSTANCE_STOP_ERROR) {
+					stopped <- evt_
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// Start an instance with a secret flag, and wait for it to stop
+	var flags rpc.Tuples
+	flags.SetStringForKey("password", "abc123")
+	flags.SetStringForKey("user", "gaffer")
+	if service, err := gaffer_.AddServiceForPath("sh"); err != nil {
+		t.Fatal(err)
+	} else if err := gaffer_.SetServiceFlagsForName(service.Name(), flags); err != nil {
+		t.Fatal(err)
+	} else if _, err := gaffer_.StartInstanceForServiceName(service.Name(), gaffer_.GenerateInstanceId()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-stopped:
+		break
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for instance to stop")
+	}
+
+	// The command line is logged with the secret value redacted
+	if data, err := ioutil.ReadFile(path); err != nil {
+		t.Fatal(err)
+	} else if bytes.Contains(data, []byte("abc123")) {
+		t.Errorf("Secret values in log: %v", string(data))
+	} else if bytes.Contains(data, []byte("-user=gaffer")) == false || bytes.Contains(data, []byte("-password="+rpc.TUPLES_REDACTED)) == false {
+		t.Errorf("Expected command line in log: %v", string(data))
+	}
+}
+
+func Test_Gaffer_Stop_031(t *testing.T) {
+	gaffer_, err := NewGafferForPath("/bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gaffer_.Close()
+
+	// Receive stop events for instances
+	events, stopped, done := gaffer_.Subscribe(), make(chan rpc.GafferEvent, 1), make(chan struct{})
+	defer gaffer_.Unsubscribe(events)
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case evt := <-events:
+				if evt_, ok := evt.(rpc.GafferEvent); ok && (evt_.Type() == rpc.GAFFER_EVENT_INSTANCE_STOP_OK || evt_.Type() == rpc.GAFFER_EVENT_INSTANCE_STOP_ERROR || evt_.Type() == rpc.GAFFER_EVENT_INSTANCE_STOP_KILLED) {
+					stopped <- evt_
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// The instance starts a child which keeps the output open, which is
+	// stopped together with the instance
+	service, err := gaffer_.AddServiceForPath("sh")
+	if err != nil {
+		t.Fatal(err)
+	} else if err := gaffer_.SetServiceArgsForName(service.Name(), rpc.GAFFER_FLAG_STYLE_SINGLE_DASH, []string{"-c", "sleep 30 & wait"}); err != nil {
+		t.Fatal(err)
+	}
+	instance, err := gaffer_.StartInstanceForServiceName(service.Name(), gaffer_.GenerateInstanceId())
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := gaffer_.StopInstanceForId(instance.Id()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-stopped:
+		break
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for instance to stop")
+	}
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 
 func NewGafferForPath(path string) (rpc.Gaffer, error) {
@@ -278,3 +1408,29 @@ func NewGafferForPath(path string) (rpc.Gaffer, error) {
 		return gaffer_.(rpc.Gaffer), nil
 	}
 }
+
+func NewGafferWithConfig(config gaffer.Gaffer) (rpc.Gaffer, error) {
+	if log, err := gopi.Open(logger.Config{Level: LOG_LEVEL}, nil); err != nil {
+		return nil, err
+	} else if gaffer_, err := gopi.Open(config, log.(gopi.Logger)); err != nil {
+		return nil, err
+	} else {
+		return gaffer_.(rpc.Gaffer), nil
+	}
+}
+
+// waitForJournal returns true when the journal is no larger than a size
+// within a second, as the oldest events are removed in the background
+func waitForJournal(path string, size int64) bool {
+	for i := 0; i < 20; i++ {
+		if stat, err := os.Stat(path); err == nil && stat.Size() <= size {
+			return true
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return false
+}
+
+func redacted(tuples rpc.Tuples, key string) bool {
+	return tuples.StringForKey(key) == rpc.TUPLES_REDACTED
+}
@@ -0,0 +1,198 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package gaffer
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// ServiceResult is the result of a group operation for one service
+type ServiceResult struct {
+	Service_   *Service
+	Instances_ []*ServiceInstance
+	Error_     error
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// GROUP OPERATIONS
+
+// StartGroupForName starts instances of every service in a group, in the
+// order the services were added, until the instance count of each service
+// is running. Services with an instance count of zero are skipped. When
+// all is true and a service fails to start, the instances started by the
+// operation are stopped again in reverse order
+func (this *gaffer) StartGroupForName(group string, all bool) ([]rpc.GafferServiceResult, error) {
+	this.log.Debug2("<gaffer>StartGroupForName{ group=%v all=%v }", strconv.Quote(group), all)
+
+	services, err := this.servicesForGroupOperation(group)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*ServiceResult, 0, len(services))
+	for _, service := range services {
+		result := &ServiceResult{Service_: service}
+		results = append(results, result)
+		if service.InstanceCount() == 0 {
+			continue
+		}
+		before := this.runningInstancesForService(service)
+		if uint(len(before)) < service.InstanceCount() {
+			result.Error_ = this.ScaleServiceForName(service.Name_, service.InstanceCount(), nil)
+		}
+		result.Instances_ = startedInstances(before, this.runningInstancesForService(service))
+		if result.Error_ != nil && all {
+			this.stopResults(results, fmt.Errorf("Stopped because %v failed to start", strconv.Quote(service.Name_)))
+			break
+		}
+	}
+
+	return serviceResults(results), nil
+}
+
+// StopGroupForName stops the running instances of every service in a group,
+// in the reverse order the services were added
+func (this *gaffer) StopGroupForName(group string) ([]rpc.GafferServiceResult, error) {
+	this.log.Debug2("<gaffer>StopGroupForName{ group=%v }", strconv.Quote(group))
+
+	services, err := this.servicesForGroupOperation(group)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*ServiceResult, len(services))
+	for i := len(services) - 1; i >= 0; i-- {
+		result := &ServiceResult{Service_: services[i]}
+		results[i] = result
+		for _, instance := range this.runningInstancesForService(services[i]) {
+			if err := this.stopInstance(instance, ROLLOUT_START_TIMEOUT); err != nil {
+				result.Error_ = err
+			} else {
+				result.Instances_ = append(result.Instances_, instance)
+			}
+		}
+	}
+
+	return serviceResults(results), nil
+}
+
+// RestartGroupForName performs a rolling restart of every service in a
+// group, in the order the services were added. When all is true, the
+// restart ends when a service fails to restart, and the remaining services
+// are not restarted
+func (this *gaffer) RestartGroupForName(group string, settle time.Duration, all bool) ([]rpc.GafferServiceResult, error) {
+	this.log.Debug2("<gaffer>RestartGroupForName{ group=%v settle=%v all=%v }", strconv.Quote(group), settle, all)
+
+	services, err := this.servicesForGroupOperation(group)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*ServiceResult, 0, len(services))
+	for _, service := range services {
+		result := &ServiceResult{Service_: service}
+		results = append(results, result)
+		before := this.runningInstancesForService(service)
+		result.Error_ = this.RestartServiceForName(service.Name_, settle, nil)
+		result.Instances_ = startedInstances(before, this.runningInstancesForService(service))
+		if result.Error_ != nil && all {
+			break
+		}
+	}
+
+	return serviceResults(results), nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// SERVICE RESULT IMPLEMENTATION
+
+func (this *ServiceResult) Service() rpc.GafferService {
+	return this.Service_
+}
+
+func (this *ServiceResult) Instances() []rpc.GafferServiceInstance {
+	instances := make([]rpc.GafferServiceInstance, len(this.Instances_))
+	for i, instance := range this.Instances_ {
+		instances[i] = instance
+	}
+	return instances
+}
+
+func (this *ServiceResult) Error() error {
+	return this.Error_
+}
+
+func (this *ServiceResult) String() string {
+	return fmt.Sprintf("<gaffer.ServiceResult>{ service=%v instances=%v error=%v }", strconv.Quote(this.Service_.Name_), this.Instances_, this.Error_)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// servicesForGroupOperation returns the services in a group, including
+// services in included groups, or an error if there are none
+func (this *gaffer) servicesForGroupOperation(group string) ([]*Service, error) {
+	if group == "" {
+		return nil, gopi.ErrBadParameter
+	} else if len(this.config.GetGroupsByName([]string{group})) == 0 {
+		return nil, gopi.ErrNotFound
+	} else if services := this.config.ServicesForGroupByName(group); len(services) == 0 {
+		return nil, fmt.Errorf("No services in group @%v", group)
+	} else {
+		return services, nil
+	}
+}
+
+// stopResults stops the instances which were started for each result in
+// reverse order, and sets the error for results which had succeeded
+func (this *gaffer) stopResults(results []*ServiceResult, reason error) {
+	for i := len(results) - 1; i >= 0; i-- {
+		result := results[i]
+		for _, instance := range result.Instances_ {
+			if err := this.stopInstance(instance, ROLLOUT_START_TIMEOUT); err != nil {
+				this.log.Warn("StartGroup: %v: %v", result.Service_.Name_, err)
+			}
+		}
+		if result.Error_ == nil && len(result.Instances_) > 0 {
+			result.Error_ = reason
+		}
+	}
+}
+
+// startedInstances returns the instances which are in after but not before
+func startedInstances(before, after []*ServiceInstance) []*ServiceInstance {
+	started := make([]*ServiceInstance, 0, len(after))
+FOR_LOOP:
+	for _, instance := range after {
+		for _, instance_ := range before {
+			if instance == instance_ {
+				continue FOR_LOOP
+			}
+		}
+		started = append(started, instance)
+	}
+	return started
+}
+
+func serviceResults(results []*ServiceResult) []rpc.GafferServiceResult {
+	results_ := make([]rpc.GafferServiceResult, len(results))
+	for i, result := range results {
+		results_[i] = result
+	}
+	return results_
+}
@@ -0,0 +1,174 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package gaffer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	// Frameworks
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	// HOOK_TIMEOUT is the default time a hook can run before it is killed
+	HOOK_TIMEOUT = 30 * time.Second
+
+	// HOOK_SHELL is the shell which runs hook commands
+	HOOK_SHELL = "/bin/sh"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// RESOLVE AND CHECK HOOKS
+
+// hooksForInstance returns the hooks for the groups of a service, in the
+// order the groups are resolved, followed by the hooks for the service
+func hooksForInstance(service *Service, groups []*ServiceGroup) []rpc.GafferHook {
+	hooks := make([]rpc.GafferHook, 0)
+	for _, group := range groups {
+		hooks = append(hooks, group.Hooks_...)
+	}
+	return append(hooks, service.Hooks_...)
+}
+
+// checkHooks returns an error if a hook has an invalid stage, an empty
+// command or a negative timeout
+func checkHooks(hooks []rpc.GafferHook) error {
+	for _, hook := range hooks {
+		if hook.Stage == rpc.GAFFER_HOOK_NONE || hook.Stage > rpc.GAFFER_HOOK_MAX {
+			return fmt.Errorf("Invalid hook stage: %v", hook.Stage)
+		} else if strings.TrimSpace(hook.Command) == "" {
+			return fmt.Errorf("Missing command for %v hook", hook.Stage)
+		} else if hook.Timeout < 0 {
+			return fmt.Errorf("Invalid timeout for %v hook: %v", hook.Stage, hook.Timeout)
+		}
+	}
+	return nil
+}
+
+// hooksEquals returns true if two lists of hooks are the same
+func hooksEquals(a, b []rpc.GafferHook) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// RUN HOOKS
+
+// runHooks runs the hooks for a stage in order, and returns an error for
+// the first hook which fails. Output is sent as events on the channel,
+// which can be nil, and the failure is sent as a hook error event
+func (this *Instances) runHooks(instance *ServiceInstance, stage rpc.GafferHookStage, ch chan<- rpc.GafferEvent) error {
+	for _, hook := range instance.Hooks_ {
+		if hook.Stage != stage {
+			continue
+		}
+		this.log.Debug("%v: %v hook: %v", instance.Service_.Name_, stage, strconv.Quote(hook.Command))
+		if err := this.runHook(instance, hook, ch); err != nil {
+			err = fmt.Errorf("%v: %v", hook, err)
+			if ch != nil {
+				ch <- NewEventWithInstanceData(nil, rpc.GAFFER_EVENT_HOOK_ERROR, instance, []byte(err.Error()))
+			}
+			return err
+		}
+	}
+
+	// Success
+	return nil
+}
+
+// runHook runs a hook command in the run directory of the instance, with
+// the environment of the instance, and kills the command and any children
+// when the timeout is reached
+func (this *Instances) runHook(instance *ServiceInstance, hook rpc.GafferHook, ch chan<- rpc.GafferEvent) error {
+	timeout := hook.Timeout
+	if timeout == 0 {
+		timeout = this.hook_timeout
+	}
+
+	cmd := exec.Command(HOOK_SHELL, "-c", hook.Command)
+	cmd.Env = append(instance.Env_.Environ(),
+		"GAFFER_SERVICE="+instance.Service_.Name_,
+		"GAFFER_INSTANCE="+fmt.Sprint(instance.Id_),
+		"GAFFER_HOOK="+hook.Stage.Name(),
+	)
+	if instance.RunDir_ != "" {
+		if stat, err := os.Stat(instance.RunDir_); err == nil && stat.IsDir() {
+			cmd.Dir = instance.RunDir_
+		}
+	}
+
+	// Run in a new process group so that children are killed on timeout
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// Send output as events, and wait for the output to end before
+	// waiting for the command, which closes the output
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go this.hookLogger(instance, stdout, rpc.GAFFER_EVENT_HOOK_STDOUT, ch, &wg)
+	go this.hookLogger(instance, stderr, rpc.GAFFER_EVENT_HOOK_STDERR, ch, &wg)
+	done := make(chan error, 1)
+	go func() {
+		wg.Wait()
+		done <- cmd.Wait()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		return fmt.Errorf("Killed after %v", timeout)
+	}
+}
+
+func (this *Instances) hookLogger(instance *ServiceInstance, fh io.Reader, t rpc.GafferEventType, ch chan<- rpc.GafferEvent, wg *sync.WaitGroup) {
+	defer wg.Done()
+	buf := bufio.NewReader(fh)
+	for {
+		if line, err := buf.ReadBytes('\n'); len(line) > 0 && ch != nil {
+			ch <- NewEventWithInstanceData(nil, t, instance, line)
+		} else if err != nil {
+			break
+		}
+	}
+}
@@ -9,6 +9,11 @@
 package gaffer
 
 import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
 	// Frameworks
 	gopi "github.com/djthorpe/gopi"
 )
@@ -24,15 +29,73 @@ func init() {
 		Config: func(config *gopi.AppConfig) {
 			config.AppFlags.FlagString("gaffer.path", "", "Gaffer Database File")
 			config.AppFlags.FlagString("gaffer.root", "", "Gaffer Binary Root")
+			config.AppFlags.FlagDuration("gaffer.watch", DELTA_WATCH, "Interval for checking executables for changes")
+			config.AppFlags.FlagUint("gaffer.versions", VERSIONS_KEEP, "Number of previous versions of uploaded executables to keep")
+			config.AppFlags.FlagUint("gaffer.upload.size", UPLOAD_SIZE, "Maximum size of an uploaded executable in bytes")
+			config.AppFlags.FlagString("gaffer.secrets", SECRETS_PATTERNS, "Comma-separated patterns for secret flag and environment keys")
+			config.AppFlags.FlagString("gaffer.key", "", "File with key for encrypting secrets")
+			config.AppFlags.FlagString("gaffer.data", "", "Root for service data directories")
+			config.AppFlags.FlagString("gaffer.run", "", "Root for instance run directories")
+			config.AppFlags.FlagString("gaffer.dirmode", fmt.Sprintf("%04o", uint32(DIR_MODE)), "Permissions for data and run directories")
+			config.AppFlags.FlagString("gaffer.dirowner", "", "Owner for data and run directories, as <user>:<group>")
+			config.AppFlags.FlagString("gaffer.journal", "", "Event journal file")
+			config.AppFlags.FlagUint("gaffer.journal.size", JOURNAL_SIZE, "Maximum size of the event journal in bytes")
+			config.AppFlags.FlagDuration("gaffer.journal.age", JOURNAL_AGE, "Age after which events are removed from the journal")
+			config.AppFlags.FlagString("gaffer.audit", "", "Audit log file")
+			config.AppFlags.FlagString("gaffer.crash", "", "Folder for crash reports")
+			config.AppFlags.FlagUint("gaffer.crash.count", CRASH_COUNT, "Maximum number of crash reports")
+			config.AppFlags.FlagDuration("gaffer.crash.age", CRASH_AGE, "Age after which crash reports are removed")
+			config.AppFlags.FlagUint("gaffer.crash.lines", TAIL_LINES, "Number of lines of output in crash reports")
+			config.AppFlags.FlagDuration("gaffer.hook.timeout", HOOK_TIMEOUT, "Default timeout for lifecycle hooks")
 		},
 		New: func(app *gopi.AppInstance) (gopi.Driver, error) {
 			path, _ := app.AppFlags.GetString("gaffer.path")
 			binroot, binoverride := app.AppFlags.GetString("gaffer.root")
+			watch, _ := app.AppFlags.GetDuration("gaffer.watch")
+			versions, _ := app.AppFlags.GetUint("gaffer.versions")
+			upload_size, _ := app.AppFlags.GetUint("gaffer.upload.size")
+			secrets, _ := app.AppFlags.GetString("gaffer.secrets")
+			key, _ := app.AppFlags.GetString("gaffer.key")
+			data, _ := app.AppFlags.GetString("gaffer.data")
+			run, _ := app.AppFlags.GetString("gaffer.run")
+			owner, _ := app.AppFlags.GetString("gaffer.dirowner")
+			dirmode, _ := app.AppFlags.GetString("gaffer.dirmode")
+			journal, _ := app.AppFlags.GetString("gaffer.journal")
+			journal_size, _ := app.AppFlags.GetUint("gaffer.journal.size")
+			journal_age, _ := app.AppFlags.GetDuration("gaffer.journal.age")
+			audit, _ := app.AppFlags.GetString("gaffer.audit")
+			crash, _ := app.AppFlags.GetString("gaffer.crash")
+			crash_count, _ := app.AppFlags.GetUint("gaffer.crash.count")
+			crash_age, _ := app.AppFlags.GetDuration("gaffer.crash.age")
+			crash_lines, _ := app.AppFlags.GetUint("gaffer.crash.lines")
+			hook_timeout, _ := app.AppFlags.GetDuration("gaffer.hook.timeout")
+			mode, err := strconv.ParseUint(dirmode, 8, 32)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid -gaffer.dirmode: %v", strconv.Quote(dirmode))
+			}
 			return gopi.Open(Gaffer{
-				Path:        path,
-				BinRoot:     binroot,
-				BinOverride: binoverride,
-				AppFlags:    app.AppFlags,
+				Path:           path,
+				BinRoot:        binroot,
+				BinOverride:    binoverride,
+				DeltaWatch:     watch,
+				Versions:       versions,
+				UploadSize:     int64(upload_size),
+				SecretPatterns: strings.Split(secrets, ","),
+				KeyPath:        key,
+				DataRoot:       data,
+				RunRoot:        run,
+				DirMode:        os.FileMode(mode),
+				DirOwner:       owner,
+				JournalPath:    journal,
+				JournalSize:    int64(journal_size),
+				JournalAge:     journal_age,
+				AuditPath:      audit,
+				CrashPath:      crash,
+				CrashCount:     crash_count,
+				CrashAge:       crash_age,
+				CrashLines:     crash_lines,
+				HookTimeout:    hook_timeout,
+				AppFlags:       app.AppFlags,
 			}, app.Logger)
 		},
 	})
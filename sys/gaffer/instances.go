@@ -17,6 +17,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	// Frameworks
@@ -38,6 +39,10 @@ type Instances struct {
 	ids           map[uint32]time.Time
 	r             *rand.Rand
 	flags         *gopi.Flags
+	executables   Executables
+	dirs          dirs
+	tail_lines    uint
+	hook_timeout  time.Duration
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -63,6 +68,25 @@ func (this *Instances) Init(config Gaffer, logger gopi.Logger) error {
 	this.ids = make(map[uint32]time.Time)
 	this.flags = config.AppFlags
 
+	// Set the roots for data and run directories
+	if err := this.dirs.Init(config); err != nil {
+		return err
+	}
+
+	// Set the number of lines of output retained for crash reports
+	if config.CrashLines == 0 {
+		this.tail_lines = TAIL_LINES
+	} else {
+		this.tail_lines = config.CrashLines
+	}
+
+	// Set the default timeout for hooks
+	if config.HookTimeout == 0 {
+		this.hook_timeout = HOOK_TIMEOUT
+	} else {
+		this.hook_timeout = config.HookTimeout
+	}
+
 	if config.MaxInstances == 0 {
 		this.max_instances = MAX_INSTANCES
 	} else {
@@ -125,18 +149,65 @@ func (this *Instances) NewInstance(id uint32, service *Service, groups []*Servic
 		return nil, fmt.Errorf("Not an executable file: %v", service.Path())
 	}
 
+	// Create the data directory for the service and the run directory
+	// for the instance
+	datadir, rundir, err := this.dirs.Create(service, id)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create instance
-	if instance, err := NewInstance(id, service, groups, path, this.TupleExpander); err != nil {
+	if instance, err := NewInstance(id, service, groups, path, this.dirs.Expander(datadir, rundir, this.TupleExpander)); err != nil {
+		this.dirs.Remove(rundir)
 		return nil, err
 	} else if instance == nil {
+		this.dirs.Remove(rundir)
 		return nil, gopi.ErrAppError
 	} else {
+		instance.RunDir_ = rundir
 		this.instances[id] = instance
 		delete(this.ids, id)
 		return instance, nil
 	}
 }
 
+// CopyInstance creates a new instance from an existing one, retaining the
+// resolved flags and environment of the existing instance, which is started
+// from the executable at path
+func (this *Instances) CopyInstance(id uint32, instance *ServiceInstance, path string) (*ServiceInstance, error) {
+	this.log.Debug2("<gaffer.instances.CopyInstance>{ id=%v instance=%v path=%v }", id, instance, strconv.Quote(path))
+	// Check incoming parameters
+	if id == 0 || instance == nil || path == "" {
+		return nil, gopi.ErrBadParameter
+	}
+	// Check id is unused but in the ids table
+	if this.IsUnusedIdentifier(id) == false {
+		this.log.Debug2("IsUnusedIdentifier(%v) == false", id)
+		return nil, gopi.ErrBadParameter
+	}
+
+	// Avoid race conditions
+	this.Lock()
+	defer this.Unlock()
+
+	// Create a new run directory, which replaces the run directory of the
+	// existing instance
+	_, rundir, err := this.dirs.Create(instance.Service_, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create instance
+	if instance_, err := CopyInstance(id, instance, rundir, path); err != nil {
+		this.dirs.Remove(rundir)
+		return nil, err
+	} else {
+		this.instances[id] = instance_
+		delete(this.ids, id)
+		return instance_, nil
+	}
+}
+
 func (this *Instances) DeleteInstance(instance *ServiceInstance) error {
 	this.log.Debug2("<gaffer.instances.DeleteInstance>{ instance=%v }", instance)
 	// Check incoming parameters
@@ -155,55 +226,96 @@ func (this *Instances) DeleteInstance(instance *ServiceInstance) error {
 		return gopi.ErrAppError
 	} else {
 		delete(this.instances, instance.Id_)
-		return nil
+		return this.dirs.Remove(instance.RunDir_)
 	}
 }
 
+// Start runs the pre-start hooks for an instance and then starts it. When a
+// pre-start hook fails the instance is not started. The post-start hooks are
+// run in the background once the instance is running. An instance which is
+// not started is removed
 func (this *Instances) Start(instance *ServiceInstance, ch chan<- rpc.GafferEvent) error {
 	this.log.Debug2("<gaffer.instances.Start>{ instance=%v }", instance)
-	this.Lock()
-	defer this.Unlock()
 
 	// Check parameters
 	if instance == nil {
 		return gopi.ErrBadParameter
 	}
 
+	// Run the pre-start hooks without holding the lock, as hooks can take
+	// some time to complete
+	if err := this.runHooks(instance, rpc.GAFFER_HOOK_PRE_START, ch); err != nil {
+		this.Lock()
+		defer this.Unlock()
+		this.abortStart(instance)
+		return err
+	}
+
+	return this.start(instance, ch)
+}
+
+func (this *Instances) start(instance *ServiceInstance, ch chan<- rpc.GafferEvent) error {
+	this.Lock()
+	defer this.Unlock()
+
+	// Record the executable the instance is started from
+	if executable, err := this.executables.Get(instance.Path_); err != nil {
+		this.abortStart(instance)
+		return err
+	} else {
+		instance.Executable_ = executable
+	}
+
+	instance.process.SetTailLines(this.tail_lines)
 	if err := instance.process.Start(instance.stdout, instance.stderr, instance.stop); err != nil {
+		this.abortStart(instance)
 		return err
 	}
 
 	if instance.process.cmd != nil {
-		this.log.Debug("%v %v", instance.process.cmd.Path, strings.Join(instance.Flags().Flags(), " "))
+		this.log.Debug("%v %v", instance.process.cmd.Path, strings.Join(instance.RedactedCommandLine(), " "))
 	}
 
-	// Start goroutines for receiving data from stdout and stderr
-	go this.processLog(instance, instance.stdout, rpc.GAFFER_EVENT_LOG_STDOUT, ch)
-	go this.processLog(instance, instance.stderr, rpc.GAFFER_EVENT_LOG_STDERR, ch)
-	go this.processStop(instance, instance.stop, ch)
+	// Set start
+	instance.Start_ = time.Now()
 
 	if ch != nil {
-		// Send start signal
+		// Send start signal before any output or stop events
 		ch <- NewEventWithInstance(nil, rpc.GAFFER_EVENT_INSTANCE_RUN, instance)
 	}
 
-	// Set start
-	instance.Start_ = time.Now()
+	// Start goroutines for receiving data from stdout and stderr
+	go this.processLog(instance, instance.stdout, rpc.GAFFER_EVENT_LOG_STDOUT, ch)
+	go this.processLog(instance, instance.stderr, rpc.GAFFER_EVENT_LOG_STDERR, ch)
+
+	// Run the post-start hooks, and then wait for the instance to stop
+	go func() {
+		this.runHooks(instance, rpc.GAFFER_HOOK_POST_START, ch)
+		this.processStop(instance, instance.stop, ch)
+	}()
 
 	// Return success
 	return nil
 }
 
-func (this *Instances) Stop(instance *ServiceInstance) error {
+// Stop runs the pre-stop hooks for an instance and then stops it. Output
+// from the hooks is sent on the channel, which can be nil
+func (this *Instances) Stop(instance *ServiceInstance, ch chan<- rpc.GafferEvent) error {
 	this.log.Debug2("<gaffer.instances.Stop>{ instance=%v }", instance)
-	this.Lock()
-	defer this.Unlock()
 
 	// Check parameters
 	if instance == nil {
 		return gopi.ErrBadParameter
 	}
 
+	// A failed pre-stop hook does not prevent the instance from stopping
+	if instance.IsRunning() {
+		this.runHooks(instance, rpc.GAFFER_HOOK_PRE_STOP, ch)
+	}
+
+	this.Lock()
+	defer this.Unlock()
+
 	// Stop the process
 	if err := instance.process.Stop(); err != nil {
 		return err
@@ -212,6 +324,42 @@ func (this *Instances) Stop(instance *ServiceInstance) error {
 	}
 }
 
+func (this *Instances) Signal(instance *ServiceInstance, signal syscall.Signal, group bool) error {
+	this.log.Debug2("<gaffer.instances.Signal>{ instance=%v signal=%v group=%v }", instance, signal, group)
+	this.Lock()
+	defer this.Unlock()
+
+	// Check parameters
+	if instance == nil || signal == 0 {
+		return gopi.ErrBadParameter
+	}
+
+	// Signal the process
+	return instance.process.Signal(signal, group)
+}
+
+// SetLabels replaces the labels for an instance
+func (this *Instances) SetLabels(instance *ServiceInstance, labels rpc.Tuples) error {
+	this.Lock()
+	defer this.Unlock()
+	if instance.Labels_.Equals(labels) {
+		return gopi.ErrNotModified
+	} else {
+		instance.Labels_ = labels
+		return nil
+	}
+}
+
+// GetExecutableForPath returns size, modification time and checksum
+// for an executable
+func (this *Instances) GetExecutableForPath(path string) (*Executable, error) {
+	return this.executables.Get(path)
+}
+
+func (this *Instances) GetFlagsForPath(path string) ([]*Flag, error) {
+	return this.executables.Flags(path)
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // RETURN INSTANCES
 
@@ -348,19 +496,40 @@ func (this *Instances) processStop(instance *ServiceInstance, in <-chan error, o
 		if err := <-in; err == nil {
 			break
 		} else if err == ErrSuccess {
-			// Set stop
+			// Set stop, run the post-stop hooks and remove the run directory
 			instance.Stop_ = time.Now()
+			this.runHooks(instance, rpc.GAFFER_HOOK_POST_STOP, out)
+			this.removeRunDir(instance)
 			// Emit stop event
 			out <- NewEventWithInstance(nil, rpc.GAFFER_EVENT_INSTANCE_STOP_OK, instance)
 		} else {
-			// Set stop
+			// Set stop, run the post-stop hooks and remove the run directory
 			instance.Stop_ = time.Now()
+			this.runHooks(instance, rpc.GAFFER_HOOK_POST_STOP, out)
+			this.removeRunDir(instance)
 			// Emit stop event
 			out <- NewEventWithInstanceData(nil, rpc.GAFFER_EVENT_INSTANCE_STOP_ERROR, instance, []byte(err.Error()))
 		}
 	}
 }
 
+// abortStart sets the stop time for an instance which could not be started,
+// removes the run directory and removes the instance, so that it is not
+// reported as running. The lock is held by the caller
+func (this *Instances) abortStart(instance *ServiceInstance) {
+	instance.Stop_ = time.Now()
+	this.removeRunDir(instance)
+	if this.instances[instance.Id_] == instance {
+		delete(this.instances, instance.Id_)
+	}
+}
+
+func (this *Instances) removeRunDir(instance *ServiceInstance) {
+	if err := this.dirs.Remove(instance.RunDir_); err != nil {
+		this.log.Warn("RemoveRunDir: %v", err)
+	}
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // STRINGIFY
 
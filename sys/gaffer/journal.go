@@ -0,0 +1,583 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package gaffer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+	rpc "github.com/djthorpe/gopi-rpc"
+	event "github.com/djthorpe/gopi/util/event"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// journal appends events to a file with a sequence number and timestamp,
+// and removes the oldest events when the file is too large or the events
+// are too old. When there is no file, the most recent events are kept in
+// memory instead, so that streams can still be resumed
+type journal struct {
+	sync.Mutex
+
+	log      gopi.Logger
+	path     string
+	size     int64
+	age      time.Duration
+	seq      uint64
+	first    time.Time
+	written  int64
+	fh       *os.File
+	recent   []recentEvent
+	compacts chan struct{}
+}
+
+// recentEvent is an event kept in memory, with the journal entry which is
+// used to match queries
+type recentEvent struct {
+	evt   *Event
+	entry *JournalEntry
+}
+
+// JournalEntry is an event in the journal. The names of the service, group
+// and instance are recorded rather than their configuration, together with
+// the groups the service was a member of when the event was emitted
+type JournalEntry struct {
+	Seq_      uint64              `json:"seq"`
+	Ts_       time.Time           `json:"ts"`
+	Type_     rpc.GafferEventType `json:"type"`
+	Service_  string              `json:"service,omitempty"`
+	Groups_   []string            `json:"groups,omitempty"`
+	Group_    string              `json:"group,omitempty"`
+	Instance_ uint32              `json:"instance,omitempty"`
+	Data_     []byte              `json:"data,omitempty"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	// JOURNAL_EXT is the extension of the journal file, which is written
+	// next to the configuration file
+	JOURNAL_EXT = ".journal"
+
+	// JOURNAL_SIZE is the default maximum size of the journal in bytes. When
+	// the journal is larger, the oldest events are removed until it is half
+	// the maximum size
+	JOURNAL_SIZE = 16 * 1024 * 1024
+
+	// JOURNAL_AGE is the default age after which events are removed
+	JOURNAL_AGE = 7 * 24 * time.Hour
+
+	// DELTA_JOURNAL is the interval for removing events which are too old
+	DELTA_JOURNAL = time.Minute
+
+	// JOURNAL_RECENT is the number of recent events kept in memory
+	JOURNAL_RECENT = 1000
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// INIT / DESTROY
+
+func (this *journal) Init(config Gaffer, path string, logger gopi.Logger) error {
+	logger.Debug("<gaffer.journal.Init>{ path=%v size=%v age=%v }", strconv.Quote(path), config.JournalSize, config.JournalAge)
+
+	this.log = logger
+	this.path = path
+	this.compacts = make(chan struct{}, 1)
+	if config.JournalSize == 0 {
+		this.size = JOURNAL_SIZE
+	} else {
+		this.size = config.JournalSize
+	}
+	if config.JournalAge == 0 {
+		this.age = JOURNAL_AGE
+	} else {
+		this.age = config.JournalAge
+	}
+
+	// Without a path, events are given sequence numbers but not recorded
+	if this.path == "" {
+		return nil
+	}
+
+	// Continue the sequence from the last event in the journal
+	if entries, err := this.read(-1); err != nil {
+		return err
+	} else if len(entries) > 0 {
+		this.seq = entries[len(entries)-1].Seq_
+		this.first = entries[0].Ts_
+	}
+
+	// Open the journal for appending and remove old events
+	if err := this.open(); err != nil {
+		return err
+	} else if err := this.compact(); err != nil {
+		return err
+	}
+
+	// Success
+	return nil
+}
+
+func (this *journal) Destroy() error {
+	this.log.Debug("<gaffer.journal.Destroy>{ path=%v }", strconv.Quote(this.path))
+	this.Lock()
+	defer this.Unlock()
+
+	if this.fh != nil {
+		if err := this.fh.Close(); err != nil {
+			return err
+		}
+		this.fh = nil
+	}
+
+	// Success
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// APPEND AND QUERY
+
+// Append sets the sequence number and timestamp for an event and writes it
+// to the journal, with the groups of the service for the event
+func (this *journal) Append(evt *Event, groups []string) error {
+	this.Lock()
+	defer this.Unlock()
+
+	this.seq++
+	evt.Seq_, evt.Ts_ = this.seq, time.Now()
+	entry := NewJournalEntry(evt, groups)
+
+	// Keep the most recent events in memory when there is no file
+	if this.path == "" {
+		if len(this.recent) >= JOURNAL_RECENT {
+			this.recent = append(this.recent[:0], this.recent[len(this.recent)-JOURNAL_RECENT+1:]...)
+		}
+		this.recent = append(this.recent, recentEvent{evt, entry})
+	}
+	if this.fh == nil {
+		return nil
+	}
+
+	// Write the entry as a line of JSON
+	if data, err := json.Marshal(entry); err != nil {
+		return err
+	} else if n, err := this.fh.Write(append(data, '\n')); err != nil {
+		return err
+	} else {
+		this.written += int64(n)
+	}
+	if this.first.IsZero() {
+		this.first = evt.Ts_
+	}
+
+	// Signal the journal task to remove the oldest events when the journal
+	// is too large
+	if this.written > this.size {
+		select {
+		case this.compacts <- struct{}{}:
+		default:
+		}
+	}
+
+	// Success
+	return nil
+}
+
+// Query returns the entries in the journal which match a query. The journal
+// is read up to its size when the query is made without holding the lock,
+// so that events can be appended while it is read
+func (this *journal) Query(query rpc.GafferEventQuery) ([]*JournalEntry, error) {
+	this.Lock()
+	seq, size := this.seq, this.written
+	this.Unlock()
+
+	if this.path == "" && query.After > 0 {
+		return nil, fmt.Errorf("Events after %v are no longer kept, use -gaffer.journal to record events", query.After)
+	} else if this.path == "" {
+		return nil, fmt.Errorf("Missing -gaffer.journal path")
+	} else if query.After > seq {
+		return nil, fmt.Errorf("Events after %v have not been emitted", query.After)
+	}
+	for _, pattern := range []string{query.Service, query.Group} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("Invalid pattern: %v", strconv.Quote(pattern))
+		}
+	}
+
+	entries, err := this.read(size)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check for events which have been removed from the journal
+	if query.After > 0 && query.After < seq {
+		if len(entries) == 0 || entries[0].Seq_ > query.After+1 {
+			return nil, fmt.Errorf("Events after %v have been removed from the journal", query.After)
+		}
+	}
+
+	matched := make([]*JournalEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Matches(query) {
+			matched = append(matched, entry)
+		}
+	}
+	if query.Limit > 0 && uint(len(matched)) > query.Limit {
+		matched = matched[uint(len(matched))-query.Limit:]
+	}
+	return matched, nil
+}
+
+// Recent returns the recent events kept in memory which match a query when
+// there is no file, and false when there is a file or some of the events
+// after the sequence number in the query are no longer kept. The events
+// are returned with the service, group and instance they were emitted with
+func (this *journal) Recent(query rpc.GafferEventQuery) ([]*Event, bool) {
+	this.Lock()
+	defer this.Unlock()
+
+	if this.path != "" || query.After > this.seq {
+		return nil, false
+	} else if query.After < this.seq && (len(this.recent) == 0 || this.recent[0].entry.Seq_ > query.After+1) {
+		return nil, false
+	}
+
+	matched := make([]*Event, 0, len(this.recent))
+	for _, recent := range this.recent {
+		if recent.entry.Matches(query) {
+			matched = append(matched, recent.evt)
+		}
+	}
+	if query.Limit > 0 && uint(len(matched)) > query.Limit {
+		matched = matched[uint(len(matched))-query.Limit:]
+	}
+	return matched, true
+}
+
+// Seq returns the sequence number of the most recent event
+func (this *journal) Seq() uint64 {
+	this.Lock()
+	defer this.Unlock()
+	return this.seq
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// BACKGROUND TASKS
+
+// JournalTask periodically removes events which are too old, and removes
+// the oldest events when the journal becomes too large
+func (this *gaffer) JournalTask(start chan<- event.Signal, stop <-chan event.Signal) error {
+	start <- gopi.DONE
+	ticker := time.NewTicker(DELTA_JOURNAL)
+FOR_LOOP:
+	for {
+		select {
+		case <-ticker.C:
+			if err := this.journal.Expire(); err != nil {
+				this.log.Warn("Journal: %v", err)
+			}
+		case <-this.journal.compacts:
+			if err := this.journal.Expire(); err != nil {
+				this.log.Warn("Journal: %v", err)
+			}
+		case <-stop:
+			break FOR_LOOP
+		}
+	}
+
+	// Stop the ticker
+	ticker.Stop()
+
+	// Success
+	return nil
+}
+
+// Expire removes events which are too old, and the oldest events when the
+// journal is too large
+func (this *journal) Expire() error {
+	this.Lock()
+	expired := this.first.IsZero() == false && time.Since(this.first) > this.age
+	compact := this.fh != nil && (expired || this.written > this.size)
+	this.Unlock()
+
+	if compact == false {
+		return nil
+	} else {
+		return this.compact()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// open opens the journal for appending
+func (this *journal) open() error {
+	if fh, err := os.OpenFile(this.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600); err != nil {
+		return err
+	} else if stat, err := fh.Stat(); err != nil {
+		fh.Close()
+		return err
+	} else {
+		this.fh = fh
+		this.written = stat.Size()
+		return nil
+	}
+}
+
+// read returns the entries in the first size bytes of the journal, or all
+// the entries when size is negative. Lines which cannot be decoded are
+// skipped
+func (this *journal) read(size int64) ([]*JournalEntry, error) {
+	fh, err := os.Open(this.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	var r io.Reader = fh
+	if size >= 0 {
+		r = io.LimitReader(fh, size)
+	}
+	entries := make([]*JournalEntry, 0)
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			entry := new(JournalEntry)
+			if err := json.Unmarshal(line, entry); err != nil {
+				this.log.Warn("Journal: %v: %v", this.path, err)
+			} else {
+				entries = append(entries, entry)
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// compact rewrites the journal without events which are too old, and
+// removes the oldest events until the journal is half the maximum size. The
+// most recent event is kept so that the sequence continues when the journal
+// is read again. The journal is read and rewritten without holding the lock,
+// and events appended in the meantime are copied before it is replaced
+func (this *journal) compact() error {
+	this.Lock()
+	written := this.written
+	this.Unlock()
+
+	entries, err := this.read(written)
+	if err != nil {
+		return err
+	}
+
+	// Encode the entries which are not too old
+	lines := make([][]byte, 0, len(entries))
+	size := int64(0)
+	for i, entry := range entries {
+		if time.Since(entry.Ts_) > this.age && i < len(entries)-1 {
+			continue
+		} else if data, err := json.Marshal(entry); err != nil {
+			return err
+		} else {
+			lines = append(lines, append(data, '\n'))
+			size += int64(len(data) + 1)
+		}
+	}
+
+	// Remove the oldest entries when the journal is too large
+	if size > this.size {
+		for len(lines) > 1 && size > this.size/2 {
+			size -= int64(len(lines[0]))
+			lines = lines[1:]
+		}
+	}
+
+	// Return if nothing is removed
+	if len(lines) == len(entries) {
+		return nil
+	}
+
+	// Write to a temporary file and replace the journal
+	fh, err := ioutil.TempFile(filepath.Dir(this.path), "."+filepath.Base(this.path)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(fh.Name())
+	for _, line := range lines {
+		if _, err := fh.Write(line); err != nil {
+			fh.Close()
+			return err
+		}
+	}
+
+	// Copy the events appended while the journal was read, and replace it
+	this.Lock()
+	defer this.Unlock()
+	if this.written > written {
+		if err := copyFrom(fh, this.path, written); err != nil {
+			fh.Close()
+			return err
+		}
+	}
+	if err := fh.Chmod(0600); err != nil {
+		fh.Close()
+		return err
+	} else if err := fh.Close(); err != nil {
+		return err
+	} else if err := os.Rename(fh.Name(), this.path); err != nil {
+		return err
+	}
+	this.log.Debug("Journal: Removed %v events", len(entries)-len(lines))
+
+	// Reopen the journal
+	this.first = time.Time{}
+	if len(lines) > 0 {
+		entry := new(JournalEntry)
+		if err := json.Unmarshal(lines[0], entry); err == nil {
+			this.first = entry.Ts_
+		}
+	}
+	if this.fh != nil {
+		this.fh.Close()
+		this.fh = nil
+	}
+	return this.open()
+}
+
+// copyFrom appends the contents of a file from an offset
+func copyFrom(w io.Writer, path string, offset int64) error {
+	fh, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	if _, err := fh.Seek(offset, io.SeekStart); err != nil {
+		return err
+	} else if _, err := io.Copy(w, fh); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// JOURNAL ENTRY
+
+// NewJournalEntry returns a journal entry for an event
+func NewJournalEntry(evt *Event, groups []string) *JournalEntry {
+	this := &JournalEntry{
+		Seq_:    evt.Seq_,
+		Ts_:     evt.Ts_,
+		Type_:   evt.Type_,
+		Groups_: groups,
+		Data_:   evt.Data_,
+	}
+	if service := evt.Service(); service != nil {
+		this.Service_ = service.Name()
+	}
+	if group := evt.Group(); group != nil {
+		this.Group_ = group.Name()
+	}
+	if instance := evt.Instance(); instance != nil {
+		this.Instance_ = instance.Id()
+	}
+	return this
+}
+
+// Matches returns true if the entry matches a query
+func (this *JournalEntry) Matches(query rpc.GafferEventQuery) bool {
+	if query.After > 0 && this.Seq_ <= query.After {
+		return false
+	} else if query.Start.IsZero() == false && this.Ts_.Before(query.Start) {
+		return false
+	} else if query.End.IsZero() == false && this.Ts_.Before(query.End) == false {
+		return false
+	} else if query.Instance != 0 && query.Instance != this.Instance_ {
+		return false
+	} else if query.Service != "" && matchName(query.Service, this.Service_) == false {
+		return false
+	}
+	if len(query.Types) > 0 {
+		match := false
+		for _, type_ := range query.Types {
+			if type_ == this.Type_ {
+				match = true
+			}
+		}
+		if match == false {
+			return false
+		}
+	}
+	if query.Group != "" {
+		if matchName(query.Group, this.Group_) {
+			return true
+		}
+		for _, group := range this.Groups_ {
+			if matchName(query.Group, group) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Event returns an event for the entry, where the service, group and
+// instance have only the name or identifier set
+func (this *JournalEntry) Event() *Event {
+	evt := &Event{
+		Type_: this.Type_,
+		Data_: this.Data_,
+		Seq_:  this.Seq_,
+		Ts_:   this.Ts_,
+	}
+	if this.Instance_ != 0 {
+		evt.Instance_ = &ServiceInstance{Id_: this.Instance_, Service_: &Service{Name_: this.Service_}}
+	} else if this.Service_ != "" {
+		evt.Service_ = &Service{Name_: this.Service_}
+	}
+	if this.Group_ != "" {
+		evt.Group_ = &ServiceGroup{Name_: this.Group_}
+	}
+	return evt
+}
+
+// matchName returns true if a name matches a pattern
+func matchName(pattern, name string) bool {
+	if name == "" {
+		return false
+	} else if match, err := path.Match(pattern, name); err != nil {
+		return false
+	} else {
+		return match
+	}
+}
+
+func (this *JournalEntry) String() string {
+	return fmt.Sprintf("<gaffer.JournalEntry>{ seq=%v ts=%v type=%v service=%v group=%v instance=%v }", this.Seq_, this.Ts_.Format(time.RFC3339), this.Type_, strconv.Quote(this.Service_), strconv.Quote(this.Group_), this.Instance_)
+}
@@ -0,0 +1,218 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package gaffer
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	// Frameworks
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// metrics counts instance starts, restarts and exits for each service.
+// A start is counted as a restart when an instance of the same service
+// has exited before
+type metrics struct {
+	sync.Mutex
+
+	starts   map[string]uint64
+	restarts map[string]uint64
+	exits    map[string]map[string]uint64
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	// CLOCK_TICKS is the number of clock ticks per second used for process
+	// times in /proc
+	CLOCK_TICKS = 100
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// COUNT EVENTS
+
+// Event counts instance start and stop events
+func (this *metrics) Event(evt rpc.GafferEvent) {
+	instance, ok := evt.Instance().(*ServiceInstance)
+	if ok == false || instance == nil || instance.Service_ == nil {
+		return
+	}
+
+	this.Lock()
+	defer this.Unlock()
+
+	if this.starts == nil {
+		this.starts = make(map[string]uint64)
+		this.restarts = make(map[string]uint64)
+		this.exits = make(map[string]map[string]uint64)
+	}
+
+	service := instance.Service_.Name_
+	switch evt.Type() {
+	case rpc.GAFFER_EVENT_INSTANCE_RUN:
+		this.starts[service]++
+		if len(this.exits[service]) > 0 {
+			this.restarts[service]++
+		}
+	case rpc.GAFFER_EVENT_INSTANCE_STOP_OK, rpc.GAFFER_EVENT_INSTANCE_STOP_ERROR, rpc.GAFFER_EVENT_INSTANCE_STOP_KILLED:
+		if this.exits[service] == nil {
+			this.exits[service] = make(map[string]uint64)
+		}
+		this.exits[service][exitCodeForInstance(instance)]++
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// METRICS
+
+// Metrics returns instances by state, starts, restarts and exit codes for
+// each service, and the resources used by each running instance
+func (this *gaffer) Metrics() []*rpc.MetricFamily {
+	instances := rpc.NewMetricFamily("gaffer_instances", "Instances by service and state", rpc.METRIC_TYPE_GAUGE)
+	starts := rpc.NewMetricFamily("gaffer_instance_starts_total", "Instances started by service", rpc.METRIC_TYPE_COUNTER)
+	restarts := rpc.NewMetricFamily("gaffer_instance_restarts_total", "Instances started after a previous instance of the service exited", rpc.METRIC_TYPE_COUNTER)
+	exits := rpc.NewMetricFamily("gaffer_instance_exits_total", "Instances exited by service and exit code or signal", rpc.METRIC_TYPE_COUNTER)
+	uptime := rpc.NewMetricFamily("gaffer_instance_uptime_seconds", "Time each running instance has been running", rpc.METRIC_TYPE_GAUGE)
+	cpu := rpc.NewMetricFamily("gaffer_instance_cpu_seconds_total", "User and system time used by each running instance", rpc.METRIC_TYPE_COUNTER)
+	rss := rpc.NewMetricFamily("gaffer_instance_resident_memory_bytes", "Resident memory of each running instance", rpc.METRIC_TYPE_GAUGE)
+
+	// Count instances by service and state, and get the resources used
+	// by running instances, in instance order
+	states := make(map[string]map[string]uint)
+	running := make([]*ServiceInstance, 0)
+	for _, instance := range this.Instances.GetInstances() {
+		instance_ := instance.(*ServiceInstance)
+		service, state := instance_.Service_.Name_, stateForInstance(instance_)
+		if states[service] == nil {
+			states[service] = make(map[string]uint)
+		}
+		states[service][state]++
+		if state == "running" {
+			running = append(running, instance_)
+		}
+	}
+	for _, service := range sortedKeys(states) {
+		for _, state := range []string{"starting", "running", "stopped"} {
+			instances.Add(float64(states[service][state]), "service", service, "state", state)
+		}
+	}
+	sort.Slice(running, func(i, j int) bool {
+		return running[i].Id_ < running[j].Id_
+	})
+	for _, instance := range running {
+		service, id := instance.Service_.Name_, fmt.Sprint(instance.Id_)
+		uptime.Add(time.Since(instance.Start_).Seconds(), "service", service, "instance", id)
+		if cpu_, rss_, err := usageForProcess(instance.process.Id()); err == nil {
+			cpu.Add(cpu_.Seconds(), "service", service, "instance", id)
+			rss.Add(float64(rss_), "service", service, "instance", id)
+		}
+	}
+
+	// Add counters
+	this.metrics.Lock()
+	defer this.metrics.Unlock()
+	for _, service := range sortedKeys(this.metrics.starts) {
+		starts.Add(float64(this.metrics.starts[service]), "service", service)
+		restarts.Add(float64(this.metrics.restarts[service]), "service", service)
+	}
+	for _, service := range sortedKeys(this.metrics.exits) {
+		for _, code := range sortedKeys(this.metrics.exits[service]) {
+			exits.Add(float64(this.metrics.exits[service][code]), "service", service, "code", code)
+		}
+	}
+
+	return []*rpc.MetricFamily{instances, starts, restarts, exits, uptime, cpu, rss}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// stateForInstance returns "running", "stopped" or "starting" for an
+// instance which has not yet started running
+func stateForInstance(instance *ServiceInstance) string {
+	if instance.IsRunning() {
+		return "running"
+	} else if instance.Stop_.IsZero() == false {
+		return "stopped"
+	} else {
+		return "starting"
+	}
+}
+
+// exitCodeForInstance returns the exit code of an instance, or the name of
+// the signal which terminated it
+func exitCodeForInstance(instance *ServiceInstance) string {
+	if instance.process == nil {
+		return "0"
+	} else if status, _ := instance.process.WaitStatus(); status.Signaled() {
+		return rpc.NameForSignal(status.Signal())
+	} else {
+		return fmt.Sprint(instance.process.ExitCode())
+	}
+}
+
+// usageForProcess returns the user and system time and resident memory of
+// a process from /proc, which is only available on Linux
+func usageForProcess(pid uint32) (time.Duration, int64, error) {
+	if pid == 0 {
+		return 0, 0, os.ErrNotExist
+	}
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%v/stat", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+	// Fields follow the command name, which is in parentheses and can
+	// contain spaces. The first field after the name is the state
+	if i := bytes.LastIndexByte(data, ')'); i < 0 {
+		return 0, 0, fmt.Errorf("Invalid process status for %v", pid)
+	} else if fields := bytes.Fields(data[i+1:]); len(fields) < 22 {
+		return 0, 0, fmt.Errorf("Invalid process status for %v", pid)
+	} else if utime, err := strconv.ParseUint(string(fields[11]), 10, 64); err != nil {
+		return 0, 0, err
+	} else if stime, err := strconv.ParseUint(string(fields[12]), 10, 64); err != nil {
+		return 0, 0, err
+	} else if pages, err := strconv.ParseInt(string(fields[21]), 10, 64); err != nil {
+		return 0, 0, err
+	} else {
+		cpu := time.Duration(utime+stime) * time.Second / CLOCK_TICKS
+		return cpu, pages * int64(os.Getpagesize()), nil
+	}
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys(m interface{}) []string {
+	keys := make([]string, 0)
+	switch m_ := m.(type) {
+	case map[string]uint64:
+		for key := range m_ {
+			keys = append(keys, key)
+		}
+	case map[string]map[string]uint64:
+		for key := range m_ {
+			keys = append(keys, key)
+		}
+	case map[string]map[string]uint:
+		for key := range m_ {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -15,7 +15,10 @@ import (
 	"fmt"
 	"io"
 	"os/exec"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -26,17 +29,39 @@ type Process struct {
 	sync.Mutex
 
 	cmd            *exec.Cmd
+	ctx            context.Context
 	cancel         context.CancelFunc
 	stdout, stderr io.ReadCloser
 	start, stop    time.Time
 	wg             sync.WaitGroup
+
+	// running is set when the process has started and cleared when it has
+	// been waited for, and is accessed atomically so that it can be read
+	// without the lock
+	running int32
+
+	// The last lines of output, for crash reports
+	tail [2]*tail
+}
+
+// tail retains the most recent lines written
+type tail struct {
+	sync.Mutex
+	max   uint
+	lines []string
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 // CONSTANTS
 
 var (
-	ErrSuccess = errors.New("No Error")
+	ErrSuccess    = errors.New("No Error")
+	ErrNotRunning = errors.New("Process is not running")
+)
+
+const (
+	// TAIL_LINES is the default number of lines of output retained
+	TAIL_LINES = 50
 )
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -46,8 +71,9 @@ var (
 func NewProcess(instance *ServiceInstance) (*Process, error) {
 	this := new(Process)
 	ctx, cancel := ctxForTimeout(instance.RunTime())
-	this.cmd = exec.CommandContext(ctx, instance.Path(), instance.Flags().Flags()...)
-	this.cancel = cancel
+	this.cmd = exec.Command(instance.Path(), instance.CommandLine()...)
+	this.ctx, this.cancel = ctx, cancel
+	this.tail = [2]*tail{NewTail(TAIL_LINES), NewTail(TAIL_LINES)}
 
 	if stdout, err := this.cmd.StdoutPipe(); err != nil {
 		return nil, err
@@ -62,7 +88,12 @@ func NewProcess(instance *ServiceInstance) (*Process, error) {
 	}
 
 	// Set environment
-	this.cmd.Env = instance.Env().Env()
+	this.cmd.Env = instance.Env_.Environ()
+
+	// Run in a new process group so that signals can be delivered
+	// to the process and any children, which are killed together when
+	// the process is stopped or the run time is exceeded
+	this.cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 
 	// Success
 	return this, nil
@@ -78,17 +109,41 @@ func (this *Process) Start(stdout, stderr chan<- []byte, stop chan<- error) erro
 	// Start but don't wait
 	this.start = time.Now()
 	this.stop = time.Time{}
-	if err := this.cmd.Start(); err != nil {
+	if err := this.ctx.Err(); err != nil {
 		return err
+	} else if err := this.cmd.Start(); err != nil {
+		return err
+	} else {
+		atomic.StoreInt32(&this.running, 1)
 	}
 
+	// Kill the process group when the process is stopped or the run time
+	// is exceeded
+	exited := make(chan struct{})
+	go func() {
+		select {
+		case <-this.ctx.Done():
+			this.kill()
+		case <-exited:
+			break
+		}
+	}()
+
+	// Start logging to channels
+	this.wg.Add(2)
+	go this.ProcessLogger(this.stdout, stdout, this.tail[0])
+	go this.ProcessLogger(this.stderr, stderr, this.tail[1])
+
 	// Call wait in the background, which then returns the error
 	go func() {
+		// Wait for loggers to end, as the output is closed when the
+		// process is waited for
+		this.wg.Wait()
+
 		// Wait for processses
 		err := this.cmd.Wait()
-
-		// Wait for loggers to end
-		this.wg.Wait()
+		atomic.StoreInt32(&this.running, 0)
+		close(exited)
 
 		// Send stop signal and close
 		if err != nil {
@@ -99,10 +154,6 @@ func (this *Process) Start(stdout, stderr chan<- []byte, stop chan<- error) erro
 		close(stop)
 	}()
 
-	// Start logging to channels
-	go this.ProcessLogger(this.stdout, stdout)
-	go this.ProcessLogger(this.stderr, stderr)
-
 	// Success
 	return nil
 }
@@ -122,14 +173,33 @@ func (this *Process) Stop() error {
 	return nil
 }
 
-func (this *Process) IsRunning() bool {
-	if this.cmd == nil || this.cmd.ProcessState == nil {
-		return false
+// Signal delivers a signal to the process, or to the process group
+// when group is true
+func (this *Process) Signal(signal syscall.Signal, group bool) error {
+	this.Lock()
+	defer this.Unlock()
+
+	if this.IsRunning() == false {
+		return ErrNotRunning
+	} else if group {
+		return syscall.Kill(-this.cmd.Process.Pid, signal)
 	} else {
-		return this.cmd.ProcessState.Exited() == false
+		return this.cmd.Process.Signal(signal)
 	}
 }
 
+// kill sends SIGKILL to the process group, so that any children of the
+// process are also stopped
+func (this *Process) kill() {
+	if this.IsRunning() {
+		syscall.Kill(-this.cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+func (this *Process) IsRunning() bool {
+	return atomic.LoadInt32(&this.running) != 0
+}
+
 func (this *Process) Id() uint32 {
 	if this.cmd != nil && this.cmd.Process != nil {
 		return uint32(this.cmd.Process.Pid)
@@ -146,6 +216,47 @@ func (this *Process) ExitCode() int64 {
 	}
 }
 
+// SetTailLines sets the number of lines of output which are retained
+func (this *Process) SetTailLines(lines uint) {
+	for _, tail := range this.tail {
+		tail.SetMax(lines)
+	}
+}
+
+// Stdout and Stderr return the last lines of output
+func (this *Process) Stdout() []string {
+	return this.tail[0].Lines()
+}
+
+func (this *Process) Stderr() []string {
+	return this.tail[1].Lines()
+}
+
+// Crashed returns true if the process exited with an error, and was not
+// stopped or did not reach the end of its run time
+func (this *Process) Crashed() bool {
+	this.Lock()
+	defer this.Unlock()
+	if this.cmd == nil || this.cmd.ProcessState == nil || this.cmd.ProcessState.Success() {
+		return false
+	} else if this.stop.IsZero() == false || this.ctx.Err() == context.DeadlineExceeded {
+		return false
+	} else {
+		return true
+	}
+}
+
+// WaitStatus returns the status of a process which has exited, and the
+// resources used
+func (this *Process) WaitStatus() (syscall.WaitStatus, *syscall.Rusage) {
+	if this.cmd == nil || this.cmd.ProcessState == nil {
+		return 0, nil
+	}
+	status, _ := this.cmd.ProcessState.Sys().(syscall.WaitStatus)
+	rusage, _ := this.cmd.ProcessState.SysUsage().(*syscall.Rusage)
+	return status, rusage
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // STRINGIFY
 
@@ -167,15 +278,15 @@ func ctxForTimeout(timeout time.Duration) (context.Context, context.CancelFunc)
 ////////////////////////////////////////////////////////////////////////////////
 // PROCESS LOG FILES
 
-func (this *Process) ProcessLogger(fh io.Reader, c chan<- []byte) error {
+func (this *Process) ProcessLogger(fh io.Reader, c chan<- []byte, tail *tail) error {
 	buf := bufio.NewReader(fh)
-	this.wg.Add(1)
 	for {
 		if line, err := buf.ReadBytes('\n'); err == io.EOF {
 			break
 		} else if err != nil {
 			break
 		} else {
+			tail.Append(line)
 			c <- line
 		}
 	}
@@ -183,3 +294,40 @@ func (this *Process) ProcessLogger(fh io.Reader, c chan<- []byte) error {
 	this.wg.Done()
 	return nil
 }
+
+////////////////////////////////////////////////////////////////////////////////
+// TAIL
+
+func NewTail(max uint) *tail {
+	return &tail{max: max}
+}
+
+func (this *tail) SetMax(max uint) {
+	this.Lock()
+	defer this.Unlock()
+	this.max = max
+	this.trim()
+}
+
+// Append adds a line, removing the trailing newline
+func (this *tail) Append(line []byte) {
+	this.Lock()
+	defer this.Unlock()
+	this.lines = append(this.lines, strings.TrimRight(string(line), "\r\n"))
+	this.trim()
+}
+
+// Lines returns a copy of the lines retained
+func (this *tail) Lines() []string {
+	this.Lock()
+	defer this.Unlock()
+	lines := make([]string, len(this.lines))
+	copy(lines, this.lines)
+	return lines
+}
+
+func (this *tail) trim() {
+	if uint(len(this.lines)) > this.max {
+		this.lines = this.lines[uint(len(this.lines))-this.max:]
+	}
+}
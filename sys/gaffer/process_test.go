@@ -23,7 +23,7 @@ func Test_Process_001(t *testing.T) {
 		t.Fatal(err)
 	} else {
 		defer instances.Destroy()
-		srv := &gaffer.Service{"ls", "ls", []string{}, rpc.Tuples{}, rpc.Tuples{}, rpc.GAFFER_MODE_MANUAL, 1, 0, 0}
+		srv := &gaffer.Service{Name_: "ls", Path_: "ls", Groups_: []string{}, Flags_: rpc.Tuples{}, Env_: rpc.Tuples{}, Mode_: rpc.GAFFER_MODE_MANUAL, InstanceCount_: 1}
 		if id := instances.GetUnusedIdentifier(); id == 0 {
 			t.Fatal("GetUnusedIdentifier returns 0")
 		} else if instance, err := instances.NewInstance(id, srv, []*gaffer.ServiceGroup{}, "/bin"); err != nil {
@@ -39,7 +39,7 @@ func Test_Process_002(t *testing.T) {
 		t.Fatal(err)
 	} else {
 		defer instances.Destroy()
-		srv := &gaffer.Service{"ls", "ls", []string{}, rpc.Tuples{}, rpc.Tuples{}, rpc.GAFFER_MODE_MANUAL, 1, 0, 0}
+		srv := &gaffer.Service{Name_: "ls", Path_: "ls", Groups_: []string{}, Flags_: rpc.Tuples{}, Env_: rpc.Tuples{}, Mode_: rpc.GAFFER_MODE_MANUAL, InstanceCount_: 1}
 		if id := instances.GetUnusedIdentifier(); id == 0 {
 			t.Fatal("GetUnusedIdentifier returns 0")
 		} else if instance, err := instances.NewInstance(id, srv, []*gaffer.ServiceGroup{}, "/bin"); err != nil {
@@ -62,7 +62,7 @@ func Test_Process_003(t *testing.T) {
 		env.SetStringForKey("C", "${A} $B $$")
 		flags.SetStringForKey("test", "${A} $B $C")
 		expected := "return_a return_b return_a return_b $"
-		srv := &gaffer.Service{"ls", "ls", []string{}, flags, env, rpc.GAFFER_MODE_MANUAL, 1, 0, 0}
+		srv := &gaffer.Service{Name_: "ls", Path_: "ls", Groups_: []string{}, Flags_: flags, Env_: env, Mode_: rpc.GAFFER_MODE_MANUAL, InstanceCount_: 1}
 		if id := instances.GetUnusedIdentifier(); id == 0 {
 			t.Fatal("GetUnusedIdentifier returns 0")
 		} else if instance, err := instances.NewInstance(id, srv, []*gaffer.ServiceGroup{}, "/bin"); err != nil {
@@ -85,7 +85,7 @@ func Test_Process_004(t *testing.T) {
 		env.SetStringForKey("B", "${C}")
 		env.SetStringForKey("C", "${A}")
 		expected := "${C}"
-		srv := &gaffer.Service{"ls", "ls", []string{}, flags, env, rpc.GAFFER_MODE_MANUAL, 1, 0, 0}
+		srv := &gaffer.Service{Name_: "ls", Path_: "ls", Groups_: []string{}, Flags_: flags, Env_: env, Mode_: rpc.GAFFER_MODE_MANUAL, InstanceCount_: 1}
 		if id := instances.GetUnusedIdentifier(); id == 0 {
 			t.Fatal("GetUnusedIdentifier returns 0")
 		} else if instance, err := instances.NewInstance(id, srv, []*gaffer.ServiceGroup{}, "/bin"); err != nil {
@@ -104,7 +104,7 @@ func Test_Process_005(t *testing.T) {
 		flags := rpc.Tuples{}
 		env := rpc.Tuples{}
 		flags.SetStringForKey("rpc.port", "${rpc.port}")
-		srv := &gaffer.Service{"ls", "ls", []string{}, flags, env, rpc.GAFFER_MODE_MANUAL, 1, 0, 0}
+		srv := &gaffer.Service{Name_: "ls", Path_: "ls", Groups_: []string{}, Flags_: flags, Env_: env, Mode_: rpc.GAFFER_MODE_MANUAL, InstanceCount_: 1}
 		if id := instances.GetUnusedIdentifier(); id == 0 {
 			t.Fatal("GetUnusedIdentifier returns 0")
 		} else if instance, err := instances.NewInstance(id, srv, []*gaffer.ServiceGroup{}, "/bin"); err != nil {
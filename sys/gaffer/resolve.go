@@ -0,0 +1,251 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package gaffer
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	// Frameworks
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// ResolvedTuple is a flag or environment value for an instance, recording
+// where the value came from
+type ResolvedTuple struct {
+	TupleValue
+
+	// Raw is the value before variables were expanded
+	Raw_ string `json:"raw"`
+
+	// Variables which were expanded in the value
+	Variables_ []*TupleValue `json:"variables,omitempty"`
+
+	// Overrides are the lower-precedence values which were not used
+	Overrides_ []*TupleValue `json:"overrides,omitempty"`
+}
+
+// TupleValue is a key and value with its origin, which is "service",
+// "@<group>", the path of an env file or "host" for tuples. For variables the origin is "env" when expanded
+// from the environment, "gaffer" when provided by gaffer or "unresolved"
+type TupleValue struct {
+	Key_    string `json:"key"`
+	Value_  string `json:"value"`
+	Origin_ string `json:"origin"`
+}
+
+// resolver merges tuples and records the origin of each value
+type resolver struct {
+	tuples   rpc.Tuples
+	resolved map[string]*ResolvedTuple
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	ORIGIN_SERVICE    = "service"
+	ORIGIN_ENV        = "env"
+	ORIGIN_GAFFER     = "gaffer"
+	ORIGIN_UNRESOLVED = "unresolved"
+	ORIGIN_HOST       = "host"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// RESOLVE TUPLES
+
+// ResolveTuples returns the flags and environment for an instance of a
+// service. The service tuples take precedence, then the group tuples in
+// order from left to right. For the environment, the tuples for a group
+// take precedence over the env files for the group, in order, and the
+// variables inherited from the gaffer environment have the lowest
+// precedence. Variables are then expanded from the environment or the
+// expander, except in inherited values. The resolved tuples are returned
+// in the same order as the flags and environment
+func ResolveTuples(service *Service, groups []*ServiceGroup, expander func(string) string) (rpc.Tuples, rpc.Tuples, []*ResolvedTuple, []*ResolvedTuple, error) {
+	flags := newResolver(service.Flags_)
+	env := newResolver(service.Env_)
+
+	// Merge the environment & flags from groups, in order from left to right
+	for _, group := range groups {
+		origin := "@" + group.Name_
+		if err := flags.merge(group.Flags_, origin); err != nil {
+			return rpc.Tuples{}, rpc.Tuples{}, nil, nil, err
+		} else if err := env.merge(group.Env_, origin); err != nil {
+			return rpc.Tuples{}, rpc.Tuples{}, nil, nil, err
+		}
+		for _, path := range group.EnvFiles_ {
+			if tuples, err := ReadEnvFile(path); err != nil {
+				return rpc.Tuples{}, rpc.Tuples{}, nil, nil, err
+			} else if err := env.merge(tuples, path); err != nil {
+				return rpc.Tuples{}, rpc.Tuples{}, nil, nil, err
+			}
+		}
+	}
+
+	// Merge the variables inherited from the gaffer environment
+	if err := env.merge(hostEnv(EnvPolicyForService(service, groups)), ORIGIN_HOST); err != nil {
+		return rpc.Tuples{}, rpc.Tuples{}, nil, nil, err
+	}
+
+	// Resolve environment parameters and then flag parameters, which are
+	// both expanded from the environment
+	env.expand(&env.tuples, expander)
+	flags.expand(&env.tuples, expander)
+
+	// Return the tuples
+	return flags.tuples, env.tuples, flags.ordered(), env.ordered(), nil
+}
+
+// ResolveArgs returns positional arguments with variables expanded from
+// the environment or the expander
+func ResolveArgs(args []string, env rpc.Tuples, expander func(string) string) []string {
+	if len(args) == 0 {
+		return nil
+	}
+	args_ := make([]string, len(args))
+	for i, arg := range args {
+		args_[i] = expandValue(arg, &env, expander, nil)
+	}
+	return args_
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// RESOLVED TUPLE IMPLEMENTATION
+
+func (this *ResolvedTuple) Raw() string {
+	return this.Raw_
+}
+
+func (this *ResolvedTuple) Variables() []rpc.GafferTupleValue {
+	return tupleValues(this.Variables_)
+}
+
+func (this *ResolvedTuple) Overrides() []rpc.GafferTupleValue {
+	return tupleValues(this.Overrides_)
+}
+
+func (this *ResolvedTuple) String() string {
+	return fmt.Sprintf("<gaffer.ResolvedTuple>{ key=%v value=%v origin=%v raw=%v variables=%v overrides=%v }", strconv.Quote(this.Key_), strconv.Quote(this.Value_), this.Origin_, strconv.Quote(this.Raw_), this.Variables_, this.Overrides_)
+}
+
+func (this *TupleValue) Key() string {
+	return this.Key_
+}
+
+func (this *TupleValue) Value() string {
+	return this.Value_
+}
+
+func (this *TupleValue) Origin() string {
+	return this.Origin_
+}
+
+func (this *TupleValue) String() string {
+	return fmt.Sprintf("<gaffer.TupleValue>{ key=%v value=%v origin=%v }", strconv.Quote(this.Key_), strconv.Quote(this.Value_), this.Origin_)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func newResolver(tuples rpc.Tuples) *resolver {
+	this := new(resolver)
+	this.tuples = tuples.Copy()
+	this.resolved = make(map[string]*ResolvedTuple, tuples.Len())
+	for _, key := range this.tuples.Keys() {
+		value := joinValues(this.tuples.StringsForKey(key))
+		this.resolved[key] = &ResolvedTuple{TupleValue: TupleValue{key, value, ORIGIN_SERVICE}, Raw_: value}
+	}
+	return this
+}
+
+// merge adds tuples which do not already exist, and records the
+// values for existing tuples as overridden
+func (this *resolver) merge(tuples rpc.Tuples, origin string) error {
+	for _, key := range tuples.Keys() {
+		values := tuples.StringsForKey(key)
+		value := joinValues(values)
+		if resolved, exists := this.resolved[key]; exists {
+			resolved.Overrides_ = append(resolved.Overrides_, &TupleValue{key, value, origin})
+		} else if err := this.tuples.SetStringsForKey(key, values); err != nil {
+			return err
+		} else {
+			this.resolved[key] = &ResolvedTuple{TupleValue: TupleValue{key, value, origin}, Raw_: value}
+		}
+	}
+	return nil
+}
+
+// expand replaces variables in the tuples with values from the
+// environment or the expander
+func (this *resolver) expand(env *rpc.Tuples, expander func(string) string) {
+	for _, key := range this.tuples.Keys() {
+		resolved := this.resolved[key]
+		if resolved.Origin_ == ORIGIN_HOST {
+			continue
+		}
+		values := this.tuples.StringsForKey(key)
+		for i, value := range values {
+			values[i] = expandValue(value, env, expander, &resolved.Variables_)
+		}
+		this.tuples.SetStringsForKey(key, values)
+		resolved.Value_ = joinValues(values)
+	}
+}
+
+// ordered returns the resolved tuples in the order of the tuples
+func (this *resolver) ordered() []*ResolvedTuple {
+	keys := this.tuples.Keys()
+	resolved := make([]*ResolvedTuple, len(keys))
+	for i, key := range keys {
+		resolved[i] = this.resolved[key]
+	}
+	return resolved
+}
+
+// expandValue replaces variables in a value with values from the
+// environment or the expander, and records the variables when
+// variables is not nil
+func expandValue(value string, env *rpc.Tuples, expander func(string) string, variables *[]*TupleValue) string {
+	return os.Expand(value, func(key string) string {
+		variable := &TupleValue{key, "${" + key + "}", ORIGIN_UNRESOLVED}
+		if env.ExistsForKey(key) {
+			variable.Value_, variable.Origin_ = env.StringForKey(key), ORIGIN_ENV
+		} else if key == "$" {
+			return key
+		} else if expander != nil {
+			if value := expander(key); value != variable.Value_ {
+				variable.Value_, variable.Origin_ = value, ORIGIN_GAFFER
+			}
+		}
+		if variables != nil {
+			*variables = append(*variables, variable)
+		}
+		return variable.Value_
+	})
+}
+
+// joinValues returns the values for a key with more than one value
+// as a comma-separated list
+func joinValues(values []string) string {
+	return strings.Join(values, ",")
+}
+
+func tupleValues(values []*TupleValue) []rpc.GafferTupleValue {
+	values_ := make([]rpc.GafferTupleValue, len(values))
+	for i, value := range values {
+		values_[i] = value
+	}
+	return values_
+}
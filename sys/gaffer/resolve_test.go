@@ -0,0 +1,162 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package gaffer_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	// Frameworks
+	rpc "github.com/djthorpe/gopi-rpc"
+	gaffer "github.com/djthorpe/gopi-rpc/sys/gaffer"
+)
+
+func Test_Resolve_001(t *testing.T) {
+	service := &gaffer.Service{Name_: "test"}
+	service.Flags_.SetStringForKey("name", "service")
+	a := &gaffer.ServiceGroup{Name_: "a"}
+	a.Flags_.SetStringForKey("name", "a")
+	a.Flags_.SetStringForKey("port", "${rpc.port}")
+	a.Env_.SetStringForKey("HOST", "localhost")
+	b := &gaffer.ServiceGroup{Name_: "b"}
+	b.Flags_.SetStringForKey("port", "80")
+	b.Flags_.SetStringForKey("addr", "${HOST}:${MISSING}")
+
+	expander := func(key string) string {
+		if key == "rpc.port" {
+			return "9000"
+		} else {
+			return "${" + key + "}"
+		}
+	}
+	flags, env, resolved_flags, resolved_env, err := gaffer.ResolveTuples(service, []*gaffer.ServiceGroup{a, b}, expander)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags.String() != "<Tuples>{ name=service,port=9000,addr=\"localhost:${MISSING}\" }" {
+		t.Error("Unexpected flags", flags)
+	}
+	if env.String() != "<Tuples>{ HOST=localhost }" {
+		t.Error("Unexpected env", env)
+	}
+	if len(resolved_flags) != 3 || len(resolved_env) != 1 {
+		t.Fatal("Unexpected resolved tuples", resolved_flags, resolved_env)
+	}
+
+	// name is from the service and overrides a
+	if r := resolved_flags[0]; r.Origin() != "service" || len(r.Overrides()) != 1 || r.Overrides()[0].Origin() != "@a" {
+		t.Error("Unexpected", r)
+	}
+	// port is from a, expanded by gaffer and overrides b
+	if r := resolved_flags[1]; r.Origin() != "@a" || r.Raw() != "${rpc.port}" || len(r.Variables()) != 1 || r.Variables()[0].Origin() != "gaffer" || len(r.Overrides()) != 1 || r.Overrides()[0].Value() != "80" {
+		t.Error("Unexpected", r)
+	}
+	// addr is from b, with one variable from env and one unresolved
+	if r := resolved_flags[2]; r.Origin() != "@b" || len(r.Variables()) != 2 || r.Variables()[0].Origin() != "env" || r.Variables()[1].Origin() != "unresolved" {
+		t.Error("Unexpected", r)
+	}
+	if r := resolved_env[0]; r.Origin() != "@a" || r.Value() != "localhost" {
+		t.Error("Unexpected", r)
+	}
+
+	// The same values are used for instances
+	if instance, err := gaffer.NewInstance(1, service, []*gaffer.ServiceGroup{a, b}, "/bin/true", expander); err != nil {
+		t.Error(err)
+	} else if instance.Flags().Equals(flags) == false {
+		t.Error("Unexpected instance flags", instance.Flags())
+	}
+	var _ rpc.GafferResolvedTuple = resolved_flags[0]
+}
+
+func Test_Resolve_002(t *testing.T) {
+	// Env file is overridden by group env, and overrides the host
+	dir, err := ioutil.TempDir("", "gaffer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.env")
+	if err := ioutil.WriteFile(path, []byte("# comment\nexport GAFFER_A=file\nGAFFER_B=\"file value\"\nGAFFER_C='${GAFFER_A}'\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("GAFFER_A", "host")
+	os.Setenv("GAFFER_D", "host")
+	os.Setenv("GAFFER_E", "host")
+	defer os.Unsetenv("GAFFER_A")
+	defer os.Unsetenv("GAFFER_D")
+	defer os.Unsetenv("GAFFER_E")
+
+	service := &gaffer.Service{Name_: "test"}
+	a := &gaffer.ServiceGroup{Name_: "a", EnvFiles_: []string{path}}
+	a.Env_.SetStringForKey("GAFFER_B", "group")
+	expander := func(key string) string { return "${" + key + "}" }
+
+	// With the default policy nothing is inherited
+	if _, env, _, _, err := gaffer.ResolveTuples(service, []*gaffer.ServiceGroup{a}, expander); err != nil {
+		t.Fatal(err)
+	} else if env.String() != "<Tuples>{ GAFFER_B=group,GAFFER_A=file,GAFFER_C=file }" {
+		t.Error("Unexpected env", env)
+	}
+
+	// With the allow policy on the group, only GAFFER_D is inherited
+	a.EnvPolicy_ = rpc.GAFFER_ENV_ALLOW
+	a.EnvAllow_ = []string{"GAFFER_D"}
+	if _, env, _, resolved_env, err := gaffer.ResolveTuples(service, []*gaffer.ServiceGroup{a}, expander); err != nil {
+		t.Fatal(err)
+	} else if env.StringForKey("GAFFER_D") != "host" || env.ExistsForKey("GAFFER_E") {
+		t.Error("Unexpected env", env)
+	} else {
+		for _, r := range resolved_env {
+			switch r.Key() {
+			case "GAFFER_B":
+				// Group overrides file
+				if r.Origin() != "@a" || r.Value() != "group" || len(r.Overrides()) != 1 || r.Overrides()[0].Value() != "file value" {
+					t.Error("Unexpected", r)
+				}
+			case "GAFFER_D":
+				if r.Origin() != gaffer.ORIGIN_HOST {
+					t.Error("Unexpected", r)
+				}
+			}
+		}
+	}
+
+	// The service policy takes precedence over the group policy
+	service.EnvPolicy_ = rpc.GAFFER_ENV_INHERIT
+	if _, env, _, resolved_env, err := gaffer.ResolveTuples(service, []*gaffer.ServiceGroup{a}, expander); err != nil {
+		t.Fatal(err)
+	} else if env.StringForKey("GAFFER_E") != "host" {
+		t.Error("Unexpected env", env)
+	} else {
+		// File overrides host
+		for _, r := range resolved_env {
+			if r.Key() == "GAFFER_A" && (r.Origin() != path || len(r.Overrides()) != 1 || r.Overrides()[0].Origin() != gaffer.ORIGIN_HOST) {
+				t.Error("Unexpected", r)
+			}
+		}
+	}
+	if instance, err := gaffer.NewInstance(1, service, []*gaffer.ServiceGroup{a}, "/bin/true", expander); err != nil {
+		t.Error(err)
+	} else {
+		found := false
+		for _, variable := range instance.Env_.Environ() {
+			if variable == "GAFFER_B=group" {
+				found = true
+			} else if strings.HasPrefix(variable, "GAFFER_A=") && variable != "GAFFER_A=file" {
+				t.Error("Unexpected variable", variable)
+			}
+		}
+		if found == false {
+			t.Error("Missing variable GAFFER_B")
+		}
+	}
+}
@@ -0,0 +1,333 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package gaffer
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// rollouts records the services which are being scaled or restarted
+type rollouts struct {
+	sync.Mutex
+	services map[*Service]bool
+}
+
+type replacement struct {
+	old, new *ServiceInstance
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	// ROLLOUT_START_TIMEOUT is the time to wait for an instance to start or stop
+	ROLLOUT_START_TIMEOUT = 10 * time.Second
+
+	// ROLLOUT_SETTLE_TIME is the default time a new instance needs to keep
+	// running during a rolling restart before the old instance is stopped
+	ROLLOUT_SETTLE_TIME = 5 * time.Second
+
+	// ROLLOUT_POLL is the interval for polling instance state
+	ROLLOUT_POLL = 100 * time.Millisecond
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// SCALE AND RESTART
+
+// ScaleServiceForName starts or stops instances of a service until the number
+// of running instances equals count. The instance count of the service is
+// set to count, and restored when an instance cannot be started or stopped.
+// The newest instances are stopped first
+func (this *gaffer) ScaleServiceForName(service string, count uint, progress chan<- rpc.GafferEvent) error {
+	this.log.Debug2("<gaffer>ScaleServiceForName{ service=%v count=%v }", strconv.Quote(service), count)
+
+	if service == "" {
+		return gopi.ErrBadParameter
+	} else if service_ := this.config.GetServiceByName(service); service_ == nil {
+		return gopi.ErrNotFound
+	} else if err := this.lockRollout(service_); err != nil {
+		return err
+	} else {
+		defer this.unlockRollout(service_)
+
+		// Raise or lower the instance count, which needs to be set before
+		// instances of a disabled service can be started
+		previous := service_.InstanceCount()
+		if count != previous {
+			if err := this.SetServiceInstanceCountForName(service, count); err != nil {
+				return err
+			}
+		}
+
+		// Start or stop instances
+		instances := this.runningInstancesForService(service_)
+		this.emitProgress(progress, service_, nil, "Scaling from %v to %v instances", len(instances), count)
+		for i := uint(len(instances)); i < count; i++ {
+			if instance, err := this.startInstance(service_, ROLLOUT_START_TIMEOUT, 0); err != nil {
+				this.emitProgress(progress, service_, instance, "Start failed: %v", err)
+				this.restoreInstanceCount(service_, previous)
+				return err
+			} else {
+				this.emitProgress(progress, service_, instance, "Started instance %v", instance.Id())
+			}
+		}
+		for i := count; i < uint(len(instances)); i++ {
+			instance := instances[len(instances)-int(i-count)-1]
+			if err := this.stopInstance(instance, ROLLOUT_START_TIMEOUT); err != nil {
+				this.emitProgress(progress, service_, instance, "Stop failed: %v", err)
+				this.restoreInstanceCount(service_, previous)
+				return err
+			} else {
+				this.emitProgress(progress, service_, instance, "Stopped instance %v", instance.Id())
+			}
+		}
+	}
+
+	// Success
+	return nil
+}
+
+// RestartServiceForName replaces running instances of a service one at a time.
+// Each new instance needs to keep running for the settle time before the
+// instance it replaces is stopped. When a new instance fails or an old
+// instance cannot be stopped, the restart is aborted and the instances which
+// were already replaced are restored with their original flags, environment
+// and executable
+func (this *gaffer) RestartServiceForName(service string, settle time.Duration, progress chan<- rpc.GafferEvent) error {
+	this.log.Debug2("<gaffer>RestartServiceForName{ service=%v settle=%v }", strconv.Quote(service), settle)
+
+	if settle == 0 {
+		settle = ROLLOUT_SETTLE_TIME
+	}
+	if service == "" {
+		return gopi.ErrBadParameter
+	} else if service_ := this.config.GetServiceByName(service); service_ == nil {
+		return gopi.ErrNotFound
+	} else if err := this.lockRollout(service_); err != nil {
+		return err
+	} else {
+		defer this.unlockRollout(service_)
+
+		instances := this.runningInstancesForService(service_)
+		replaced := make([]replacement, 0, len(instances))
+		this.emitProgress(progress, service_, nil, "Restarting %v instances", len(instances))
+		for _, instance := range instances {
+			new, err := this.startInstance(service_, ROLLOUT_START_TIMEOUT, settle)
+			if err != nil {
+				this.emitProgress(progress, service_, new, "Replacement for instance %v failed: %v", instance.Id(), err)
+				if new != nil && new.IsRunning() {
+					if err := this.stopInstance(new, ROLLOUT_START_TIMEOUT); err != nil {
+						this.emitProgress(progress, service_, new, "Stop failed: %v", err)
+					}
+				}
+				this.rollback(service_, replaced, settle, progress)
+				return fmt.Errorf("Restart of %v aborted: %v", strconv.Quote(service), err)
+			}
+			this.emitProgress(progress, service_, new, "Started instance %v to replace instance %v", new.Id(), instance.Id())
+			if err := this.stopInstance(instance, ROLLOUT_START_TIMEOUT); err != nil {
+				// Keep the old instance and remove its replacement
+				this.emitProgress(progress, service_, instance, "Stop failed: %v", err)
+				if err := this.stopInstance(new, ROLLOUT_START_TIMEOUT); err != nil {
+					this.emitProgress(progress, service_, new, "Stop failed: %v", err)
+				}
+				this.rollback(service_, replaced, settle, progress)
+				return fmt.Errorf("Restart of %v aborted: %v", strconv.Quote(service), err)
+			} else {
+				this.emitProgress(progress, service_, instance, "Stopped instance %v", instance.Id())
+			}
+			replaced = append(replaced, replacement{instance, new})
+		}
+		this.emitProgress(progress, service_, nil, "Restarted %v instances", len(replaced))
+	}
+
+	// Success
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// rollback restores replaced instances in reverse order, using the
+// executable each instance was started from
+func (this *gaffer) rollback(service *Service, replaced []replacement, settle time.Duration, progress chan<- rpc.GafferEvent) {
+	for i := len(replaced) - 1; i >= 0; i-- {
+		r := replaced[i]
+		if id := this.Instances.GetUnusedIdentifier(); id == 0 {
+			this.emitProgress(progress, service, r.old, "Rollback of instance %v failed: %v", r.old.Id(), gopi.ErrOutOfOrder)
+		} else if path, err := this.executableForInstance(r.old); err != nil {
+			this.emitProgress(progress, service, r.old, "Rollback of instance %v failed: %v", r.old.Id(), err)
+		} else if instance, err := this.Instances.CopyInstance(id, r.old, path); err != nil {
+			this.emitProgress(progress, service, r.old, "Rollback of instance %v failed: %v", r.old.Id(), err)
+		} else {
+			this.EmitInstance(rpc.GAFFER_EVENT_INSTANCE_ADD, instance)
+			if err := this.waitForStart(instance, ROLLOUT_START_TIMEOUT, settle); err != nil {
+				this.emitProgress(progress, service, instance, "Rollback of instance %v failed: %v", r.old.Id(), err)
+			} else if err := this.stopInstance(r.new, ROLLOUT_START_TIMEOUT); err != nil {
+				this.emitProgress(progress, service, r.new, "Stop failed: %v", err)
+			} else {
+				this.emitProgress(progress, service, instance, "Restored instance %v as instance %v", r.old.Id(), instance.Id())
+			}
+		}
+	}
+}
+
+// restoreInstanceCount sets the instance count of a service back to the
+// count before it was scaled
+func (this *gaffer) restoreInstanceCount(service *Service, count uint) {
+	if service.InstanceCount() == count {
+		return
+	} else if err := this.SetServiceInstanceCountForName(service.Name(), count); err != nil {
+		this.log.Warn("ScaleServiceForName: %v: %v", service.Name(), err)
+	}
+}
+
+// executableForInstance returns the path of the executable an instance was
+// started from. When the executable has since been replaced, the previous
+// version with the same checksum is returned
+func (this *gaffer) executableForInstance(instance *ServiceInstance) (string, error) {
+	if instance.Executable_ == nil {
+		return instance.Path_, nil
+	} else if executable, err := this.Instances.GetExecutableForPath(instance.Path_); err == nil && executable.Checksum_ == instance.Executable_.Checksum_ {
+		return instance.Path_, nil
+	} else if root, err := this.config.Root(); err != nil {
+		return "", err
+	} else if path, err := filepath.Rel(root, instance.Path_); err != nil {
+		return "", err
+	} else if versions, err := versionsForExecutable(root, path); err != nil {
+		return "", err
+	} else {
+		for _, version := range versions {
+			if executable, err := this.Instances.GetExecutableForPath(version); err == nil && executable.Checksum_ == instance.Executable_.Checksum_ {
+				return version, nil
+			}
+		}
+		return "", fmt.Errorf("The executable for instance %v is no longer kept", instance.Id())
+	}
+}
+
+// startInstance starts a new instance of a service and waits for it to be
+// running for the settle time
+func (this *gaffer) startInstance(service *Service, timeout, settle time.Duration) (*ServiceInstance, error) {
+	if id := this.Instances.GetUnusedIdentifier(); id == 0 {
+		return nil, gopi.ErrOutOfOrder
+	} else if _, err := this.StartInstanceForServiceName(service.Name(), id); err != nil {
+		return nil, err
+	} else if instance := this.Instances.GetInstanceForId(id); instance == nil {
+		return nil, gopi.ErrAppError
+	} else if err := this.waitForStart(instance, timeout, settle); err != nil {
+		return instance, err
+	} else {
+		return instance, nil
+	}
+}
+
+// stopInstance stops an instance and waits for it to end
+func (this *gaffer) stopInstance(instance *ServiceInstance, timeout time.Duration) error {
+	if instance.IsRunning() == false {
+		return nil
+	} else if err := this.Instances.Stop(instance, this.evt); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(ROLLOUT_POLL)
+	defer ticker.Stop()
+	deadline := time.Now().Add(timeout)
+	for range ticker.C {
+		if instance.IsRunning() == false {
+			return nil
+		} else if time.Now().After(deadline) {
+			return gopi.ErrDeadlineExceeded
+		}
+	}
+	return nil
+}
+
+// waitForStart waits until an instance is running and then for it to
+// continue running for the settle time
+func (this *gaffer) waitForStart(instance *ServiceInstance, timeout, settle time.Duration) error {
+	ticker := time.NewTicker(ROLLOUT_POLL)
+	defer ticker.Stop()
+	deadline := time.Now().Add(timeout)
+	for range ticker.C {
+		if instance.Stop().IsZero() == false {
+			return fmt.Errorf("Instance %v exited with code %v", instance.Id(), instance.ExitCode())
+		} else if instance.Start().IsZero() == false && time.Since(instance.Start()) >= settle {
+			return nil
+		} else if instance.Start().IsZero() && time.Now().After(deadline) {
+			return gopi.ErrDeadlineExceeded
+		}
+	}
+	return nil
+}
+
+// runningInstancesForService returns the running instances for a service,
+// in order of start time
+func (this *gaffer) runningInstancesForService(service *Service) []*ServiceInstance {
+	instances := make([]*ServiceInstance, 0)
+	for _, instance := range this.Instances.GetInstances() {
+		if instance_, ok := instance.(*ServiceInstance); ok == false {
+			continue
+		} else if instance_.Service_ != service || instance_.IsRunning() == false {
+			continue
+		} else {
+			instances = append(instances, instance_)
+		}
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].Start().Before(instances[j].Start())
+	})
+	return instances
+}
+
+// lockRollout ensures only one scale or restart operation is in progress
+// for a service
+func (this *gaffer) lockRollout(service *Service) error {
+	this.rollouts.Lock()
+	defer this.rollouts.Unlock()
+	if this.rollouts.services == nil {
+		this.rollouts.services = make(map[*Service]bool)
+	}
+	if this.rollouts.services[service] {
+		return fmt.Errorf("Service %v is already being scaled or restarted", strconv.Quote(service.Name()))
+	} else {
+		this.rollouts.services[service] = true
+		return nil
+	}
+}
+
+func (this *gaffer) unlockRollout(service *Service) {
+	this.rollouts.Lock()
+	defer this.rollouts.Unlock()
+	delete(this.rollouts.services, service)
+}
+
+func (this *gaffer) emitProgress(progress chan<- rpc.GafferEvent, service *Service, instance *ServiceInstance, format string, args ...interface{}) {
+	data := []byte(fmt.Sprintf(format, args...))
+	var evt *Event
+	if instance != nil {
+		evt = NewEventWithInstanceData(this, rpc.GAFFER_EVENT_SERVICE_PROGRESS, instance, data)
+	} else {
+		evt = NewEventWithServiceData(this, rpc.GAFFER_EVENT_SERVICE_PROGRESS, service, data)
+	}
+	this.Emit(evt)
+	if progress != nil {
+		progress <- evt
+	}
+}
@@ -0,0 +1,380 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package gaffer
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	// Frameworks
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// secrets_ are the values for secret keys, which are written to a separate
+// file from the configuration, keyed by service and group name
+type secrets_ struct {
+	Services map[string]*secretTuples `json:"services"`
+	Groups   map[string]*secretTuples `json:"groups"`
+}
+
+type secretTuples struct {
+	Flags_ rpc.Tuples `json:"flags"`
+	Env_   rpc.Tuples `json:"env"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	// SECRETS_EXT replaces the extension of the configuration file
+	SECRETS_EXT = ".secrets"
+
+	// SECRETS_PATTERNS are the default patterns for secret keys
+	SECRETS_PATTERNS = "*TOKEN*,*SECRET*,*PASSWORD*"
+
+	// SECRETS_HEADER starts a secrets file which is encrypted
+	SECRETS_HEADER = "gaffer.secrets.aes-gcm\n"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// INIT
+
+// initSecrets sets the key patterns for secret keys, and reads the key
+// for encrypting secrets from a file when the path is not empty
+func (this *config) initSecrets(patterns []string, path string) error {
+	this.patterns = make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		if pattern = strings.ToUpper(strings.TrimSpace(pattern)); pattern == "" {
+			continue
+		} else if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid secret pattern: %v", strconv.Quote(pattern))
+		} else {
+			this.patterns = append(this.patterns, pattern)
+		}
+	}
+	if path == "" {
+		this.key = nil
+	} else if data, err := ioutil.ReadFile(path); err != nil {
+		return err
+	} else if len(bytes.TrimSpace(data)) == 0 {
+		return fmt.Errorf("Empty key file: %v", path)
+	} else {
+		key := sha256.Sum256(bytes.TrimSpace(data))
+		this.key = key[:]
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// MARK SECRETS
+
+// markSecrets returns the secret keys together with the keys in the tuples
+// which match a secret key pattern
+func (this *config) markSecrets(secrets []string, tuples ...rpc.Tuples) []string {
+	secrets_ := append([]string{}, secrets...)
+	for _, tuples_ := range tuples {
+		for _, key := range tuples_.Keys() {
+			if stringArrayContains(secrets_, key) == false && this.matchSecret(key) {
+				secrets_ = append(secrets_, key)
+			}
+		}
+	}
+	return secrets_
+}
+
+// matchSecret returns true if a key matches a secret key pattern,
+// ignoring case
+func (this *config) matchSecret(key string) bool {
+	key = strings.ToUpper(key)
+	for _, pattern := range this.patterns {
+		if match, _ := filepath.Match(pattern, key); match {
+			return true
+		}
+	}
+	return false
+}
+
+// markAllSecrets marks the secret keys for all services and groups,
+// and returns true if any keys were marked
+func (this *config) markAllSecrets() bool {
+	marked := false
+	for _, service := range this.Services {
+		if secrets := this.markSecrets(service.Secrets_, service.Flags_); len(secrets) != len(service.Secrets_) {
+			service.Secrets_, marked = secrets, true
+		}
+	}
+	for _, group := range this.ServiceGroups {
+		if secrets := this.markSecrets(group.Secrets_, group.Flags_, group.Env_); len(secrets) != len(group.Secrets_) {
+			group.Secrets_, marked = secrets, true
+		}
+	}
+	return marked
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// READ AND WRITE SECRETS
+
+// secretsPath returns the path to the secrets file for a configuration file
+func secretsPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + SECRETS_EXT
+}
+
+// redacted returns the configuration with the values of secret keys
+// replaced, for writing to the configuration file
+func (this *config) redacted() config_ {
+	config := config_{
+		BinRoot:       this.config_.BinRoot,
+		Services:      make([]*Service, len(this.Services)),
+		ServiceGroups: make([]*ServiceGroup, len(this.ServiceGroups)),
+	}
+	for i, service := range this.Services {
+		config.Services[i] = CopyService(service)
+		config.Services[i].Flags_ = service.Flags_.Redact(service.Secrets_)
+	}
+	for i, group := range this.ServiceGroups {
+		config.ServiceGroups[i] = CopyGroup(group)
+		config.ServiceGroups[i].Flags_ = group.Flags_.Redact(group.Secrets_)
+		config.ServiceGroups[i].Env_ = group.Env_.Redact(group.Secrets_)
+	}
+	return config
+}
+
+// secrets returns the values of secret keys for services and groups
+func (this *config) secrets() secrets_ {
+	secrets := secrets_{
+		Services: make(map[string]*secretTuples),
+		Groups:   make(map[string]*secretTuples),
+	}
+	for _, service := range this.Services {
+		if len(service.Secrets_) > 0 {
+			secrets.Services[service.Name_] = &secretTuples{
+				Flags_: selectKeys(service.Flags_, service.Secrets_),
+			}
+		}
+	}
+	for _, group := range this.ServiceGroups {
+		if len(group.Secrets_) > 0 {
+			secrets.Groups[group.Name_] = &secretTuples{
+				Flags_: selectKeys(group.Flags_, group.Secrets_),
+				Env_:   selectKeys(group.Env_, group.Secrets_),
+			}
+		}
+	}
+	return secrets
+}
+
+// WriteSecrets writes the values of secret keys to a file which can only
+// be read by the owner, encrypting them when there is a key. The file is not
+// created when there are no secrets
+func (this *config) WriteSecrets(path string) error {
+	secrets := this.secrets()
+	if len(secrets.Services) == 0 && len(secrets.Groups) == 0 {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil
+		}
+	}
+	if data, err := json.Marshal(secrets); err != nil {
+		return err
+	} else if data, err := this.encrypt(data); err != nil {
+		return err
+	} else if fh, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600); err != nil {
+		return err
+	} else {
+		defer fh.Close()
+		if err := fh.Chmod(0600); err != nil {
+			return err
+		} else if _, err := fh.Write(data); err != nil {
+			return err
+		}
+	}
+
+	// Success
+	return nil
+}
+
+// ReadSecrets reads the values of secret keys from a file and restores
+// them into the services and groups. It is not an error if the file
+// does not exist
+func (this *config) ReadSecrets(path string) error {
+	var secrets secrets_
+	if data, err := ioutil.ReadFile(path); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	} else if data, err := this.decrypt(data); err != nil {
+		return err
+	} else if err := json.Unmarshal(data, &secrets); err != nil {
+		return err
+	}
+	for _, service := range this.Services {
+		if secrets_, exists := secrets.Services[service.Name_]; exists {
+			service.Flags_ = restoreRedacted(service.Flags_, secrets_.Flags_)
+		}
+	}
+	for _, group := range this.ServiceGroups {
+		if secrets_, exists := secrets.Groups[group.Name_]; exists {
+			group.Flags_ = restoreRedacted(group.Flags_, secrets_.Flags_)
+			group.Env_ = restoreRedacted(group.Env_, secrets_.Env_)
+		}
+	}
+
+	// Success
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// ENCRYPT AND DECRYPT
+
+// encrypt returns the data encrypted with the key, or the data
+// unchanged when there is no key
+func (this *config) encrypt(data []byte) ([]byte, error) {
+	if this.key == nil {
+		return data, nil
+	} else if block, err := aes.NewCipher(this.key); err != nil {
+		return nil, err
+	} else if gcm, err := cipher.NewGCM(block); err != nil {
+		return nil, err
+	} else {
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return nil, err
+		}
+		return gcm.Seal(append([]byte(SECRETS_HEADER), nonce...), nonce, data, nil), nil
+	}
+}
+
+// decrypt returns the data decrypted with the key, or the data unchanged
+// when it is not encrypted. The configuration is marked as modified when
+// there is a key and the data is not encrypted, so that it is encrypted
+// when next written
+func (this *config) decrypt(data []byte) ([]byte, error) {
+	if bytes.HasPrefix(data, []byte(SECRETS_HEADER)) == false {
+		if this.key != nil {
+			this.modified = true
+		}
+		return data, nil
+	} else if this.key == nil {
+		return nil, fmt.Errorf("Secrets are encrypted, use the -gaffer.key flag")
+	} else if block, err := aes.NewCipher(this.key); err != nil {
+		return nil, err
+	} else if gcm, err := cipher.NewGCM(block); err != nil {
+		return nil, err
+	} else if data = data[len(SECRETS_HEADER):]; len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("Invalid secrets file")
+	} else if data, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil); err != nil {
+		return nil, fmt.Errorf("Unable to decrypt secrets, check the -gaffer.key flag")
+	} else {
+		return data, nil
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// REDACT AND RESTORE
+
+// restoreRedacted returns tuples where redacted values are replaced
+// with the existing values, so that tuples which were returned redacted
+// can be set without losing secret values
+func restoreRedacted(tuples, existing rpc.Tuples) rpc.Tuples {
+	tuples = tuples.Copy()
+	for _, key := range tuples.Keys() {
+		if values := tuples.StringsForKey(key); len(values) != 1 || values[0] != rpc.TUPLES_REDACTED {
+			continue
+		} else if existing.ExistsForKey(key) {
+			tuples.SetStringsForKey(key, existing.StringsForKey(key))
+		}
+	}
+	return tuples
+}
+
+// selectKeys returns tuples with only the keys which are in keys
+func selectKeys(tuples rpc.Tuples, keys []string) rpc.Tuples {
+	tuples = tuples.Copy()
+	for _, key := range tuples.Keys() {
+		if stringArrayContains(keys, key) == false {
+			tuples.RemoveForKey(key)
+		}
+	}
+	return tuples
+}
+
+// secretsForInstance returns the secret keys for an instance, which are
+// the secret keys of the service and groups, and keys with values which
+// were expanded from secret environment variables
+func secretsForInstance(service *Service, groups []*ServiceGroup, flags, env []*ResolvedTuple) []string {
+	secrets := append([]string{}, service.Secrets_...)
+	for _, group := range groups {
+		for _, key := range group.Secrets_ {
+			if stringArrayContains(secrets, key) == false {
+				secrets = append(secrets, key)
+			}
+		}
+	}
+	for _, resolved := range append(append([]*ResolvedTuple{}, env...), flags...) {
+		if stringArrayContains(secrets, resolved.Key_) {
+			continue
+		}
+		for _, variable := range resolved.Variables_ {
+			if variable.Origin_ == ORIGIN_ENV && stringArrayContains(secrets, variable.Key_) {
+				secrets = append(secrets, resolved.Key_)
+				break
+			}
+		}
+	}
+	return secrets
+}
+
+// redactResolved replaces the values for secret keys in resolved tuples,
+// including overridden values and secret variables
+func redactResolved(resolved []*ResolvedTuple, secrets []string) {
+	for _, tuple := range resolved {
+		if stringArrayContains(secrets, tuple.Key_) {
+			tuple.Value_, tuple.Raw_ = rpc.TUPLES_REDACTED, rpc.TUPLES_REDACTED
+			for _, override := range tuple.Overrides_ {
+				override.Value_ = rpc.TUPLES_REDACTED
+			}
+		}
+		for _, variable := range tuple.Variables_ {
+			if variable.Origin_ == ORIGIN_ENV && stringArrayContains(secrets, variable.Key_) {
+				variable.Value_ = rpc.TUPLES_REDACTED
+			}
+		}
+	}
+}
+
+// redactArgs returns positional arguments where the values of secret
+// environment variables are replaced
+func redactArgs(args []string, env rpc.Tuples, secrets []string) []string {
+	if len(args) == 0 || len(secrets) == 0 {
+		return args
+	}
+	args_ := make([]string, len(args))
+	for i, arg := range args {
+		for _, key := range secrets {
+			if value := env.StringForKey(key); value != "" {
+				arg = strings.Replace(arg, value, rpc.TUPLES_REDACTED, -1)
+			}
+		}
+		args_[i] = arg
+	}
+	return args_
+}
@@ -10,7 +10,6 @@ package gaffer
 
 import (
 	"fmt"
-	"os"
 	"strconv"
 	"time"
 
@@ -35,9 +34,19 @@ type Service struct {
 	// Flags for the command line
 	Flags_ rpc.Tuples `json:"flags"`
 
+	// FlagStyle determines how flags are passed to the executable
+	FlagStyle_ rpc.GafferFlagStyle `json:"flag_style"`
+
+	// Args are positional arguments which follow the flags
+	Args_ []string `json:"args,omitempty"`
+
 	// Env for the command line (not used)
 	Env_ rpc.Tuples `json:"-"`
 
+	// Labels are key/value pairs used for selecting services
+	// and their instances
+	Labels_ rpc.Tuples `json:"labels"`
+
 	// Mode is whether the instances are started automatically
 	Mode_ rpc.GafferServiceMode `json:"mode"`
 
@@ -51,17 +60,63 @@ type Service struct {
 	// IdleTime determines the time the instance should be stopped before
 	// it can be restarted, when in auto mode, or zero otherwise
 	IdleTime_ time.Duration `json:"idle_time"`
+
+	// UpgradePolicy determines what happens to running instances
+	// when the executable changes
+	UpgradePolicy_ rpc.GafferUpgradePolicy `json:"upgrade_policy"`
+
+	// Version is incremented when the flags or labels change
+	Version_ uint64 `json:"version"`
+
+	// Secrets are keys for flags with values which are redacted
+	Secrets_ []string `json:"secrets,omitempty"`
+
+	// EnvPolicy determines which variables are inherited from the gaffer
+	// environment, and EnvAllow are the variables for the allow policy
+	EnvPolicy_ rpc.GafferEnvPolicy `json:"env_policy"`
+	EnvAllow_  []string            `json:"env_allow,omitempty"`
+
+	// Hooks are commands which are run at each stage of the lifecycle
+	// of an instance
+	Hooks_ []rpc.GafferHook `json:"hooks,omitempty"`
+
+	// Private members
+	stale bool
 }
 
 type ServiceGroup struct {
 	// Name is unique name for the service group
 	Name_ string `json:"name"`
 
+	// Groups is a list of groups this group includes, which have lower
+	// precedence than the group itself
+	Groups_ []string `json:"groups,omitempty"`
+
 	// Flags for the command line
 	Flags_ rpc.Tuples `json:"flags"`
 
 	// Environment parameters for the instance
 	Env_ rpc.Tuples `json:"env"`
+
+	// Version is incremented when the flags or environment change
+	Version_ uint64 `json:"version"`
+
+	// Secrets are keys for flags and environment with values which
+	// are redacted
+	Secrets_ []string `json:"secrets,omitempty"`
+
+	// EnvPolicy determines which variables are inherited from the gaffer
+	// environment, and EnvAllow are the variables for the allow policy
+	EnvPolicy_ rpc.GafferEnvPolicy `json:"env_policy"`
+	EnvAllow_  []string            `json:"env_allow,omitempty"`
+
+	// EnvFiles are files in the .env format which are read into the
+	// environment when instances are started
+	EnvFiles_ []string `json:"env_files,omitempty"`
+
+	// Hooks are commands which are run at each stage of the lifecycle
+	// of an instance, before the hooks for the service
+	Hooks_ []rpc.GafferHook `json:"hooks,omitempty"`
 }
 
 type ServiceInstance struct {
@@ -77,15 +132,34 @@ type ServiceInstance struct {
 	// Flags for the command line
 	Flags_ rpc.Tuples `json:"flags"`
 
+	// Positional arguments for the command line
+	Args_ []string `json:"args,omitempty"`
+
 	// Environment parameters for the instance
 	Env_ rpc.Tuples `json:"env"`
 
+	// Labels for the instance
+	Labels_ rpc.Tuples `json:"labels"`
+
+	// Secrets are keys for flags and environment with values which
+	// are redacted, but which are passed to the process
+	Secrets_ []string `json:"secrets,omitempty"`
+
 	// Start timestamp
 	Start_ time.Time `json:"start_ts"`
 
 	// Stop timestamp
 	Stop_ time.Time `json:"stop_ts"`
 
+	// Executable the instance was started from
+	Executable_ *Executable `json:"executable"`
+
+	// Run directory, which is removed when the instance stops
+	RunDir_ string `json:"rundir,omitempty"`
+
+	// Hooks for the groups and service, in the order they are run
+	Hooks_ []rpc.GafferHook `json:"hooks,omitempty"`
+
 	// Private members
 	process *Process
 	stdout  chan []byte
@@ -126,10 +200,19 @@ func CopyService(service *Service) *Service {
 		this.Groups_[i] = group
 	}
 	this.Flags_ = service.Flags_.Copy()
+	this.FlagStyle_ = service.FlagStyle_
+	this.Args_ = append([]string{}, service.Args_...)
 	this.Env_ = service.Env_.Copy()
+	this.Labels_ = service.Labels_.Copy()
 	this.InstanceCount_ = service.InstanceCount_
 	this.RunTime_ = service.RunTime_
 	this.IdleTime_ = service.IdleTime_
+	this.UpgradePolicy_ = service.UpgradePolicy_
+	this.Version_ = service.Version_
+	this.Secrets_ = append([]string{}, service.Secrets_...)
+	this.EnvPolicy_ = service.EnvPolicy_
+	this.EnvAllow_ = append([]string{}, service.EnvAllow_...)
+	this.Hooks_ = append([]rpc.GafferHook{}, service.Hooks_...)
 	return this
 }
 
@@ -161,6 +244,14 @@ func (this *Service) InstanceCount() uint {
 	return this.InstanceCount_
 }
 
+func (this *Service) UpgradePolicy() rpc.GafferUpgradePolicy {
+	return this.UpgradePolicy_
+}
+
+func (this *Service) IsStale() bool {
+	return this.stale
+}
+
 func (this *Service) IsMemberOfGroup(group string) bool {
 	for _, group_ := range this.Groups_ {
 		if group_ == group {
@@ -171,11 +262,43 @@ func (this *Service) IsMemberOfGroup(group string) bool {
 }
 
 func (this *Service) Flags() rpc.Tuples {
-	return this.Flags_
+	return this.Flags_.Redact(this.Secrets_)
+}
+
+func (this *Service) Labels() rpc.Tuples {
+	return this.Labels_
+}
+
+func (this *Service) Version() uint64 {
+	return this.Version_
+}
+
+func (this *Service) Secrets() []string {
+	return this.Secrets_
+}
+
+func (this *Service) EnvPolicy() rpc.GafferEnvPolicy {
+	return this.EnvPolicy_
+}
+
+func (this *Service) EnvAllow() []string {
+	return this.EnvAllow_
+}
+
+func (this *Service) Hooks() []rpc.GafferHook {
+	return this.Hooks_
+}
+
+func (this *Service) FlagStyle() rpc.GafferFlagStyle {
+	return this.FlagStyle_
+}
+
+func (this *Service) Args() []string {
+	return this.Args_
 }
 
 func (this *Service) String() string {
-	return fmt.Sprintf("<gaffer.Service>{ name=%v groups=%v flags=%v mode=%v path=%v run_time=%v idle_time=%v instance_count=%v  }", strconv.Quote(this.Name_), this.Groups(), this.Flags(), this.Mode_, strconv.Quote(this.Path_), this.RunTime_, this.IdleTime_, this.InstanceCount_)
+	return fmt.Sprintf("<gaffer.Service>{ name=%v groups=%v flags=%v flag_style=%v args=%v labels=%v mode=%v path=%v run_time=%v idle_time=%v instance_count=%v upgrade_policy=%v stale=%v }", strconv.Quote(this.Name_), this.Groups(), this.Flags(), this.FlagStyle_, this.Args_, this.Labels_, this.Mode_, strconv.Quote(this.Path_), this.RunTime_, this.IdleTime_, this.InstanceCount_, this.UpgradePolicy_, this.stale)
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -199,8 +322,15 @@ func CopyGroup(group *ServiceGroup) *ServiceGroup {
 	if this := NewGroup(group.Name_); this == nil {
 		return nil
 	} else {
+		this.Groups_ = append([]string{}, group.Groups_...)
 		this.Flags_ = group.Flags_.Copy()
 		this.Env_ = group.Env_.Copy()
+		this.Version_ = group.Version_
+		this.Secrets_ = append([]string{}, group.Secrets_...)
+		this.EnvPolicy_ = group.EnvPolicy_
+		this.EnvAllow_ = append([]string{}, group.EnvAllow_...)
+		this.EnvFiles_ = append([]string{}, group.EnvFiles_...)
+		this.Hooks_ = append([]rpc.GafferHook{}, group.Hooks_...)
 		return this
 	}
 }
@@ -209,16 +339,44 @@ func (this *ServiceGroup) Name() string {
 	return this.Name_
 }
 
+func (this *ServiceGroup) Groups() []string {
+	return this.Groups_
+}
+
+func (this *ServiceGroup) Version() uint64 {
+	return this.Version_
+}
+
+func (this *ServiceGroup) Secrets() []string {
+	return this.Secrets_
+}
+
+func (this *ServiceGroup) EnvPolicy() rpc.GafferEnvPolicy {
+	return this.EnvPolicy_
+}
+
+func (this *ServiceGroup) EnvAllow() []string {
+	return this.EnvAllow_
+}
+
+func (this *ServiceGroup) EnvFiles() []string {
+	return this.EnvFiles_
+}
+
+func (this *ServiceGroup) Hooks() []rpc.GafferHook {
+	return this.Hooks_
+}
+
 func (this *ServiceGroup) Flags() rpc.Tuples {
-	return this.Flags_
+	return this.Flags_.Redact(this.Secrets_)
 }
 
 func (this *ServiceGroup) Env() rpc.Tuples {
-	return this.Env_
+	return this.Env_.Redact(this.Secrets_)
 }
 
 func (this *ServiceGroup) String() string {
-	return fmt.Sprintf("<gaffer.ServiceGroup>{ name=%v flags=%v env=%v }", strconv.Quote(this.Name_), this.Flags_, this.Env_)
+	return fmt.Sprintf("<gaffer.ServiceGroup>{ name=%v groups=%v flags=%v env=%v }", strconv.Quote(this.Name_), this.Groups(), this.Flags(), this.Env())
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -235,63 +393,69 @@ func NewInstance(id uint32, service *Service, groups []*ServiceGroup, path strin
 	this.Service_ = service
 	this.Path_ = path
 	this.Id_ = id
-	this.Flags_ = service.Flags_.Copy()
-	this.Env_ = service.Env_.Copy()
 
-	// Generate the environment & flags from groups, in order from left to right
-	for _, group := range groups {
-		for _, key := range group.Flags_.Keys() {
-			if exists := this.Flags_.ExistsForKey(key); exists == false {
-				if err := this.Flags_.SetStringForKey(key, group.Flags_.StringForKey(key)); err != nil {
-					return nil, err
-				}
-			}
-		}
-		for _, key := range group.Env_.Keys() {
-			if exists := this.Env_.ExistsForKey(key); exists == false {
-				if err := this.Env_.SetStringForKey(key, group.Env_.StringForKey(key)); err != nil {
-					return nil, err
-				}
-			}
-		}
+	// Generate the environment & flags from the service and groups
+	if flags, env, flags_, env_, err := ResolveTuples(service, groups, expander); err != nil {
+		return nil, err
+	} else {
+		this.Flags_ = flags
+		this.Env_ = env
+		this.Args_ = ResolveArgs(service.Args_, env, expander)
+		this.Secrets_ = secretsForInstance(service, groups, flags_, env_)
 	}
+	this.Labels_ = service.Labels_.Copy()
+	this.Hooks_ = hooksForInstance(service, groups)
 
-	// Resolve environment parameters
-	for _, key := range this.Env_.Keys() {
-		value := this.Env_.StringForKey(key)
-		this.Env_.SetStringForKey(key, os.Expand(value, func(key_ string) string {
-			if this.Env_.ExistsForKey(key_) {
-				return this.Env_.StringForKey(key_)
-			} else if key_ == "$" {
-				return key_
-			} else if expander != nil {
-				return expander(key_)
-			} else {
-				return "${" + key_ + "}"
-			}
-		}))
+	// Make the process and channels
+	if err := this.init(); err != nil {
+		return nil, err
+	}
+
+	// Success
+	return this, nil
+}
+
+// CopyInstance returns a new instance with a different identifier, which
+// uses the resolved flags and environment of an existing instance, where the
+// run directory of the existing instance is replaced by rundir. The instance
+// is started from the executable at path
+func CopyInstance(id uint32, instance *ServiceInstance, rundir, path string) (*ServiceInstance, error) {
+	// Check parameters
+	if id == 0 || instance == nil || path == "" {
+		return nil, gopi.ErrBadParameter
+	}
+
+	// Create the instance
+	this := new(ServiceInstance)
+	this.Service_ = instance.Service_
+	this.Path_ = path
+	this.Id_ = id
+	this.Flags_ = instance.Flags_.Copy()
+	this.Args_ = append([]string{}, instance.Args_...)
+	this.Env_ = instance.Env_.Copy()
+	this.Labels_ = instance.Labels_.Copy()
+	this.Secrets_ = append([]string{}, instance.Secrets_...)
+	this.Hooks_ = append([]rpc.GafferHook{}, instance.Hooks_...)
+
+	// Replace the run directory of the existing instance
+	if instance.RunDir_ != "" && rundir != "" {
+		replaceDir(instance.RunDir_, rundir, this.Args_, &this.Flags_, &this.Env_)
 	}
+	this.RunDir_ = rundir
 
-	// Resolve flag parameters
-	for _, key := range this.Flags_.Keys() {
-		value := this.Flags_.StringForKey(key)
-		this.Flags_.SetStringForKey(key, os.Expand(value, func(key_ string) string {
-			if this.Env_.ExistsForKey(key_) {
-				return this.Env_.StringForKey(key_)
-			} else if key_ == "$" {
-				return key_
-			} else if expander != nil {
-				return expander(key_)
-			} else {
-				// Not found, replace with ${key}
-				return "${" + key_ + "}"
-			}
-		}))
+	// Make the process and channels
+	if err := this.init(); err != nil {
+		return nil, err
 	}
 
+	// Success
+	return this, nil
+}
+
+func (this *ServiceInstance) init() error {
 	// Make the process
 	if process, err := NewProcess(this); err != nil {
-		return nil, err
+		return err
 	} else {
 		this.process = process
 	}
@@ -301,7 +465,7 @@ func NewInstance(id uint32, service *Service, groups []*ServiceGroup, path strin
 	this.stop = make(chan error)
 
 	// Success
-	return this, nil
+	return nil
 }
 
 func (this *ServiceInstance) Id() uint32 {
@@ -316,12 +480,34 @@ func (this *ServiceInstance) Path() string {
 	return this.Path_
 }
 
+// Flags returns the flags with secret values redacted
 func (this *ServiceInstance) Flags() rpc.Tuples {
-	return this.Flags_
+	return this.Flags_.Redact(this.Secrets_)
 }
 
+// Env returns the environment with secret values redacted
 func (this *ServiceInstance) Env() rpc.Tuples {
-	return this.Env_
+	return this.Env_.Redact(this.Secrets_)
+}
+
+// Args returns the positional arguments with secret values redacted
+func (this *ServiceInstance) Args() []string {
+	return redactArgs(this.Args_, this.Env_, this.Secrets_)
+}
+
+// CommandLine returns the flags in the flag style of the service,
+// followed by the positional arguments
+func (this *ServiceInstance) CommandLine() []string {
+	return append(this.Flags_.Args(this.Service_.FlagStyle_), this.Args_...)
+}
+
+// RedactedCommandLine returns the command line with secret values redacted
+func (this *ServiceInstance) RedactedCommandLine() []string {
+	return append(this.Flags().Args(this.Service_.FlagStyle_), this.Args()...)
+}
+
+func (this *ServiceInstance) Labels() rpc.Tuples {
+	return this.Labels_
 }
 
 func (this *ServiceInstance) RunTime() time.Duration {
@@ -340,6 +526,18 @@ func (this *ServiceInstance) Stop() time.Time {
 	return this.Stop_
 }
 
+func (this *ServiceInstance) Executable() rpc.GafferExecutable {
+	if this.Executable_ == nil {
+		return nil
+	} else {
+		return this.Executable_
+	}
+}
+
+func (this *ServiceInstance) RunDir() string {
+	return this.RunDir_
+}
+
 func (this *ServiceInstance) ExitCode() int64 {
 	if this.process == nil {
 		return 0
@@ -357,5 +555,5 @@ func (this *ServiceInstance) IsRunning() bool {
 }
 
 func (this *ServiceInstance) String() string {
-	return fmt.Sprintf("<gaffer.ServiceInstance>{ id=%v service=%v flags=%v env=%v exit_code=%v %v }", this.Id_, strconv.Quote(this.Service_.Name()), this.Flags(), this.Env(), this.ExitCode(), this.process)
+	return fmt.Sprintf("<gaffer.ServiceInstance>{ id=%v service=%v flags=%v args=%v env=%v exit_code=%v %v }", this.Id_, strconv.Quote(this.Service_.Name()), this.Flags(), this.Args(), this.Env(), this.ExitCode(), this.process)
 }
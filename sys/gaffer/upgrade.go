@@ -0,0 +1,186 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package gaffer
+
+import (
+	"path/filepath"
+	"sort"
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+	rpc "github.com/djthorpe/gopi-rpc"
+	event "github.com/djthorpe/gopi/util/event"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// upgrades records the state of executables between checks, and is only
+// accessed from the ExecutableTask
+type upgrades struct {
+	delta     time.Duration
+	checked   bool
+	checksums map[string]string
+	handled   map[*Service]string
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	// DELTA_WATCH is the default interval for checking executables
+	DELTA_WATCH = 5 * time.Second
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// BACKGROUND TASKS
+
+// ExecutableTask periodically checks the executables under the binary root,
+// emits GAFFER_EVENT_EXECUTABLE_CHANGE when an executable has been added or
+// replaced and applies the upgrade policy when running instances of a
+// service are using an outdated executable
+func (this *gaffer) ExecutableTask(start chan<- event.Signal, stop <-chan event.Signal) error {
+	start <- gopi.DONE
+	ticker := time.NewTicker(this.upgrades.delta)
+FOR_LOOP:
+	for {
+		select {
+		case <-ticker.C:
+			this.checkExecutables()
+		case <-stop:
+			break FOR_LOOP
+		}
+	}
+
+	// Stop the ticker
+	ticker.Stop()
+
+	// Success
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func (this *gaffer) checkExecutables() {
+	root, err := this.Root()
+	if err != nil {
+		return
+	}
+	if this.upgrades.checksums == nil {
+		this.upgrades.checksums = make(map[string]string)
+	}
+	if this.upgrades.handled == nil {
+		this.upgrades.handled = make(map[*Service]string)
+	}
+
+	// Services which use each executable, from a copy of the services which
+	// can be changed while the executables are checked
+	this.config.Lock()
+	services_ := append([]*Service{}, this.config.Services...)
+	this.config.Unlock()
+	services := make(map[string][]*Service)
+	for _, service := range services_ {
+		path := filepath.Join(root, service.Path_)
+		services[path] = append(services[path], service)
+	}
+
+	// Executables under the binary root, and those used by services
+	paths := make(map[string]bool, len(services))
+	for path := range services {
+		paths[path] = true
+	}
+	if err := walkExecutables(root, true, func(path string) {
+		paths[filepath.Join(root, path)] = true
+	}); err != nil {
+		this.log.Warn("ExecutableTask: %v", err)
+	}
+
+	// Determine which executables have been added or replaced since the
+	// last check
+	executables := make(map[string]*Executable, len(paths))
+	changed := make([]string, 0)
+	for path := range paths {
+		if executable, err := this.Instances.GetExecutableForPath(path); err != nil {
+			delete(this.upgrades.checksums, path)
+		} else {
+			if checksum, exists := this.upgrades.checksums[path]; checksum != executable.Checksum_ && (exists || this.upgrades.checked) {
+				changed = append(changed, path)
+			}
+			this.upgrades.checksums[path] = executable.Checksum_
+			executables[path] = executable
+		}
+	}
+	for path := range this.upgrades.checksums {
+		if paths[path] == false {
+			delete(this.upgrades.checksums, path)
+		}
+	}
+	this.upgrades.checked = true
+
+	// Emit an event for each change, for each service which uses the
+	// executable or else without a service
+	sort.Strings(changed)
+	for _, path := range changed {
+		if len(services[path]) == 0 {
+			this.EmitServiceData(rpc.GAFFER_EVENT_EXECUTABLE_CHANGE, nil, []byte(path))
+		}
+		for _, service := range services[path] {
+			this.EmitServiceData(rpc.GAFFER_EVENT_EXECUTABLE_CHANGE, service, []byte(path))
+		}
+	}
+
+	// Apply the upgrade policy for each service
+	for _, service := range services_ {
+		path := filepath.Join(root, service.Path_)
+		executable := executables[path]
+		if executable == nil {
+			continue
+		}
+		if this.isStale(service, executable) == false {
+			delete(this.upgrades.handled, service)
+			if err := this.config.SetServiceStale(service, false); err == nil {
+				this.EmitService(rpc.GAFFER_EVENT_SERVICE_CHANGE, service)
+			}
+			continue
+		} else if this.upgrades.handled[service] == executable.Checksum_ {
+			continue
+		}
+
+		// Act once for each change of executable
+		this.upgrades.handled[service] = executable.Checksum_
+		switch service.UpgradePolicy_ {
+		case rpc.GAFFER_UPGRADE_STALE:
+			if err := this.config.SetServiceStale(service, true); err == nil {
+				this.EmitService(rpc.GAFFER_EVENT_SERVICE_CHANGE, service)
+			}
+		case rpc.GAFFER_UPGRADE_RESTART:
+			if err := this.config.SetServiceStale(service, true); err == nil {
+				this.EmitService(rpc.GAFFER_EVENT_SERVICE_CHANGE, service)
+			}
+			go func(name string) {
+				if err := this.RestartServiceForName(name, 0, nil); err != nil {
+					this.log.Warn("ExecutableTask: %v", err)
+				}
+			}(service.Name_)
+		}
+	}
+}
+
+// isStale returns true if any running instance of a service was started
+// from a different executable
+func (this *gaffer) isStale(service *Service, executable *Executable) bool {
+	for _, instance := range this.runningInstancesForService(service) {
+		if instance.Executable_ != nil && instance.Executable_.Equals(executable) == false {
+			return true
+		}
+	}
+	return false
+}
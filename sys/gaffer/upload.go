@@ -0,0 +1,302 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package gaffer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// uploads records the maximum size of an uploaded executable, and locks
+// for each executable so that uploads and rollbacks of the same executable
+// happen one at a time
+type uploads struct {
+	sync.Mutex
+	size  int64
+	paths map[string]*sync.Mutex
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	// VERSIONS_FOLDER is the folder under the binary root where previous
+	// versions of executables are kept
+	VERSIONS_FOLDER = ".versions"
+
+	// VERSIONS_KEEP is the default number of previous versions to keep
+	VERSIONS_KEEP = 3
+
+	// VERSION_FORMAT is the filename format for previous versions, which
+	// sorts in time order
+	VERSION_FORMAT = "20060102T150405.000000000"
+
+	// UPLOAD_SIZE is the default maximum size of an uploaded executable
+	UPLOAD_SIZE = 256 * 1024 * 1024
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// UPLOAD AND ROLLBACK
+
+// UploadExecutable writes an executable into the binary root. The data is
+// written to a temporary file up to the maximum upload size, checked against
+// the SHA-256 checksum and checked to be an ELF binary for the host
+// architecture before it replaces any existing executable, which is kept as
+// a previous version
+func (this *gaffer) UploadExecutable(path string, data io.Reader, checksum string) (rpc.GafferExecutable, error) {
+	this.log.Debug2("<gaffer>UploadExecutable{ path=%v checksum=%v }", strconv.Quote(path), checksum)
+
+	if data == nil || checksum == "" {
+		return nil, gopi.ErrBadParameter
+	}
+
+	root, err := this.config.Root()
+	if err != nil {
+		return nil, err
+	}
+	dest, err := pathForExecutable(root, path)
+	if err != nil {
+		return nil, err
+	}
+	versions := filepath.Join(root, VERSIONS_FOLDER)
+	if err := os.MkdirAll(versions, 0755); err != nil {
+		return nil, err
+	}
+
+	// Write to a temporary file in the binary root, so that it can be renamed
+	fh, err := ioutil.TempFile(versions, ".upload-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(fh.Name())
+	hash := sha256.New()
+	if n, err := io.Copy(io.MultiWriter(fh, hash), io.LimitReader(data, this.uploads.size+1)); err != nil {
+		fh.Close()
+		return nil, err
+	} else if n > this.uploads.size {
+		fh.Close()
+		return nil, fmt.Errorf("%v: Upload is larger than %v bytes", path, this.uploads.size)
+	} else if err := fh.Close(); err != nil {
+		return nil, err
+	} else if checksum_ := hex.EncodeToString(hash.Sum(nil)); strings.EqualFold(checksum_, checksum) == false {
+		return nil, fmt.Errorf("Checksum mismatch for %v: expected %v, got %v", strconv.Quote(path), checksum, checksum_)
+	} else if err := isElfForHost(fh.Name()); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	} else if err := os.Chmod(fh.Name(), 0755); err != nil {
+		return nil, err
+	}
+
+	// Keep the existing executable as a previous version
+	this.uploads.lock(dest)
+	defer this.uploads.unlock(dest)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return nil, err
+	} else if stat, err := os.Stat(dest); err == nil {
+		if stat.Mode().IsRegular() == false {
+			return nil, fmt.Errorf("Not a regular file: %v", path)
+		} else if err := this.keepVersion(root, path, dest); err != nil {
+			return nil, err
+		}
+	}
+
+	// Move the new executable into place
+	if err := os.Rename(fh.Name(), dest); err != nil {
+		return nil, err
+	} else {
+		return this.GetExecutableForPath(path)
+	}
+}
+
+// RollbackExecutable replaces an executable with a previous version, which
+// is the version with a checksum or the most recent version when the
+// checksum is empty. The executable which is replaced is kept as a previous
+// version
+func (this *gaffer) RollbackExecutable(path, checksum string) (rpc.GafferExecutable, error) {
+	this.log.Debug2("<gaffer>RollbackExecutable{ path=%v checksum=%v }", strconv.Quote(path), checksum)
+
+	root, err := this.config.Root()
+	if err != nil {
+		return nil, err
+	}
+	dest, err := pathForExecutable(root, path)
+	if err != nil {
+		return nil, err
+	}
+	this.uploads.lock(dest)
+	defer this.uploads.unlock(dest)
+
+	// Find the version to restore
+	version := ""
+	if versions, err := versionsForExecutable(root, path); err != nil {
+		return nil, err
+	} else if len(versions) == 0 {
+		return nil, fmt.Errorf("No previous versions of %v", strconv.Quote(path))
+	} else if checksum == "" {
+		version = versions[0]
+	} else {
+		for _, v := range versions {
+			if executable, err := this.Instances.GetExecutableForPath(v); err == nil && strings.EqualFold(executable.Checksum_, checksum) {
+				version = v
+				break
+			}
+		}
+		if version == "" {
+			return nil, fmt.Errorf("No previous version of %v with checksum %v", strconv.Quote(path), checksum)
+		}
+	}
+
+	// Move the version out of the versions folder, so that it is not removed
+	// when the existing executable is kept as a previous version
+	fh, err := ioutil.TempFile(filepath.Join(root, VERSIONS_FOLDER), ".rollback-")
+	if err != nil {
+		return nil, err
+	} else if err := fh.Close(); err != nil {
+		return nil, err
+	} else if err := os.Rename(version, fh.Name()); err != nil {
+		os.Remove(fh.Name())
+		return nil, err
+	}
+	if _, err := os.Stat(dest); err == nil {
+		if err := this.keepVersion(root, path, dest); err != nil {
+			os.Rename(fh.Name(), version)
+			return nil, err
+		}
+	}
+
+	// Move the version into place
+	if err := os.Rename(fh.Name(), dest); err != nil {
+		return nil, err
+	} else {
+		return this.GetExecutableForPath(path)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// keepVersion moves an executable into the versions folder and removes
+// the oldest versions
+func (this *gaffer) keepVersion(root, path, dest string) error {
+	folder := filepath.Join(root, VERSIONS_FOLDER, path)
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		return err
+	} else if err := os.Rename(dest, filepath.Join(folder, time.Now().UTC().Format(VERSION_FORMAT))); err != nil {
+		return err
+	} else if versions, err := versionsForExecutable(root, path); err != nil {
+		return err
+	} else {
+		for i := int(this.versions); i < len(versions); i++ {
+			if err := os.Remove(versions[i]); err != nil {
+				this.log.Warn("UploadExecutable: %v", err)
+			}
+		}
+	}
+
+	// Success
+	return nil
+}
+
+// lock waits until no other upload or rollback is in progress for an
+// executable
+func (this *uploads) lock(path string) {
+	this.Lock()
+	if this.paths == nil {
+		this.paths = make(map[string]*sync.Mutex)
+	}
+	mutex, exists := this.paths[path]
+	if exists == false {
+		mutex = new(sync.Mutex)
+		this.paths[path] = mutex
+	}
+	this.Unlock()
+	mutex.Lock()
+}
+
+func (this *uploads) unlock(path string) {
+	this.Lock()
+	mutex := this.paths[path]
+	this.Unlock()
+	mutex.Unlock()
+}
+
+// pathForExecutable returns the absolute path for an executable, which
+// needs to be within the binary root and not within a hidden folder
+func pathForExecutable(root, path string) (string, error) {
+	if path == "" || filepath.IsAbs(path) || reExecutableName.MatchString(path) == false {
+		return "", fmt.Errorf("Invalid executable path: %v", strconv.Quote(path))
+	}
+	for _, elem := range strings.Split(path, "/") {
+		if elem == "" || strings.HasPrefix(elem, ".") {
+			return "", fmt.Errorf("Invalid executable path: %v", strconv.Quote(path))
+		}
+	}
+
+	// Ensure the path does not escape the root, including through symbolic
+	// links in existing folders
+	root = filepath.Clean(root)
+	dest := filepath.Join(root, path)
+	if rel, err := filepath.Rel(root, dest); err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("Invalid executable path: %v", strconv.Quote(path))
+	} else if root_, err := filepath.EvalSymlinks(root); err != nil {
+		return "", err
+	} else {
+		parent := filepath.Dir(dest)
+		for parent != root && strings.HasPrefix(parent, root) {
+			if _, err := os.Lstat(parent); err == nil {
+				break
+			}
+			parent = filepath.Dir(parent)
+		}
+		if parent_, err := filepath.EvalSymlinks(parent); err != nil {
+			return "", err
+		} else if rel, err := filepath.Rel(root_, parent_); err != nil || strings.HasPrefix(rel, "..") {
+			return "", fmt.Errorf("Invalid executable path: %v", strconv.Quote(path))
+		}
+	}
+
+	// Success
+	return dest, nil
+}
+
+// versionsForExecutable returns the paths of previous versions of an
+// executable, most recent first
+func versionsForExecutable(root, path string) ([]string, error) {
+	folder := filepath.Join(root, VERSIONS_FOLDER, path)
+	if files, err := ioutil.ReadDir(folder); os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	} else {
+		versions := make([]string, 0, len(files))
+		for _, file := range files {
+			if file.Mode().IsRegular() {
+				versions = append(versions, filepath.Join(folder, file.Name()))
+			}
+		}
+		sort.Sort(sort.Reverse(sort.StringSlice(versions)))
+		return versions, nil
+	}
+}
@@ -0,0 +1,406 @@
+/*
+	Go Language Raspberry Pi Interface
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	Documentation http://djthorpe.github.io/gopi/
+	For Licensing and Usage information, please see LICENSE.md
+*/
+
+package grpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+	event "github.com/djthorpe/gopi/util/event"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	metadata "google.golang.org/grpc/metadata"
+	status "google.golang.org/grpc/status"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Auth is the configuration for authorizing calls. Path is a file which
+// maps callers to roles, and is read again when it changes. Delta is the
+// interval for checking the file for changes
+type Auth struct {
+	Path  string
+	Delta time.Duration
+}
+
+type auth struct {
+	sync.Mutex
+
+	log     gopi.Logger
+	path    string
+	delta   time.Duration
+	modtime time.Time
+	config  *AuthConfig
+	roles   map[string][]string
+
+	event.Tasks
+}
+
+// AuthConfig is the file which maps callers to roles. Callers are identified
+// by a bearer token, or the subject common name of a client certificate.
+// Callers which are not identified have the anonymous role, or are denied
+// when the anonymous role is empty. Roles replace the default method
+// patterns for a role, or add a role
+type AuthConfig struct {
+	Anonymous  string              `json:"anonymous,omitempty"`
+	Identities []*AuthIdentity     `json:"identities"`
+	Roles      map[string][]string `json:"roles,omitempty"`
+}
+
+// AuthIdentity is a caller, which is identified by either a subject or a
+// token
+type AuthIdentity struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject,omitempty"`
+	Token   string `json:"token,omitempty"`
+	Role    string `json:"role"`
+}
+
+// identityKey is the context key for the name of an authorized caller
+type identityKey struct{}
+
+// authStream replaces the context of a stream with the authorized context
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	// AUTH_DELTA is the default interval for checking the file for changes
+	AUTH_DELTA = 5 * time.Second
+
+	// AUTH_SCHEME is the scheme for tokens in the authorization metadata
+	AUTH_SCHEME = "Bearer "
+)
+
+var (
+	// AUTH_SERVICES are the services which require authorization. Calls
+	// to other services are always allowed
+	AUTH_SERVICES = []string{"gopi.Gaffer", "gopi.Discovery"}
+
+	// AUTH_ROLES are the default method patterns for each role, in the form
+	// <service>/<method>, where the method can include wildcards
+	AUTH_ROLES = map[string][]string{
+		"viewer": AUTH_VIEWER,
+		"operator": append(append([]string{}, AUTH_VIEWER...),
+			"gopi.Gaffer/StartInstance", "gopi.Gaffer/StopInstance", "gopi.Gaffer/Signal*",
+			"gopi.Gaffer/ScaleService", "gopi.Gaffer/RestartService",
+			"gopi.Gaffer/StartGroup", "gopi.Gaffer/StopGroup", "gopi.Gaffer/RestartGroup",
+		),
+		"admin": []string{"*/*"},
+	}
+
+	// AUTH_VIEWER are the methods which do not change anything
+	AUTH_VIEWER = []string{
+		"gopi.Gaffer/Ping", "gopi.Gaffer/List*", "gopi.Gaffer/Get*",
+		"gopi.Gaffer/ResolveService", "gopi.Gaffer/StreamEvents", "gopi.Gaffer/QueryEvents",
+		"gopi.Discovery/Ping", "gopi.Discovery/Enumerate", "gopi.Discovery/Lookup",
+		"gopi.Discovery/StreamEvents",
+	}
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// OPEN AND CLOSE
+
+func (config Auth) Open(logger gopi.Logger) (gopi.Driver, error) {
+	logger.Debug("<grpc.auth>Open{ path=%v delta=%v }", strconv.Quote(config.Path), config.Delta)
+
+	this := new(auth)
+	this.log = logger
+	this.path = config.Path
+	this.delta = config.Delta
+
+	if this.path == "" {
+		return nil, gopi.ErrBadParameter
+	}
+	if this.delta == 0 {
+		this.delta = AUTH_DELTA
+	}
+
+	// Read the configuration
+	if err := this.read(); err != nil {
+		return nil, err
+	}
+
+	// Start background task which reads the configuration when it changes
+	this.Tasks.Start(this.ReloadTask)
+
+	// Success
+	return this, nil
+}
+
+func (this *auth) Close() error {
+	this.log.Debug("<grpc.auth>Close{ path=%v }", strconv.Quote(this.path))
+
+	// Stop background tasks
+	if err := this.Tasks.Close(); err != nil {
+		return err
+	}
+
+	// Release resources
+	this.config = nil
+	this.roles = nil
+
+	// Success
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// INTERCEPTORS
+
+func (this *auth) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if ctx, err := this.Authorize(ctx, info.FullMethod); err != nil {
+		return nil, err
+	} else {
+		return handler(ctx, req)
+	}
+}
+
+func (this *auth) StreamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if ctx, err := this.Authorize(stream.Context(), info.FullMethod); err != nil {
+		return err
+	} else {
+		return handler(srv, &authStream{stream, ctx})
+	}
+}
+
+func (this *authStream) Context() context.Context {
+	return this.ctx
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// AUTHORIZE
+
+// Authorize returns a context with the name of the caller when the caller
+// can call a method, or a PermissionDenied error with the reason
+func (this *auth) Authorize(ctx context.Context, method string) (context.Context, error) {
+	service, name := splitMethod(method)
+	if stringSliceContains(AUTH_SERVICES, service) == false {
+		return ctx, nil
+	}
+	method = service + "/" + name
+
+	this.Lock()
+	defer this.Unlock()
+
+	// Identify the caller
+	identity, err := this.identify(ctx)
+	if err != nil {
+		return nil, this.deny(method, err.Error())
+	} else if identity == nil && this.config.Anonymous == "" {
+		return nil, this.deny(method, fmt.Sprintf("Missing credentials for %v", method))
+	}
+
+	// Check the role of the caller
+	role, caller := this.config.Anonymous, "Anonymous caller"
+	if identity != nil {
+		role, caller = identity.Role, fmt.Sprintf("Caller %v", strconv.Quote(identity.Name))
+	}
+	for _, pattern := range this.roles[role] {
+		if match, _ := path.Match(pattern, method); match {
+			if identity != nil {
+				setCaller(ctx, identity.Name)
+				ctx = context.WithValue(ctx, identityKey{}, identity.Name)
+			}
+			return ctx, nil
+		}
+	}
+	return nil, this.deny(method, fmt.Sprintf("%v with role %v cannot call %v", caller, strconv.Quote(role), method))
+}
+
+// identify returns the identity for a bearer token or the subject of a
+// client certificate, or nil when the caller presented neither
+func (this *auth) identify(ctx context.Context) (*AuthIdentity, error) {
+	if token, exists := tokenForContext(ctx); exists {
+		for _, identity := range this.config.Identities {
+			if identity.Token != "" && subtle.ConstantTimeCompare([]byte(identity.Token), []byte(token)) == 1 {
+				return identity, nil
+			}
+		}
+		return nil, fmt.Errorf("Invalid bearer token")
+	} else if subject := IdentityForContext(ctx); subject != "" {
+		for _, identity := range this.config.Identities {
+			if identity.Subject != "" && identity.Subject == subject {
+				return identity, nil
+			}
+		}
+		return nil, fmt.Errorf("Unknown certificate subject %v", strconv.Quote(subject))
+	} else {
+		return nil, nil
+	}
+}
+
+// deny logs and returns a PermissionDenied error
+func (this *auth) deny(method, reason string) error {
+	this.log.Warn("grpc.auth: %v: %v", method, reason)
+	return status.Error(codes.PermissionDenied, reason)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// BACKGROUND TASKS
+
+// ReloadTask reads the configuration again when the file changes. The
+// existing configuration is kept when the file cannot be read
+func (this *auth) ReloadTask(start chan<- event.Signal, stop <-chan event.Signal) error {
+	start <- gopi.DONE
+	ticker := time.NewTicker(this.delta)
+FOR_LOOP:
+	for {
+		select {
+		case <-ticker.C:
+			if stat, err := os.Stat(this.path); err != nil {
+				this.log.Warn("grpc.auth: %v", err)
+			} else if this.isModified(stat.ModTime()) == false {
+				continue
+			} else if err := this.read(); err != nil {
+				this.log.Warn("grpc.auth: %v: %v", this.path, err)
+			} else {
+				this.log.Info("Reloaded authorization from %v", this.path)
+			}
+		case <-stop:
+			break FOR_LOOP
+		}
+	}
+
+	// Stop the ticker
+	ticker.Stop()
+
+	// Success
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *auth) String() string {
+	this.Lock()
+	defer this.Unlock()
+	if this.config == nil {
+		return fmt.Sprintf("<grpc.auth>{ path=%v }", strconv.Quote(this.path))
+	} else {
+		return fmt.Sprintf("<grpc.auth>{ path=%v identities=%v anonymous=%v }", strconv.Quote(this.path), len(this.config.Identities), strconv.Quote(this.config.Anonymous))
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// isModified returns true if the file has changed since it was read
+func (this *auth) isModified(modtime time.Time) bool {
+	this.Lock()
+	defer this.Unlock()
+	return modtime.Equal(this.modtime) == false
+}
+
+// read reads and checks the configuration, and replaces the existing
+// configuration when there are no errors
+func (this *auth) read() error {
+	stat, err := os.Stat(this.path)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(this.path)
+	if err != nil {
+		return err
+	}
+	config := new(AuthConfig)
+	if err := json.Unmarshal(data, config); err != nil {
+		return err
+	}
+
+	// Set the patterns for each role, replacing the defaults
+	roles := make(map[string][]string, len(AUTH_ROLES)+len(config.Roles))
+	for role, patterns := range AUTH_ROLES {
+		roles[role] = patterns
+	}
+	for role, patterns := range config.Roles {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("Invalid pattern for role %v: %v", strconv.Quote(role), strconv.Quote(pattern))
+			}
+		}
+		roles[role] = patterns
+	}
+
+	// Check identities
+	if _, exists := roles[config.Anonymous]; config.Anonymous != "" && exists == false {
+		return fmt.Errorf("Invalid anonymous role: %v", strconv.Quote(config.Anonymous))
+	}
+	names := make(map[string]bool, len(config.Identities))
+	for _, identity := range config.Identities {
+		if identity == nil || strings.TrimSpace(identity.Name) == "" {
+			return fmt.Errorf("Missing identity name")
+		} else if names[identity.Name] {
+			return fmt.Errorf("Duplicate identity: %v", strconv.Quote(identity.Name))
+		} else if (identity.Subject == "") == (identity.Token == "") {
+			return fmt.Errorf("Identity %v requires either a subject or a token", strconv.Quote(identity.Name))
+		} else if _, exists := roles[identity.Role]; exists == false {
+			return fmt.Errorf("Invalid role for identity %v: %v", strconv.Quote(identity.Name), strconv.Quote(identity.Role))
+		} else {
+			names[identity.Name] = true
+		}
+	}
+
+	// Replace the configuration
+	this.Lock()
+	defer this.Unlock()
+	this.config, this.roles, this.modtime = config, roles, stat.ModTime()
+
+	// Success
+	return nil
+}
+
+// tokenForContext returns the bearer token from the authorization metadata
+// for a request
+func tokenForContext(ctx context.Context) (string, bool) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok == false {
+		return "", false
+	} else if values := md.Get("authorization"); len(values) == 0 {
+		return "", false
+	} else if strings.HasPrefix(values[0], AUTH_SCHEME) == false {
+		return "", false
+	} else {
+		return strings.TrimPrefix(values[0], AUTH_SCHEME), true
+	}
+}
+
+// setCaller records the name of an authorized caller for interceptors
+// which were called before the authorization
+func setCaller(ctx context.Context, name string) {
+	if caller, ok := ctx.Value(callerKey{}).(*caller); ok {
+		caller.Lock()
+		defer caller.Unlock()
+		caller.name = name
+	}
+}
+
+func stringSliceContains(values []string, value string) bool {
+	for _, other := range values {
+		if other == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,280 @@
+package grpc_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+	codes "google.golang.org/grpc/codes"
+	credentials "google.golang.org/grpc/credentials"
+	metadata "google.golang.org/grpc/metadata"
+	peer "google.golang.org/grpc/peer"
+	status "google.golang.org/grpc/status"
+
+	// Modules
+	grpc "github.com/djthorpe/gopi-rpc/sys/grpc"
+	logger "github.com/djthorpe/gopi/sys/logger"
+)
+
+const (
+	LOG_LEVEL = logger.LOG_DEBUG2
+)
+
+const (
+	AUTH_CONFIG = `{
+		"identities": [
+			{ "name": "viewer", "token": "token-viewer", "role": "viewer" },
+			{ "name": "operator", "token": "token-operator", "role": "operator" },
+			{ "name": "admin", "subject": "admin.local", "role": "admin" }
+		]
+	}`
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type Authorizer interface {
+	gopi.Driver
+	Authorize(ctx context.Context, method string) (context.Context, error)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// AUTHORIZE
+
+func Test_Auth_001(t *testing.T) {
+	auth, path := NewAuth(t, AUTH_CONFIG, 0)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer auth.Close()
+
+	tests := []struct {
+		ctx    context.Context
+		method string
+		allow  bool
+	}{
+		// Viewer
+		{TokenContext("token-viewer"), "/gopi.Gaffer/ListServices", true},
+		{TokenContext("token-viewer"), "/gopi.Gaffer/StreamEvents", true},
+		{TokenContext("token-viewer"), "/gopi.Discovery/Lookup", true},
+		{TokenContext("token-viewer"), "/gopi.Gaffer/StartInstance", false},
+		{TokenContext("token-viewer"), "/gopi.Gaffer/AddService", false},
+		// Operator
+		{TokenContext("token-operator"), "/gopi.Gaffer/GetInstance", true},
+		{TokenContext("token-operator"), "/gopi.Gaffer/StartInstance", true},
+		{TokenContext("token-operator"), "/gopi.Gaffer/SignalService", true},
+		{TokenContext("token-operator"), "/gopi.Gaffer/AddService", false},
+		{TokenContext("token-operator"), "/gopi.Gaffer/UploadExecutable", false},
+		// Admin
+		{CertContext("admin.local"), "/gopi.Gaffer/AddService", true},
+		{CertContext("admin.local"), "/gopi.Gaffer/UploadExecutable", true},
+		// Unknown callers
+		{TokenContext("token-other"), "/gopi.Gaffer/ListServices", false},
+		{CertContext("other.local"), "/gopi.Gaffer/ListServices", false},
+		{context.Background(), "/gopi.Gaffer/ListServices", false},
+		// Services which do not require authorization
+		{context.Background(), "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo", true},
+	}
+	for i, test := range tests {
+		if _, err := auth.Authorize(test.ctx, test.method); test.allow && err != nil {
+			t.Errorf("%v: %v: %v", i, test.method, err)
+		} else if test.allow == false && err == nil {
+			t.Errorf("%v: %v: Expected error", i, test.method)
+		} else if test.allow == false && status.Code(err) != codes.PermissionDenied {
+			t.Errorf("%v: %v: Unexpected error: %v", i, test.method, err)
+		}
+	}
+}
+
+func Test_Auth_002(t *testing.T) {
+	auth, path := NewAuth(t, AUTH_CONFIG, 0)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer auth.Close()
+
+	// The name of the caller is returned for tokens and certificates
+	if ctx, err := auth.Authorize(TokenContext("token-operator"), "/gopi.Gaffer/ListServices"); err != nil {
+		t.Error(err)
+	} else if name := grpc.IdentityForContext(ctx); name != "operator" {
+		t.Errorf("Unexpected identity: %v", name)
+	}
+	if ctx, err := auth.Authorize(CertContext("admin.local"), "/gopi.Gaffer/ListServices"); err != nil {
+		t.Error(err)
+	} else if name := grpc.IdentityForContext(ctx); name != "admin" {
+		t.Errorf("Unexpected identity: %v", name)
+	}
+
+	// The name of the caller is recorded for interceptors called before
+	// the authorization
+	ctx := grpc.WithCaller(TokenContext("token-viewer"))
+	if _, err := auth.Authorize(ctx, "/gopi.Gaffer/ListServices"); err != nil {
+		t.Error(err)
+	} else if name := grpc.IdentityForContext(ctx); name != "viewer" {
+		t.Errorf("Unexpected identity: %v", name)
+	}
+}
+
+func Test_Auth_003(t *testing.T) {
+	// Anonymous callers and roles which replace the defaults
+	auth, path := NewAuth(t, `{
+		"anonymous": "viewer",
+		"identities": [
+			{ "name": "deployer", "token": "token-deployer", "role": "deployer" }
+		],
+		"roles": {
+			"viewer": [ "gopi.Gaffer/Ping" ],
+			"deployer": [ "gopi.Gaffer/UploadExecutable" ]
+		}
+	}`, 0)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer auth.Close()
+
+	if _, err := auth.Authorize(context.Background(), "/gopi.Gaffer/Ping"); err != nil {
+		t.Error(err)
+	} else if _, err := auth.Authorize(context.Background(), "/gopi.Gaffer/ListServices"); err == nil {
+		t.Error("Expected error for anonymous caller")
+	} else if _, err := auth.Authorize(TokenContext("token-deployer"), "/gopi.Gaffer/UploadExecutable"); err != nil {
+		t.Error(err)
+	} else if _, err := auth.Authorize(TokenContext("token-deployer"), "/gopi.Gaffer/Ping"); err == nil {
+		t.Error("Expected error for deployer")
+	}
+}
+
+func Test_Auth_004(t *testing.T) {
+	// Invalid configurations are not opened
+	tests := map[string]string{
+		"syntax":    `{`,
+		"name":      `{ "identities": [ { "token": "a", "role": "viewer" } ] }`,
+		"duplicate": `{ "identities": [ { "name": "a", "token": "a", "role": "viewer" }, { "name": "a", "token": "b", "role": "viewer" } ] }`,
+		"both":      `{ "identities": [ { "name": "a", "token": "a", "subject": "a", "role": "viewer" } ] }`,
+		"role":      `{ "identities": [ { "name": "a", "token": "a", "role": "other" } ] }`,
+		"anonymous": `{ "anonymous": "other", "identities": [] }`,
+		"pattern":   `{ "identities": [], "roles": { "viewer": [ "[" ] } }`,
+	}
+	log, err := gopi.Open(logger.Config{Level: LOG_LEVEL}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	for name, config := range tests {
+		path := WriteConfig(t, "", config)
+		if driver, err := gopi.Open(grpc.Auth{Path: path}, log.(gopi.Logger)); err == nil {
+			driver.Close()
+			t.Errorf("%v: Expected error", name)
+		}
+		os.RemoveAll(filepath.Dir(path))
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// RELOAD
+
+func Test_Auth_005(t *testing.T) {
+	auth, path := NewAuth(t, AUTH_CONFIG, 50*time.Millisecond)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer auth.Close()
+
+	if _, err := auth.Authorize(TokenContext("token-viewer"), "/gopi.Gaffer/StartInstance"); err == nil {
+		t.Fatal("Expected error before reload")
+	}
+
+	// Change the role of the viewer, and wait for the file to be read again
+	WriteConfig(t, path, `{
+		"identities": [
+			{ "name": "viewer", "token": "token-viewer", "role": "operator" }
+		]
+	}`)
+	Touch(t, path, time.Now().Add(time.Second))
+	if WaitForAuthorize(auth, TokenContext("token-viewer"), "/gopi.Gaffer/StartInstance") == false {
+		t.Fatal("Expected configuration to be reloaded")
+	} else if _, err := auth.Authorize(CertContext("admin.local"), "/gopi.Gaffer/ListServices"); err == nil {
+		t.Error("Expected error for removed identity")
+	}
+
+	// An invalid configuration is not loaded, and the existing
+	// configuration is kept
+	WriteConfig(t, path, `{ "identities": [ { "name": "viewer", "role": "viewer" } ] }`)
+	Touch(t, path, time.Now().Add(2*time.Second))
+	time.Sleep(200 * time.Millisecond)
+	if _, err := auth.Authorize(TokenContext("token-viewer"), "/gopi.Gaffer/StartInstance"); err != nil {
+		t.Error(err)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// NewAuth writes a configuration to a temporary folder and opens the
+// authorization driver
+func NewAuth(t *testing.T, config string, delta time.Duration) (Authorizer, string) {
+	t.Helper()
+	path := WriteConfig(t, "", config)
+	if log, err := gopi.Open(logger.Config{Level: LOG_LEVEL}, nil); err != nil {
+		t.Fatal(err)
+	} else if driver, err := gopi.Open(grpc.Auth{Path: path, Delta: delta}, log.(gopi.Logger)); err != nil {
+		t.Fatal(err)
+	} else if auth, ok := driver.(Authorizer); ok == false {
+		t.Fatal("Driver is not an Authorizer")
+	} else {
+		return auth, path
+	}
+	return nil, ""
+}
+
+// WriteConfig writes a configuration to a path, or to a new temporary
+// folder when the path is empty, and returns the path
+func WriteConfig(t *testing.T, path, config string) string {
+	t.Helper()
+	if path == "" {
+		if folder, err := ioutil.TempDir("", "auth"); err != nil {
+			t.Fatal(err)
+		} else {
+			path = filepath.Join(folder, "auth.json")
+		}
+	}
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Touch sets the modification time of a file, so that a change is seen
+// even when the file is written twice within the resolution of the clock
+func Touch(t *testing.T, path string, modtime time.Time) {
+	t.Helper()
+	if err := os.Chtimes(path, modtime, modtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// WaitForAuthorize returns true when a call is authorized within a second
+func WaitForAuthorize(auth Authorizer, ctx context.Context, method string) bool {
+	for i := 0; i < 20; i++ {
+		if _, err := auth.Authorize(ctx, method); err == nil {
+			return true
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return false
+}
+
+func TokenContext(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+}
+
+func CertContext(subject string) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{
+					&x509.Certificate{Subject: pkix.Name{CommonName: subject}},
+				},
+			},
+		},
+	})
+}
@@ -23,12 +23,16 @@ import (
 	reflection_pb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
 )
 
-// Client Configuration
+// Client Configuration. SSLCertificate and SSLKey are a client
+// certificate, and Token is a bearer token sent with each call
 type ClientConn struct {
-	Addr       string
-	SSL        bool
-	SkipVerify bool
-	Timeout    time.Duration
+	Addr           string
+	SSL            bool
+	SkipVerify     bool
+	SSLCertificate string
+	SSLKey         string
+	Token          string
+	Timeout        time.Duration
 }
 
 type clientconn struct {
@@ -36,11 +40,20 @@ type clientconn struct {
 	addr       string
 	ssl        bool
 	skipverify bool
+	cert       string
+	key        string
+	token      string
 	timeout    time.Duration
 	conn       *grpc.ClientConn
 	lock       sync.Mutex
 }
 
+// tokenCredentials sends a bearer token with each call
+type tokenCredentials struct {
+	token  string
+	secure bool
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // CLIENT OPEN AND CLOSE
 
@@ -53,6 +66,9 @@ func (config ClientConn) Open(log gopi.Logger) (gopi.Driver, error) {
 	this.addr = config.Addr
 	this.ssl = config.SSL
 	this.skipverify = config.SkipVerify
+	this.cert = config.SSLCertificate
+	this.key = config.SSLKey
+	this.token = config.Token
 	this.timeout = config.Timeout
 	this.log = log
 	this.conn = nil
@@ -87,13 +103,29 @@ func (this *clientconn) Connect() error {
 	// Create connection options
 	opts := make([]grpc.DialOption, 0, 1)
 
-	// SSL options
+	// SSL options, with a client certificate
 	if this.ssl {
-		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{InsecureSkipVerify: this.skipverify})))
+		config := &tls.Config{InsecureSkipVerify: this.skipverify}
+		if this.cert != "" || this.key != "" {
+			if keypair, err := tls.LoadX509KeyPair(this.cert, this.key); err != nil {
+				return err
+			} else {
+				config.Certificates = []tls.Certificate{keypair}
+			}
+		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(config)))
 	} else {
 		opts = append(opts, grpc.WithInsecure())
 	}
 
+	// Send bearer token with each call
+	if this.token != "" {
+		if this.ssl == false {
+			this.log.Warn("grpc.clientconn: Sending bearer token over plaintext connection")
+		}
+		opts = append(opts, grpc.WithPerRPCCredentials(&tokenCredentials{this.token, this.ssl}))
+	}
+
 	// Connection timeout options
 	if this.timeout > 0 {
 		opts = append(opts, grpc.WithTimeout(this.timeout))
@@ -175,6 +207,22 @@ func (this *clientconn) String() string {
 	return fmt.Sprintf("<grpc.ClientConn>{ addr=%v ssl=%v connected=%v }", this.addr, this.ssl, this.conn != nil)
 }
 
+////////////////////////////////////////////////////////////////////////////////
+// TOKEN CREDENTIALS
+
+// GetRequestMetadata returns the authorization header for a call
+func (this *tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{
+		"authorization": AUTH_SCHEME + this.token,
+	}, nil
+}
+
+// RequireTransportSecurity returns true when the token is only sent over
+// a secure connection
+func (this *tokenCredentials) RequireTransportSecurity() bool {
+	return this.secure
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // PRIVATE METHODS
 
@@ -28,11 +28,17 @@ import (
 ////////////////////////////////////////////////////////////////////////////////
 // TYPES
 
+// ClientPool is the client pool configuration. SSLCertificate and SSLKey
+// are a client certificate, and Token is a bearer token sent with each
+// call
 type ClientPool struct {
-	SSL        bool
-	SkipVerify bool
-	Timeout    time.Duration
-	Util       rpc.Util
+	SSL            bool
+	SkipVerify     bool
+	SSLCertificate string
+	SSLKey         string
+	Token          string
+	Timeout        time.Duration
+	Util           rpc.Util
 }
 
 type clientpool struct {
@@ -44,6 +50,9 @@ type clientpool struct {
 	clients    []*clientconn
 	ssl        bool
 	skipverify bool
+	cert       string
+	key        string
+	token      string
 	timeout    time.Duration
 	util       rpc.Util
 }
@@ -59,6 +68,9 @@ func (config ClientPool) Open(log gopi.Logger) (gopi.Driver, error) {
 	this.util = config.Util
 	this.ssl = config.SSL
 	this.skipverify = config.SkipVerify
+	this.cert = config.SSLCertificate
+	this.key = config.SSLKey
+	this.token = config.Token
 	this.timeout = config.Timeout
 	this.services = make(map[string]gopi.RPCNewClientFunc, 10)
 	this.clients = make([]*clientconn, 0)
@@ -121,10 +133,13 @@ func (this *clientpool) ConnectAddr(addr string, flags gopi.RPCFlag) (gopi.RPCCl
 	if host, port, err := net.SplitHostPort(addr); err != nil {
 		return nil, err
 	} else if conn, err := gopi.Open(ClientConn{
-		Addr:       fmt.Sprintf("[%v]:%v", host, port),
-		SSL:        this.ssl,
-		SkipVerify: this.skipverify,
-		Timeout:    this.timeout,
+		Addr:           fmt.Sprintf("[%v]:%v", host, port),
+		SSL:            this.ssl,
+		SkipVerify:     this.skipverify,
+		SSLCertificate: this.cert,
+		SSLKey:         this.key,
+		Token:          this.token,
+		Timeout:        this.timeout,
 	}, this.log); err != nil {
 		return nil, err
 	} else if conn_, ok := conn.(*clientconn); ok == false {
@@ -299,10 +314,13 @@ func (this *clientpool) connectTo(name string, addr net.IP, port uint, ssl, skip
 	this.log.Debug2("<grpc.clientpool.Connect>{ name=%v addr=%v port=%v ssl=%v skipverify=%v timeout=%v }", strconv.Quote(name), addr, port, ssl, skipverify, timeout)
 
 	if conn, err := gopi.Open(ClientConn{
-		Addr:       fmt.Sprintf("[%v]:%v", addr.String(), port),
-		SSL:        ssl,
-		SkipVerify: skipverify,
-		Timeout:    timeout,
+		Addr:           fmt.Sprintf("[%v]:%v", addr.String(), port),
+		SSL:            ssl,
+		SkipVerify:     skipverify,
+		SSLCertificate: this.cert,
+		SSLKey:         this.key,
+		Token:          this.token,
+		Timeout:        timeout,
 	}, this.log); err != nil {
 		return nil, err
 	} else if conn_, ok := conn.(*clientconn); ok == false {
@@ -28,6 +28,11 @@ type GRPCServer interface {
 
 	// Return the gRPC Server object
 	GRPCServer() *grpc.Server
+
+	// Add interceptors, which are called in the order they were added
+	// before each method, and before calls are authorized
+	AddUnaryInterceptor(grpc.UnaryServerInterceptor)
+	AddStreamInterceptor(grpc.StreamServerInterceptor)
 }
 
 // GRPCClientConn is an RPCClientConn which also
@@ -18,6 +18,7 @@ import (
 	grpc "google.golang.org/grpc"
 
 	// Modules
+	_ "github.com/djthorpe/gopi-rpc/sys/metrics"
 	_ "github.com/djthorpe/gopi-rpc/sys/rpcutil"
 )
 
@@ -29,23 +30,33 @@ func init() {
 	gopi.RegisterModule(gopi.Module{
 		Name:     "rpc/server",
 		Type:     gopi.MODULE_TYPE_OTHER,
-		Requires: []string{"rpc/util"},
+		Requires: []string{"rpc/util", "rpc/metrics"},
 		Config: func(config *gopi.AppConfig) {
 			config.AppFlags.FlagUint("rpc.port", 0, "Server Port")
 			config.AppFlags.FlagString("rpc.sslcert", "", "SSL Certificate Path")
 			config.AppFlags.FlagString("rpc.sslkey", "", "SSL Key Path")
+			config.AppFlags.FlagString("rpc.sslca", "", "SSL Certificate Authority Path for verifying client certificates")
+			config.AppFlags.FlagString("rpc.auth", "", "Authorization file which maps callers to roles")
 			config.AppFlags.FlagString("rpc.zone", DEFAULT_ZONE, "Zone in which to register server")
+			config.AppFlags.FlagString("rpc.name", "", "Name with which to register server, defaults to the hostname")
+			config.AppFlags.FlagString("rpc.labels", "", "Labels published with the service, for example zone=garage,arch=arm")
 		},
 		New: func(app *gopi.AppInstance) (gopi.Driver, error) {
 			port, _ := app.AppFlags.GetUint("rpc.port")
 			key, _ := app.AppFlags.GetString("rpc.sslkey")
 			cert, _ := app.AppFlags.GetString("rpc.sslcert")
+			ca, _ := app.AppFlags.GetString("rpc.sslca")
+			auth, _ := app.AppFlags.GetString("rpc.auth")
 			zone, _ := app.AppFlags.GetString("rpc.zone")
+			labels, _ := app.AppFlags.GetString("rpc.labels")
 			return gopi.Open(Server{
 				Port:           port,
 				SSLCertificate: cert,
 				SSLKey:         key,
+				SSLClientCA:    ca,
+				AuthPath:       auth,
 				Zone:           zone,
+				Labels:         labels,
 				ServerOption:   []grpc.ServerOption{},
 				Util:           app.ModuleInstance("rpc/util").(rpc.Util),
 			}, app.Logger)
@@ -61,16 +72,25 @@ func init() {
 			config.AppFlags.FlagDuration("rpc.timeout", 5*time.Second, "Connection timeout")
 			config.AppFlags.FlagBool("rpc.insecure", false, "Allow plaintext connections")
 			config.AppFlags.FlagBool("rpc.skipverify", true, "Skip SSL certificate verification")
+			config.AppFlags.FlagString("rpc.clientcert", "", "SSL Client Certificate Path")
+			config.AppFlags.FlagString("rpc.clientkey", "", "SSL Client Key Path")
+			config.AppFlags.FlagString("rpc.token", "", "Bearer token sent with each call")
 		},
 		New: func(app *gopi.AppInstance) (gopi.Driver, error) {
 			insecure, _ := app.AppFlags.GetBool("rpc.insecure")
 			skipverify, _ := app.AppFlags.GetBool("rpc.skipverify")
 			timeout, _ := app.AppFlags.GetDuration("rpc.timeout")
+			cert, _ := app.AppFlags.GetString("rpc.clientcert")
+			key, _ := app.AppFlags.GetString("rpc.clientkey")
+			token, _ := app.AppFlags.GetString("rpc.token")
 			config := ClientPool{
-				SSL:        (insecure == false),
-				SkipVerify: skipverify,
-				Timeout:    timeout,
-				Util:       app.ModuleInstance("rpc/util").(rpc.Util),
+				SSL:            (insecure == false),
+				SkipVerify:     skipverify,
+				SSLCertificate: cert,
+				SSLKey:         key,
+				Token:          token,
+				Timeout:        timeout,
+				Util:           app.ModuleInstance("rpc/util").(rpc.Util),
 			}
 			return gopi.Open(config, app.Logger)
 		},
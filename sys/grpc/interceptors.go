@@ -0,0 +1,169 @@
+/*
+	Go Language Raspberry Pi Interface
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	Documentation http://djthorpe.github.io/gopi/
+	For Licensing and Usage information, please see LICENSE.md
+*/
+
+package grpc
+
+import (
+	"context"
+	"sync"
+
+	// Frameworks
+	grpc "google.golang.org/grpc"
+	credentials "google.golang.org/grpc/credentials"
+	peer "google.golang.org/grpc/peer"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// interceptors are called in the order they were added, before the method
+// handler. The gRPC server only accepts one unary and one stream
+// interceptor, so these are chained. The last interceptors are called
+// after all the others, so that they can see calls which are rejected
+type interceptors struct {
+	sync.Mutex
+	unary      []grpc.UnaryServerInterceptor
+	stream     []grpc.StreamServerInterceptor
+	unaryLast  grpc.UnaryServerInterceptor
+	streamLast grpc.StreamServerInterceptor
+}
+
+// caller is the name of an authorized caller, which is set by the
+// authorization interceptor for interceptors called before it
+type caller struct {
+	sync.Mutex
+	name string
+}
+
+// callerKey is the context key for the caller
+type callerKey struct{}
+
+////////////////////////////////////////////////////////////////////////////////
+// ADD INTERCEPTORS
+
+// AddUnaryInterceptor adds an interceptor for unary methods
+func (this *interceptors) AddUnaryInterceptor(interceptor grpc.UnaryServerInterceptor) {
+	this.Lock()
+	defer this.Unlock()
+	this.unary = append(this.unary, interceptor)
+}
+
+// AddStreamInterceptor adds an interceptor for streaming methods
+func (this *interceptors) AddStreamInterceptor(interceptor grpc.StreamServerInterceptor) {
+	this.Lock()
+	defer this.Unlock()
+	this.stream = append(this.stream, interceptor)
+}
+
+// SetLastInterceptors sets the interceptors which are called after all
+// the others, immediately before the method handler
+func (this *interceptors) SetLastInterceptors(unary grpc.UnaryServerInterceptor, stream grpc.StreamServerInterceptor) {
+	this.Lock()
+	defer this.Unlock()
+	this.unaryLast, this.streamLast = unary, stream
+}
+
+// ServerOptions returns the options which call the interceptors
+func (this *interceptors) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(this.unaryInterceptor),
+		grpc.StreamInterceptor(this.streamInterceptor),
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CHAIN
+
+func (this *interceptors) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	this.Lock()
+	chain := this.unary
+	if this.unaryLast != nil {
+		chain = append(chain[:len(chain):len(chain)], this.unaryLast)
+	}
+	this.Unlock()
+
+	// Wrap the handler with each interceptor, starting with the last
+	for i := len(chain) - 1; i >= 0; i-- {
+		interceptor, next := chain[i], handler
+		handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return interceptor(ctx, req, info, next)
+		}
+	}
+	return handler(ctx, req)
+}
+
+func (this *interceptors) streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	this.Lock()
+	chain := this.stream
+	if this.streamLast != nil {
+		chain = append(chain[:len(chain):len(chain)], this.streamLast)
+	}
+	this.Unlock()
+
+	// Wrap the handler with each interceptor, starting with the last
+	for i := len(chain) - 1; i >= 0; i-- {
+		interceptor, next := chain[i], handler
+		handler = func(srv interface{}, stream grpc.ServerStream) error {
+			return interceptor(srv, stream, info, next)
+		}
+	}
+	return handler(srv, stream)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CALLER
+
+// PeerForContext returns the address of the caller for a request, or an
+// empty string if it is not known
+func PeerForContext(ctx context.Context) string {
+	if peer, ok := peer.FromContext(ctx); ok == false || peer.Addr == nil {
+		return ""
+	} else {
+		return peer.Addr.String()
+	}
+}
+
+// WithCaller returns a context which records the name of the caller when
+// the call is authorized later, so that an interceptor called before the
+// authorization can use IdentityForContext once the call has completed
+func WithCaller(ctx context.Context) context.Context {
+	return context.WithValue(ctx, callerKey{}, new(caller))
+}
+
+// IdentityForContext returns the name of the caller for a request when
+// the caller has been authorized, or else the subject common name of the
+// client certificate. It returns an empty string when the caller is not
+// known
+func IdentityForContext(ctx context.Context) string {
+	if name, ok := ctx.Value(identityKey{}).(string); ok {
+		return name
+	} else if name := callerForContext(ctx); name != "" {
+		return name
+	} else if peer, ok := peer.FromContext(ctx); ok == false {
+		return ""
+	} else if info, ok := peer.AuthInfo.(credentials.TLSInfo); ok == false {
+		return ""
+	} else if len(info.State.PeerCertificates) == 0 {
+		return ""
+	} else {
+		return info.State.PeerCertificates[0].Subject.CommonName
+	}
+}
+
+// callerForContext returns the name of the caller recorded by the
+// authorization, or an empty string
+func callerForContext(ctx context.Context) string {
+	if caller, ok := ctx.Value(callerKey{}).(*caller); ok == false {
+		return ""
+	} else {
+		caller.Lock()
+		defer caller.Unlock()
+		return caller.name
+	}
+}
@@ -0,0 +1,150 @@
+/*
+	Go Language Raspberry Pi Interface
+	(c) Copyright David Thorpe 2016-2018
+	All Rights Reserved
+
+	Documentation http://djthorpe.github.io/gopi/
+	For Licensing and Usage information, please see LICENSE.md
+*/
+
+package grpc
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	// Frameworks
+	rpc "github.com/djthorpe/gopi-rpc"
+	metrics "github.com/djthorpe/gopi-rpc/sys/metrics"
+	grpc "google.golang.org/grpc"
+	status "google.golang.org/grpc/status"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// serverMetrics records requests, errors, latency and active streams for
+// each method served
+type serverMetrics struct {
+	sync.Mutex
+	methods map[string]*methodMetrics
+}
+
+type methodMetrics struct {
+	service  string
+	method   string
+	type_    string
+	requests uint64
+	errors   map[string]uint64
+	streams  int64
+	latency  *metrics.Histogram
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// INTERCEPTORS
+
+func (this *serverMetrics) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	method := this.method(info.FullMethod, "unary")
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	this.done(method, start, err)
+	return resp, err
+}
+
+func (this *serverMetrics) streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	method := this.method(info.FullMethod, "stream")
+	start := time.Now()
+	this.Lock()
+	method.streams++
+	this.Unlock()
+	err := handler(srv, stream)
+	this.Lock()
+	method.streams--
+	this.Unlock()
+	this.done(method, start, err)
+	return err
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// METRICS
+
+// Metrics returns the request counts, errors, latency and active streams
+// for each method, in method order
+func (this *serverMetrics) Metrics() []*rpc.MetricFamily {
+	this.Lock()
+	defer this.Unlock()
+
+	requests := rpc.NewMetricFamily("grpc_server_requests_total", "Requests received by method", rpc.METRIC_TYPE_COUNTER)
+	errors := rpc.NewMetricFamily("grpc_server_errors_total", "Requests which returned an error by method and status code", rpc.METRIC_TYPE_COUNTER)
+	latency := rpc.NewMetricFamily("grpc_server_latency_seconds", "Time to complete requests by method", rpc.METRIC_TYPE_HISTOGRAM)
+	streams := rpc.NewMetricFamily("grpc_server_streams_active", "Streams in progress by method", rpc.METRIC_TYPE_GAUGE)
+
+	keys := make([]string, 0, len(this.methods))
+	for key := range this.methods {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		method := this.methods[key]
+		requests.Add(float64(method.requests), "service", method.service, "method", method.method, "type", method.type_)
+		codes := make([]string, 0, len(method.errors))
+		for code := range method.errors {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			errors.Add(float64(method.errors[code]), "service", method.service, "method", method.method, "code", code)
+		}
+		latency.Metrics = append(latency.Metrics, method.latency.Metric("service", method.service, "method", method.method))
+		if method.type_ == "stream" {
+			streams.Add(float64(method.streams), "service", method.service, "method", method.method)
+		}
+	}
+
+	return []*rpc.MetricFamily{requests, errors, latency, streams}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// method returns the metrics for a method, and counts the request
+func (this *serverMetrics) method(name, type_ string) *methodMetrics {
+	this.Lock()
+	defer this.Unlock()
+
+	if this.methods == nil {
+		this.methods = make(map[string]*methodMetrics)
+	}
+	method, exists := this.methods[name]
+	if exists == false {
+		method = &methodMetrics{type_: type_, errors: make(map[string]uint64), latency: metrics.NewHistogram()}
+		method.service, method.method = splitMethod(name)
+		this.methods[name] = method
+	}
+	method.requests++
+	return method
+}
+
+// done records the latency and any error for a request
+func (this *serverMetrics) done(method *methodMetrics, start time.Time, err error) {
+	method.latency.Observe(time.Since(start).Seconds())
+	if err != nil {
+		this.Lock()
+		method.errors[status.Code(err).String()]++
+		this.Unlock()
+	}
+}
+
+// splitMethod returns the service and method from the full method name,
+// which is in the form /package.service/method
+func splitMethod(name string) (string, string) {
+	name = strings.TrimPrefix(name, "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		return name[:i], name[i+1:]
+	} else {
+		return "", name
+	}
+}
@@ -10,8 +10,11 @@
 package grpc
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
 	"regexp"
@@ -27,13 +30,19 @@ import (
 	reflection "google.golang.org/grpc/reflection"
 )
 
-// Server is the RPC server configuration
+// Server is the RPC server configuration. When SSLClientCA is set, client
+// certificates signed by the authority are verified. When AuthPath is set,
+// calls are authorized using the roles in the file. Labels are a
+// comma-separated list of key=value pairs published in the service record
 type Server struct {
 	SSLKey         string
 	SSLCertificate string
+	SSLClientCA    string
+	AuthPath       string
 	Port           uint
 	ServerOption   []grpc.ServerOption
 	Zone           string
+	Labels         string
 	Util           rpc.Util
 }
 
@@ -44,8 +53,18 @@ type server struct {
 	addr   net.Addr
 	ssl    bool
 	zone   string
+	labels rpc.Tuples
 	util   rpc.Util
 
+	// Requests, errors, latency and streams for each method
+	metrics serverMetrics
+
+	// Interceptors called before each method
+	interceptors interceptors
+
+	// Authorization of calls, or nil
+	auth gopi.Driver
+
 	event.Publisher
 }
 
@@ -65,7 +84,7 @@ var (
 
 // Open the server
 func (config Server) Open(log gopi.Logger) (gopi.Driver, error) {
-	log.Debug("<grpc.Server>Open{ port=%v sslcert=%v sslkey=%v zone=%v }", config.Port, strconv.Quote(config.SSLCertificate), strconv.Quote(config.SSLKey), strconv.Quote(config.Zone))
+	log.Debug("<grpc.Server>Open{ port=%v sslcert=%v sslkey=%v sslca=%v auth=%v zone=%v labels=%v }", config.Port, strconv.Quote(config.SSLCertificate), strconv.Quote(config.SSLKey), strconv.Quote(config.SSLClientCA), strconv.Quote(config.AuthPath), strconv.Quote(config.Zone), strconv.Quote(config.Labels))
 
 	this := new(server)
 	this.log = log
@@ -74,6 +93,11 @@ func (config Server) Open(log gopi.Logger) (gopi.Driver, error) {
 	this.zone = strings.Trim(config.Zone, ".")
 	this.util = config.Util
 
+	// Record metrics for each method before calling any other interceptors
+	this.interceptors.AddUnaryInterceptor(this.metrics.unaryInterceptor)
+	this.interceptors.AddStreamInterceptor(this.metrics.streamInterceptor)
+	options := append(config.ServerOption, this.interceptors.ServerOptions()...)
+
 	if this.util == nil || this.zone == "" {
 		return nil, gopi.ErrBadParameter
 	} else {
@@ -81,18 +105,40 @@ func (config Server) Open(log gopi.Logger) (gopi.Driver, error) {
 		this.zone = this.zone + "."
 	}
 
+	// Labels for the service record
+	if labels, err := rpc.ParseLabels(config.Labels); err != nil {
+		return nil, err
+	} else {
+		this.labels = labels
+	}
+
 	if config.SSLKey != "" && config.SSLCertificate != "" {
-		if creds, err := credentials.NewServerTLSFromFile(config.SSLCertificate, config.SSLKey); err != nil {
+		if creds, err := serverCredentials(config.SSLCertificate, config.SSLKey, config.SSLClientCA); err != nil {
 			return nil, err
 		} else {
-			this.server = grpc.NewServer(append(config.ServerOption, grpc.Creds(creds))...)
+			this.server = grpc.NewServer(append(options, grpc.Creds(creds))...)
 		}
 		this.ssl = true
 	} else if config.SSLKey != "" || config.SSLCertificate != "" {
 		this.log.Warn("Both flags required: -rpc.sslcert and -rpc.sslkey")
 		return nil, gopi.ErrBadParameter
+	} else if config.SSLClientCA != "" {
+		this.log.Warn("Flags required for -rpc.sslca: -rpc.sslcert and -rpc.sslkey")
+		return nil, gopi.ErrBadParameter
 	} else {
-		this.server = grpc.NewServer(config.ServerOption...)
+		this.server = grpc.NewServer(options...)
+	}
+
+	// Authorize calls after interceptors added by services, so that they
+	// see calls which are denied
+	if config.AuthPath != "" {
+		if driver, err := gopi.Open(Auth{Path: config.AuthPath}, log); err != nil {
+			this.server.Stop()
+			return nil, err
+		} else {
+			this.auth = driver
+			this.interceptors.SetLastInterceptors(driver.(*auth).UnaryInterceptor, driver.(*auth).StreamInterceptor)
+		}
 	}
 
 	this.addr = nil
@@ -117,9 +163,17 @@ func (this *server) Close() error {
 	// Close publisher
 	this.Publisher.Close()
 
+	// Stop authorizing calls
+	if this.auth != nil {
+		if err_ := this.auth.Close(); err_ != nil && err == nil {
+			err = err_
+		}
+	}
+
 	// Release resources
 	this.addr = nil
 	this.server = nil
+	this.auth = nil
 
 	// Return any error that occurred
 	return err
@@ -201,6 +255,24 @@ func (this *server) GRPCServer() *grpc.Server {
 	return this.server
 }
 
+// AddUnaryInterceptor adds an interceptor for unary methods, which is
+// called after any interceptors already added, and before authorization
+func (this *server) AddUnaryInterceptor(interceptor grpc.UnaryServerInterceptor) {
+	this.interceptors.AddUnaryInterceptor(interceptor)
+}
+
+// AddStreamInterceptor adds an interceptor for streaming methods, which is
+// called after any interceptors already added, and before authorization
+func (this *server) AddStreamInterceptor(interceptor grpc.StreamServerInterceptor) {
+	this.interceptors.AddStreamInterceptor(interceptor)
+}
+
+// Metrics returns the requests, errors, latency and active streams for
+// each method served
+func (this *server) Metrics() []*rpc.MetricFamily {
+	return this.metrics.Metrics()
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 // SERVICE
 
@@ -266,6 +338,12 @@ func (this *server) Service(service, subtype, name string, text ...string) gopi.
 			return nil
 		}
 
+		// Set TXT records for labels
+		if err := r.AppendTXT(rpc.TextForLabels(this.labels)...); err != nil {
+			this.log.Warn("grpc.Service: AppendTXT: %v", err)
+			return nil
+		}
+
 		return r
 	}
 }
@@ -294,6 +372,27 @@ func toSslTXT(ssl bool) string {
 	}
 }
 
+// serverCredentials returns the credentials for a certificate and key, which
+// verify client certificates signed by an authority when the path to the
+// authority is not empty
+func serverCredentials(cert, key, ca string) (credentials.TransportCredentials, error) {
+	if ca == "" {
+		return credentials.NewServerTLSFromFile(cert, key)
+	} else if keypair, err := tls.LoadX509KeyPair(cert, key); err != nil {
+		return nil, err
+	} else if data, err := ioutil.ReadFile(ca); err != nil {
+		return nil, err
+	} else if pool := x509.NewCertPool(); pool.AppendCertsFromPEM(data) == false {
+		return nil, fmt.Errorf("No certificates in %v", ca)
+	} else {
+		return credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{keypair},
+			ClientCAs:    pool,
+			ClientAuth:   tls.VerifyClientCertIfGiven,
+		}), nil
+	}
+}
+
 func portString(port uint) string {
 	if port == 0 {
 		return ""
@@ -0,0 +1,100 @@
+/*
+  Go Language Raspberry Pi Interface
+  (c) Copyright David Thorpe 2019
+  All Rights Reserved
+
+  Documentation http://djthorpe.github.io/gopi/
+  For Licensing and Usage information, please see LICENSE.md
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	// Frameworks
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Histogram counts observations in buckets, and is safe to use from
+// several goroutines
+type Histogram struct {
+	sync.Mutex
+
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+var (
+	// LATENCY_BUCKETS are the upper bounds in seconds for latency histograms
+	LATENCY_BUCKETS = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// NEW
+
+// NewHistogram returns a histogram with bucket upper bounds, or the
+// latency buckets if no bounds are provided
+func NewHistogram(bounds ...float64) *Histogram {
+	this := new(Histogram)
+	if len(bounds) == 0 {
+		bounds = LATENCY_BUCKETS
+	}
+	this.bounds = make([]float64, len(bounds))
+	copy(this.bounds, bounds)
+	sort.Float64s(this.bounds)
+	this.counts = make([]uint64, len(this.bounds))
+	return this
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Observe adds a value to the histogram
+func (this *Histogram) Observe(value float64) {
+	this.Lock()
+	defer this.Unlock()
+	if i := sort.SearchFloat64s(this.bounds, value); i < len(this.counts) {
+		this.counts[i]++
+	}
+	this.count++
+	this.sum += value
+}
+
+// Metric returns the cumulative bucket counts, count and sum with labels,
+// which are name and value pairs
+func (this *Histogram) Metric(labels ...string) rpc.Metric {
+	this.Lock()
+	defer this.Unlock()
+	metric := rpc.Metric{
+		Labels:  rpc.NewMetricLabels(labels...),
+		Buckets: make([]rpc.MetricBucket, len(this.bounds)),
+		Count:   this.count,
+		Sum:     this.sum,
+	}
+	cumulative := uint64(0)
+	for i, bound := range this.bounds {
+		cumulative += this.counts[i]
+		metric.Buckets[i] = rpc.MetricBucket{UpperBound: bound, Count: cumulative}
+	}
+	return metric
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *Histogram) String() string {
+	this.Lock()
+	defer this.Unlock()
+	return fmt.Sprintf("<metrics.Histogram>{ buckets=%v count=%v sum=%v }", len(this.bounds), this.count, this.sum)
+}
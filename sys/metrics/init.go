@@ -0,0 +1,65 @@
+/*
+  Go Language Raspberry Pi Interface
+  (c) Copyright David Thorpe 2019
+  All Rights Reserved
+
+  Documentation http://djthorpe.github.io/gopi/
+  For Licensing and Usage information, please see LICENSE.md
+*/
+
+package metrics
+
+import (
+	"sort"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// INIT
+
+func init() {
+	// Register rpc/metrics
+	gopi.RegisterModule(gopi.Module{
+		Name: "rpc/metrics",
+		Type: gopi.MODULE_TYPE_OTHER,
+		Config: func(config *gopi.AppConfig) {
+			config.AppFlags.FlagString("rpc.metrics", "", "Address to serve metrics on, for example :9100")
+			config.AppFlags.FlagString("rpc.metrics.path", DEFAULT_PATH, "Path to serve metrics on")
+		},
+		New: func(app *gopi.AppInstance) (gopi.Driver, error) {
+			addr, _ := app.AppFlags.GetString("rpc.metrics")
+			path, _ := app.AppFlags.GetString("rpc.metrics.path")
+			return gopi.Open(Metrics{
+				Addr: addr,
+				Path: path,
+			}, app.Logger)
+		},
+		Run: func(app *gopi.AppInstance, driver gopi.Driver) error {
+			// Add every module which collects metrics, once all modules
+			// have been created
+			for _, module := range modulesByName() {
+				if collector, ok := app.ModuleInstance(module.Name).(rpc.MetricsCollector); ok == false {
+					continue
+				} else if err := driver.(rpc.Metrics).AddCollector(collector); err != nil && err != gopi.ErrNotModified {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
+
+// modulesByName returns all registered modules in name order
+func modulesByName() []*gopi.Module {
+	modules := make([]*gopi.Module, 0)
+	for t := gopi.MODULE_TYPE_NONE; t <= gopi.MODULE_TYPE_KEYMAP; t++ {
+		modules = append(modules, gopi.ModulesByType(t)...)
+	}
+	sort.Slice(modules, func(i, j int) bool {
+		return modules[i].Name < modules[j].Name
+	})
+	return modules
+}
@@ -0,0 +1,168 @@
+/*
+  Go Language Raspberry Pi Interface
+  (c) Copyright David Thorpe 2019
+  All Rights Reserved
+
+  Documentation http://djthorpe.github.io/gopi/
+  For Licensing and Usage information, please see LICENSE.md
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Metrics is the configuration for the metrics listener. When Addr is
+// empty, metrics are collected but not served
+type Metrics struct {
+	Addr string
+	Path string
+}
+
+type metrics struct {
+	sync.Mutex
+
+	log        gopi.Logger
+	path       string
+	server     *http.Server
+	addr       net.Addr
+	collectors []rpc.MetricsCollector
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	DEFAULT_PATH = "/metrics"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// OPEN AND CLOSE
+
+func (config Metrics) Open(logger gopi.Logger) (gopi.Driver, error) {
+	logger.Debug("<rpc.metrics>Open{ addr=%v path=%v }", strconv.Quote(config.Addr), strconv.Quote(config.Path))
+
+	this := new(metrics)
+	this.log = logger
+	this.path = config.Path
+	this.collectors = make([]rpc.MetricsCollector, 0)
+
+	if this.path == "" {
+		this.path = DEFAULT_PATH
+	}
+
+	// Start listening when there is an address
+	if config.Addr != "" {
+		if lis, err := net.Listen("tcp", config.Addr); err != nil {
+			return nil, err
+		} else {
+			mux := http.NewServeMux()
+			mux.Handle(this.path, this)
+			this.server = &http.Server{Handler: mux}
+			this.addr = lis.Addr()
+			go func() {
+				if err := this.server.Serve(lis); err != nil && err != http.ErrServerClosed {
+					this.log.Error("rpc.metrics: %v", err)
+				}
+			}()
+			this.log.Info("Serving metrics on %v%v", this.addr, this.path)
+		}
+	}
+
+	// Success
+	return this, nil
+}
+
+func (this *metrics) Close() error {
+	this.log.Debug("<rpc.metrics>Close{ addr=%v }", this.addr)
+
+	// Stop serving
+	if this.server != nil {
+		if err := this.server.Close(); err != nil {
+			return err
+		}
+	}
+
+	// Release resources
+	this.server = nil
+	this.addr = nil
+	this.collectors = nil
+
+	// Success
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// AddCollector adds a collector, which is called whenever metrics are
+// requested
+func (this *metrics) AddCollector(collector rpc.MetricsCollector) error {
+	this.Lock()
+	defer this.Unlock()
+
+	if collector == nil {
+		return gopi.ErrBadParameter
+	}
+	for _, other := range this.collectors {
+		if other == collector {
+			return gopi.ErrNotModified
+		}
+	}
+	this.collectors = append(this.collectors, collector)
+
+	// Success
+	return nil
+}
+
+// Addr returns the address metrics are served on, or nil
+func (this *metrics) Addr() net.Addr {
+	return this.addr
+}
+
+// ServeHTTP writes the metrics from all the collectors
+func (this *metrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	this.Lock()
+	collectors := this.collectors
+	this.Unlock()
+
+	families := make([]*rpc.MetricFamily, 0)
+	for _, collector := range collectors {
+		families = append(families, collector.Metrics()...)
+	}
+
+	w.Header().Set("Content-Type", CONTENT_TYPE)
+	if err := Write(w, families); err != nil {
+		this.log.Warn("rpc.metrics: %v", err)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *metrics) String() string {
+	this.Lock()
+	defer this.Unlock()
+	if this.addr != nil {
+		return fmt.Sprintf("<rpc.metrics>{ serving,addr=%v path=%v collectors=%v }", this.addr, strconv.Quote(this.path), len(this.collectors))
+	} else {
+		return fmt.Sprintf("<rpc.metrics>{ idle collectors=%v }", len(this.collectors))
+	}
+}
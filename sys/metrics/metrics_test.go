@@ -0,0 +1,126 @@
+package metrics_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+	rpc "github.com/djthorpe/gopi-rpc"
+
+	// Modules
+	metrics "github.com/djthorpe/gopi-rpc/sys/metrics"
+	logger "github.com/djthorpe/gopi/sys/logger"
+)
+
+type Collector []*rpc.MetricFamily
+
+func (this Collector) Metrics() []*rpc.MetricFamily {
+	return this
+}
+
+func Test_Metrics_001(t *testing.T) {
+	counter := rpc.NewMetricFamily("requests_total", "Requests\nreceived", rpc.METRIC_TYPE_COUNTER)
+	counter.Add(3, "method", "Get")
+	counter.Add(1, "method", "Say \"hello\"")
+	gauge := rpc.NewMetricFamily("streams", "", rpc.METRIC_TYPE_GAUGE)
+	gauge.Add(math.Inf(+1))
+	empty := rpc.NewMetricFamily("empty", "Not written", rpc.METRIC_TYPE_GAUGE)
+
+	buf := new(bytes.Buffer)
+	if err := metrics.Write(buf, []*rpc.MetricFamily{counter, gauge, empty}); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP requests_total Requests\nreceived
+# TYPE requests_total counter
+requests_total{method="Get"} 3
+requests_total{method="Say \"hello\""} 1
+# TYPE streams gauge
+streams +Inf
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\n%v", buf.String())
+	}
+}
+
+func Test_Metrics_002(t *testing.T) {
+	histogram := metrics.NewHistogram(1, 0.1)
+	for _, value := range []float64{0.05, 0.1, 0.5, 2} {
+		histogram.Observe(value)
+	}
+	family := rpc.NewMetricFamily("latency_seconds", "Latency", rpc.METRIC_TYPE_HISTOGRAM)
+	family.Metrics = append(family.Metrics, histogram.Metric("method", "Get"))
+
+	buf := new(bytes.Buffer)
+	if err := metrics.Write(buf, []*rpc.MetricFamily{family}); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP latency_seconds Latency
+# TYPE latency_seconds histogram
+latency_seconds_bucket{method="Get",le="0.1"} 2
+latency_seconds_bucket{method="Get",le="1"} 3
+latency_seconds_bucket{method="Get",le="+Inf"} 4
+latency_seconds_sum{method="Get"} 2.65
+latency_seconds_count{method="Get"} 4
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\n%v", buf.String())
+	}
+}
+
+func Test_Metrics_003(t *testing.T) {
+	// Without an address metrics are not served
+	if driver, err := NewMetricsWithConfig(metrics.Metrics{}); err != nil {
+		t.Fatal(err)
+	} else if err := driver.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Metrics_004(t *testing.T) {
+	driver, err := NewMetricsWithConfig(metrics.Metrics{Addr: "localhost:0", Path: "/test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+
+	family := rpc.NewMetricFamily("answers_total", "Answers", rpc.METRIC_TYPE_COUNTER)
+	family.Add(42)
+	if err := driver.(rpc.Metrics).AddCollector(Collector{family}); err != nil {
+		t.Fatal(err)
+	} else if err := driver.(rpc.Metrics).AddCollector(nil); err != gopi.ErrBadParameter {
+		t.Error("Expected ErrBadParameter, got", err)
+	}
+
+	addr := driver.(interface{ Addr() net.Addr }).Addr()
+	if resp, err := http.Get("http://" + addr.String() + "/test"); err != nil {
+		t.Fatal(err)
+	} else {
+		defer resp.Body.Close()
+		if body, err := ioutil.ReadAll(resp.Body); err != nil {
+			t.Fatal(err)
+		} else if resp.StatusCode != http.StatusOK {
+			t.Error("Unexpected status", resp.Status)
+		} else if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") == false {
+			t.Error("Unexpected content type", resp.Header.Get("Content-Type"))
+		} else if strings.Contains(string(body), "answers_total 42\n") == false {
+			t.Errorf("Unexpected body:\n%v", string(body))
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// OPEN
+
+func NewMetricsWithConfig(config metrics.Metrics) (gopi.Driver, error) {
+	if log, err := gopi.Open(logger.Config{Level: logger.LOG_DEBUG2}, nil); err != nil {
+		return nil, err
+	} else {
+		return gopi.Open(config, log.(gopi.Logger))
+	}
+}
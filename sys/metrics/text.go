@@ -0,0 +1,108 @@
+/*
+  Go Language Raspberry Pi Interface
+  (c) Copyright David Thorpe 2019
+  All Rights Reserved
+
+  Documentation http://djthorpe.github.io/gopi/
+  For Licensing and Usage information, please see LICENSE.md
+*/
+
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	// Frameworks
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	// CONTENT_TYPE is the content type of the text format
+	CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var (
+	escapeHelp  = strings.NewReplacer("\\", "\\\\", "\n", "\\n")
+	escapeLabel = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\"", "\\\"")
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// WRITE
+
+// Write metric families in the Prometheus text format. Families without
+// metrics are not written
+func Write(w io.Writer, families []*rpc.MetricFamily) error {
+	buf := bufio.NewWriter(w)
+	for _, family := range families {
+		if family == nil || len(family.Metrics) == 0 {
+			continue
+		}
+		if family.Help != "" {
+			buf.WriteString("# HELP " + family.Name + " " + escapeHelp.Replace(family.Help) + "\n")
+		}
+		buf.WriteString("# TYPE " + family.Name + " " + family.Type.String() + "\n")
+		for _, metric := range family.Metrics {
+			if family.Type == rpc.METRIC_TYPE_HISTOGRAM {
+				writeHistogram(buf, family.Name, metric)
+			} else {
+				writeSample(buf, family.Name, metric.Labels, metric.Value)
+			}
+		}
+	}
+	return buf.Flush()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func writeHistogram(buf *bufio.Writer, name string, metric rpc.Metric) {
+	for _, bucket := range metric.Buckets {
+		if math.IsInf(bucket.UpperBound, +1) == false {
+			writeSample(buf, name+"_bucket", withLabel(metric.Labels, "le", formatFloat(bucket.UpperBound)), float64(bucket.Count))
+		}
+	}
+	writeSample(buf, name+"_bucket", withLabel(metric.Labels, "le", "+Inf"), float64(metric.Count))
+	writeSample(buf, name+"_sum", metric.Labels, metric.Sum)
+	writeSample(buf, name+"_count", metric.Labels, float64(metric.Count))
+}
+
+func writeSample(buf *bufio.Writer, name string, labels []rpc.MetricLabel, value float64) {
+	buf.WriteString(name)
+	if len(labels) > 0 {
+		buf.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(label.Name + "=\"" + escapeLabel.Replace(label.Value) + "\"")
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteString(" " + formatFloat(value) + "\n")
+}
+
+// withLabel returns a copy of the labels with a label appended
+func withLabel(labels []rpc.MetricLabel, name, value string) []rpc.MetricLabel {
+	labels_ := make([]rpc.MetricLabel, 0, len(labels)+1)
+	labels_ = append(labels_, labels...)
+	return append(labels_, rpc.MetricLabel{Name: name, Value: value})
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, +1) {
+		return "+Inf"
+	} else if math.IsInf(value, -1) {
+		return "-Inf"
+	} else if math.IsNaN(value) {
+		return "NaN"
+	} else {
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,53 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package scheduler
+
+import (
+	"fmt"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// INIT
+
+func init() {
+	// Register Scheduler, which places instances on the gaffer services
+	// discovered with the client pool
+	gopi.RegisterModule(gopi.Module{
+		Name:     "scheduler",
+		Type:     gopi.MODULE_TYPE_OTHER,
+		Requires: []string{"rpc/clientpool", "rpc/gaffer:client"},
+		Config: func(config *gopi.AppConfig) {
+			config.AppFlags.FlagString("scheduler.path", "", "Scheduler jobs file")
+			config.AppFlags.FlagUint("scheduler.capacity", 0, "Number of instances which can run on a node without a capacity label, or zero for no limit")
+			config.AppFlags.FlagDuration("scheduler.timeout", DISCOVERY_TIMEOUT, "Time to wait for nodes to be discovered")
+		},
+		New: func(app *gopi.AppInstance) (gopi.Driver, error) {
+			path, _ := app.AppFlags.GetString("scheduler.path")
+			capacity, _ := app.AppFlags.GetUint("scheduler.capacity")
+			timeout, _ := app.AppFlags.GetDuration("scheduler.timeout")
+			if path == "" {
+				return nil, fmt.Errorf("Missing -scheduler.path")
+			}
+			service, _, _, err := app.Service()
+			if err != nil {
+				return nil, err
+			}
+			return gopi.Open(Scheduler{
+				Pool:     app.ModuleInstance("rpc/clientpool").(gopi.RPCClientPool),
+				Service:  fmt.Sprintf("_%v._tcp", service),
+				Path:     path,
+				Capacity: capacity,
+				Timeout:  timeout,
+			}, app.Logger)
+		},
+	})
+}
@@ -0,0 +1,188 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// client is a connection to a gaffer service, which is kept between passes
+type client struct {
+	record gopi.RPCServiceRecord
+	conn   gopi.RPCClientConn
+	gaffer rpc.GafferClient
+}
+
+// running are the running instances on a node by identifier
+type running map[uint32]rpc.GafferServiceInstance
+
+////////////////////////////////////////////////////////////////////////////////
+// DISCOVER NODES
+
+// discover returns the nodes discovered on the network, and the running
+// instances on each node. Nodes which cannot be reached are returned with
+// an error. Connections to nodes which have gone are closed
+func (this *scheduler) discover() ([]*rpc.GafferNode, map[string]running, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+	records, err := this.pool.Lookup(ctx, this.service, "", 0)
+	if err == gopi.ErrDeadlineExceeded {
+		records = nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	// Use the first record for each name
+	byName := make(map[string]gopi.RPCServiceRecord, len(records))
+	for _, record := range records {
+		if _, exists := byName[record.Name()]; exists == false {
+			byName[record.Name()] = record
+		}
+	}
+
+	// Close connections to nodes which have gone or moved
+	for name, client := range this.clients {
+		if record, exists := byName[name]; exists == false || record.Port() != client.record.Port() {
+			this.disconnect(name)
+		}
+	}
+
+	// Query the nodes at once
+	nodes := make([]*rpc.GafferNode, 0, len(byName))
+	instances := make(map[string]running, len(byName))
+	clients := make(map[string]*client, len(byName))
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	for name, record := range byName {
+		wg.Add(1)
+		go func(name string, record gopi.RPCServiceRecord, client_ *client) {
+			defer wg.Done()
+			node, running, client := this.query(name, record, client_)
+			lock.Lock()
+			defer lock.Unlock()
+			nodes = append(nodes, node)
+			instances[name] = running
+			if client != nil {
+				clients[name] = client
+			}
+		}(name, record, this.clients[name])
+	}
+	wg.Wait()
+
+	// Keep connections to nodes which could be reached
+	for _, node := range nodes {
+		if client, exists := clients[node.Name]; exists && node.Error != nil {
+			if err := this.pool.Disconnect(client.conn); err != nil {
+				this.log.Warn("Scheduler: %v: %v", node.Name, err)
+			}
+			delete(clients, node.Name)
+		}
+	}
+	this.clients = clients
+
+	// Sort nodes by name
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+
+	// Success
+	return nodes, instances, nil
+}
+
+// query connects to a node if there is no connection, and returns the node
+// with the services and running instances, and the connection
+func (this *scheduler) query(name string, record gopi.RPCServiceRecord, client *client) (*rpc.GafferNode, running, *client) {
+	node := &rpc.GafferNode{
+		Name:     name,
+		Labels:   rpc.LabelsForText(record.Text()),
+		Capacity: this.capacity,
+		Services: make(map[string]uint),
+	}
+	instances := make(running)
+
+	// Set capacity from the node labels
+	if value := node.Labels.StringForKey(LABEL_CAPACITY); value != "" {
+		if capacity, err := strconv.ParseUint(value, 10, 32); err != nil {
+			node.Error = fmt.Errorf("Invalid %v label: %v", LABEL_CAPACITY, strconv.Quote(value))
+			return node, instances, client
+		} else {
+			node.Capacity = uint(capacity)
+		}
+	}
+
+	// Connect to the node
+	if client == nil {
+		if client_, err := this.connect(record); err != nil {
+			node.Error = err
+			return node, instances, nil
+		} else {
+			client = client_
+		}
+	}
+
+	// Return services and running instances
+	if err := client.gaffer.Ping(); err != nil {
+		node.Error = err
+	} else if services, err := client.gaffer.ListServices(); err != nil {
+		node.Error = err
+	} else if running_, err := client.gaffer.ListInstancesWithFilter(rpc.GafferFilter{State: rpc.GAFFER_INSTANCE_RUNNING}); err != nil {
+		node.Error = err
+	} else {
+		for _, service := range services {
+			node.Services[service.Name()] = 0
+		}
+		for _, instance := range running_ {
+			if service := instance.Service(); service != nil {
+				node.Services[service.Name()]++
+			}
+			instances[instance.Id()] = instance
+		}
+		node.Running = uint(len(instances))
+	}
+
+	// Success
+	return node, instances, client
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONNECT AND DISCONNECT
+
+func (this *scheduler) connect(record gopi.RPCServiceRecord) (*client, error) {
+	if conn, err := this.pool.Connect(record, 0); err != nil {
+		return nil, err
+	} else if stub := this.pool.NewClient("gopi.Gaffer", conn); stub == nil {
+		this.pool.Disconnect(conn)
+		return nil, gopi.ErrBadParameter
+	} else if gaffer, ok := stub.(rpc.GafferClient); ok == false {
+		this.pool.Disconnect(conn)
+		return nil, fmt.Errorf("Stub is not an rpc.GafferClient")
+	} else {
+		return &client{record, conn, gaffer}, nil
+	}
+}
+
+func (this *scheduler) disconnect(name string) {
+	if client, exists := this.clients[name]; exists == false {
+		return
+	} else if err := this.pool.Disconnect(client.conn); err != nil {
+		this.log.Warn("Scheduler: %v: %v", name, err)
+	}
+	delete(this.clients, name)
+}
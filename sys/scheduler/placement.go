@@ -0,0 +1,163 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+
+	// Frameworks
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// counts are the instances placed for a job on each node, and for each
+// value of the spread label
+type counts struct {
+	spread string
+	node   map[string]uint
+	value  map[string]uint
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PLACEMENT
+
+// Fits returns nil when an instance of a job can be placed on a node, or
+// else the reason it cannot be placed
+func Fits(job rpc.GafferJob, node *rpc.GafferNode) error {
+	if node.Error != nil {
+		return node.Error
+	} else if _, exists := node.Services[job.Service]; exists == false {
+		return fmt.Errorf("Service %v has not been added", strconv.Quote(job.Service))
+	} else if selector, err := rpc.ParseLabelSelector(job.Selector); err != nil {
+		return err
+	} else if selector.Matches(node.Labels) == false {
+		return fmt.Errorf("Labels do not match %v", strconv.Quote(job.Selector))
+	} else if node.Capacity > 0 && node.Running >= node.Capacity {
+		return fmt.Errorf("No free capacity")
+	}
+	for _, service := range job.Affinity {
+		if node.Services[service] == 0 {
+			return fmt.Errorf("Service %v is not running", strconv.Quote(service))
+		}
+	}
+	for _, service := range job.AntiAffinity {
+		if node.Services[service] > 0 {
+			return fmt.Errorf("Service %v is running", strconv.Quote(service))
+		}
+	}
+	return nil
+}
+
+// Place returns the node for another instance of a job, or nil when no
+// node can run the instance. The placements are the instances already
+// placed for the job. Nodes are chosen to spread instances across the
+// values of the spread label and then across nodes, and then by the most
+// free capacity
+func Place(job rpc.GafferJob, nodes []*rpc.GafferNode, placements []rpc.GafferPlacement) *rpc.GafferNode {
+	counts := countPlacements(job, nodes, placements)
+	var best *rpc.GafferNode
+	for _, node := range nodes {
+		if Fits(job, node) != nil {
+			continue
+		} else if best == nil || counts.less(node, best) {
+			best = node
+		}
+	}
+	return best
+}
+
+// Surplus returns the placement to stop when a job has more instances than
+// requested, which is the most recent placement on the node least suited
+// to the job. It returns false when there are no placements
+func Surplus(job rpc.GafferJob, nodes []*rpc.GafferNode, placements []rpc.GafferPlacement) (rpc.GafferPlacement, bool) {
+	counts := countPlacements(job, nodes, placements)
+	byName := nodesByName(nodes)
+	var worst rpc.GafferPlacement
+	found := false
+	for _, placement := range placements {
+		if found == false {
+			worst, found = placement, true
+			continue
+		}
+		node, worst_ := byName[placement.Node], byName[worst.Node]
+		if node == nil || worst_ == nil {
+			// Nodes which have gone are least suited
+			if worst_ != nil || placement.Timestamp.After(worst.Timestamp) {
+				worst = placement
+			}
+		} else if node == worst_ {
+			if placement.Timestamp.After(worst.Timestamp) {
+				worst = placement
+			}
+		} else if counts.less(worst_, node) {
+			worst = placement
+		}
+	}
+	return worst, found
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func countPlacements(job rpc.GafferJob, nodes []*rpc.GafferNode, placements []rpc.GafferPlacement) *counts {
+	byName := nodesByName(nodes)
+	counts := &counts{
+		spread: job.Spread,
+		node:   make(map[string]uint, len(nodes)),
+		value:  make(map[string]uint),
+	}
+	for _, placement := range placements {
+		counts.node[placement.Node]++
+		if node := byName[placement.Node]; node != nil && counts.spread != "" {
+			counts.value[node.Labels.StringForKey(counts.spread)]++
+		}
+	}
+	return counts
+}
+
+// less returns true if node a is better suited to another instance than
+// node b
+func (this *counts) less(a, b *rpc.GafferNode) bool {
+	if this.spread != "" {
+		if va, vb := this.value[a.Labels.StringForKey(this.spread)], this.value[b.Labels.StringForKey(this.spread)]; va != vb {
+			return va < vb
+		}
+	}
+	if na, nb := this.node[a.Name], this.node[b.Name]; na != nb {
+		return na < nb
+	} else if fa, fb := free(a), free(b); fa != fb {
+		return fa > fb
+	} else if a.Running != b.Running {
+		return a.Running < b.Running
+	} else {
+		return a.Name < b.Name
+	}
+}
+
+// free returns the number of instances which can be started on a node
+func free(node *rpc.GafferNode) uint {
+	if node.Capacity == 0 {
+		return ^uint(0)
+	} else if node.Running >= node.Capacity {
+		return 0
+	} else {
+		return node.Capacity - node.Running
+	}
+}
+
+func nodesByName(nodes []*rpc.GafferNode) map[string]*rpc.GafferNode {
+	byName := make(map[string]*rpc.GafferNode, len(nodes))
+	for _, node := range nodes {
+		byName[node.Name] = node
+	}
+	return byName
+}
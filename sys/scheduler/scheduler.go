@@ -0,0 +1,433 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Scheduler places instances of services on the gaffer services which are
+// discovered on the network
+type Scheduler struct {
+	// Pool is used to discover and connect to nodes
+	Pool gopi.RPCClientPool
+
+	// Service is the service type for gaffer nodes, for example "_gopi._tcp"
+	Service string
+
+	// Path is the jobs file. Placements are recorded in a file with the
+	// same name and a ".placements" extension
+	Path string
+
+	// Capacity is the number of instances which can run on a node without
+	// a capacity label, or zero for no limit
+	Capacity uint
+
+	// Timeout is the time to wait for nodes to be discovered
+	Timeout time.Duration
+}
+
+type scheduler struct {
+	log      gopi.Logger
+	pool     gopi.RPCClientPool
+	service  string
+	path     string
+	capacity uint
+	timeout  time.Duration
+
+	// jobs are read from the jobs file, which was modified at the time
+	// recorded
+	jobs     map[string]rpc.GafferJob
+	modified time.Time
+
+	// placements are the instances placed on nodes, and clients the
+	// connections to nodes
+	placements []rpc.GafferPlacement
+	clients    map[string]*client
+
+	sync.Mutex
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	DISCOVERY_TIMEOUT = time.Second
+	PLACEMENTS_EXT    = ".placements"
+
+	// LABEL_CAPACITY is the node label for the number of instances which
+	// can run on the node, and LABEL_JOB the instance label for instances
+	// which have been placed by the scheduler
+	LABEL_CAPACITY = "capacity"
+	LABEL_JOB      = "scheduler.job"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// OPEN AND CLOSE
+
+func (config Scheduler) Open(logger gopi.Logger) (gopi.Driver, error) {
+	logger.Debug("<scheduler.Open>{ service=%v path=%v capacity=%v }", strconv.Quote(config.Service), strconv.Quote(config.Path), config.Capacity)
+
+	this := new(scheduler)
+	this.log = logger
+	this.pool = config.Pool
+	this.service = config.Service
+	this.path = config.Path
+	this.capacity = config.Capacity
+	this.timeout = config.Timeout
+	this.clients = make(map[string]*client)
+
+	// Set defaults
+	if this.timeout == 0 {
+		this.timeout = DISCOVERY_TIMEOUT
+	}
+
+	// Check parameters
+	if this.pool == nil || this.service == "" || this.path == "" {
+		return nil, gopi.ErrBadParameter
+	}
+
+	// Read the jobs and placements
+	if _, err := this.readJobs(); err != nil {
+		return nil, err
+	} else if err := this.readPlacements(); err != nil {
+		return nil, err
+	}
+
+	// Success
+	return this, nil
+}
+
+func (this *scheduler) Close() error {
+	this.log.Debug("<scheduler.Close>{ path=%v }", strconv.Quote(this.path))
+
+	this.Lock()
+	defer this.Unlock()
+
+	// Close connections to nodes
+	for name := range this.clients {
+		this.disconnect(name)
+	}
+
+	// Release resources
+	this.jobs = nil
+	this.placements = nil
+	this.clients = nil
+
+	// Success
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *scheduler) String() string {
+	return fmt.Sprintf("<scheduler>{ service=%v path=%v capacity=%v jobs=%v placements=%v }", strconv.Quote(this.service), strconv.Quote(this.path), this.capacity, len(this.jobs), len(this.placements))
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// JOBS
+
+func (this *scheduler) Jobs() ([]rpc.GafferJob, error) {
+	this.Lock()
+	defer this.Unlock()
+
+	if _, err := this.readJobs(); err != nil {
+		return nil, err
+	} else {
+		return this.sortedJobs(), nil
+	}
+}
+
+func (this *scheduler) SetJob(job rpc.GafferJob) error {
+	this.log.Debug2("<scheduler>SetJob{ job=%+v }", job)
+
+	this.Lock()
+	defer this.Unlock()
+
+	// Check incoming parameters
+	if job.Service == "" {
+		return gopi.ErrBadParameter
+	} else if _, err := rpc.ParseLabelSelector(job.Selector); err != nil {
+		return err
+	}
+
+	// Set the job
+	if _, err := this.readJobs(); err != nil {
+		return err
+	}
+	this.jobs[job.Service] = job
+	return this.writeJobs()
+}
+
+func (this *scheduler) RemoveJob(service string) error {
+	this.log.Debug2("<scheduler>RemoveJob{ service=%v }", strconv.Quote(service))
+
+	this.Lock()
+	defer this.Unlock()
+
+	if _, err := this.readJobs(); err != nil {
+		return err
+	} else if _, exists := this.jobs[service]; exists == false {
+		return gopi.ErrNotFound
+	}
+	delete(this.jobs, service)
+	return this.writeJobs()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PLACEMENTS AND NODES
+
+func (this *scheduler) Placements() []rpc.GafferPlacement {
+	this.Lock()
+	defer this.Unlock()
+
+	placements := make([]rpc.GafferPlacement, len(this.placements))
+	copy(placements, this.placements)
+	return placements
+}
+
+func (this *scheduler) Nodes() ([]*rpc.GafferNode, error) {
+	this.Lock()
+	defer this.Unlock()
+
+	if nodes, _, err := this.discover(); err != nil {
+		return nil, err
+	} else {
+		return nodes, nil
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// RECONCILE
+
+func (this *scheduler) Reconcile() error {
+	this.log.Debug2("<scheduler>Reconcile{ }")
+
+	this.Lock()
+	defer this.Unlock()
+
+	// Read jobs and discover nodes
+	if _, err := this.readJobs(); err != nil {
+		return err
+	}
+	nodes, instances, err := this.discover()
+	if err != nil {
+		return err
+	}
+	byName := nodesByName(nodes)
+
+	// Forget instances on nodes which have gone or cannot be reached, and
+	// instances which are no longer running. Instances on these nodes are
+	// placed again on other nodes
+	placements := make([]rpc.GafferPlacement, 0, len(this.placements))
+	placed := make(map[string]bool, len(this.placements))
+	for _, placement := range this.placements {
+		if node := byName[placement.Node]; node == nil {
+			this.log.Info("Scheduler: Node %v has gone, forgetting %v instance %v", placement.Node, placement.Service, placement.Instance)
+		} else if node.Error != nil {
+			this.log.Info("Scheduler: Node %v cannot be reached, forgetting %v instance %v: %v", placement.Node, placement.Service, placement.Instance, node.Error)
+		} else if _, exists := instances[placement.Node][placement.Instance]; exists == false {
+			this.log.Info("Scheduler: %v instance %v on %v is not running", placement.Service, placement.Instance, placement.Node)
+		} else {
+			placements = append(placements, placement)
+			placed[keyForPlacement(placement.Node, placement.Instance)] = true
+		}
+	}
+	changed := len(placements) != len(this.placements)
+
+	// Adopt running instances which were placed by the scheduler, for
+	// example on nodes which can be reached again
+	for _, node := range nodes {
+		for _, id := range sortedIds(instances[node.Name]) {
+			instance := instances[node.Name][id]
+			labels := instance.Labels()
+			if service := labels.StringForKey(LABEL_JOB); service == "" || instance.Service() == nil || instance.Service().Name() != service {
+				continue
+			} else if placed[keyForPlacement(node.Name, id)] {
+				continue
+			} else {
+				this.log.Info("Scheduler: Adopting %v instance %v on %v", service, id, node.Name)
+				placements = append(placements, rpc.GafferPlacement{
+					Service:   service,
+					Node:      node.Name,
+					Instance:  id,
+					Timestamp: instance.Start(),
+				})
+				changed = true
+			}
+		}
+	}
+	this.placements = placements
+
+	// Stop instances of services which have no job
+	for _, placement := range this.placementsWithoutJob() {
+		if err := this.stop(placement, byName[placement.Node]); err != nil {
+			this.log.Warn("Scheduler: %v instance %v on %v: %v", placement.Service, placement.Instance, placement.Node, err)
+		} else {
+			changed = true
+		}
+	}
+
+	// Start or stop instances for each job
+	for _, job := range this.sortedJobs() {
+		for {
+			placements := this.placementsForService(job.Service)
+			if uint(len(placements)) < job.Count {
+				if node := Place(job, nodes, placements); node == nil {
+					this.log.Warn("Scheduler: %v: No node for instance %v of %v", job.Service, len(placements)+1, job.Count)
+					break
+				} else if err := this.start(job, node); err != nil {
+					this.log.Warn("Scheduler: %v on %v: %v", job.Service, node.Name, err)
+					break
+				}
+			} else if uint(len(placements)) > job.Count {
+				if placement, exists := Surplus(job, nodes, placements); exists == false {
+					break
+				} else if err := this.stop(placement, byName[placement.Node]); err != nil {
+					this.log.Warn("Scheduler: %v instance %v on %v: %v", placement.Service, placement.Instance, placement.Node, err)
+					break
+				}
+			} else {
+				break
+			}
+			changed = true
+		}
+	}
+
+	// Record the placements
+	if changed {
+		if err := this.writePlacements(); err != nil {
+			return err
+		}
+	}
+
+	// Success
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// START AND STOP INSTANCES
+
+// start places an instance of a job on a node, and labels the instance so
+// that it can be adopted when the placements are lost
+func (this *scheduler) start(job rpc.GafferJob, node *rpc.GafferNode) error {
+	client := this.clients[node.Name]
+	if client == nil {
+		return gopi.ErrNotFound
+	}
+	id, err := client.gaffer.GetInstanceId()
+	if err != nil {
+		return err
+	}
+	instance, err := client.gaffer.StartInstance(job.Service, id)
+	if err != nil {
+		return err
+	}
+	labels := instance.Labels().Copy()
+	labels.SetStringForKey(LABEL_JOB, job.Service)
+	if _, err := client.gaffer.SetLabelsForInstance(instance.Id(), labels); err != nil {
+		// Stop the instance, which would not be adopted
+		if _, err_ := client.gaffer.StopInstance(instance.Id()); err_ != nil {
+			this.log.Warn("Scheduler: %v instance %v on %v: %v", job.Service, instance.Id(), node.Name, err_)
+		}
+		return err
+	}
+
+	// Record the placement
+	this.placements = append(this.placements, rpc.GafferPlacement{
+		Service:   job.Service,
+		Node:      node.Name,
+		Instance:  instance.Id(),
+		Timestamp: time.Now(),
+	})
+	node.Running++
+	node.Services[job.Service]++
+	this.log.Info("Scheduler: Started %v instance %v on %v", job.Service, instance.Id(), node.Name)
+
+	// Success
+	return nil
+}
+
+// stop stops a placed instance and forgets the placement
+func (this *scheduler) stop(placement rpc.GafferPlacement, node *rpc.GafferNode) error {
+	client := this.clients[placement.Node]
+	if client == nil || node == nil {
+		return gopi.ErrNotFound
+	} else if _, err := client.gaffer.StopInstance(placement.Instance); err != nil {
+		return err
+	}
+
+	// Forget the placement
+	for i, placement_ := range this.placements {
+		if placement_.Node == placement.Node && placement_.Instance == placement.Instance {
+			this.placements = append(this.placements[:i], this.placements[i+1:]...)
+			break
+		}
+	}
+	if node.Running > 0 {
+		node.Running--
+	}
+	if node.Services[placement.Service] > 0 {
+		node.Services[placement.Service]--
+	}
+	this.log.Info("Scheduler: Stopped %v instance %v on %v", placement.Service, placement.Instance, placement.Node)
+
+	// Success
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func (this *scheduler) placementsForService(service string) []rpc.GafferPlacement {
+	placements := make([]rpc.GafferPlacement, 0)
+	for _, placement := range this.placements {
+		if placement.Service == service {
+			placements = append(placements, placement)
+		}
+	}
+	return placements
+}
+
+func (this *scheduler) placementsWithoutJob() []rpc.GafferPlacement {
+	placements := make([]rpc.GafferPlacement, 0)
+	for _, placement := range this.placements {
+		if _, exists := this.jobs[placement.Service]; exists == false {
+			placements = append(placements, placement)
+		}
+	}
+	return placements
+}
+
+func keyForPlacement(node string, id uint32) string {
+	return fmt.Sprint(node, "/", id)
+}
+
+func sortedIds(instances running) []uint32 {
+	ids := make([]uint32, 0, len(instances))
+	for id := range instances {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	return ids
+}
@@ -0,0 +1,472 @@
+package scheduler_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+	rpc "github.com/djthorpe/gopi-rpc"
+
+	// Modules
+	scheduler "github.com/djthorpe/gopi-rpc/sys/scheduler"
+	logger "github.com/djthorpe/gopi/sys/logger"
+)
+
+const (
+	LOG_LEVEL = logger.LOG_DEBUG2
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// PLACEMENT
+
+func Test_Scheduler_001(t *testing.T) {
+	node := NewNode("a", "zone=garage", 2, "helloworld", "db")
+	node.Services["db"] = 1
+	node.Running = 1
+
+	tests := map[string]rpc.GafferJob{
+		"":       rpc.GafferJob{Service: "helloworld"},
+		"select": rpc.GafferJob{Service: "helloworld", Selector: "zone=garage"},
+		"affine": rpc.GafferJob{Service: "helloworld", Affinity: []string{"db"}},
+	}
+	for name, job := range tests {
+		if err := scheduler.Fits(job, node); err != nil {
+			t.Error(name, err)
+		}
+	}
+	tests = map[string]rpc.GafferJob{
+		"service":    rpc.GafferJob{Service: "other"},
+		"select":     rpc.GafferJob{Service: "helloworld", Selector: "zone=attic"},
+		"affine":     rpc.GafferJob{Service: "helloworld", Affinity: []string{"helloworld"}},
+		"antiaffine": rpc.GafferJob{Service: "helloworld", AntiAffinity: []string{"db"}},
+	}
+	for name, job := range tests {
+		if err := scheduler.Fits(job, node); err == nil {
+			t.Error(name, "Expected error")
+		}
+	}
+
+	// No free capacity
+	node.Running = 2
+	if err := scheduler.Fits(rpc.GafferJob{Service: "helloworld"}, node); err == nil {
+		t.Error("Expected error for capacity")
+	}
+}
+
+func Test_Scheduler_002(t *testing.T) {
+	// Spread across zones before nodes
+	nodes := []*rpc.GafferNode{
+		NewNode("a", "zone=garage", 0, "helloworld"),
+		NewNode("b", "zone=garage", 0, "helloworld"),
+		NewNode("c", "zone=attic", 0, "helloworld"),
+	}
+	job := rpc.GafferJob{Service: "helloworld", Spread: "zone"}
+	placements := []rpc.GafferPlacement{}
+	expected := []string{"a", "c", "b", "c", "a", "c"}
+	for _, name := range expected {
+		if node := scheduler.Place(job, nodes, placements); node == nil {
+			t.Fatal("Expected a node")
+		} else if node.Name != name {
+			t.Fatal("Expected", name, "got", node.Name, "for", len(placements))
+		} else {
+			placements = append(placements, rpc.GafferPlacement{Service: job.Service, Node: node.Name, Instance: uint32(len(placements) + 1)})
+			node.Running++
+		}
+	}
+
+	// Without spread, prefer the node with most free capacity
+	nodes = []*rpc.GafferNode{
+		NewNode("a", "", 2, "helloworld"),
+		NewNode("b", "", 4, "helloworld"),
+		NewNode("c", "", 1, "other"),
+	}
+	if node := scheduler.Place(rpc.GafferJob{Service: "helloworld"}, nodes, nil); node == nil || node.Name != "b" {
+		t.Error("Expected node b, got", node)
+	}
+	nodes[0].Running, nodes[1].Running = 2, 4
+	if node := scheduler.Place(rpc.GafferJob{Service: "helloworld"}, nodes, nil); node != nil {
+		t.Error("Expected no node, got", node)
+	}
+}
+
+func Test_Scheduler_003(t *testing.T) {
+	nodes := []*rpc.GafferNode{
+		NewNode("a", "zone=garage", 0, "helloworld"),
+		NewNode("b", "zone=garage", 0, "helloworld"),
+		NewNode("c", "zone=attic", 0, "helloworld"),
+	}
+	now := time.Now()
+	placements := []rpc.GafferPlacement{
+		{Service: "helloworld", Node: "a", Instance: 1, Timestamp: now},
+		{Service: "helloworld", Node: "b", Instance: 2, Timestamp: now},
+		{Service: "helloworld", Node: "c", Instance: 3, Timestamp: now},
+		{Service: "helloworld", Node: "c", Instance: 4, Timestamp: now.Add(time.Second)},
+	}
+	job := rpc.GafferJob{Service: "helloworld", Spread: "zone"}
+	if placement, exists := scheduler.Surplus(job, nodes, placements); exists == false {
+		t.Error("Expected a placement")
+	} else if placement.Instance != 4 {
+		t.Error("Expected instance 4, got", placement)
+	}
+	if _, exists := scheduler.Surplus(job, nodes, nil); exists {
+		t.Error("Expected no placement")
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// JOBS
+
+func Test_Scheduler_004(t *testing.T) {
+	folder, err := ioutil.TempDir("", "scheduler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	path := filepath.Join(folder, "jobs.json")
+
+	driver, err := NewSchedulerWithConfig(scheduler.Scheduler{Pool: NewPool(), Service: "_gopi._tcp", Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+	if err := driver.SetJob(rpc.GafferJob{Service: "helloworld", Count: 3, Spread: "zone"}); err != nil {
+		t.Error(err)
+	} else if err := driver.SetJob(rpc.GafferJob{Service: "db", Count: 1}); err != nil {
+		t.Error(err)
+	} else if err := driver.SetJob(rpc.GafferJob{Service: "bad", Selector: "=x"}); err == nil {
+		t.Error("Expected error for selector")
+	}
+	if jobs, err := driver.Jobs(); err != nil {
+		t.Error(err)
+	} else if len(jobs) != 2 || jobs[0].Service != "db" || jobs[1].Count != 3 {
+		t.Error("Unexpected jobs", jobs)
+	}
+	if err := driver.RemoveJob("db"); err != nil {
+		t.Error(err)
+	} else if err := driver.RemoveJob("db"); err != gopi.ErrNotFound {
+		t.Error("Expected ErrNotFound, got", err)
+	}
+
+	// Read jobs with another scheduler
+	if driver2, err := NewSchedulerWithConfig(scheduler.Scheduler{Pool: NewPool(), Service: "_gopi._tcp", Path: path}); err != nil {
+		t.Error(err)
+	} else if jobs, err := driver2.Jobs(); err != nil {
+		t.Error(err)
+	} else if len(jobs) != 1 || jobs[0].Service != "helloworld" || jobs[0].Spread != "zone" {
+		t.Error("Unexpected jobs", jobs)
+	} else {
+		driver2.Close()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// RECONCILE
+
+func Test_Scheduler_005(t *testing.T) {
+	folder, err := ioutil.TempDir("", "scheduler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	path := filepath.Join(folder, "jobs.json")
+
+	pool := NewPool()
+	pool.AddNode("a", 1, "label.zone=garage")
+	pool.AddNode("b", 2, "label.zone=garage")
+	pool.AddNode("c", 3, "label.zone=attic", "label.capacity=1")
+
+	driver, err := NewSchedulerWithConfig(scheduler.Scheduler{Pool: pool, Service: "_gopi._tcp", Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+	if err := driver.SetJob(rpc.GafferJob{Service: "helloworld", Count: 3, Spread: "zone"}); err != nil {
+		t.Fatal(err)
+	} else if err := driver.Reconcile(); err != nil {
+		t.Fatal(err)
+	}
+	if counts := pool.Running(); counts["a"] != 1 || counts["b"] != 1 || counts["c"] != 1 {
+		t.Error("Unexpected instances", counts)
+	} else if placements := driver.Placements(); len(placements) != 3 {
+		t.Error("Unexpected placements", placements)
+	}
+
+	// Node c has gone, so an instance is placed on a or b
+	pool.RemoveNode("c")
+	if err := driver.Reconcile(); err != nil {
+		t.Fatal(err)
+	} else if counts := pool.Running(); counts["a"]+counts["b"] != 3 {
+		t.Error("Unexpected instances", counts)
+	}
+
+	// Placements are read by another scheduler, which stops surplus
+	// instances when the job changes
+	driver2, err := NewSchedulerWithConfig(scheduler.Scheduler{Pool: pool, Service: "_gopi._tcp", Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver2.Close()
+	if placements := driver2.Placements(); len(placements) != 3 {
+		t.Error("Unexpected placements", placements)
+	} else if err := driver2.SetJob(rpc.GafferJob{Service: "helloworld", Count: 1}); err != nil {
+		t.Error(err)
+	} else if err := driver2.Reconcile(); err != nil {
+		t.Error(err)
+	} else if counts := pool.Running(); counts["a"]+counts["b"] != 1 {
+		t.Error("Unexpected instances", counts)
+	}
+
+	// Removing the job stops the instances
+	if err := driver2.RemoveJob("helloworld"); err != nil {
+		t.Error(err)
+	} else if err := driver2.Reconcile(); err != nil {
+		t.Error(err)
+	} else if counts := pool.Running(); counts["a"]+counts["b"] != 0 {
+		t.Error("Unexpected instances", counts)
+	} else if placements := driver2.Placements(); len(placements) != 0 {
+		t.Error("Unexpected placements", placements)
+	}
+}
+
+func Test_Scheduler_006(t *testing.T) {
+	folder, err := ioutil.TempDir("", "scheduler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	path := filepath.Join(folder, "jobs.json")
+
+	// Instances labelled by a scheduler are adopted when the placements
+	// are lost
+	pool := NewPool()
+	pool.AddNode("a", 1)
+	pool.nodes["a"].start("helloworld", rpc.Tuples{})
+	labels := rpc.Tuples{}
+	labels.SetStringForKey(scheduler.LABEL_JOB, "helloworld")
+	pool.nodes["a"].start("helloworld", labels)
+
+	driver, err := NewSchedulerWithConfig(scheduler.Scheduler{Pool: pool, Service: "_gopi._tcp", Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+	if err := driver.SetJob(rpc.GafferJob{Service: "helloworld", Count: 1}); err != nil {
+		t.Fatal(err)
+	} else if err := driver.Reconcile(); err != nil {
+		t.Fatal(err)
+	} else if counts := pool.Running(); counts["a"] != 2 {
+		t.Error("Unexpected instances", counts)
+	} else if placements := driver.Placements(); len(placements) != 1 || placements[0].Instance != 2 {
+		t.Error("Unexpected placements", placements)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// NODES
+
+func NewNode(name, labels string, capacity uint, services ...string) *rpc.GafferNode {
+	labels_, _ := rpc.ParseLabels(labels)
+	node := &rpc.GafferNode{
+		Name:     name,
+		Labels:   labels_,
+		Capacity: capacity,
+		Services: make(map[string]uint),
+	}
+	for _, service := range services {
+		node.Services[service] = 0
+	}
+	return node
+}
+
+// Pool discovers and connects to gaffer nodes in memory
+type Pool struct {
+	gopi.RPCClientPool
+	sync.Mutex
+	nodes map[string]*Gaffer
+}
+
+type Record struct {
+	gopi.RPCServiceRecord
+	name string
+	port uint
+	text []string
+}
+
+type Conn struct {
+	gopi.RPCClientConn
+	name string
+}
+
+type Gaffer struct {
+	rpc.GafferClient
+	sync.Mutex
+	record    *Record
+	instances map[uint32]*Instance
+	last      uint32
+}
+
+type Service struct {
+	rpc.GafferService
+	name string
+}
+
+type Instance struct {
+	rpc.GafferServiceInstance
+	id      uint32
+	service string
+	labels  rpc.Tuples
+	start   time.Time
+}
+
+func NewPool() *Pool {
+	return &Pool{nodes: make(map[string]*Gaffer)}
+}
+
+func (this *Pool) AddNode(name string, port uint, text ...string) {
+	this.Lock()
+	defer this.Unlock()
+	this.nodes[name] = &Gaffer{
+		record:    &Record{name: name, port: port, text: text},
+		instances: make(map[uint32]*Instance),
+	}
+}
+
+func (this *Pool) RemoveNode(name string) {
+	this.Lock()
+	defer this.Unlock()
+	delete(this.nodes, name)
+}
+
+func (this *Pool) Running() map[string]int {
+	this.Lock()
+	defer this.Unlock()
+	counts := make(map[string]int)
+	for name, node := range this.nodes {
+		node.Lock()
+		counts[name] = len(node.instances)
+		node.Unlock()
+	}
+	return counts
+}
+
+func (this *Pool) Lookup(ctx context.Context, service, addr string, max int) ([]gopi.RPCServiceRecord, error) {
+	this.Lock()
+	defer this.Unlock()
+	if len(this.nodes) == 0 {
+		return nil, gopi.ErrDeadlineExceeded
+	}
+	records := make([]gopi.RPCServiceRecord, 0, len(this.nodes))
+	for _, node := range this.nodes {
+		records = append(records, node.record)
+	}
+	return records, nil
+}
+
+func (this *Pool) Connect(record gopi.RPCServiceRecord, flags gopi.RPCFlag) (gopi.RPCClientConn, error) {
+	return &Conn{name: record.Name()}, nil
+}
+
+func (this *Pool) Disconnect(conn gopi.RPCClientConn) error {
+	return nil
+}
+
+func (this *Pool) NewClient(service string, conn gopi.RPCClientConn) gopi.RPCClient {
+	this.Lock()
+	defer this.Unlock()
+	if node, exists := this.nodes[conn.(*Conn).name]; exists {
+		return node
+	} else {
+		return nil
+	}
+}
+
+func (this *Record) Name() string   { return this.name }
+func (this *Record) Port() uint     { return this.port }
+func (this *Record) Text() []string { return this.text }
+
+func (this *Gaffer) Ping() error {
+	return nil
+}
+
+func (this *Gaffer) ListServices() ([]rpc.GafferService, error) {
+	return []rpc.GafferService{&Service{name: "helloworld"}}, nil
+}
+
+func (this *Gaffer) ListInstancesWithFilter(filter rpc.GafferFilter) ([]rpc.GafferServiceInstance, error) {
+	this.Lock()
+	defer this.Unlock()
+	instances := make([]rpc.GafferServiceInstance, 0, len(this.instances))
+	for _, instance := range this.instances {
+		instances = append(instances, instance)
+	}
+	return instances, nil
+}
+
+func (this *Gaffer) GetInstanceId() (uint32, error) {
+	this.Lock()
+	defer this.Unlock()
+	this.last++
+	return this.last, nil
+}
+
+func (this *Gaffer) StartInstance(service string, id uint32) (rpc.GafferServiceInstance, error) {
+	this.Lock()
+	defer this.Unlock()
+	instance := &Instance{id: id, service: service, start: time.Now()}
+	this.instances[id] = instance
+	return instance, nil
+}
+
+func (this *Gaffer) StopInstance(id uint32) (rpc.GafferServiceInstance, error) {
+	this.Lock()
+	defer this.Unlock()
+	if instance, exists := this.instances[id]; exists == false {
+		return nil, gopi.ErrNotFound
+	} else {
+		delete(this.instances, id)
+		return instance, nil
+	}
+}
+
+func (this *Gaffer) SetLabelsForInstance(id uint32, labels rpc.Tuples) (rpc.GafferServiceInstance, error) {
+	this.Lock()
+	defer this.Unlock()
+	if instance, exists := this.instances[id]; exists == false {
+		return nil, gopi.ErrNotFound
+	} else {
+		instance.labels = labels
+		return instance, nil
+	}
+}
+
+func (this *Gaffer) start(service string, labels rpc.Tuples) {
+	id, _ := this.GetInstanceId()
+	this.StartInstance(service, id)
+	this.SetLabelsForInstance(id, labels)
+}
+
+func (this *Service) Name() string { return this.name }
+
+func (this *Instance) Id() uint32                 { return this.id }
+func (this *Instance) Service() rpc.GafferService { return &Service{name: this.service} }
+func (this *Instance) Labels() rpc.Tuples         { return this.labels }
+func (this *Instance) Start() time.Time           { return this.start }
+
+////////////////////////////////////////////////////////////////////////////////
+// OPEN
+
+func NewSchedulerWithConfig(config scheduler.Scheduler) (rpc.GafferScheduler, error) {
+	if log, err := gopi.Open(logger.Config{Level: LOG_LEVEL}, nil); err != nil {
+		return nil, err
+	} else if driver, err := gopi.Open(config, log.(gopi.Logger)); err != nil {
+		return nil, err
+	} else {
+		return driver.(rpc.GafferScheduler), nil
+	}
+}
@@ -0,0 +1,147 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package scheduler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	// Frameworks
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// JOBS
+
+// readJobs reads the jobs file when it has been modified since it was last
+// read, and returns true if the jobs were read. A missing file has no jobs
+func (this *scheduler) readJobs() (bool, error) {
+	var modified time.Time
+	if stat, err := os.Stat(this.path); os.IsNotExist(err) {
+		// No jobs
+	} else if err != nil {
+		return false, err
+	} else {
+		modified = stat.ModTime()
+	}
+	if this.jobs != nil && modified.Equal(this.modified) {
+		return false, nil
+	}
+
+	jobs := make([]rpc.GafferJob, 0)
+	if modified.IsZero() == false {
+		if data, err := ioutil.ReadFile(this.path); err != nil {
+			return false, err
+		} else if err := json.Unmarshal(data, &jobs); err != nil {
+			return false, err
+		}
+	}
+	this.jobs = make(map[string]rpc.GafferJob, len(jobs))
+	for _, job := range jobs {
+		this.jobs[job.Service] = job
+	}
+	this.modified = modified
+
+	// Success
+	return true, nil
+}
+
+// writeJobs writes the jobs file, sorted by service name
+func (this *scheduler) writeJobs() error {
+	jobs := this.sortedJobs()
+	if data, err := json.MarshalIndent(jobs, "", "  "); err != nil {
+		return err
+	} else if err := writeFile(this.path, data); err != nil {
+		return err
+	} else if stat, err := os.Stat(this.path); err != nil {
+		return err
+	} else {
+		this.modified = stat.ModTime()
+	}
+
+	// Success
+	return nil
+}
+
+func (this *scheduler) sortedJobs() []rpc.GafferJob {
+	jobs := make([]rpc.GafferJob, 0, len(this.jobs))
+	for _, job := range this.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Service < jobs[j].Service
+	})
+	return jobs
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PLACEMENTS
+
+// readPlacements reads the placements file, which is written next to the
+// jobs file. A missing file has no placements
+func (this *scheduler) readPlacements() error {
+	this.placements = make([]rpc.GafferPlacement, 0)
+	if data, err := ioutil.ReadFile(this.path + PLACEMENTS_EXT); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	} else {
+		return json.Unmarshal(data, &this.placements)
+	}
+}
+
+// writePlacements writes the placements file, sorted by service and node
+func (this *scheduler) writePlacements() error {
+	sort.Slice(this.placements, func(i, j int) bool {
+		a, b := this.placements[i], this.placements[j]
+		if a.Service != b.Service {
+			return a.Service < b.Service
+		} else if a.Node != b.Node {
+			return a.Node < b.Node
+		} else {
+			return a.Instance < b.Instance
+		}
+	})
+	if data, err := json.MarshalIndent(this.placements, "", "  "); err != nil {
+		return err
+	} else {
+		return writeFile(this.path+PLACEMENTS_EXT, data)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// writeFile writes data to a temporary file and replaces the file, so
+// that a partly written file is never read
+func writeFile(path string, data []byte) error {
+	fh, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(fh.Name())
+	if _, err := fh.Write(data); err != nil {
+		fh.Close()
+		return err
+	} else if err := fh.Chmod(0600); err != nil {
+		fh.Close()
+		return err
+	} else if err := fh.Close(); err != nil {
+		return err
+	} else if err := os.Rename(fh.Name(), path); err != nil {
+		return err
+	}
+
+	// Success
+	return nil
+}
@@ -0,0 +1,277 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+	event "github.com/djthorpe/gopi/util/event"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// endpoint batches events and posts them to a URL, retrying with backoff
+// and queueing batches which could not be delivered
+type endpoint struct {
+	sync.Mutex
+
+	log     gopi.Logger
+	url     string
+	client  *http.Client
+	batch   uint
+	delay   time.Duration
+	retries uint
+	backoff time.Duration
+	pending []*Event
+	queue   queue
+	signal  chan struct{}
+
+	// retry is the time after which delivery is attempted again, after
+	// delivery has failed
+	retry time.Time
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	// MAX_BACKOFF is the maximum time between attempts to deliver events
+	MAX_BACKOFF = 5 * time.Minute
+)
+
+var (
+	errStopped = errors.New("Stopped")
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// INIT
+
+func (this *endpoint) Init(config Webhook, url string, logger gopi.Logger) error {
+	logger.Debug("<webhook.endpoint.Init>{ url=%v }", strconv.Quote(url))
+
+	this.log = logger
+	this.url = url
+	this.client = &http.Client{Timeout: config.Timeout}
+	this.batch = config.BatchSize
+	this.delay = config.BatchDelay
+	this.retries = config.Retries
+	this.backoff = config.Backoff
+	this.signal = make(chan struct{}, 1)
+
+	// Each endpoint has a separate queue
+	if config.QueuePath == "" {
+		return this.queue.Init("", config.QueueSize, logger)
+	} else {
+		return this.queue.Init(filepath.Join(config.QueuePath, folderForURL(url)), config.QueueSize, logger)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Add an event to the next batch, and signal when the batch is full
+func (this *endpoint) Add(evt *Event) {
+	this.Lock()
+	defer this.Unlock()
+
+	this.pending = append(this.pending, evt)
+	if uint(len(this.pending)) >= this.batch {
+		select {
+		case this.signal <- struct{}{}:
+		default:
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *endpoint) String() string {
+	return fmt.Sprintf("<webhook.endpoint>{ url=%v batch=%v delay=%v retries=%v backoff=%v queue=%v }", strconv.Quote(this.url), this.batch, this.delay, this.retries, this.backoff, &this.queue)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// BACKGROUND TASKS
+
+// Task delivers batches when a batch is full or after the batch delay, and
+// queues any pending events when stopped
+func (this *endpoint) Task(start chan<- event.Signal, stop <-chan event.Signal) error {
+	start <- gopi.DONE
+	ticker := time.NewTicker(this.delay)
+FOR_LOOP:
+	for {
+		select {
+		case <-ticker.C:
+			this.deliver(stop)
+		case <-this.signal:
+			this.deliver(stop)
+		case <-stop:
+			break FOR_LOOP
+		}
+	}
+	ticker.Stop()
+
+	// Queue pending events, which are delivered when restarted
+	this.enqueue(false)
+
+	// Success
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// deliver posts the queued batches and then the pending events, in order.
+// When delivery fails, the pending events are queued. While delivery is held
+// off, only full batches are queued
+func (this *endpoint) deliver(stop <-chan event.Signal) {
+	if time.Now().Before(this.retry) {
+		this.enqueue(true)
+		return
+	}
+
+	// Deliver queued batches first
+	for batch := this.queue.Peek(); batch != nil; batch = this.queue.Peek() {
+		if err := this.post(batch.events, stop); err != nil {
+			this.failed(err)
+			return
+		} else {
+			this.queue.Pop(batch)
+		}
+	}
+
+	// Deliver pending events
+	for events := this.take(false); len(events) > 0; events = this.take(false) {
+		if err := this.post(events, stop); err != nil {
+			if err := this.queue.Push(events); err != nil {
+				this.log.Error("Webhook: %v", err)
+			}
+			this.failed(err)
+			return
+		}
+	}
+}
+
+// failed holds off delivery for the maximum backoff, and queues full
+// batches of pending events in the meantime
+func (this *endpoint) failed(err error) {
+	if err != errStopped {
+		this.log.Warn("Webhook: %v", err)
+	}
+	this.retry = time.Now().Add(this.maxBackoff())
+	this.enqueue(true)
+}
+
+// enqueue moves pending events into the queue. When full is true, only
+// full batches are moved and the remaining events are kept pending
+func (this *endpoint) enqueue(full bool) {
+	for events := this.take(full); len(events) > 0; events = this.take(full) {
+		if err := this.queue.Push(events); err != nil {
+			this.log.Error("Webhook: %v", err)
+		}
+	}
+}
+
+// take removes up to a batch of pending events, or when full is true
+// removes a batch only if there are enough pending events
+func (this *endpoint) take(full bool) []*Event {
+	this.Lock()
+	defer this.Unlock()
+
+	n := uint(len(this.pending))
+	if n > this.batch {
+		n = this.batch
+	} else if full && n < this.batch {
+		return nil
+	}
+	events := this.pending[:n]
+	this.pending = this.pending[n:]
+	return events
+}
+
+// post sends events, retrying with exponential backoff
+func (this *endpoint) post(events []*Event, stop <-chan event.Signal) error {
+	var err error
+	backoff := this.backoff
+	for attempt := uint(0); attempt <= this.retries; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+				backoff = backoff * 2
+			case <-stop:
+				timer.Stop()
+				return errStopped
+			}
+		}
+		if err = this.send(events); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// send posts events as a JSON array, and returns an error unless the
+// endpoint returns a success status
+func (this *endpoint) send(events []*Event) error {
+	if data, err := json.Marshal(events); err != nil {
+		return err
+	} else if req, err := http.NewRequest("POST", this.url, bytes.NewReader(data)); err != nil {
+		return err
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+		if resp, err := this.client.Do(req); err != nil {
+			return err
+		} else {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode < 200 || resp.StatusCode > 299 {
+				return fmt.Errorf("%v: %v", this.url, resp.Status)
+			}
+		}
+	}
+
+	// Success
+	return nil
+}
+
+// maxBackoff returns the time between the first and last attempt to
+// deliver a batch, limited to MAX_BACKOFF
+func (this *endpoint) maxBackoff() time.Duration {
+	backoff := this.backoff
+	for i := uint(0); i < this.retries && backoff < MAX_BACKOFF; i++ {
+		backoff = backoff * 2
+	}
+	if backoff > MAX_BACKOFF {
+		return MAX_BACKOFF
+	} else {
+		return backoff
+	}
+}
+
+// folderForURL returns the name of the queue folder for an endpoint
+func folderForURL(url string) string {
+	hash := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(hash[:8])
+}
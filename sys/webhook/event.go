@@ -0,0 +1,151 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package webhook
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+	rpc "github.com/djthorpe/gopi-rpc"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Event is the JSON encoding of a gaffer or discovery event which is
+// posted to endpoints
+type Event struct {
+	Source_ string    `json:"source"`
+	Type_   string    `json:"type"`
+	Ts_     time.Time `json:"ts"`
+
+	// Gaffer events
+	Seq_      uint64 `json:"seq,omitempty"`
+	Service_  string `json:"service,omitempty"`
+	Group_    string `json:"group,omitempty"`
+	Instance_ uint32 `json:"instance,omitempty"`
+	Data_     string `json:"data,omitempty"`
+
+	// Discovery events
+	Record_ *Record `json:"record,omitempty"`
+}
+
+// Record is the JSON encoding of a discovered service record
+type Record struct {
+	Name_    string   `json:"name"`
+	Service_ string   `json:"service"`
+	Subtype_ string   `json:"subtype,omitempty"`
+	Host_    string   `json:"host,omitempty"`
+	Port_    uint     `json:"port,omitempty"`
+	Addrs_   []string `json:"addrs,omitempty"`
+	Text_    []string `json:"txt,omitempty"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	SOURCE_GAFFER    = "gaffer"
+	SOURCE_DISCOVERY = "discovery"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// NEW
+
+// NewEvent returns an event for a gaffer or discovery event, or nil if the
+// event is not supported
+func NewEvent(evt gopi.Event) *Event {
+	switch evt_ := evt.(type) {
+	case rpc.GafferEvent:
+		return newGafferEvent(evt_)
+	case gopi.RPCEvent:
+		return newDiscoveryEvent(evt_)
+	default:
+		return nil
+	}
+}
+
+func newGafferEvent(evt rpc.GafferEvent) *Event {
+	this := &Event{
+		Source_: SOURCE_GAFFER,
+		Type_:   strings.ToLower(strings.TrimPrefix(fmt.Sprint(evt.Type()), "GAFFER_EVENT_")),
+		Ts_:     evt.Timestamp(),
+		Seq_:    evt.Seq(),
+		Data_:   strings.TrimRight(string(evt.Data()), "\r\n"),
+	}
+	if this.Ts_.IsZero() {
+		this.Ts_ = time.Now()
+	}
+	if service := evt.Service(); service != nil {
+		this.Service_ = service.Name()
+	}
+	if group := evt.Group(); group != nil {
+		this.Group_ = group.Name()
+	}
+	if instance := evt.Instance(); instance != nil {
+		this.Instance_ = instance.Id()
+	}
+	return this
+}
+
+func newDiscoveryEvent(evt gopi.RPCEvent) *Event {
+	this := &Event{
+		Source_: SOURCE_DISCOVERY,
+		Type_:   strings.ToLower(strings.TrimPrefix(fmt.Sprint(evt.Type()), "RPC_EVENT_")),
+		Ts_:     time.Now(),
+	}
+	if record := evt.ServiceRecord(); record != nil {
+		this.Record_ = &Record{
+			Name_:    record.Name(),
+			Service_: record.Service(),
+			Subtype_: record.Subtype(),
+			Host_:    record.Host(),
+			Port_:    record.Port(),
+			Text_:    record.Text(),
+		}
+		for _, ip := range record.IP4() {
+			this.Record_.Addrs_ = append(this.Record_.Addrs_, ip.String())
+		}
+		for _, ip := range record.IP6() {
+			this.Record_.Addrs_ = append(this.Record_.Addrs_, ip.String())
+		}
+	}
+	return this
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Matches returns true if the event type matches one of the patterns, or
+// there are no patterns. Patterns can include the wildcards '*' and '?', and
+// can be prefixed with the source, for example "gaffer:instance_*"
+func (this *Event) Matches(patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if strings.Contains(pattern, ":") {
+			if matched, _ := path.Match(pattern, this.Source_+":"+this.Type_); matched {
+				return true
+			}
+		} else if matched, _ := path.Match(pattern, this.Type_); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *Event) String() string {
+	return fmt.Sprintf("<webhook.Event>{ source=%v type=%v ts=%v }", strconv.Quote(this.Source_), strconv.Quote(this.Type_), this.Ts_.Format(time.RFC3339))
+}
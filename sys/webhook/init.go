@@ -0,0 +1,90 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package webhook
+
+import (
+	"strings"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// INIT
+
+func init() {
+	// Register Webhook, which posts events from the gaffer and discovery
+	// modules when they are loaded before this module
+	gopi.RegisterModule(gopi.Module{
+		Name: "webhook",
+		Type: gopi.MODULE_TYPE_OTHER,
+		Config: func(config *gopi.AppConfig) {
+			config.AppFlags.FlagString("webhook.url", "", "Comma-separated endpoint URLs for events")
+			config.AppFlags.FlagString("webhook.types", "", "Comma-separated patterns for event types to post")
+			config.AppFlags.FlagUint("webhook.batch", BATCH_SIZE, "Maximum number of events posted together")
+			config.AppFlags.FlagDuration("webhook.delay", BATCH_DELAY, "Time to wait for a batch of events")
+			config.AppFlags.FlagUint("webhook.retries", RETRIES, "Number of times delivery is retried")
+			config.AppFlags.FlagDuration("webhook.backoff", BACKOFF, "Initial time between delivery attempts")
+			config.AppFlags.FlagDuration("webhook.timeout", TIMEOUT, "Timeout for posting events")
+			config.AppFlags.FlagString("webhook.queue", "", "Folder for events which could not be delivered")
+			config.AppFlags.FlagUint("webhook.queue.size", QUEUE_SIZE, "Maximum number of batches queued for each endpoint")
+		},
+		New: func(app *gopi.AppInstance) (gopi.Driver, error) {
+			endpoints, _ := app.AppFlags.GetString("webhook.url")
+			types, _ := app.AppFlags.GetString("webhook.types")
+			batch, _ := app.AppFlags.GetUint("webhook.batch")
+			delay, _ := app.AppFlags.GetDuration("webhook.delay")
+			retries, _ := app.AppFlags.GetUint("webhook.retries")
+			backoff, _ := app.AppFlags.GetDuration("webhook.backoff")
+			timeout, _ := app.AppFlags.GetDuration("webhook.timeout")
+			queue, _ := app.AppFlags.GetString("webhook.queue")
+			queue_size, _ := app.AppFlags.GetUint("webhook.queue.size")
+			return gopi.Open(Webhook{
+				Gaffer:     publisherForModule(app, "gaffer"),
+				Discovery:  publisherForModule(app, "discovery"),
+				Endpoints:  splitFlag(endpoints),
+				Types:      splitFlag(types),
+				BatchSize:  batch,
+				BatchDelay: delay,
+				Retries:    retries,
+				Backoff:    backoff,
+				Timeout:    timeout,
+				QueuePath:  queue,
+				QueueSize:  queue_size,
+			}, app.Logger)
+		},
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// publisherForModule returns a module as a publisher, or nil if the module
+// is not loaded
+func publisherForModule(app *gopi.AppInstance, name string) gopi.Publisher {
+	if module := app.ModuleInstance(name); module == nil {
+		return nil
+	} else if publisher, ok := module.(gopi.Publisher); ok == false {
+		return nil
+	} else {
+		return publisher
+	}
+}
+
+// splitFlag returns the comma-separated values of a flag, ignoring empty
+// values
+func splitFlag(value string) []string {
+	values := make([]string, 0)
+	for _, value := range strings.Split(value, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,198 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// queue retains batches of events which could not be delivered, oldest
+// first. When the path is set the batches are stored as files in the
+// folder, otherwise they are retained in memory. When there are more
+// than size batches, the oldest batches are dropped
+type queue struct {
+	sync.Mutex
+
+	log     gopi.Logger
+	path    string
+	size    uint
+	seq     uint64
+	batches []*batch
+}
+
+// batch is a set of events which are posted together
+type batch struct {
+	seq    uint64
+	events []*Event
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	// QUEUE_EXT is the extension for queued batches
+	QUEUE_EXT = ".json"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// INIT
+
+func (this *queue) Init(path string, size uint, logger gopi.Logger) error {
+	this.log = logger
+	this.path = path
+	this.size = size
+
+	// Without a path, batches are retained in memory
+	if this.path == "" {
+		return nil
+	}
+
+	// Read batches which were queued before
+	if err := os.MkdirAll(this.path, 0700); err != nil {
+		return err
+	} else if err := this.read(); err != nil {
+		return err
+	}
+
+	// Success
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Len returns the number of batches in the queue
+func (this *queue) Len() int {
+	this.Lock()
+	defer this.Unlock()
+	return len(this.batches)
+}
+
+// Push adds a batch to the end of the queue, and drops the oldest batches
+// when the queue is full
+func (this *queue) Push(events []*Event) error {
+	this.Lock()
+	defer this.Unlock()
+
+	this.seq++
+	batch := &batch{this.seq, events}
+	if err := this.write(batch); err != nil {
+		return err
+	}
+	this.batches = append(this.batches, batch)
+
+	// Drop the oldest batches
+	for uint(len(this.batches)) > this.size {
+		this.log.Warn("Webhook: Dropped %v events for %v", len(this.batches[0].events), strconv.Quote(this.path))
+		this.remove(this.batches[0])
+		this.batches = this.batches[1:]
+	}
+
+	// Success
+	return nil
+}
+
+// Peek returns the oldest batch, or nil if the queue is empty
+func (this *queue) Peek() *batch {
+	this.Lock()
+	defer this.Unlock()
+	if len(this.batches) == 0 {
+		return nil
+	} else {
+		return this.batches[0]
+	}
+}
+
+// Pop removes a batch which was returned by Peek
+func (this *queue) Pop(batch *batch) {
+	this.Lock()
+	defer this.Unlock()
+	if len(this.batches) > 0 && this.batches[0] == batch {
+		this.remove(batch)
+		this.batches = this.batches[1:]
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *queue) String() string {
+	return fmt.Sprintf("<webhook.queue>{ path=%v size=%v batches=%v }", strconv.Quote(this.path), this.size, this.Len())
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// read loads the batches in the folder in order. Files which cannot be
+// decoded are skipped
+func (this *queue) read() error {
+	files, err := ioutil.ReadDir(this.path)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.Mode().IsRegular() == false || filepath.Ext(file.Name()) != QUEUE_EXT {
+			continue
+		} else if seq, err := strconv.ParseUint(strings.TrimSuffix(file.Name(), QUEUE_EXT), 10, 64); err != nil {
+			continue
+		} else if data, err := ioutil.ReadFile(filepath.Join(this.path, file.Name())); err != nil {
+			return err
+		} else {
+			batch := &batch{seq: seq}
+			if err := json.Unmarshal(data, &batch.events); err != nil {
+				this.log.Warn("Webhook: %v: %v", file.Name(), err)
+			} else {
+				this.batches = append(this.batches, batch)
+			}
+			if seq > this.seq {
+				this.seq = seq
+			}
+		}
+	}
+	sort.Slice(this.batches, func(i, j int) bool {
+		return this.batches[i].seq < this.batches[j].seq
+	})
+	return nil
+}
+
+func (this *queue) write(batch *batch) error {
+	if this.path == "" {
+		return nil
+	} else if data, err := json.Marshal(batch.events); err != nil {
+		return err
+	} else {
+		return ioutil.WriteFile(this.filename(batch), data, 0600)
+	}
+}
+
+func (this *queue) remove(batch *batch) {
+	if this.path == "" {
+		return
+	} else if err := os.Remove(this.filename(batch)); err != nil && os.IsNotExist(err) == false {
+		this.log.Warn("Webhook: %v", err)
+	}
+}
+
+func (this *queue) filename(batch *batch) string {
+	return filepath.Join(this.path, fmt.Sprintf("%020d", batch.seq)+QUEUE_EXT)
+}
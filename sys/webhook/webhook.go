@@ -0,0 +1,212 @@
+/*
+	Gaffer: Microservice Manager
+	(c) Copyright David Thorpe 2019
+	All Rights Reserved
+
+	For Licensing and Usage information, please see LICENSE
+*/
+
+package webhook
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+	event "github.com/djthorpe/gopi/util/event"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Webhook posts events from the gaffer and discovery publishers to one or
+// more HTTP endpoints
+type Webhook struct {
+	// Gaffer and Discovery are the publishers of events, either of which
+	// can be nil
+	Gaffer    gopi.Publisher
+	Discovery gopi.Publisher
+
+	// Endpoints are the URLs which events are posted to
+	Endpoints []string
+
+	// Types are patterns for the event types which are posted, such as
+	// "instance_stop_*" or "discovery:service_expired". When empty, all
+	// events are posted
+	Types []string
+
+	// BatchSize is the maximum number of events posted together, and
+	// BatchDelay is the time to wait for a batch to be filled
+	BatchSize  uint
+	BatchDelay time.Duration
+
+	// Retries is the number of times a batch is retried, with the time
+	// between attempts starting at Backoff and doubling. Timeout is the
+	// time to wait for a response
+	Retries uint
+	Backoff time.Duration
+	Timeout time.Duration
+
+	// QueuePath is the folder for batches which could not be delivered,
+	// or empty to queue in memory, and QueueSize is the maximum number of
+	// batches queued for each endpoint
+	QueuePath string
+	QueueSize uint
+}
+
+type webhook struct {
+	log       gopi.Logger
+	gaffer    gopi.Publisher
+	discovery gopi.Publisher
+	types     []string
+	endpoints []*endpoint
+
+	event.Tasks
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	BATCH_SIZE  = 10
+	BATCH_DELAY = time.Second
+	RETRIES     = 3
+	BACKOFF     = time.Second
+	TIMEOUT     = 10 * time.Second
+	QUEUE_SIZE  = 100
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// OPEN AND CLOSE
+
+func (config Webhook) Open(logger gopi.Logger) (gopi.Driver, error) {
+	logger.Debug("<webhook.Open>{ endpoints=%v types=%v queue=%v }", config.Endpoints, config.Types, strconv.Quote(config.QueuePath))
+
+	this := new(webhook)
+	this.log = logger
+	this.gaffer = config.Gaffer
+	this.discovery = config.Discovery
+	this.types = config.Types
+
+	// Set defaults
+	if config.BatchSize == 0 {
+		config.BatchSize = BATCH_SIZE
+	}
+	if config.BatchDelay == 0 {
+		config.BatchDelay = BATCH_DELAY
+	}
+	if config.Backoff == 0 {
+		config.Backoff = BACKOFF
+	}
+	if config.Timeout == 0 {
+		config.Timeout = TIMEOUT
+	}
+	if config.QueueSize == 0 {
+		config.QueueSize = QUEUE_SIZE
+	}
+
+	// Check parameters
+	for _, pattern := range config.Types {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("Invalid event type pattern: %v", strconv.Quote(pattern))
+		}
+	}
+
+	// Create the endpoints
+	for _, endpoint_ := range config.Endpoints {
+		if url_, err := url.Parse(endpoint_); err != nil {
+			return nil, err
+		} else if url_.Scheme != "http" && url_.Scheme != "https" {
+			return nil, fmt.Errorf("Invalid endpoint: %v", strconv.Quote(endpoint_))
+		}
+		endpoint := new(endpoint)
+		if err := endpoint.Init(config, endpoint_, logger); err != nil {
+			return nil, err
+		}
+		this.endpoints = append(this.endpoints, endpoint)
+	}
+
+	// Subscribe to events when there are endpoints. The subscriptions are
+	// started first so that they are stopped before the endpoints
+	if len(this.endpoints) > 0 {
+		if this.gaffer != nil {
+			this.Tasks.Start(this.GafferTask)
+		}
+		if this.discovery != nil {
+			this.Tasks.Start(this.DiscoveryTask)
+		}
+	}
+	for _, endpoint := range this.endpoints {
+		this.Tasks.Start(endpoint.Task)
+	}
+
+	// Success
+	return this, nil
+}
+
+func (this *webhook) Close() error {
+	this.log.Debug("<webhook.Close>{ endpoints=%v }", this.endpoints)
+
+	// Stop background tasks, which queues pending events
+	if err := this.Tasks.Close(); err != nil {
+		return err
+	}
+
+	// Release resources
+	this.endpoints = nil
+
+	// Success
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *webhook) String() string {
+	return fmt.Sprintf("<webhook>{ endpoints=%v types=%v }", this.endpoints, this.types)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// BACKGROUND TASKS
+
+func (this *webhook) GafferTask(start chan<- event.Signal, stop <-chan event.Signal) error {
+	return this.watch(this.gaffer, start, stop)
+}
+
+func (this *webhook) DiscoveryTask(start chan<- event.Signal, stop <-chan event.Signal) error {
+	return this.watch(this.discovery, start, stop)
+}
+
+// watch subscribes to a publisher and adds matching events to each
+// endpoint. Adding an event does not block, so that the publisher is
+// not held up when an endpoint is unavailable
+func (this *webhook) watch(publisher gopi.Publisher, start chan<- event.Signal, stop <-chan event.Signal) error {
+	events := publisher.Subscribe()
+	start <- gopi.DONE
+FOR_LOOP:
+	for {
+		select {
+		case evt := <-events:
+			if evt == nil {
+				// Do nothing
+			} else if evt_ := NewEvent(evt); evt_ == nil {
+				this.log.Debug2("Webhook: Ignoring: %v", evt)
+			} else if evt_.Matches(this.types) {
+				for _, endpoint := range this.endpoints {
+					endpoint.Add(evt_)
+				}
+			}
+		case <-stop:
+			break FOR_LOOP
+		}
+	}
+
+	publisher.Unsubscribe(events)
+
+	// Success
+	return nil
+}
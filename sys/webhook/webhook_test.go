@@ -0,0 +1,280 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi"
+	rpc "github.com/djthorpe/gopi-rpc"
+	event "github.com/djthorpe/gopi/util/event"
+
+	// Modules
+	gaffer "github.com/djthorpe/gopi-rpc/sys/gaffer"
+	webhook "github.com/djthorpe/gopi-rpc/sys/webhook"
+	logger "github.com/djthorpe/gopi/sys/logger"
+)
+
+const (
+	LOG_LEVEL   = logger.LOG_DEBUG2
+	TEST_FOLDER = "test_folder"
+)
+
+func Test_Webhook_001(t *testing.T) {
+	if driver, err := NewWebhookWithConfig(webhook.Webhook{}); err != nil {
+		t.Fatal(err)
+	} else if err := driver.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Webhook_002(t *testing.T) {
+	for _, endpoint := range []string{"ftp://localhost/", "localhost", "://"} {
+		if _, err := NewWebhookWithConfig(webhook.Webhook{Endpoints: []string{endpoint}}); err == nil {
+			t.Error("Expected error for endpoint", endpoint)
+		}
+	}
+	if _, err := NewWebhookWithConfig(webhook.Webhook{Endpoints: []string{"http://localhost/"}, Types: []string{"["}}); err == nil {
+		t.Error("Expected error for type pattern")
+	}
+}
+
+func Test_Webhook_003(t *testing.T) {
+	tests := []struct {
+		pattern string
+		matches bool
+	}{
+		{"instance_stop_error", true},
+		{"instance_stop_*", true},
+		{"gaffer:instance_*", true},
+		{"discovery:*", false},
+		{"service_*", false},
+	}
+	evt := webhook.NewEvent(gaffer.NewEventWithServiceData(nil, rpc.GAFFER_EVENT_INSTANCE_STOP_ERROR, nil, []byte("exit status 1\n")))
+	if evt == nil {
+		t.Fatal("Unexpected nil event")
+	} else if evt.Source_ != webhook.SOURCE_GAFFER || evt.Type_ != "instance_stop_error" || evt.Data_ != "exit status 1" {
+		t.Error("Unexpected event", evt)
+	}
+	for _, test := range tests {
+		if evt.Matches([]string{test.pattern}) != test.matches {
+			t.Error("Unexpected match for", test.pattern)
+		}
+	}
+}
+
+func Test_Webhook_004(t *testing.T) {
+	server := NewServer(http.StatusOK)
+	defer server.Close()
+
+	// Post stop events in batches of two
+	publisher := new(event.Publisher)
+	driver, err := NewWebhookWithConfig(webhook.Webhook{
+		Gaffer:     publisher,
+		Endpoints:  []string{server.URL},
+		Types:      []string{"instance_stop_*"},
+		BatchSize:  2,
+		BatchDelay: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+
+	for _, type_ := range []rpc.GafferEventType{rpc.GAFFER_EVENT_INSTANCE_STOP_OK, rpc.GAFFER_EVENT_SERVICE_CHANGE, rpc.GAFFER_EVENT_INSTANCE_STOP_ERROR, rpc.GAFFER_EVENT_INSTANCE_STOP_KILLED} {
+		publisher.Emit(gaffer.NewEventWithServiceData(nil, type_, nil, nil))
+	}
+	if events := server.Wait(3, time.Second); len(events) != 3 {
+		t.Fatal("Unexpected events", events)
+	} else if events[0].Type_ != "instance_stop_ok" || events[1].Type_ != "instance_stop_error" || events[2].Type_ != "instance_stop_killed" {
+		t.Error("Unexpected events", events)
+	} else if server.Batches() < 2 {
+		t.Error("Unexpected batches", server.Batches())
+	}
+}
+
+func Test_Webhook_005(t *testing.T) {
+	folder, err := ioutil.TempDir("", TEST_FOLDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	// The endpoint is down, so events are queued on disk in batches of one
+	server := NewServer(http.StatusServiceUnavailable)
+	defer server.Close()
+	publisher := new(event.Publisher)
+	config := webhook.Webhook{
+		Gaffer:     publisher,
+		Endpoints:  []string{server.URL},
+		BatchSize:  1,
+		BatchDelay: 20 * time.Millisecond,
+		Retries:    1,
+		Backoff:    10 * time.Millisecond,
+		QueuePath:  folder,
+		QueueSize:  2,
+	}
+	driver, err := NewWebhookWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		publisher.Emit(gaffer.NewEventWithServiceData(nil, rpc.GAFFER_EVENT_INSTANCE_STOP_ERROR, nil, []byte{byte('a' + i)}))
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	} else if server.Attempts() == 0 {
+		t.Error("Expected delivery attempts")
+	}
+
+	// The oldest batch is dropped, and the remaining batches are delivered
+	// when the endpoint is up
+	server.SetStatus(http.StatusOK)
+	driver, err = NewWebhookWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+	if events := server.Wait(2, time.Second); len(events) != 2 {
+		t.Fatal("Unexpected events", events)
+	} else if events[0].Data_ != "b" || events[1].Data_ != "c" {
+		t.Error("Unexpected events", events)
+	}
+}
+
+func Test_Webhook_006(t *testing.T) {
+	folder, err := ioutil.TempDir("", TEST_FOLDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	// The endpoint is down, and partial batches are kept pending rather
+	// than filling the queue while delivery is held off
+	server := NewServer(http.StatusServiceUnavailable)
+	defer server.Close()
+	publisher := new(event.Publisher)
+	config := webhook.Webhook{
+		Gaffer:     publisher,
+		Endpoints:  []string{server.URL},
+		BatchSize:  10,
+		BatchDelay: 20 * time.Millisecond,
+		Retries:    1,
+		Backoff:    50 * time.Millisecond,
+		QueuePath:  folder,
+		QueueSize:  2,
+	}
+	driver, err := NewWebhookWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		publisher.Emit(gaffer.NewEventWithServiceData(nil, rpc.GAFFER_EVENT_INSTANCE_STOP_ERROR, nil, []byte{byte('a' + i)}))
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// No events are dropped
+	server.SetStatus(http.StatusOK)
+	driver, err = NewWebhookWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+	if events := server.Wait(5, time.Second); len(events) != 5 {
+		t.Fatal("Unexpected events", events)
+	} else if events[0].Data_ != "a" || events[4].Data_ != "e" {
+		t.Error("Unexpected events", events)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// SERVER
+
+type Server struct {
+	sync.Mutex
+	*httptest.Server
+
+	status   int
+	attempts int
+	batches  int
+	events   []*webhook.Event
+}
+
+func NewServer(status int) *Server {
+	this := &Server{status: status}
+	this.Server = httptest.NewServer(http.HandlerFunc(this.ServeHTTP))
+	return this
+}
+
+func (this *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	this.Lock()
+	defer this.Unlock()
+
+	this.attempts++
+	if this.status != http.StatusOK {
+		w.WriteHeader(this.status)
+		return
+	}
+	events := make([]*webhook.Event, 0)
+	if req.Header.Get("Content-Type") != "application/json" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+	} else if err := json.NewDecoder(req.Body).Decode(&events); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+	} else {
+		this.batches++
+		this.events = append(this.events, events...)
+	}
+}
+
+func (this *Server) SetStatus(status int) {
+	this.Lock()
+	defer this.Unlock()
+	this.status = status
+}
+
+func (this *Server) Attempts() int {
+	this.Lock()
+	defer this.Unlock()
+	return this.attempts
+}
+
+func (this *Server) Batches() int {
+	this.Lock()
+	defer this.Unlock()
+	return this.batches
+}
+
+// Wait for a number of events to be received, or the timeout
+func (this *Server) Wait(n int, timeout time.Duration) []*webhook.Event {
+	deadline := time.Now().Add(timeout)
+	for {
+		this.Lock()
+		events := this.events
+		this.Unlock()
+		if len(events) >= n || time.Now().After(deadline) {
+			return events
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// OPEN
+
+func NewWebhookWithConfig(config webhook.Webhook) (gopi.Driver, error) {
+	if log, err := gopi.Open(logger.Config{Level: LOG_LEVEL}, nil); err != nil {
+		return nil, err
+	} else {
+		return gopi.Open(config, log.(gopi.Logger))
+	}
+}
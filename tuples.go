@@ -27,13 +27,21 @@ type Tuples struct {
 	tuples []*tuple
 }
 
+// tuple is a key with one or more values. Keys with more than one
+// value are repeated in flags, for example -tag a -tag b
 type tuple struct {
-	key, value string
+	key    string
+	values []string
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 // CONSTANTS
 
+const (
+	// TUPLES_REDACTED replaces the values for secret keys
+	TUPLES_REDACTED = "<redacted>"
+)
+
 var (
 	reTupleKey         = regexp.MustCompile("^[A-Za-z][A-Za-z0-9\\-\\_\\.]*$")
 	reTupleValueIdent  = reTupleKey
@@ -53,7 +61,7 @@ func (this Tuples) Copy() Tuples {
 	var that Tuples
 	that.tuples = make([]*tuple, len(this.tuples))
 	for i, t := range this.tuples {
-		that.tuples[i] = &tuple{t.key, t.value}
+		that.tuples[i] = &tuple{t.key, append([]string{}, t.values...)}
 	}
 	return that
 }
@@ -72,6 +80,54 @@ func (this *Tuples) RemoveAll() {
 	this.tuples = make([]*tuple, 0, cap(this.tuples))
 }
 
+// RemoveForKey removes a tuple by key, and returns false if
+// the key was not present
+func (this *Tuples) RemoveForKey(k string) bool {
+	if pos := this.indexForKey(k); pos == -1 {
+		return false
+	} else {
+		this.tuples = append(this.tuples[:pos:pos], this.tuples[pos+1:]...)
+		return true
+	}
+}
+
+// Redact returns a copy of the tuples where the values for
+// the keys are replaced, so that secret values are not revealed
+func (this Tuples) Redact(keys []string) Tuples {
+	that := this.Copy()
+	for _, key := range keys {
+		if pos := that.indexForKey(key); pos != -1 {
+			that.tuples[pos].values = []string{TUPLES_REDACTED}
+		}
+	}
+	return that
+}
+
+// Patch returns a copy of the tuples with patch operations applied
+// in order. Unsetting a key which is not present is not an error
+func (this Tuples) Patch(patch []GafferTuplesPatch) (Tuples, error) {
+	that := this.Copy()
+	for _, op := range patch {
+		switch op.Op {
+		case GAFFER_TUPLES_SET:
+			if err := that.SetStringForKey(op.Key, op.Value); err != nil {
+				return this, err
+			}
+		case GAFFER_TUPLES_ADD:
+			if err := that.AddStringForKey(op.Key, op.Value); err != nil {
+				return this, err
+			}
+		case GAFFER_TUPLES_UNSET:
+			that.RemoveForKey(op.Key)
+		case GAFFER_TUPLES_CLEAR:
+			that.RemoveAll()
+		default:
+			return this, gopi.ErrBadParameter
+		}
+	}
+	return that, nil
+}
+
 // Equals returns true if the tuples are identical
 func (this Tuples) Equals(that Tuples) bool {
 	if this.Len() != that.Len() {
@@ -85,38 +141,70 @@ func (this Tuples) Equals(that Tuples) bool {
 	return true
 }
 
-// SetStringForKey sets a tuple key-value pair. Returns error
-// if a key is invalid
+// SetStringForKey sets a tuple key-value pair, replacing any
+// existing values. Returns error if a key is invalid
 func (this *Tuples) SetStringForKey(k, v string) error {
+	return this.SetStringsForKey(k, []string{v})
+}
+
+// SetStringsForKey sets one or more values for a key, replacing any
+// existing values. Returns error if a key is invalid or there are
+// no values
+func (this *Tuples) SetStringsForKey(k string, v []string) error {
 	// Create tuples if nil
 	if this.tuples == nil {
 		this.RemoveAll()
 	}
+	if len(v) == 0 {
+		return gopi.ErrBadParameter
+	}
 	// Replace or append tuples by key
 	if pos := this.indexForKey(k); pos == -1 {
 		// Check key
 		if reTupleKey.MatchString(k) == false {
 			return fmt.Errorf("Invalid key: %v", strconv.Quote(k))
 		} else {
-			this.tuples = append(this.tuples, &tuple{k, v})
+			this.tuples = append(this.tuples, &tuple{k, append([]string{}, v...)})
 		}
 	} else {
-		this.tuples[pos] = &tuple{k, v}
+		this.tuples[pos] = &tuple{k, append([]string{}, v...)}
 	}
 	// Success
 	return nil
 }
 
+// AddStringForKey appends a value for a key, so that the key has
+// more than one value. Returns error if a key is invalid
+func (this *Tuples) AddStringForKey(k, v string) error {
+	if pos := this.indexForKey(k); pos == -1 {
+		return this.SetStringForKey(k, v)
+	} else {
+		this.tuples[pos].values = append(this.tuples[pos].values, v)
+		return nil
+	}
+}
+
 // StringForKey returns the string value for a key or an
-// empty string if a keyed tuple was not found
+// empty string if a keyed tuple was not found. When a key
+// has more than one value, the first value is returned
 func (this *Tuples) StringForKey(k string) string {
 	if pos := this.indexForKey(k); pos >= 0 {
-		return this.tuples[pos].value
+		return this.tuples[pos].values[0]
 	} else {
 		return ""
 	}
 }
 
+// StringsForKey returns the values for a key or nil if a keyed
+// tuple was not found
+func (this *Tuples) StringsForKey(k string) []string {
+	if pos := this.indexForKey(k); pos >= 0 {
+		return append([]string{}, this.tuples[pos].values...)
+	} else {
+		return nil
+	}
+}
+
 // ExistsForKey returns true if a key is present
 func (this *Tuples) ExistsForKey(k string) bool {
 	if pos := this.indexForKey(k); pos >= 0 {
@@ -142,24 +230,60 @@ func (this Tuples) String() string {
 	return fmt.Sprintf("<Tuples>{ %v }", str)
 }
 
-// Flags returns tuples as a set of flags, including the initial '-' character
+// Flags returns tuples as a set of flags, including the initial '-' character.
+// Keys with more than one value are repeated
 func (this Tuples) Flags() []string {
-	strs := make([]string, len(this.tuples))
-	for i, t := range this.tuples {
-		strs[i] = t.Flag()
+	strs := make([]string, 0, len(this.tuples))
+	for _, t := range this.tuples {
+		strs = append(strs, t.Flags()...)
 	}
 	return strs
 }
 
-// Env returns tuples as a set of key value parameters
+// Env returns tuples as a set of key value parameters. Keys with more
+// than one value are repeated
 func (this Tuples) Env() []string {
-	strs := make([]string, len(this.tuples))
-	for i, t := range this.tuples {
-		strs[i] = t.String()
+	strs := make([]string, 0, len(this.tuples))
+	for _, t := range this.tuples {
+		strs = append(strs, t.Strings()...)
+	}
+	return strs
+}
+
+// Environ returns tuples as environment variables for a process, in the
+// form key=value. Values are not quoted, and keys with more than one value
+// have the values separated by commas
+func (this Tuples) Environ() []string {
+	strs := make([]string, 0, len(this.tuples))
+	for _, t := range this.tuples {
+		strs = append(strs, t.key+"="+strings.Join(t.values, ","))
 	}
 	return strs
 }
 
+// Args returns tuples as command line arguments for a process, in the
+// flag style. Values are not quoted, and keys with more than one value
+// are repeated. Empty values are rendered as a flag without a value
+func (this Tuples) Args(style GafferFlagStyle) []string {
+	prefix := "-"
+	if style != GAFFER_FLAG_STYLE_SINGLE_DASH {
+		prefix = "--"
+	}
+	args := make([]string, 0, len(this.tuples))
+	for _, t := range this.tuples {
+		for _, value := range t.values {
+			if value == "" {
+				args = append(args, prefix+t.key)
+			} else if style == GAFFER_FLAG_STYLE_SEPARATE {
+				args = append(args, prefix+t.key, value)
+			} else {
+				args = append(args, prefix+t.key+"="+value)
+			}
+		}
+	}
+	return args
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // PRIVATE METHODS
 
@@ -173,27 +297,43 @@ func (this *Tuples) indexForKey(k string) int {
 }
 
 func (this *tuple) String() string {
-	if this.value == "" {
-		return fmt.Sprintf("%v", this.key)
-	} else if reTupleValueDigits.MatchString(this.value) || reTupleValueIdent.MatchString(this.value) {
-		return fmt.Sprintf("%v=%v", this.key, this.value)
-	} else {
-		return fmt.Sprintf("%v=%v", this.key, strconv.Quote(this.value))
+	return strings.Join(this.Strings(), ",")
+}
+
+// Strings returns key=value for each value
+func (this *tuple) Strings() []string {
+	strs := make([]string, len(this.values))
+	for i, value := range this.values {
+		if value == "" {
+			strs[i] = fmt.Sprintf("%v", this.key)
+		} else if reTupleValueDigits.MatchString(value) || reTupleValueIdent.MatchString(value) {
+			strs[i] = fmt.Sprintf("%v=%v", this.key, value)
+		} else {
+			strs[i] = fmt.Sprintf("%v=%v", this.key, strconv.Quote(value))
+		}
 	}
+	return strs
 }
 
-func (this *tuple) Flag() string {
-	if this.value == "" {
-		return fmt.Sprintf("-%v", this.key)
-	} else if reTupleValueDigits.MatchString(this.value) || reTupleValueIdent.MatchString(this.value) {
-		return fmt.Sprintf("-%v=%v", this.key, this.value)
-	} else {
-		return fmt.Sprintf("-%v=%v", this.key, strconv.Quote(this.value))
+// Flags returns -key=value for each value
+func (this *tuple) Flags() []string {
+	strs := this.Strings()
+	for i := range strs {
+		strs[i] = "-" + strs[i]
 	}
+	return strs
 }
 
 func (this *tuple) Equals(that *tuple) bool {
-	return (this.key == that.key) && (this.value == that.value)
+	if this.key != that.key || len(this.values) != len(that.values) {
+		return false
+	}
+	for i, value := range this.values {
+		if value != that.values[i] {
+			return false
+		}
+	}
+	return true
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -208,25 +348,23 @@ func (t *Tuples) UnmarshalJSON(data []byte) error {
 	if err := json.Unmarshal(data, &arr); err != nil {
 		return err
 	}
-	if len(arr) == 0 {
-		t.RemoveAll()
-		return nil
-	}
+	// Repeated keys add values
+	t.RemoveAll()
 	for _, str := range arr {
 		key_value := strings.SplitN(str, "=", 2)
 		if len(key_value) == 1 {
-			if err := t.SetStringForKey(key_value[0], ""); err != nil {
+			if err := t.AddStringForKey(key_value[0], ""); err != nil {
 				return err
 			}
 		} else if len(key_value) == 2 {
 			value := key_value[1]
 			if reTupleValueDigits.MatchString(value) || reTupleValueIdent.MatchString(value) {
-				if err := t.SetStringForKey(key_value[0], value); err != nil {
+				if err := t.AddStringForKey(key_value[0], value); err != nil {
 					return err
 				}
 			} else if value_, err := strconv.Unquote(value); err != nil {
 				return err
-			} else if err := t.SetStringForKey(key_value[0], value_); err != nil {
+			} else if err := t.AddStringForKey(key_value[0], value_); err != nil {
 				return err
 			}
 		} else {
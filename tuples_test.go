@@ -1,6 +1,8 @@
 package rpc_test
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
 
 	// Frameworks
@@ -105,3 +107,88 @@ func Test_Tuples_004(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func Test_Tuples_005(t *testing.T) {
+	var tuples rpc.Tuples
+	tuples.AddStringForKey("tag", "a")
+	tuples.AddStringForKey("tag", "b c")
+	tuples.SetStringForKey("ssl", "")
+	if tuples.Len() != 2 {
+		t.Fatal("Len != 2")
+	} else if values := tuples.StringsForKey("tag"); len(values) != 2 || values[1] != "b c" {
+		t.Errorf("Unexpected values %v", values)
+	} else if tuples.StringForKey("tag") != "a" {
+		t.Error("Expected first value")
+	}
+	if flags := strings.Join(tuples.Flags(), " "); flags != `-tag=a -tag="b c" -ssl` {
+		t.Errorf("Unexpected flags %v", flags)
+	}
+
+	// Flag styles do not quote values
+	styles := map[rpc.GafferFlagStyle]string{
+		rpc.GAFFER_FLAG_STYLE_SINGLE_DASH: "-tag=a|-tag=b c|-ssl",
+		rpc.GAFFER_FLAG_STYLE_DOUBLE_DASH: "--tag=a|--tag=b c|--ssl",
+		rpc.GAFFER_FLAG_STYLE_SEPARATE:    "--tag|a|--tag|b c|--ssl",
+	}
+	for style, expected := range styles {
+		if args := strings.Join(tuples.Args(style), "|"); args != expected {
+			t.Errorf("%v: Expected %v, got %v", style, expected, args)
+		}
+	}
+
+	// Round trip through JSON
+	var tuples_copy rpc.Tuples
+	if data, err := json.Marshal(tuples); err != nil {
+		t.Error(err)
+	} else if err := json.Unmarshal(data, &tuples_copy); err != nil {
+		t.Error(err)
+	} else if tuples.Equals(tuples_copy) == false {
+		t.Errorf("Expected %v, got %v", tuples, tuples_copy)
+	}
+
+	// Setting a value replaces all values
+	tuples.SetStringForKey("tag", "d")
+	if values := tuples.StringsForKey("tag"); len(values) != 1 || values[0] != "d" {
+		t.Errorf("Unexpected values %v", values)
+	}
+}
+
+func Test_Tuples_006(t *testing.T) {
+	var tuples rpc.Tuples
+	tuples.SetStringForKey("a", "1")
+	tuples.SetStringForKey("b", "2")
+	if patched, err := tuples.Patch([]rpc.GafferTuplesPatch{
+		rpc.GafferTuplesPatch{Op: rpc.GAFFER_TUPLES_UNSET, Key: "a"},
+		rpc.GafferTuplesPatch{Op: rpc.GAFFER_TUPLES_UNSET, Key: "c"},
+		rpc.GafferTuplesPatch{Op: rpc.GAFFER_TUPLES_ADD, Key: "b", Value: "3"},
+		rpc.GafferTuplesPatch{Op: rpc.GAFFER_TUPLES_SET, Key: "d", Value: "4"},
+	}); err != nil {
+		t.Error(err)
+	} else if keys := strings.Join(patched.Keys(), ","); keys != "b,d" {
+		t.Errorf("Unexpected keys %v", keys)
+	} else if values := patched.StringsForKey("b"); len(values) != 2 || values[1] != "3" {
+		t.Errorf("Unexpected values %v", values)
+	} else if tuples.Len() != 2 || tuples.StringForKey("a") != "1" {
+		t.Error("Expected original tuples to be unchanged")
+	}
+
+	// Clear removes all keys, unknown operations are an error
+	if patched, err := tuples.Patch([]rpc.GafferTuplesPatch{
+		rpc.GafferTuplesPatch{Op: rpc.GAFFER_TUPLES_CLEAR},
+	}); err != nil {
+		t.Error(err)
+	} else if patched.Len() != 0 {
+		t.Errorf("Expected no tuples, got %v", patched)
+	} else if _, err := tuples.Patch([]rpc.GafferTuplesPatch{
+		rpc.GafferTuplesPatch{Op: rpc.GafferTuplesOp(99)},
+	}); err == nil {
+		t.Error("Expected error for unknown operation")
+	}
+
+	// RemoveForKey returns false when the key does not exist
+	if tuples.RemoveForKey("a") == false {
+		t.Error("Expected key to be removed")
+	} else if tuples.RemoveForKey("a") {
+		t.Error("Expected key to not exist")
+	}
+}